@@ -0,0 +1,193 @@
+// Package attestation verifies ownership attestations offline. attestOwnership of the reference chaincode answers
+// with an Attestation: who owns a product, since which transaction and block, and nothing of the owners before.
+// The peer signs its proposal response as an endorsement, so the response serialized by the client SDK is proof
+// the owner can hand to a customer or an insurer. Verify checks it against the signing certificates of trusted
+// peers without connecting to the network.
+package attestation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ChaincodeName is the chaincode that issues attestations
+const ChaincodeName = "reference"
+
+var (
+	// ErrUntrustedEndorser is returned by Verify when the response is endorsed by none of the trusted peers
+	ErrUntrustedEndorser = errors.New("endorser certificate is not trusted")
+	// ErrInvalidSignature is returned by Verify when the signature doesn't match the response
+	ErrInvalidSignature = errors.New("endorsement signature is invalid")
+)
+
+// Attestation states that Owner owns the product since the transaction TxId at Timestamp, in seconds, in the block
+// Block of the channel. Issued is the time of the proposal that produced the attestation, and Nonce is the
+// challenge the verifying party gave the owner, so an old attestation can't be passed off as a fresh one.
+type Attestation struct {
+	Product   string          `json:"product"`
+	Owner     string          `json:"owner"`
+	TxId      string          `json:"txId"`
+	Timestamp int64           `json:"timestamp"`
+	Block     *BlockReference `json:"block,omitempty"`
+	Channel   string          `json:"channel"`
+	Nonce     string          `json:"nonce"`
+	Issued    int64           `json:"issued"`
+}
+
+// BlockReference is the number of a block and the hex SHA-256 hash of its header
+type BlockReference struct {
+	Number uint64 `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// ecdsaSignature is the ASN.1 form of the signatures of Fabric identities
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Verify checks that the serialized proposal response is endorsed by one of the peers, given by their signing
+// certificates, and that it carries a successful answer of the reference chaincode. It returns the attestation.
+func Verify(response []byte, peers []*x509.Certificate) (Attestation, error) {
+	var proposalResponse pb.ProposalResponse
+	if err := proto.Unmarshal(response, &proposalResponse); err != nil {
+		return Attestation{}, errors.New(fmt.Sprintf("cannot read proposal response: %s", err.Error()))
+	}
+
+	endorsement := proposalResponse.GetEndorsement()
+	if endorsement == nil {
+		return Attestation{}, errors.New("proposal response is not endorsed")
+	}
+
+	certificate, err := endorserCertificate(endorsement.GetEndorser())
+	if err != nil {
+		return Attestation{}, err
+	}
+	if !isTrusted(certificate, peers) {
+		return Attestation{}, ErrUntrustedEndorser
+	}
+
+	// the peer signs the payload followed by its serialized identity
+	signed := append(append([]byte{}, proposalResponse.GetPayload()...), endorsement.GetEndorser()...)
+	if err := verifySignature(certificate, signed, endorsement.GetSignature()); err != nil {
+		return Attestation{}, err
+	}
+
+	return readAttestation(proposalResponse.GetPayload())
+}
+
+func endorserCertificate(endorser []byte) (*x509.Certificate, error) {
+	var identity msp.SerializedIdentity
+	if err := proto.Unmarshal(endorser, &identity); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot read endorser identity: %s", err.Error()))
+	}
+
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return nil, errors.New("endorser identity has no PEM certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func isTrusted(certificate *x509.Certificate, peers []*x509.Certificate) bool {
+	for _, peer := range peers {
+		if bytes.Equal(certificate.Raw, peer.Raw) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifySignature checks an ECDSA signature over SHA-256 of the message. Like the peers, it accepts only
+// signatures with the low S value, since the other one is a second valid signature of the same message.
+func verifySignature(certificate *x509.Certificate, message, signature []byte) error {
+	key, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("endorser certificate has no ECDSA key")
+	}
+
+	var sig ecdsaSignature
+	if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) > 0 || sig.R == nil || sig.S == nil {
+		return ErrInvalidSignature
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(key.Curve.Params().N, 1)) > 0 {
+		return ErrInvalidSignature
+	}
+
+	digest := sha256.Sum256(message)
+	if !ecdsa.Verify(key, digest[:], sig.R, sig.S) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// readAttestation unwraps the chaincode response from the proposal response payload
+func readAttestation(payload []byte) (Attestation, error) {
+	var responsePayload pb.ProposalResponsePayload
+	if err := proto.Unmarshal(payload, &responsePayload); err != nil {
+		return Attestation{}, errors.New(fmt.Sprintf("cannot read proposal response payload: %s", err.Error()))
+	}
+
+	var action pb.ChaincodeAction
+	if err := proto.Unmarshal(responsePayload.GetExtension(), &action); err != nil {
+		return Attestation{}, errors.New(fmt.Sprintf("cannot read chaincode action: %s", err.Error()))
+	}
+
+	if name := action.GetChaincodeId().GetName(); name != ChaincodeName {
+		return Attestation{}, errors.New(fmt.Sprintf("response is of chaincode %q, not %s", name, ChaincodeName))
+	}
+	if status := action.GetResponse().GetStatus(); status != 200 {
+		return Attestation{}, errors.New(fmt.Sprintf("chaincode answered with status %d: %s", status,
+			action.GetResponse().GetMessage()))
+	}
+
+	var attestation Attestation
+	if err := json.Unmarshal(action.GetResponse().GetPayload(), &attestation); err != nil {
+		return Attestation{}, errors.New(fmt.Sprintf("cannot read attestation: %s", err.Error()))
+	}
+	if len(attestation.Product) == 0 || len(attestation.Owner) == 0 || len(attestation.TxId) == 0 {
+		return Attestation{}, errors.New("response is not an ownership attestation")
+	}
+
+	return attestation, nil
+}
+
+// ParseCertificates reads every certificate of a PEM file
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certificates := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+
+	return certificates, nil
+}
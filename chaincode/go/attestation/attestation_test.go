@@ -0,0 +1,148 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"testutil"
+)
+
+var statement = Attestation{Product: "p1", Owner: "b", TxId: "tx2", Timestamp: 1001,
+	Block: &BlockReference{Number: 7, Hash: "ab"}, Channel: "common", Nonce: "challenge", Issued: 1005}
+
+// response is the proposal response the peer sends for an invocation of the chaincode
+type response struct {
+	chaincode string
+	status    int32
+	payload   []byte
+	// tamper changes the payload after it's signed
+	tamper bool
+	// highS signs with the other S value of the signature
+	highS bool
+}
+
+func (r response) endorse(t *testing.T, peer *testutil.Identity) []byte {
+	action, err := proto.Marshal(&pb.ChaincodeAction{ChaincodeId: &pb.ChaincodeID{Name: r.chaincode},
+		Response: &pb.Response{Status: r.status, Payload: r.payload}})
+	if err != nil {
+		t.Fatalf("cannot marshal chaincode action: %s", err.Error())
+	}
+	payload, err := proto.Marshal(&pb.ProposalResponsePayload{ProposalHash: []byte("proposal"), Extension: action})
+	if err != nil {
+		t.Fatalf("cannot marshal payload: %s", err.Error())
+	}
+	endorser, err := peer.Serialize()
+	if err != nil {
+		t.Fatalf("cannot serialize peer identity: %s", err.Error())
+	}
+
+	digest := sha256.Sum256(append(append([]byte{}, payload...), endorser...))
+	R, S, err := ecdsa.Sign(rand.Reader, peer.PrivateKey, digest[:])
+	if err != nil {
+		t.Fatalf("cannot sign: %s", err.Error())
+	}
+	halfOrder := new(big.Int).Rsh(peer.PrivateKey.Curve.Params().N, 1)
+	if (S.Cmp(halfOrder) > 0) != r.highS {
+		S.Sub(peer.PrivateKey.Curve.Params().N, S)
+	}
+	signature, err := asn1.Marshal(ecdsaSignature{R, S})
+	if err != nil {
+		t.Fatalf("cannot marshal signature: %s", err.Error())
+	}
+
+	if r.tamper {
+		payload = append(payload, ' ')
+	}
+
+	data, err := proto.Marshal(&pb.ProposalResponse{Payload: payload,
+		Endorsement: &pb.Endorsement{Endorser: endorser, Signature: signature}})
+	if err != nil {
+		t.Fatalf("cannot marshal proposal response: %s", err.Error())
+	}
+
+	return data
+}
+
+func TestVerify(t *testing.T) {
+	ca, err := testutil.NewCA("b")
+	if err != nil {
+		t.Fatalf("cannot generate CA: %s", err.Error())
+	}
+	peer, err := ca.Issue("peer0")
+	if err != nil {
+		t.Fatalf("cannot issue peer certificate: %s", err.Error())
+	}
+	other, err := ca.Issue("peer1")
+	if err != nil {
+		t.Fatalf("cannot issue peer certificate: %s", err.Error())
+	}
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatalf("cannot marshal attestation: %s", err.Error())
+	}
+
+	if attestation, err := Verify(response{chaincode: ChaincodeName, status: 200, payload: payload}.endorse(t, peer),
+		[]*x509.Certificate{other.Certificate, peer.Certificate}); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	} else if *attestation.Block != *statement.Block || attestation.Nonce != statement.Nonce {
+		t.Errorf("expected %+v, got %+v", statement, attestation)
+	}
+
+	for _, test := range []struct {
+		name     string
+		response response
+		trusted  *testutil.Identity
+		expected error
+	}{
+		{"untrusted", response{chaincode: ChaincodeName, status: 200, payload: payload}, other, ErrUntrustedEndorser},
+		{"tampered", response{chaincode: ChaincodeName, status: 200, payload: payload, tamper: true}, peer,
+			ErrInvalidSignature},
+		{"high S", response{chaincode: ChaincodeName, status: 200, payload: payload, highS: true}, peer,
+			ErrInvalidSignature},
+		{"other chaincode", response{chaincode: "relationship", status: 200, payload: payload}, peer, nil},
+		{"error", response{chaincode: ChaincodeName, status: 403, payload: nil}, peer, nil},
+		{"not an attestation", response{chaincode: ChaincodeName, status: 200, payload: []byte(`{"name":"p1"}`)},
+			peer, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Verify(test.response.endorse(t, peer), []*x509.Certificate{test.trusted.Certificate})
+			if err == nil || (test.expected != nil && err != test.expected) {
+				t.Errorf("expected error %v, got %v", test.expected, err)
+			}
+		})
+	}
+
+	if _, err := Verify([]byte("garbage"), []*x509.Certificate{peer.Certificate}); err == nil {
+		t.Error("expected an error for a response that cannot be read")
+	}
+}
+
+func TestParseCertificates(t *testing.T) {
+	a, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate identity: %s", err.Error())
+	}
+	b, err := testutil.NewIdentity("b")
+	if err != nil {
+		t.Fatalf("cannot generate identity: %s", err.Error())
+	}
+
+	certificates, err := ParseCertificates(append(a.PEM(), b.PEM()...))
+	if err != nil || len(certificates) != 2 {
+		t.Errorf("expected 2 certificates, got %d (%v)", len(certificates), err)
+	}
+
+	if _, err := ParseCertificates([]byte("no certificates")); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+}
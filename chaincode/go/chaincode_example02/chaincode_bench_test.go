@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"testutil"
+)
+
+// seededTokenStub returns a stub with n accounts spread over organizations a, b and c
+func seededTokenStub(b *testing.B, n int) *testutil.MockStub {
+	stub := testutil.NewMockStub("token", new(SimpleChaincode))
+	orgs := []string{"aMSP", "bMSP", "cMSP"}
+
+	keys := make([]string, 0, n)
+	values := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		account := Account{Key: AccountKey{Org: orgs[i%len(orgs)], Name: fmt.Sprintf("User%08d", i)}}
+		key, err := account.ToCompositeKey(stub)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		value, err := json.Marshal(AccountValue{ObjectType: accountObjectType,
+			Balances: map[string]int64{"USD": int64(i)}})
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		keys, values = append(keys, key), append(values, value)
+	}
+	stub.SeedState(keys, values)
+
+	return stub
+}
+
+// BenchmarkQueryAccounts lists the accounts of one organization, a third of the ledger
+func BenchmarkQueryAccounts(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := seededTokenStub(b, n)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if response := stub.MockInvoke("bench", testutil.Args("query", "aMSP")); response.Status >= 400 {
+					b.Fatalf("query failed: %s", response.Message)
+				}
+			}
+			b.ReportMetric(float64(n), "records")
+		})
+	}
+}
+
+// BenchmarkQueryHistory reads a page of EUR movements from the middle of the history of an account that made n
+// movements, half of them in USD
+func BenchmarkQueryHistory(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := testutil.NewMockStub("token", new(SimpleChaincode))
+			from := AccountKey{Org: "aMSP", Name: "User1@a.example.com"}
+			assets := []string{"USD", "EUR"}
+
+			keys := make([]string, 0, 2*n)
+			values := make([][]byte, 0, 2*n)
+			for i := 0; i < n; i++ {
+				receipt := Receipt{TxId: fmt.Sprintf("tx%08d", i), Kind: receiptTransfer, From: &from,
+					To: &AccountKey{Org: "bMSP", Name: "User1@b.example.com"}, Asset: assets[i%len(assets)],
+					Amount: int64(i + 1), Timestamp: int64(i)}
+
+				key, err := stub.CreateCompositeKey(receiptIndex, []string{receipt.TxId})
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				value, err := json.Marshal(receipt)
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				indexKey, err := stub.CreateCompositeKey(accountReceiptIndex,
+					[]string{from.Org, from.Name, fmt.Sprintf("%020d.%09d", i, 0), receipt.TxId})
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				keys, values = append(keys, key, indexKey), append(values, value, []byte{0x00})
+			}
+			stub.SeedState(keys, values)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				response := stub.MockInvoke("bench", testutil.Args("queryHistory", from.Org, from.Name, "EUR", "100",
+					strconv.Itoa(n/4)))
+				if response.Status >= 400 {
+					b.Fatalf("queryHistory failed: %s", response.Message)
+				}
+			}
+			b.ReportMetric(float64(n), "records")
+		})
+	}
+}
+
+// BenchmarkQueryHolds lists the holds of a payer with n holds, one in ten of them still active
+func BenchmarkQueryHolds(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := testutil.NewMockStub("token", new(SimpleChaincode))
+			from := AccountKey{Org: "aMSP", Name: "User1@a.example.com"}
+			to := AccountKey{Org: "bMSP", Name: "User1@b.example.com"}
+
+			keys := make([]string, 0, 3*n)
+			values := make([][]byte, 0, 3*n)
+			for i := 0; i < n; i++ {
+				hold := Hold{Id: fmt.Sprintf("tx%08d", i), From: from, To: to, Asset: "USD", Amount: int64(i + 1),
+					Expiry: 1 << 40, Status: holdExecuted, Created: int64(i)}
+				if i%10 == 0 {
+					hold.Status = holdActive
+				}
+
+				key, err := hold.ToCompositeKey(stub)
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				value, err := json.Marshal(hold)
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				keys, values = append(keys, key), append(values, value)
+
+				for _, account := range []AccountKey{from, to} {
+					indexKey, err := stub.CreateCompositeKey(accountHoldIndex, []string{account.Org, account.Name, hold.Id})
+					if err != nil {
+						b.Fatal(err.Error())
+					}
+					keys, values = append(keys, indexKey), append(values, []byte{0x00})
+				}
+			}
+			stub.SeedState(keys, values)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				response := stub.MockInvoke("bench", testutil.Args("queryHolds", from.Org, from.Name, holdActive))
+				if response.Status >= 400 {
+					b.Fatalf("queryHolds failed: %s", response.Message)
+				}
+			}
+			b.ReportMetric(float64(n), "records")
+		})
+	}
+}
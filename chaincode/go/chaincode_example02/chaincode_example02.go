@@ -1,196 +1,886 @@
-
 package main
 
 import (
-	"strconv"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
 	pb "github.com/hyperledger/fabric/protos/peer"
-	"encoding/pem"
-	"crypto/x509"
-	"strings"
 )
 
 var logger = shim.NewLogger("SimpleChaincode")
 
-// SimpleChaincode example simple Chaincode implementation
+// SimpleChaincode is a settlement token of the consortium. The issuer organization mints and burns assets, users hold
+// them in accounts named after their MSP and certificate and only the owner of an account can transfer from it. Every
+// movement leaves a receipt.
 type SimpleChaincode struct {
 }
 
+// Init sets the issuer organization and its MSP, "<issuer>MSP" unless given, the way network.sh names MSPs. On
+// upgrade they may be omitted to keep the current ones.
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	logger.Debug("Init")
 
 	_, args := stub.GetFunctionAndParameters()
-	var a, b string    // Entities
-	var aVal, bVal int // Asset holdings
-	var err error
-
-	if len(args) != 4 {
-		return pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting 4"}
+	//   0          1
+	// issuer, [issuerMsp]
+	if len(args) > 2 {
+		return pb.Response{Status:400, Message:"Incorrect number of arguments. Expecting issuer organization " +
+			"and optional MSP"}
 	}
 
-	// Initialize the chaincode
-	a = args[0]
-	aVal, err = strconv.Atoi(args[1])
-	if err != nil {
-		return pb.Response{Status:403, Message:"Expecting integer value for asset holding"}
+	token, err := loadToken(stub)
+	initialized := err == nil
+	if !initialized {
+		token = Token{Supply: map[string]int64{}}
 	}
-	b = args[2]
-	bVal, err = strconv.Atoi(args[3])
-	if err != nil {
-		return pb.Response{Status:403, Message:"Expecting integer value for asset holding"}
+
+	if len(args) == 0 {
+		if !initialized {
+			return pb.Response{Status:400, Message:"Incorrect number of arguments. Expecting issuer organization"}
+		}
+		if len(token.IssuerMSP) > 0 {
+			return shim.Success(nil)
+		}
+		// a token of an earlier version has no MSP of the issuer yet
+		args = []string{token.Issuer}
 	}
-	logger.Debugf("aVal, bVal = %d", aVal, bVal)
 
-	// Write the state to the ledger
-	err = stub.PutState(a, []byte(strconv.Itoa(aVal)))
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args[0]) == 0 || !isValidKeyPart(args[0]) {
+		return pb.Response{Status:400, Message:"Issuer organization must be a non-empty string"}
+	}
+	token.Issuer = args[0]
+
+	token.IssuerMSP = token.Issuer + "MSP"
+	if len(args) > 1 {
+		if len(args[1]) == 0 || !isValidKeyPart(args[1]) {
+			return pb.Response{Status:400, Message:"Issuer MSP must be a non-empty string"}
+		}
+		token.IssuerMSP = args[1]
 	}
 
-	err = stub.PutState(b, []byte(strconv.Itoa(bVal)))
-	if err != nil {
+	if err := saveToken(stub, token); err != nil {
 		return shim.Error(err.Error())
 	}
 
+	logger.Info("token issuer is " + token.Issuer + " of MSP " + token.IssuerMSP)
 	return shim.Success(nil)
 }
 
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	logger.Debug("Invoke")
 
-	creatorBytes, err := stub.GetCreator()
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	name, org := getCreator(creatorBytes)
-
-	logger.Debug("transaction creator " + name + "@" + org)
-
 	function, args := stub.GetFunctionAndParameters()
-	if function == "move" {
-		// Make payment of x units from a to b
+	if function == "mint" {
+		// Issue new tokens to an account
+		return t.mint(stub, args)
+	} else if function == "burn" {
+		// Withdraw tokens of an account from circulation
+		return t.burn(stub, args)
+	} else if function == "move" || function == "transfer" {
+		// Make payment from the account of the creator to another one
 		return t.move(stub, args)
 	} else if function == "delete" {
-		// Deletes an entity from its state
+		// Close the empty account of the creator
 		return t.delete(stub, args)
 	} else if function == "query" {
 		// the old "Query" is now implemented in invoke
 		return t.query(stub, args)
+	} else if function == "queryAccount" {
+		return t.queryAccount(stub, args)
+	} else if function == "queryReceipts" {
+		return t.queryReceipts(stub, args)
+	} else if function == "queryHistory" {
+		// Page through the movements of an account
+		return t.queryHistory(stub, args)
+	} else if function == "placeHold" {
+		// Reserve funds of the creator for a beneficiary
+		return t.placeHold(stub, args)
+	} else if function == "executeHold" {
+		return t.executeHold(stub, args)
+	} else if function == "releaseHold" {
+		return t.releaseHold(stub, args)
+	} else if function == "expireHolds" {
+		return t.expireHolds(stub, args)
+	} else if function == "queryHolds" {
+		return t.queryHolds(stub, args)
+	} else if function == "token" {
+		return t.token(stub, args)
+	}
+
+	return pb.Response{Status:403, Message:"Invalid invoke function name. " +
+		"Expecting one of {mint, burn, move, transfer, delete, query, queryAccount, queryReceipts, queryHistory, " +
+		"placeHold, executeHold, releaseHold, expireHolds, queryHolds, token}"}
+}
+
+// mint credits an account with new units of an asset. Only the issuer organization may call it.
+func (t *SimpleChaincode) mint(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0     1      2       3        4
+	// org, name, asset, amount, [memo]
+	movement, response := t.readMovement(args)
+	if response != nil {
+		return *response
 	}
+	account := movement.Account
 
-	return pb.Response{Status:403, Message:"Invalid invoke function name."}
+	token, response := t.requireIssuer(stub)
+	if response != nil {
+		return *response
+	}
+
+	supply, err := addAmounts(token.Supply[movement.Asset], movement.Amount)
+	if err != nil {
+		return pb.Response{Status:403, Message:fmt.Sprintf("cannot mint %d %s: supply would overflow",
+			movement.Amount, movement.Asset)}
+	}
+	token.Supply[movement.Asset] = supply
+
+	if err := account.LoadFrom(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := account.credit(movement.Asset, movement.Amount); err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+
+	if err := account.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := saveToken(stub, token); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := t.saveReceipt(stub, receiptMint, nil, &account.Key, movement); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Infof("minted %d %s to %s of %s", movement.Amount, movement.Asset, account.Key.Name, account.Key.Org)
+	return shim.Success(nil)
 }
 
-// Transaction makes payment of x units from a to b
+// burn debits an account and reduces the supply of the asset, e.g. when its owner redeems it with the issuer.
+// Only the issuer organization may call it.
+func (t *SimpleChaincode) burn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0     1      2       3        4
+	// org, name, asset, amount, [memo]
+	movement, response := t.readMovement(args)
+	if response != nil {
+		return *response
+	}
+	account := movement.Account
+
+	token, response := t.requireIssuer(stub)
+	if response != nil {
+		return *response
+	}
+
+	if err := loadAccount(stub, &account, true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := account.debit(movement.Asset, movement.Amount); err != nil {
+		return insufficientFunds(account, movement)
+	}
+	token.Supply[movement.Asset] -= movement.Amount
+	if token.Supply[movement.Asset] == 0 {
+		delete(token.Supply, movement.Asset)
+	}
+
+	if err := account.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := saveToken(stub, token); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := t.saveReceipt(stub, receiptBurn, &account.Key, nil, movement); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Infof("burned %d %s of %s of %s", movement.Amount, movement.Asset, account.Key.Name, account.Key.Org)
+	return shim.Success(nil)
+}
+
+// move makes payment from the account of the transaction creator to the account of another user. transfer is an
+// alias of it.
 func (t *SimpleChaincode) move(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var a, b string    // Entities
-	var aVal, bVal int // Asset holdings
-	var x int          // Transaction value
-	var err error
+	//  0     1      2       3        4
+	// org, name, asset, amount, [memo]
+	movement, response := t.readMovement(args)
+	if response != nil {
+		return *response
+	}
+	receiver := movement.Account
 
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	sender, err := creatorAccount(stub)
+	if err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+	if sender.Key == receiver.Key {
+		return pb.Response{Status:400, Message:"Cannot transfer to the same account"}
 	}
 
-	a = args[0]
-	b = args[1]
+	if err := loadAccount(stub, &sender, true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := receiver.LoadFrom(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := sender.debit(movement.Asset, movement.Amount); err != nil {
+		return insufficientFunds(sender, movement)
+	}
+	if err := receiver.credit(movement.Asset, movement.Amount); err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+
+	if err := sender.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := receiver.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := t.saveReceipt(stub, receiptTransfer, &sender.Key, &receiver.Key, movement); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Debugf("%s of %s paid %d %s to %s of %s", sender.Key.Name, sender.Key.Org, movement.Amount,
+		movement.Asset, receiver.Key.Name, receiver.Key.Org)
+	return shim.Success(nil)
+}
 
-	// Get the state from the ledger
-	aBytes, err := stub.GetState(a)
+// delete closes the account of the transaction creator. It must hold nothing, so no funds are lost.
+func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return pb.Response{Status:403, Message:"Incorrect number of arguments"}
+	}
+
+	account, err := creatorAccount(stub)
+	if err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+
+	exists, err := account.ExistsIn(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	if aBytes == nil {
+	if !exists {
 		return pb.Response{Status:404, Message:"Entity not found"}
 	}
-	aVal, _ = strconv.Atoi(string(aBytes))
 
-	bBytes, err := stub.GetState(b)
+	if err := loadAccount(stub, &account, true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(account.Value.Balances) != 0 || len(account.Value.Held) != 0 {
+		return pb.Response{Status:403, Message:fmt.Sprintf("Cannot delete account with balances %v and held %v",
+			account.Value.Balances, account.Value.Held)}
+	}
+
+	compositeKey, err := account.ToCompositeKey(stub)
 	if err != nil {
-		return shim.Error("Failed to get state")
+		return shim.Error(err.Error())
 	}
-	if bBytes == nil {
-		return pb.Response{Status:404, Message:"Entity not found"}
+
+	// Delete the key from the state in ledger
+	if err := stub.DelState(compositeKey); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// placeHold reserves part of the available balance of the transaction creator for the beneficiary until expiry.
+// It returns the hold, its id is needed to execute or release it.
+func (t *SimpleChaincode) placeHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0     1      2       3       4        5
+	// org, name, asset, amount, expiry, [memo]
+	if len(args) < 5 || len(args) > 6 {
+		return pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting 5 or 6"}
+	}
+
+	m, response := t.readMovement(args[:4])
+	if response != nil {
+		return *response
+	}
+	if len(args) > 5 {
+		m.Memo = args[5]
 	}
-	bVal, _ = strconv.Atoi(string(bBytes))
 
-	// Perform the execution
-	x, err = strconv.Atoi(args[2])
+	now, err := getTxTimestamp(stub)
 	if err != nil {
-		return pb.Response{Status:403, Message:"Invalid transaction amount, expecting an integer value"}
+		return shim.Error(err.Error())
+	}
+	expiry, err := parseExpiry(args[4], now)
+	if err != nil {
+		return pb.Response{Status:400, Message:err.Error()}
+	}
+
+	payer, err := creatorAccount(stub)
+	if err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+	if payer.Key == m.Account.Key {
+		return pb.Response{Status:400, Message:"Cannot place a hold for the same account"}
+	}
+
+	if err := loadAccount(stub, &payer, true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := payer.reserve(m.Asset, m.Amount); err != nil {
+		return insufficientFunds(payer, m)
+	}
+
+	hold := Hold{Id: stub.GetTxID(), From: payer.Key, To: m.Account.Key, Asset: m.Asset, Amount: m.Amount,
+		Memo: m.Memo, Expiry: expiry, Status: holdActive, Created: now}
+	if err := hold.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := payer.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(hold)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	aVal = aVal - x
-	bVal = bVal + x
-	logger.Debug("aVal = %d, bVal = %d\n", aVal, bVal)
 
-	// Write the state back to the ledger
-	err = stub.PutState(a, []byte(strconv.Itoa(aVal)))
+	return shim.Success(result)
+}
+
+// executeHold pays the amount of an active hold to its beneficiary. Only the payer may execute it, and only
+// until it expires.
+func (t *SimpleChaincode) executeHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// holdId
+	hold, payer, response := t.readActiveHold(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	creator, err := creatorAccount(stub)
 	if err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+	if creator.Key != hold.From {
+		return pb.Response{Status:403, Message:fmt.Sprintf("no privileges to execute hold %s: it can be executed "+
+			"by %s of %s only", hold.Id, hold.From.Name, hold.From.Org)}
+	}
+
+	receiver := Account{Key: hold.To}
+	if err := receiver.LoadFrom(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := payer.spendHeld(hold.Asset, hold.Amount); err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := receiver.credit(hold.Asset, hold.Amount); err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
 
-	err = stub.PutState(b, []byte(strconv.Itoa(bVal)))
+	return t.closeHold(stub, hold, payer, &receiver, holdExecuted)
+}
+
+// releaseHold returns the amount of an active hold to the available balance of the payer. Only the beneficiary may
+// release it before it expires, the payer has to wait for the expiry.
+func (t *SimpleChaincode) releaseHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// holdId
+	hold, payer, response := t.readActiveHold(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	creator, err := creatorAccount(stub)
 	if err != nil {
+		return pb.Response{Status:403, Message:err.Error()}
+	}
+	if creator.Key != hold.To {
+		return pb.Response{Status:403, Message:fmt.Sprintf("no privileges to release hold %s: it can be released "+
+			"by %s of %s only", hold.Id, hold.To.Name, hold.To.Org)}
+	}
+
+	if err := payer.release(hold.Asset, hold.Amount); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return t.closeHold(stub, hold, payer, nil, holdReleased)
+}
+
+// expireHolds closes the expired holds of an account. They stop counting as held as soon as they expire, this only
+// records it in the ledger, which the account's own transactions also do.
+func (t *SimpleChaincode) expireHolds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0     1
+	// org, name
+	if len(args) != 2 {
+		return pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting org and name"}
+	}
+
+	account := Account{}
+	if err := account.FillFromKeyParts(args[0], args[1]); err != nil {
+		return pb.Response{Status:400, Message:err.Error()}
+	}
+
+	if err := loadAccount(stub, &account, true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := account.UpdateOrInsertIn(stub); err != nil {
 		return shim.Error(err.Error())
 	}
 
 	return shim.Success(nil)
 }
 
-// deletes an entity from state
-func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+// queryHolds lists the holds an account is the payer or the beneficiary of, optionally with one status only
+func (t *SimpleChaincode) queryHolds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0     1       2
+	// org, name, [status]
+	if len(args) < 2 || len(args) > 3 {
+		return pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting org, name and optional status"}
+	}
+
+	account := Account{}
+	if err := account.FillFromKeyParts(args[0], args[1]); err != nil {
+		return pb.Response{Status:400, Message:err.Error()}
+	}
+
+	status := ""
+	if len(args) > 2 {
+		status = args[2]
+	}
+	if status != "" && status != holdActive && status != holdExecuted && status != holdReleased &&
+		status != holdExpired {
+		return pb.Response{Status:400, Message:fmt.Sprintf("Hold status is invalid: %s (must be one of %s, %s, "+
+			"%s, %s)", status, holdActive, holdExecuted, holdReleased, holdExpired)}
+	}
+
+	now, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	holds, err := loadHolds(stub, accountHoldIndex, account.Key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result := []Hold{}
+	for _, hold := range holds {
+		// holds are reported expired as soon as they expire, whether it's recorded or not
+		if hold.isExpired(now) {
+			hold.Status = holdExpired
+		}
+		if status == "" || hold.Status == status {
+			result = append(result, hold)
+		}
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(payload)
+}
+
+// readActiveHold reads the hold from the arguments and its payer. A hold that has expired is rejected as Expired even
+// if that isn't recorded yet: the peer doesn't commit transactions that fail, so closing it here would be lost.
+func (t *SimpleChaincode) readActiveHold(stub shim.ChaincodeStubInterface, args []string) (Hold, *Account,
+	*pb.Response) {
 	if len(args) != 1 {
-		return pb.Response{Status:403, Message:"Incorrect number of arguments"}
+		return Hold{}, nil, &pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting hold id"}
+	}
+	if len(args[0]) == 0 || !isValidKeyPart(args[0]) {
+		return Hold{}, nil, &pb.Response{Status:400, Message:fmt.Sprintf("Hold id is invalid: %q", args[0])}
 	}
 
-	a := args[0]
+	hold := Hold{Id: args[0]}
+	found, err := hold.LoadFrom(stub)
+	if err != nil {
+		response := shim.Error(err.Error())
+		return Hold{}, nil, &response
+	}
+	if !found {
+		return Hold{}, nil, &pb.Response{Status:404, Message:fmt.Sprintf("Hold %s not found", hold.Id)}
+	}
 
-	// Delete the key from the state in ledger
-	err := stub.DelState(a)
+	now, err := getTxTimestamp(stub)
 	if err != nil {
+		response := shim.Error(err.Error())
+		return Hold{}, nil, &response
+	}
+	if hold.isExpired(now) {
+		hold.Status = holdExpired
+	}
+	if hold.Status != holdActive {
+		return Hold{}, nil, &pb.Response{Status:409, Message:fmt.Sprintf("Hold %s is %s", hold.Id, hold.Status)}
+	}
+
+	payer := Account{Key: hold.From}
+	if err := payer.LoadFrom(stub); err != nil {
+		response := shim.Error(err.Error())
+		return Hold{}, nil, &response
+	}
+
+	return hold, &payer, nil
+}
+
+// closeHold records the new status of the hold and saves the accounts it moved funds between. An executed hold
+// also leaves a transfer receipt.
+func (t *SimpleChaincode) closeHold(stub shim.ChaincodeStubInterface, hold Hold, payer, receiver *Account,
+	status string) pb.Response {
+	hold.Status = status
+	hold.Closed = stub.GetTxID()
+
+	if err := hold.UpdateOrInsertIn(stub); err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := payer.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if receiver != nil {
+		if err := receiver.UpdateOrInsertIn(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+
+		receipt, err := newReceipt(stub, receiptTransfer, &payer.Key, &receiver.Key, hold.Asset, hold.Amount,
+			hold.Memo)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		receipt.HoldId = hold.Id
+		if err := receipt.Save(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
+	logger.Infof("hold %s is %s", hold.Id, status)
 	return shim.Success(nil)
 }
 
-// read value
+// query reads an account or, without a name, all accounts of the MSP
 func (t *SimpleChaincode) query(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var a string // Entities
-	var err error
+	//  0      1
+	// org, [name]
+	if len(args) < 1 || len(args) > 2 {
+		return pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting org and optional name"}
+	}
 
-	//if len(args) != 1 {
-	//	return pb.Response{Status:403, Message:"Incorrect number of arguments"}
-	//}
+	if len(args) == 1 {
+		return t.queryAccounts(stub, args[0])
+	}
 
-	a = args[0]
+	return t.queryAccount(stub, args)
+}
+
+// queryAccount reads the balances of an account
+func (t *SimpleChaincode) queryAccount(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0     1
+	// org, name
+	if len(args) != 2 {
+		return pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting org and name"}
+	}
+
+	account := Account{}
+	if err := account.FillFromKeyParts(args[0], args[1]); err != nil {
+		return pb.Response{Status:400, Message:err.Error()}
+	}
 
-	// Get the state from the ledger
-	valBytes, err := stub.GetState(a)
+	exists, err := account.ExistsIn(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	if valBytes == nil {
+	if !exists {
 		return pb.Response{Status:404, Message:"Entity not found"}
 	}
 
-	return shim.Success(valBytes)
+	if err := loadAccount(stub, &account, false); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
 }
 
-var getCreator = func (certificate []byte) (string, string) {
-	data := certificate[strings.Index(string(certificate), "-----"): strings.LastIndex(string(certificate), "-----")+5]
-	block, _ := pem.Decode([]byte(data))
-	cert, _ := x509.ParseCertificate(block.Bytes)
-	organization := cert.Issuer.Organization[0]
-	commonName := cert.Subject.CommonName
-	logger.Debug("commonName: " + commonName + ", organization: " + organization)
+func (t *SimpleChaincode) queryAccounts(stub shim.ChaincodeStubInterface, org string) pb.Response {
+	if len(org) == 0 || !isValidKeyPart(org) {
+		return pb.Response{Status:400, Message:"Organization must be a non-empty string"}
+	}
+
+	now, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(accountIndex, []string{org})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer it.Close()
+
+	accounts := []Account{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		account := Account{Key: AccountKey{Org: compositeKeyParts[0], Name: compositeKeyParts[1]}}
+		if err := account.FillFromLedgerValue(response.Value); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := expireHolds(stub, &account, now, false); err != nil {
+			return shim.Error(err.Error())
+		}
+		accounts = append(accounts, account)
+	}
+
+	result, err := json.Marshal(accounts)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// queryReceipts reads the receipts of the transactions. Transactions that moved nothing are left out.
+func (t *SimpleChaincode) queryReceipts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0      1
+	// txId, [txId...]
+	if len(args) < 1 || len(args) > maxPageSize {
+		return pb.Response{Status:403, Message:fmt.Sprintf(
+			"Incorrect number of arguments. Expecting from 1 to %d transaction ids", maxPageSize)}
+	}
 
-	organizationShort := strings.Split(organization, ".")[0]
+	receipts := []Receipt{}
+	for _, txId := range args {
+		if len(txId) == 0 || !isValidKeyPart(txId) {
+			return pb.Response{Status:400, Message:fmt.Sprintf("Transaction id is invalid: %q", txId)}
+		}
+
+		receipt, err := loadReceipt(stub, txId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if receipt != nil {
+			receipts = append(receipts, *receipt)
+		}
+	}
+
+	result, err := json.Marshal(receipts)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// queryHistory pages through the movements of an account, oldest first
+func (t *SimpleChaincode) queryHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	query, err := parseHistoryQuery(args)
+	if err != nil {
+		return pb.Response{Status:400, Message:err.Error()}
+	}
+
+	page, err := query.Execute(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// token reads the issuer organization and the supply of each asset
+func (t *SimpleChaincode) token(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	token, err := loadToken(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// movement is what mint, burn and transfer read from their arguments: the account to credit or debit
+type movement struct {
+	Account Account
+	Asset   string
+	Amount  int64
+	Memo    string
+}
+
+func (t *SimpleChaincode) readMovement(args []string) (movement, *pb.Response) {
+	if len(args) < 4 || len(args) > 5 {
+		return movement{}, &pb.Response{Status:403, Message:"Incorrect number of arguments. Expecting 4 or 5"}
+	}
+
+	m := movement{}
+	if err := m.Account.FillFromKeyParts(args[0], args[1]); err != nil {
+		return movement{}, &pb.Response{Status:400, Message:err.Error()}
+	}
+
+	asset, err := parseAsset(args[2])
+	if err != nil {
+		return movement{}, &pb.Response{Status:400, Message:err.Error()}
+	}
+	m.Asset = asset
+
+	amount, err := parseAmount(args[3])
+	if err != nil {
+		return movement{}, &pb.Response{Status:400, Message:err.Error()}
+	}
+	m.Amount = amount
+
+	if len(args) > 4 {
+		m.Memo = args[4]
+	}
+
+	return m, nil
+}
+
+func (t *SimpleChaincode) saveReceipt(stub shim.ChaincodeStubInterface, kind string, from, to *AccountKey,
+	m movement) error {
+	receipt, err := newReceipt(stub, kind, from, to, m.Asset, m.Amount, m.Memo)
+	if err != nil {
+		return err
+	}
+
+	return receipt.Save(stub)
+}
+
+// requireIssuer loads the token and checks the transaction creator belongs to the MSP of its issuer organization
+func (t *SimpleChaincode) requireIssuer(stub shim.ChaincodeStubInterface) (Token, *pb.Response) {
+	token, err := loadToken(stub)
+	if err != nil {
+		response := shim.Error(err.Error())
+		return token, &response
+	}
+
+	mspID, err := creatorMSP(stub)
+	if err != nil {
+		return token, &pb.Response{Status:403, Message:err.Error()}
+	}
+	if mspID != token.IssuerMSP {
+		return token, &pb.Response{Status:403, Message:fmt.Sprintf(
+			"no privileges to mint or burn tokens: MSP %s is not the MSP %s of the issuer %s", mspID,
+			token.IssuerMSP, token.Issuer)}
+	}
+
+	return token, nil
+}
+
+func insufficientFunds(account Account, m movement) pb.Response {
+	return pb.Response{Status:409, Message:fmt.Sprintf("%s: account %s of %s has %d %s, needs %d",
+		errInsufficientFunds.Error(), account.Key.Name, account.Key.Org, account.Value.Balances[m.Asset], m.Asset,
+		m.Amount)}
+}
+
+// loadAccount reads the account and returns the amounts of its expired holds to the available balance. With save
+// set the holds are closed in the ledger too, which is what transactions that write the account do.
+func loadAccount(stub shim.ChaincodeStubInterface, account *Account, save bool) error {
+	if err := account.LoadFrom(stub); err != nil {
+		return err
+	}
+
+	now, err := getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	return expireHolds(stub, account, now, save)
+}
+
+// getTxTimestamp returns the transaction time in seconds: unlike the local clock it is the same on every endorser.
+func getTxTimestamp(stub shim.ChaincodeStubInterface) (int64, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, err
+	}
+
+	return timestamp.Seconds, nil
+}
+
+// creatorAccount returns the key of the account owned by the transaction creator: the MSP of the creator, which the
+// peer has validated, and the common name of its certificate. The issuer organization of the certificate is not
+// used, since the CA of any member could put the name of another organization there.
+func creatorAccount(stub shim.ChaincodeStubInterface) (Account, error) {
+	identity, err := creatorIdentity(stub)
+	if err != nil {
+		return Account{}, err
+	}
+
+	name, err := getCommonName(identity.IdBytes)
+	if err != nil {
+		return Account{}, err
+	}
+	logger.Debug("transaction creator " + name + "@" + identity.Mspid)
+
+	account := Account{}
+	if err := account.FillFromKeyParts(identity.Mspid, name); err != nil {
+		return Account{}, errors.New(fmt.Sprintf("invalid creator identity: %s", err.Error()))
+	}
+
+	return account, nil
+}
+
+// creatorMSP returns the MSP of the transaction creator
+func creatorMSP(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := creatorIdentity(stub)
+	if err != nil {
+		return "", err
+	}
+
+	return identity.Mspid, nil
+}
+
+func creatorIdentity(stub shim.ChaincodeStubInterface) (msp.SerializedIdentity, error) {
+	creatorBytes, err := stub.GetCreator()
+	if err != nil {
+		return msp.SerializedIdentity{}, err
+	}
+
+	var identity msp.SerializedIdentity
+	if err := proto.Unmarshal(creatorBytes, &identity); err != nil {
+		return msp.SerializedIdentity{}, errors.New(fmt.Sprintf("invalid creator identity: %s", err.Error()))
+	}
+	if len(identity.Mspid) == 0 {
+		return msp.SerializedIdentity{}, errors.New("creator identity has no MSP")
+	}
+
+	return identity, nil
+}
+
+var getCommonName = func (certificate []byte) (string, error) {
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		return "", errors.New("creator certificate is not PEM-encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("commonName: " + cert.Subject.CommonName)
 
-	return commonName, organizationShort
+	return cert.Subject.CommonName, nil
 }
 
 func main() {
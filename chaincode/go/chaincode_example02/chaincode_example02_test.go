@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"testutil"
+)
+
+// tokenStub returns a stub of a token issued by a with the users of a and b it was issued to
+type tokenStub struct {
+	*testutil.MockStub
+	t      *testing.T
+	issuer *testutil.Identity
+	alice  *testutil.Identity
+	bob    *testutil.Identity
+	tx     int
+}
+
+func newTokenStub(t *testing.T) *tokenStub {
+	stub := &tokenStub{MockStub: testutil.NewMockStub("token", new(SimpleChaincode)), t: t}
+
+	identities := map[string]**testutil.Identity{"a/Admin": &stub.issuer, "a/User1": &stub.alice, "b/User1": &stub.bob}
+	cas := map[string]*testutil.CA{}
+	for _, org := range []string{"a", "b"} {
+		ca, err := testutil.NewCA(org)
+		if err != nil {
+			t.Fatalf("cannot generate CA of %s: %s", org, err.Error())
+		}
+		cas[org] = ca
+	}
+	for id, identity := range identities {
+		issued, err := cas[id[:1]].Issue(id[2:])
+		if err != nil {
+			t.Fatalf("cannot issue %s: %s", id, err.Error())
+		}
+		*identity = issued
+	}
+
+	if err := stub.SetCreator(stub.issuer); err != nil {
+		t.Fatalf("cannot set creator: %s", err.Error())
+	}
+	if response := stub.MockInit("init", testutil.Args("init", "a")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+
+	return stub
+}
+
+func (stub *tokenStub) invoke(id *testutil.Identity, args ...string) (int32, string, []byte) {
+	stub.tx++
+	response := stub.MockInvokeAs(id, fmt.Sprintf("tx%d", stub.tx), testutil.Args(args...))
+	return response.Status, response.Message, response.Payload
+}
+
+func (stub *tokenStub) mustInvoke(id *testutil.Identity, args ...string) []byte {
+	status, message, payload := stub.invoke(id, args...)
+	if status >= 400 {
+		stub.t.Fatalf("%s failed: %s", args[0], message)
+	}
+	return payload
+}
+
+func (stub *tokenStub) balance(org, name, asset string) int64 {
+	var account Account
+	if err := json.Unmarshal(stub.mustInvoke(stub.alice, "queryAccount", org, name), &account); err != nil {
+		stub.t.Fatalf("cannot unmarshal account: %s", err.Error())
+	}
+	return account.Value.Balances[asset]
+}
+
+func (stub *tokenStub) supply(asset string) int64 {
+	var token Token
+	if err := json.Unmarshal(stub.mustInvoke(stub.alice, "token"), &token); err != nil {
+		stub.t.Fatalf("cannot unmarshal token: %s", err.Error())
+	}
+	return token.Supply[asset]
+}
+
+const (
+	alice = "User1@a.example.com"
+	bob   = "User1@b.example.com"
+)
+
+func TestInit(t *testing.T) {
+	stub := testutil.NewMockStub("token", new(SimpleChaincode))
+	if response := stub.MockInit("init", testutil.Args("init")); response.Status < 400 {
+		t.Errorf("expected an error without issuer")
+	}
+	if response := stub.MockInit("init", testutil.Args("init", "a", "100", "b", "100")); response.Status < 400 {
+		t.Errorf("expected an error for the arguments of example02")
+	}
+
+	token := newTokenStub(t)
+	token.mustInvoke(token.issuer, "mint", "aMSP", alice, "USD", "10")
+
+	if response := token.MockInit("upgrade", testutil.Args("init")); response.Status >= 400 {
+		t.Fatalf("upgrade without arguments failed: %s", response.Message)
+	}
+	if response := token.MockInit("upgrade", testutil.Args("init", "b")); response.Status >= 400 {
+		t.Fatalf("upgrade with a new issuer failed: %s", response.Message)
+	}
+	if supply := token.supply("USD"); supply != 10 {
+		t.Errorf("upgrade must keep the total supply, got %d", supply)
+	}
+	if status, _, _ := token.invoke(token.issuer, "mint", "aMSP", alice, "USD", "10"); status != 403 {
+		t.Errorf("expected the former issuer to be denied, got %d", status)
+	}
+
+	if response := token.MockInit("upgrade", testutil.Args("init", "a", "IssuerMSP")); response.Status >= 400 {
+		t.Fatalf("upgrade with an issuer MSP failed: %s", response.Message)
+	}
+	if status, _, _ := token.invoke(token.issuer, "mint", "aMSP", alice, "USD", "10"); status != 403 {
+		t.Errorf("expected users of aMSP to be denied when the issuer MSP is IssuerMSP, got %d", status)
+	}
+	token.issuer.MSPID = "IssuerMSP"
+	token.mustInvoke(token.issuer, "mint", "aMSP", alice, "USD", "10")
+}
+
+func TestMintAndBurn(t *testing.T) {
+	stub := newTokenStub(t)
+
+	if status, _, _ := stub.invoke(stub.alice, "mint", "aMSP", alice, "USD", "100"); status != 200 {
+		t.Fatalf("expected any user of the issuer organization to mint, got %d", status)
+	}
+	if status, _, _ := stub.invoke(stub.bob, "mint", "bMSP", bob, "USD", "100"); status != 403 {
+		t.Errorf("expected 403 for mint by another organization, got %d", status)
+	}
+
+	// a CA of b that puts the name of a in its subject doesn't make b the issuer
+	impostor, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate identity: %s", err.Error())
+	}
+	impostor.MSPID = "bMSP"
+	if status, _, _ := stub.invoke(impostor, "mint", "bMSP", bob, "USD", "100"); status != 403 {
+		t.Errorf("expected 403 for mint by a member of another MSP, got %d", status)
+	}
+	stub.mustInvoke(stub.issuer, "mint", "bMSP", bob, "USD", "50")
+
+	if status, _, _ := stub.invoke(stub.bob, "burn", "bMSP", bob, "USD", "10"); status != 403 {
+		t.Errorf("expected 403 for burn by another organization, got %d", status)
+	}
+	if status, _, _ := stub.invoke(stub.issuer, "burn", "bMSP", bob, "USD", "51"); status != 409 {
+		t.Errorf("expected 409 for burning more than the balance, got %d", status)
+	}
+	stub.mustInvoke(stub.issuer, "burn", "bMSP", bob, "USD", "20")
+
+	if balance := stub.balance("bMSP", bob, "USD"); balance != 30 {
+		t.Errorf("expected 30, got %d", balance)
+	}
+	if supply := stub.supply("USD"); supply != 130 {
+		t.Errorf("expected total supply 130, got %d", supply)
+	}
+}
+
+func TestMintOverflow(t *testing.T) {
+	stub := newTokenStub(t)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", strconv.FormatInt(math.MaxInt64, 10))
+
+	if status, _, _ := stub.invoke(stub.issuer, "mint", "bMSP", bob, "USD", "1"); status != 403 {
+		t.Errorf("expected 403 when the total supply overflows, got %d", status)
+	}
+	if balance := stub.balance("aMSP", alice, "USD"); balance != math.MaxInt64 {
+		t.Errorf("expected the balance to stay at max int64, got %d", balance)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	stub := newTokenStub(t)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "100")
+
+	stub.mustInvoke(stub.alice, "move", "bMSP", bob, "USD", "60")
+	if status, _, _ := stub.invoke(stub.alice, "move", "bMSP", bob, "USD", "41"); status != 409 {
+		t.Errorf("expected 409 for insufficient funds, got %d", status)
+	}
+	// transfer is an alias of move
+	stub.mustInvoke(stub.bob, "transfer", "aMSP", alice, "USD", "10")
+
+	if a, b := stub.balance("aMSP", alice, "USD"), stub.balance("bMSP", bob, "USD"); a != 50 || b != 50 {
+		t.Errorf("expected 50 and 50, got %d and %d", a, b)
+	}
+	if supply := stub.supply("USD"); supply != 100 {
+		t.Errorf("transfers must not change the total supply, got %d", supply)
+	}
+
+	// a CA of b that issues a certificate of alice in the name of a doesn't get into her account
+	impostor, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate identity: %s", err.Error())
+	}
+	impostor.MSPID = "bMSP"
+	if status, _, _ := stub.invoke(impostor, "move", "bMSP", bob, "USD", "10"); status != 409 {
+		t.Errorf("expected 409 for a move by a member of another MSP, got %d", status)
+	}
+	if status, _, _ := stub.invoke(impostor, "placeHold", "bMSP", bob, "USD", "10", "2000000000"); status != 409 {
+		t.Errorf("expected 409 for a hold by a member of another MSP, got %d", status)
+	}
+	if balance := stub.balance("aMSP", alice, "USD"); balance != 50 {
+		t.Errorf("expected the balance of alice to stay 50, got %d", balance)
+	}
+}
+
+func TestMultipleAssets(t *testing.T) {
+	stub := newTokenStub(t)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "100")
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "EUR", "30")
+
+	if status, _, _ := stub.invoke(stub.alice, "move", "bMSP", bob, "EUR", "31"); status != 409 {
+		t.Errorf("expected 409: funds of another asset must not count, got %d", status)
+	}
+	stub.mustInvoke(stub.alice, "move", "bMSP", bob, "EUR", "30")
+
+	var account Account
+	if err := json.Unmarshal(stub.mustInvoke(stub.bob, "queryAccount", "aMSP", alice), &account); err != nil {
+		t.Fatalf("cannot unmarshal account: %s", err.Error())
+	}
+	if len(account.Value.Balances) != 1 || account.Value.Balances["USD"] != 100 {
+		t.Errorf("expected only 100 USD left, got %v", account.Value.Balances)
+	}
+	if eur := stub.balance("bMSP", bob, "EUR"); eur != 30 {
+		t.Errorf("expected 30 EUR, got %d", eur)
+	}
+	if usd, eur := stub.supply("USD"), stub.supply("EUR"); usd != 100 || eur != 30 {
+		t.Errorf("expected supply of 100 USD and 30 EUR, got %d and %d", usd, eur)
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+	stub := newTokenStub(t)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "100")
+
+	tests := []struct {
+		args   []string
+		status int32
+	}{
+		{[]string{"move", "bMSP", bob}, 403},
+		{[]string{"move", "bMSP", bob, "USD", "0"}, 400},
+		{[]string{"move", "bMSP", bob, "USD", "-10"}, 400},
+		{[]string{"move", "bMSP", bob, "USD", "ten"}, 400},
+		{[]string{"move", "bMSP", bob, "USD", "9223372036854775808"}, 400},
+		{[]string{"move", "", bob, "USD", "10"}, 400},
+		{[]string{"move", "bMSP", bob, "", "10"}, 400},
+		{[]string{"move", "bMSP", bob, "US D", "10"}, 400},
+		{[]string{"move", "aMSP", alice, "USD", "10"}, 400},
+	}
+
+	for _, test := range tests {
+		if status, message, _ := stub.invoke(stub.alice, test.args...); status != test.status {
+			t.Errorf("%v: expected %d, got %d %q", test.args, test.status, status, message)
+		}
+	}
+
+	stub.Creator = nil
+	response := stub.MockInvoke("anonymous", testutil.Args("move", "bMSP", bob, "USD", "10"))
+	if response.Status != 403 {
+		t.Errorf("expected 403 without a creator certificate, got %d", response.Status)
+	}
+
+	if balance := stub.balance("aMSP", alice, "USD"); balance != 100 {
+		t.Errorf("failed transfers must not change the balance, got %d", balance)
+	}
+}
+
+func TestQueryAndDelete(t *testing.T) {
+	stub := newTokenStub(t)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "10")
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", "Admin@a.example.com", "USD", "5")
+	stub.mustInvoke(stub.issuer, "mint", "bMSP", bob, "USD", "1")
+
+	var accounts []Account
+	if err := json.Unmarshal(stub.mustInvoke(stub.bob, "query", "aMSP"), &accounts); err != nil {
+		t.Fatalf("cannot unmarshal accounts: %s", err.Error())
+	}
+	if len(accounts) != 2 || accounts[0].Key.Name != "Admin@a.example.com" || accounts[1].Value.Balances["USD"] != 10 {
+		t.Errorf("expected both accounts of a, got %+v", accounts)
+	}
+
+	if status, _, _ := stub.invoke(stub.alice, "delete"); status != 403 {
+		t.Errorf("expected 403 for deleting an account with funds, got %d", status)
+	}
+	stub.mustInvoke(stub.alice, "move", "bMSP", bob, "USD", "10")
+	stub.mustInvoke(stub.alice, "delete")
+
+	if status, _, _ := stub.invoke(stub.alice, "query", "aMSP", alice); status != 404 {
+		t.Errorf("expected 404 for a deleted account, got %d", status)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"testutil"
+)
+
+func TestResponseContracts(t *testing.T) {
+	stub := newTokenStub(t)
+	stub.Now = testutil.FixedClock(time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC), time.Minute)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "100")
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "EUR", "10")
+	stub.mustInvoke(stub.alice, "move", "bMSP", bob, "USD", "40", "invoice 1")
+	stub.mustInvoke(stub.alice, "placeHold", "bMSP", bob, "USD", "10", "1519992000", "order 2")
+
+	tests := []struct {
+		name string
+		args []string
+		v    interface{}
+	}{
+		{"query", []string{"query", "bMSP", bob}, Account{}},
+		{"queryAccount", []string{"queryAccount", "aMSP", alice}, Account{}},
+		{"queryReceipts", []string{"queryReceipts", "tx1", "tx3"}, []Receipt{}},
+		{"queryHistory", []string{"queryHistory", "aMSP", alice, "", "2"}, receiptPage{}},
+		{"queryAccounts", []string{"query", "aMSP"}, []Account{}},
+		{"queryHolds", []string{"queryHolds", "aMSP", alice}, []Hold{}},
+		{"token", []string{"token"}, Token{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := stub.mustInvoke(stub.alice, test.args...)
+			testutil.AssertContract(t, test.name, payload, test.v)
+		})
+	}
+}
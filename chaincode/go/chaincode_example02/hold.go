@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	holdIndex = "Hold"
+	// accountHoldIndex lists the holds an account is the payer or the beneficiary of: org~name~holdId
+	accountHoldIndex = "AccountHold"
+	// activeHoldIndex lists the active holds of a payer, the ones that may expire: org~name~holdId
+	activeHoldIndex = "ActiveHold"
+)
+
+const (
+	holdActive   = "Active"
+	holdExecuted = "Executed"
+	holdReleased = "Released"
+	holdExpired  = "Expired"
+)
+
+// Hold reserves an amount of the payer's asset for the beneficiary until Expiry, the time in seconds after which
+// it can no longer be executed. The id of a hold is the id of the transaction that placed it. Closed is the
+// transaction that executed, released or expired it.
+type Hold struct {
+	Id      string     `json:"id"`
+	From    AccountKey `json:"from"`
+	To      AccountKey `json:"to"`
+	Asset   string     `json:"asset"`
+	Amount  int64      `json:"amount"`
+	Memo    string     `json:"memo"`
+	Expiry  int64      `json:"expiry"`
+	Status  string     `json:"status"`
+	Created int64      `json:"created"`
+	Closed  string     `json:"closed,omitempty"`
+}
+
+func (hold *Hold) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey(holdIndex, []string{hold.Id})
+}
+
+// isExpired tells if the hold can't be executed at the time now
+func (hold *Hold) isExpired(now int64) bool {
+	return hold.Status == holdActive && now > hold.Expiry
+}
+
+// LoadFrom reads the hold by its id. It returns false if there is no such hold.
+func (hold *Hold) LoadFrom(stub shim.ChaincodeStubInterface) (bool, error) {
+	compositeKey, err := hold.ToCompositeKey(stub)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := stub.GetState(compositeKey)
+	if err != nil || data == nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, hold)
+}
+
+// UpdateOrInsertIn stores the hold and keeps the indexes of the accounts up to date with its status
+func (hold *Hold) UpdateOrInsertIn(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := hold.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(hold)
+	if err != nil {
+		return err
+	}
+	if err := stub.PutState(compositeKey, value); err != nil {
+		return err
+	}
+
+	for _, account := range []AccountKey{hold.From, hold.To} {
+		indexKey, err := stub.CreateCompositeKey(accountHoldIndex, []string{account.Org, account.Name, hold.Id})
+		if err != nil {
+			return err
+		}
+		if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+
+	activeKey, err := stub.CreateCompositeKey(activeHoldIndex, []string{hold.From.Org, hold.From.Name, hold.Id})
+	if err != nil {
+		return err
+	}
+	if hold.Status == holdActive {
+		return stub.PutState(activeKey, []byte{0x00})
+	}
+
+	return stub.DelState(activeKey)
+}
+
+// loadHolds reads the holds of an index by the account key parts
+func loadHolds(stub shim.ChaincodeStubInterface, index string, account AccountKey) ([]Hold, error) {
+	it, err := stub.GetStateByPartialCompositeKey(index, []string{account.Org, account.Name})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	holds := []Hold{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		hold := Hold{Id: compositeKeyParts[2]}
+		found, err := hold.LoadFrom(stub)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.New(fmt.Sprintf("hold %s is missing", hold.Id))
+		}
+		holds = append(holds, hold)
+	}
+
+	return holds, nil
+}
+
+// expireHolds returns the amounts of the active holds of the payer that have expired by the time now to the
+// available balances of the account. With save set it also closes those holds, otherwise it only adjusts the
+// account in memory, the way queries report it. The account itself is left for the caller to save.
+func expireHolds(stub shim.ChaincodeStubInterface, account *Account, now int64, save bool) error {
+	holds, err := loadHolds(stub, activeHoldIndex, account.Key)
+	if err != nil {
+		return err
+	}
+
+	for _, hold := range holds {
+		if !hold.isExpired(now) {
+			continue
+		}
+
+		if err := account.release(hold.Asset, hold.Amount); err != nil {
+			return err
+		}
+		if !save {
+			continue
+		}
+
+		hold.Status = holdExpired
+		hold.Closed = stub.GetTxID()
+		if err := hold.UpdateOrInsertIn(stub); err != nil {
+			return err
+		}
+		logger.Infof("hold %s of %s of %s expired", hold.Id, account.Key.Name, account.Key.Org)
+	}
+
+	return nil
+}
+
+// parseExpiry reads the time in seconds a hold placed at the time now expires at, which must be in the future
+func parseExpiry(s string, now int64) (int64, error) {
+	expiry, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || expiry <= now {
+		return 0, errors.New(fmt.Sprintf("expiry is invalid: %s (must be a time in seconds after %d)", s, now))
+	}
+
+	return expiry, nil
+}
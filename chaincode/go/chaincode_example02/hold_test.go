@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"testutil"
+)
+
+// holdStub mints 100 USD to alice at 1000, each following transaction a second later
+func holdStub(t *testing.T) *tokenStub {
+	stub := newTokenStub(t)
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "100")
+	return stub
+}
+
+func (stub *tokenStub) placeHold(amount, expiry string) Hold {
+	var hold Hold
+	payload := stub.mustInvoke(stub.alice, "placeHold", "bMSP", bob, "USD", amount, expiry, "order 1")
+	if err := json.Unmarshal(payload, &hold); err != nil {
+		stub.t.Fatalf("cannot unmarshal hold: %s", err.Error())
+	}
+	return hold
+}
+
+func (stub *tokenStub) account(org, name string) AccountValue {
+	var account Account
+	if err := json.Unmarshal(stub.mustInvoke(stub.bob, "queryAccount", org, name), &account); err != nil {
+		stub.t.Fatalf("cannot unmarshal account: %s", err.Error())
+	}
+	return account.Value
+}
+
+func (stub *tokenStub) holds(args ...string) []Hold {
+	var holds []Hold
+	if err := json.Unmarshal(stub.mustInvoke(stub.bob, append([]string{"queryHolds"}, args...)...), &holds); err != nil {
+		stub.t.Fatalf("cannot unmarshal holds: %s", err.Error())
+	}
+	return holds
+}
+
+func TestPlaceAndExecuteHold(t *testing.T) {
+	stub := holdStub(t)
+
+	hold := stub.placeHold("30", "2000")
+	if hold.Id != "tx2" || hold.Status != holdActive || hold.From != (AccountKey{"aMSP", alice}) ||
+		hold.To != (AccountKey{"bMSP", bob}) || hold.Created != 1001 || hold.Expiry != 2000 {
+		t.Fatalf("unexpected hold %+v", hold)
+	}
+
+	value := stub.account("aMSP", alice)
+	if value.Balances["USD"] != 70 || value.Held["USD"] != 30 {
+		t.Errorf("expected 70 available and 30 held, got %+v", value)
+	}
+	if status, _, _ := stub.invoke(stub.alice, "move", "bMSP", bob, "USD", "71"); status != 409 {
+		t.Errorf("expected held funds not to be spendable, got %d", status)
+	}
+
+	if status, _, _ := stub.invoke(stub.bob, "executeHold", hold.Id); status != 403 {
+		t.Errorf("expected 403 for execution by the beneficiary, got %d", status)
+	}
+	stub.mustInvoke(stub.alice, "executeHold", hold.Id)
+	if status, _, _ := stub.invoke(stub.alice, "executeHold", hold.Id); status != 409 {
+		t.Errorf("expected 409 for executing twice, got %d", status)
+	}
+
+	if value := stub.account("aMSP", alice); value.Balances["USD"] != 70 || len(value.Held) != 0 {
+		t.Errorf("expected 70 available and nothing held, got %+v", value)
+	}
+	if balance := stub.balance("bMSP", bob, "USD"); balance != 30 {
+		t.Errorf("expected bob to get 30, got %d", balance)
+	}
+
+	page := stub.history("bMSP", bob)
+	if len(page.Receipts) != 1 || page.Receipts[0].HoldId != hold.Id || page.Receipts[0].Memo != "order 1" {
+		t.Errorf("expected a receipt of the hold, got %+v", page.Receipts)
+	}
+	if holds := stub.holds("aMSP", alice); len(holds) != 1 || holds[0].Status != holdExecuted || holds[0].Closed == "" {
+		t.Errorf("expected the hold executed, got %+v", holds)
+	}
+}
+
+func TestReleaseHold(t *testing.T) {
+	stub := holdStub(t)
+	hold := stub.placeHold("30", "2000")
+
+	if status, _, _ := stub.invoke(stub.alice, "releaseHold", hold.Id); status != 403 {
+		t.Errorf("expected 403 for release by the payer before expiry, got %d", status)
+	}
+	stub.mustInvoke(stub.bob, "releaseHold", hold.Id)
+
+	if value := stub.account("aMSP", alice); value.Balances["USD"] != 100 || len(value.Held) != 0 {
+		t.Errorf("expected the funds back, got %+v", value)
+	}
+	if holds := stub.holds("bMSP", bob, holdReleased); len(holds) != 1 {
+		t.Errorf("expected the hold released, got %+v", holds)
+	}
+	if page := stub.history("aMSP", alice); len(page.Receipts) != 1 {
+		t.Errorf("a released hold must not leave a receipt, got %+v", page.Receipts)
+	}
+}
+
+func TestExpiredHold(t *testing.T) {
+	stub := holdStub(t)
+	hold := stub.placeHold("30", "1002")
+	stub.placeHold("20", "2000")
+
+	// tx4 at 1003 is after the expiry of the first hold
+	if value := stub.account("aMSP", alice); value.Balances["USD"] != 80 || value.Held["USD"] != 20 {
+		t.Errorf("expected the expired hold to be reported available, got %+v", value)
+	}
+	if holds := stub.holds("aMSP", alice, holdExpired); len(holds) != 1 || holds[0].Id != hold.Id {
+		t.Errorf("expected the hold reported expired, got %+v", holds)
+	}
+	if status, _, _ := stub.invoke(stub.alice, "executeHold", hold.Id); status != 409 {
+		t.Errorf("expected 409 for executing an expired hold, got %d", status)
+	}
+
+	stub.mustInvoke(stub.alice, "move", "bMSP", bob, "USD", "80")
+
+	if value := stub.account("aMSP", alice); len(value.Balances) != 0 || value.Held["USD"] != 20 {
+		t.Errorf("expected the expired funds spent and the other hold kept, got %+v", value)
+	}
+	holds := stub.holds("aMSP", alice, holdExpired)
+	if len(holds) != 1 || holds[0].Closed == "" {
+		t.Errorf("expected the expiry recorded by the transfer, got %+v", holds)
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	stub := holdStub(t)
+	hold := stub.placeHold("30", "1002")
+
+	// the hold is still active at 1002 and expireHolds at 1003 closes it
+	if holds := stub.holds("aMSP", alice, holdActive); len(holds) != 1 {
+		t.Fatalf("expected the hold active at 1002, got %+v", holds)
+	}
+	stub.mustInvoke(stub.bob, "expireHolds", "aMSP", alice)
+
+	var recorded Hold
+	recorded.Id = hold.Id
+	stub.MockTransactionStart("check")
+	if found, err := recorded.LoadFrom(stub); !found || err != nil || recorded.Status != holdExpired {
+		t.Errorf("expected the expiry in the ledger, got %+v, %v", recorded, err)
+	}
+	stub.MockTransactionEnd("check")
+
+	var account Account
+	account.Key = AccountKey{"aMSP", alice}
+	if err := account.LoadFrom(stub); err != nil || account.Value.Balances["USD"] != 100 {
+		t.Errorf("expected the funds back in the ledger, got %+v, %v", account.Value, err)
+	}
+}
+
+func TestPlaceHoldErrors(t *testing.T) {
+	stub := holdStub(t)
+
+	tests := []struct {
+		args   []string
+		status int32
+	}{
+		{[]string{"placeHold", "bMSP", bob, "USD", "10"}, 403},
+		{[]string{"placeHold", "bMSP", bob, "USD", "10", "1000"}, 400},
+		{[]string{"placeHold", "bMSP", bob, "USD", "10", "soon"}, 400},
+		{[]string{"placeHold", "bMSP", bob, "USD", "0", "2000"}, 400},
+		{[]string{"placeHold", "aMSP", alice, "USD", "10", "2000"}, 400},
+		{[]string{"placeHold", "bMSP", bob, "USD", "101", "2000"}, 409},
+		{[]string{"executeHold", "unknown"}, 404},
+		{[]string{"releaseHold"}, 403},
+		{[]string{"queryHolds", "aMSP", alice, "Pending"}, 400},
+	}
+
+	for _, test := range tests {
+		if status, message, _ := stub.invoke(stub.alice, test.args...); status != test.status {
+			t.Errorf("%v: expected %d, got %d %q", test.args, test.status, status, message)
+		}
+	}
+
+	if value := stub.account("aMSP", alice); value.Balances["USD"] != 100 || len(value.Held) != 0 {
+		t.Errorf("failed holds must not change the account, got %+v", value)
+	}
+}
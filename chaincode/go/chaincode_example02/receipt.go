@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	receiptIndex = "Receipt"
+	// accountReceiptIndex lists the receipts of an account in time order: org~name~position~txId
+	accountReceiptIndex = "AccountReceipt"
+)
+
+const (
+	receiptMint     = "mint"
+	receiptBurn     = "burn"
+	receiptTransfer = "transfer"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Receipt records a movement of an asset made by a transaction. From is nil for a mint, To is nil for a burn.
+// HoldId is set when a transfer executed a hold. Timestamp is the time of the transaction in seconds.
+type Receipt struct {
+	TxId      string      `json:"txId"`
+	Kind      string      `json:"kind"`
+	From      *AccountKey `json:"from,omitempty"`
+	To        *AccountKey `json:"to,omitempty"`
+	Asset     string      `json:"asset"`
+	Amount    int64       `json:"amount"`
+	Memo      string      `json:"memo"`
+	HoldId    string      `json:"holdId,omitempty"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// receiptPage is a response of queryHistory. Bookmark is empty on the last page, otherwise it is passed back
+// to get the next one.
+type receiptPage struct {
+	Receipts []Receipt `json:"receipts"`
+	Bookmark string    `json:"bookmark"`
+}
+
+// newReceipt fills the transaction id and time of a movement made by the current transaction
+func newReceipt(stub shim.ChaincodeStubInterface, kind string, from, to *AccountKey, asset string, amount int64,
+	memo string) (Receipt, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	return Receipt{TxId: stub.GetTxID(), Kind: kind, From: from, To: to, Asset: asset, Amount: amount, Memo: memo,
+		Timestamp: timestamp.Seconds}, nil
+}
+
+// Save stores the receipt under the transaction id and adds it to the history of the accounts involved
+func (receipt *Receipt) Save(stub shim.ChaincodeStubInterface) error {
+	key, err := stub.CreateCompositeKey(receiptIndex, []string{receipt.TxId})
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	if err := stub.PutState(key, value); err != nil {
+		return err
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+	// timestamps are padded so that the index sorts by time
+	position := fmt.Sprintf("%020d.%09d", timestamp.Seconds, timestamp.Nanos)
+
+	for _, account := range []*AccountKey{receipt.From, receipt.To} {
+		if account == nil {
+			continue
+		}
+
+		indexKey, err := stub.CreateCompositeKey(accountReceiptIndex,
+			[]string{account.Org, account.Name, position, receipt.TxId})
+		if err != nil {
+			return err
+		}
+		if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadReceipt reads the receipt of the transaction, nil if it moved nothing
+func loadReceipt(stub shim.ChaincodeStubInterface, txId string) (*Receipt, error) {
+	key, err := stub.CreateCompositeKey(receiptIndex, []string{txId})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+// historyQuery pages through the receipts of an account, oldest first, optionally of one asset only
+type historyQuery struct {
+	Account  Account
+	Asset    string
+	PageSize int
+	Offset   int
+}
+
+func parseHistoryQuery(args []string) (historyQuery, error) {
+	//  0     1       2          3            4
+	// org, name, [asset], [pageSize], [bookmark]
+	if len(args) < 2 {
+		return historyQuery{}, errors.New("incorrect number of arguments: expected org and name")
+	}
+
+	query := historyQuery{PageSize: defaultPageSize}
+	if err := query.Account.FillFromKeyParts(args[0], args[1]); err != nil {
+		return historyQuery{}, err
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		asset, err := parseAsset(args[2])
+		if err != nil {
+			return historyQuery{}, err
+		}
+		query.Asset = asset
+	}
+
+	if len(args) > 3 && len(args[3]) > 0 {
+		pageSize, err := strconv.Atoi(args[3])
+		if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+			return historyQuery{}, errors.New(fmt.Sprintf("page size is invalid: %s (must be from 1 to %d)",
+				args[3], maxPageSize))
+		}
+		query.PageSize = pageSize
+	}
+
+	if len(args) > 4 && len(args[4]) > 0 {
+		offset, err := strconv.Atoi(args[4])
+		if err != nil || offset < 0 {
+			return historyQuery{}, errors.New(fmt.Sprintf("bookmark is invalid: %s", args[4]))
+		}
+		query.Offset = offset
+	}
+
+	return query, nil
+}
+
+// Execute walks the index of the account. The bookmark is the number of receipts to skip, so each page re-scans
+// the index entries before it.
+func (query historyQuery) Execute(stub shim.ChaincodeStubInterface) (receiptPage, error) {
+	it, err := stub.GetStateByPartialCompositeKey(accountReceiptIndex,
+		[]string{query.Account.Key.Org, query.Account.Key.Name})
+	if err != nil {
+		return receiptPage{}, err
+	}
+	defer it.Close()
+
+	page := receiptPage{Receipts: []Receipt{}}
+	matched := 0
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return receiptPage{}, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return receiptPage{}, err
+		}
+
+		// without an asset filter the receipts to skip don't need to be read
+		if len(query.Asset) == 0 && matched < query.Offset {
+			matched++
+			continue
+		}
+
+		receipt, err := loadReceipt(stub, compositeKeyParts[3])
+		if err != nil {
+			return receiptPage{}, err
+		}
+		if receipt == nil {
+			return receiptPage{}, errors.New(fmt.Sprintf("receipt of transaction %s is missing",
+				compositeKeyParts[3]))
+		}
+		if len(query.Asset) > 0 && receipt.Asset != query.Asset {
+			continue
+		}
+
+		matched++
+		if matched <= query.Offset {
+			continue
+		}
+		if len(page.Receipts) == query.PageSize {
+			page.Bookmark = strconv.Itoa(query.Offset + query.PageSize)
+			break
+		}
+		page.Receipts = append(page.Receipts, *receipt)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"testutil"
+)
+
+// receiptStub mints 100 USD and 10 EUR to alice, who then pays bob 3 times, a transaction a second from 1000
+func receiptStub(t *testing.T) *tokenStub {
+	stub := newTokenStub(t)
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "USD", "100", "opening balance")
+	stub.mustInvoke(stub.issuer, "mint", "aMSP", alice, "EUR", "10")
+	for i := 1; i <= 3; i++ {
+		stub.mustInvoke(stub.alice, "move", "bMSP", bob, "USD", fmt.Sprint(i), fmt.Sprintf("invoice %d", i))
+	}
+	stub.mustInvoke(stub.issuer, "burn", "bMSP", bob, "USD", "6")
+
+	return stub
+}
+
+func (stub *tokenStub) history(args ...string) receiptPage {
+	var page receiptPage
+	if err := json.Unmarshal(stub.mustInvoke(stub.bob, append([]string{"queryHistory"}, args...)...), &page); err != nil {
+		stub.t.Fatalf("cannot unmarshal history: %s", err.Error())
+	}
+	return page
+}
+
+func txIds(receipts []Receipt) string {
+	ids := []string{}
+	for _, receipt := range receipts {
+		ids = append(ids, receipt.TxId)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestReceipts(t *testing.T) {
+	stub := receiptStub(t)
+
+	var receipts []Receipt
+	payload := stub.mustInvoke(stub.bob, "queryReceipts", "tx1", "tx3", "unknown", "tx6")
+	if err := json.Unmarshal(payload, &receipts); err != nil {
+		t.Fatalf("cannot unmarshal receipts: %s", err.Error())
+	}
+	if txIds(receipts) != "[tx1 tx3 tx6]" {
+		t.Fatalf("expected receipts of tx1, tx3 and tx6, got %s", txIds(receipts))
+	}
+
+	mint, transfer, burn := receipts[0], receipts[1], receipts[2]
+	if mint.Kind != receiptMint || mint.From != nil || *mint.To != (AccountKey{"aMSP", alice}) ||
+		mint.Memo != "opening balance" || mint.Timestamp != 1000 {
+		t.Errorf("unexpected mint receipt %+v", mint)
+	}
+	if transfer.Kind != receiptTransfer || *transfer.From != (AccountKey{"aMSP", alice}) ||
+		*transfer.To != (AccountKey{"bMSP", bob}) || transfer.Asset != "USD" || transfer.Amount != 1 ||
+		transfer.Memo != "invoice 1" || transfer.Timestamp != 1002 {
+		t.Errorf("unexpected transfer receipt %+v", transfer)
+	}
+	if burn.Kind != receiptBurn || *burn.From != (AccountKey{"bMSP", bob}) || burn.To != nil || burn.Amount != 6 {
+		t.Errorf("unexpected burn receipt %+v", burn)
+	}
+
+	if status, _, _ := stub.invoke(stub.bob, "queryReceipts"); status < 400 {
+		t.Errorf("expected an error without transaction ids")
+	}
+}
+
+func TestReceiptsOfFailedMovements(t *testing.T) {
+	stub := receiptStub(t)
+
+	if status, _, _ := stub.invoke(stub.bob, "move", "aMSP", alice, "EUR", "1"); status != 409 {
+		t.Fatalf("expected 409, got %d", status)
+	}
+	if page := stub.history("bMSP", bob); txIds(page.Receipts) != "[tx3 tx4 tx5 tx6]" {
+		t.Errorf("a failed transfer must not leave a receipt, got %s", txIds(page.Receipts))
+	}
+}
+
+func TestQueryHistory(t *testing.T) {
+	stub := receiptStub(t)
+
+	tests := []struct {
+		args     []string
+		expected string
+		bookmark string
+	}{
+		{[]string{"aMSP", alice}, "[tx1 tx2 tx3 tx4 tx5]", ""},
+		{[]string{"bMSP", bob}, "[tx3 tx4 tx5 tx6]", ""},
+		{[]string{"aMSP", alice, "EUR"}, "[tx2]", ""},
+		{[]string{"aMSP", alice, "", "2"}, "[tx1 tx2]", "2"},
+		{[]string{"aMSP", alice, "", "2", "4"}, "[tx5]", ""},
+		{[]string{"aMSP", alice, "USD", "2", "2"}, "[tx4 tx5]", ""},
+		{[]string{"aMSP", alice, "USD", "1", "1"}, "[tx3]", "2"},
+		{[]string{"c", "nobody"}, "[]", ""},
+	}
+
+	for _, test := range tests {
+		page := stub.history(test.args...)
+		if txIds(page.Receipts) != test.expected || page.Bookmark != test.bookmark {
+			t.Errorf("%v: expected %s with bookmark %q, got %s with %q", test.args, test.expected, test.bookmark,
+				txIds(page.Receipts), page.Bookmark)
+		}
+	}
+
+	for _, args := range [][]string{{"aMSP"}, {"aMSP", alice, "$"}, {"aMSP", alice, "", "0"},
+		{"aMSP", alice, "", "", "-1"}} {
+		if status, _, _ := stub.invoke(stub.bob, append([]string{"queryHistory"}, args...)...); status != 400 {
+			t.Errorf("%v: expected 400, got %d", args, status)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package document anchors off-chain documents, e.g. certificates of origin, invoices or inspection reports, to
+// records of the ledger by their SHA-256 hashes. The files stay in the document store; the ledger keeps the hash
+// and the metadata, so a file presented later can be checked against it. It is shared by the reference and the
+// relationship chaincodes.
+package document
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// documentIndex keys a document by the record it's attached to and its hash: type~key parts~hash, e.g.
+// product~p1~<hash>
+const documentIndex = "Document"
+
+// ArgumentsNumber is the number of arguments ParseDocument reads at least
+const ArgumentsNumber = 3
+
+// ErrAlreadyAttached is returned by Attach for a document with the same hash already attached to the record
+var ErrAlreadyAttached = errors.New("document is already attached")
+
+// Document is the hash of a file attached to a record and what is known about the file: its type, e.g. invoice,
+// the party that issued it and where it is stored. Org is the organization that attached it.
+type Document struct {
+	Hash      string `json:"hash"`
+	Type      string `json:"type"`
+	Issuer    string `json:"issuer"`
+	URI       string `json:"uri"`
+	Org       string `json:"org"`
+	TxId      string `json:"txId"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Verification is the result of checking the hash of a presented file against the documents of a record.
+// Document is the attachment with that hash, nil if there is none.
+type Verification struct {
+	Hash     string    `json:"hash"`
+	Matches  bool      `json:"matches"`
+	Document *Document `json:"document,omitempty"`
+}
+
+// ParseHash reads a hex SHA-256 hash. Upper case digits are accepted and turned to lower case.
+func ParseHash(s string) (string, error) {
+	hash := strings.ToLower(s)
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != 32 {
+		return "", errors.New(fmt.Sprintf("document hash is invalid: %s (must be hex SHA-256)", s))
+	}
+
+	return hash, nil
+}
+
+// ParseDocument reads the hash and the metadata of a document from the arguments
+func ParseDocument(args []string) (Document, error) {
+	//  0     1       2       3
+	// hash, type, issuer, [uri]
+	if len(args) < ArgumentsNumber {
+		return Document{}, errors.New(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			ArgumentsNumber, len(args)))
+	}
+
+	hash, err := ParseHash(args[0])
+	if err != nil {
+		return Document{}, err
+	}
+
+	for k, v := range args[1:ArgumentsNumber] {
+		if len(v) == 0 || !utf8.ValidString(v) {
+			return Document{}, errors.New(fmt.Sprintf("argument #%d must be a non-empty UTF-8 string", k+2))
+		}
+	}
+
+	document := Document{Hash: hash, Type: args[1], Issuer: args[2]}
+	if len(args) > ArgumentsNumber {
+		document.URI = args[ArgumentsNumber]
+	}
+
+	return document, nil
+}
+
+func documentKey(stub shim.ChaincodeStubInterface, target []string, hash string) (string, error) {
+	return stub.CreateCompositeKey(documentIndex, append(append([]string{}, target...), hash))
+}
+
+// Attach stores the document for the record identified by target, the type of the record followed by its key
+// parts. It fills the transaction id and time. A document can be attached to a record once.
+func Attach(stub shim.ChaincodeStubInterface, target []string, document *Document) error {
+	key, err := documentKey(stub, target, document.Hash)
+	if err != nil {
+		return err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		return ErrAlreadyAttached
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+	document.TxId = stub.GetTxID()
+	document.Timestamp = timestamp.Seconds
+
+	value, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// List returns the documents attached to the record in the order they were attached
+func List(stub shim.ChaincodeStubInterface, target []string) ([]Document, error) {
+	it, err := stub.GetStateByPartialCompositeKey(documentIndex, target)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	documents := []Document{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var document Document
+		if err := json.Unmarshal(response.Value, &document); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	// the index goes by hash
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].Timestamp < documents[j].Timestamp
+	})
+
+	return documents, nil
+}
+
+// Verify tells if a file with the hash is attached to the record
+func Verify(stub shim.ChaincodeStubInterface, target []string, hash string) (Verification, error) {
+	verification := Verification{Hash: hash}
+
+	key, err := documentKey(stub, target, hash)
+	if err != nil {
+		return verification, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return verification, err
+	}
+
+	var document Document
+	if err := json.Unmarshal(data, &document); err != nil {
+		return verification, err
+	}
+
+	verification.Matches = true
+	verification.Document = &document
+	return verification, nil
+}
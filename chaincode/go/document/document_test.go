@@ -0,0 +1,124 @@
+package document
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"testutil"
+)
+
+const (
+	hashA = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	hashB = "0000000000000000000000000000000000000000000000000000000000000001"
+)
+
+// attachChaincode attaches the document in the arguments to the target
+type attachChaincode struct {
+	target []string
+}
+
+func (cc *attachChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *attachChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	document, err := ParseDocument(stub.GetStringArgs())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := Attach(stub, cc.target, &document); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+func newStub() (*testutil.MockStub, *attachChaincode) {
+	cc := new(attachChaincode)
+	stub := testutil.NewMockStub("document", cc)
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+	return stub, cc
+}
+
+func attach(stub *testutil.MockStub, cc *attachChaincode, txId string, target []string, args ...string) string {
+	cc.target = target
+	return stub.MockInvoke(txId, testutil.Args(args...)).Message
+}
+
+func TestAttachListVerify(t *testing.T) {
+	stub, cc := newStub()
+	p1, p10 := []string{"product", "p1"}, []string{"product", "p10"}
+
+	// the later document has the smaller hash: listing goes by the time of attachment
+	if message := attach(stub, cc, "tx1", p1, hashA, "invoice", "a", "https://docs/1"); message != "" {
+		t.Fatalf("unexpected error: %s", message)
+	}
+	if message := attach(stub, cc, "tx2", p1, hashB, "inspection", "lab"); message != "" {
+		t.Fatalf("unexpected error: %s", message)
+	}
+	if message := attach(stub, cc, "tx3", p10, hashA, "invoice", "a"); message != "" {
+		t.Fatalf("unexpected error: %s", message)
+	}
+	if message := attach(stub, cc, "tx4", p1, hashA, "invoice", "a"); message != ErrAlreadyAttached.Error() {
+		t.Errorf("expected %v for the same document twice, got %q", ErrAlreadyAttached, message)
+	}
+
+	documents, err := List(stub, p1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	expected := []Document{
+		{Hash: hashA, Type: "invoice", Issuer: "a", URI: "https://docs/1", TxId: "tx1", Timestamp: 1000},
+		{Hash: hashB, Type: "inspection", Issuer: "lab", TxId: "tx2", Timestamp: 1001},
+	}
+	if !reflect.DeepEqual(documents, expected) {
+		t.Errorf("expected %+v, got %+v", expected, documents)
+	}
+
+	for _, test := range []struct {
+		target  []string
+		hash    string
+		matches bool
+	}{
+		{p1, hashA, true},
+		{p1, hashB, true},
+		{p10, hashB, false},
+		{[]string{"transfer", "p1", "a", "b"}, hashA, false},
+	} {
+		t.Run(fmt.Sprint(test.target, test.hash), func(t *testing.T) {
+			verification, err := Verify(stub, test.target, test.hash)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if verification.Matches != test.matches || (verification.Document != nil) != test.matches {
+				t.Errorf("expected matches %v, got %+v", test.matches, verification)
+			}
+		})
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	document, err := ParseDocument([]string{"2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE",
+		"invoice", "a"})
+	if err != nil || document.Hash != hashA {
+		t.Errorf("expected the hash in lower case, got %+v (%v)", document, err)
+	}
+
+	for _, args := range [][]string{
+		{hashA, "invoice"},
+		{hashA[:62], "invoice", "a"},
+		{hashA[:63] + "g", "invoice", "a"},
+		{hashA, "", "a"},
+		{hashA, "invoice", "\xff"},
+	} {
+		if _, err := ParseDocument(args); err == nil {
+			t.Errorf("expected an error for arguments %q", args)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package params reads the optional arguments that the read-only functions of the reference and the relationship
+// chaincodes share: the time window of statistics and the page of an export.
+package params
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	// DefaultPageSize is the size of a page of an export when none is given
+	DefaultPageSize = 100
+	// MaxPageSize is the largest page of an export
+	MaxPageSize = 1000
+)
+
+// TimeWindow bounds transaction times in seconds inclusively, From is 0 and To is math.MaxInt64 when not set. Both
+// chaincodes apply it to the timestamps of transactions, never to times that clients write into values.
+type TimeWindow struct {
+	From int64
+	To   int64
+}
+
+// ParseTimeWindow reads the optional bounds of a time window
+func ParseTimeWindow(args []string) (TimeWindow, error) {
+	//   0       1
+	// [from], [to]
+	window := TimeWindow{From: 0, To: math.MaxInt64}
+
+	for i, bound := range []*int64{&window.From, &window.To} {
+		if len(args) <= i || len(args[i]) == 0 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil || value < 0 {
+			return TimeWindow{}, errors.New(fmt.Sprintf("time window bound is invalid: %s (must be non-negative int)",
+				args[i]))
+		}
+		*bound = value
+	}
+
+	if window.From > window.To {
+		return TimeWindow{}, errors.New(fmt.Sprintf("time window is empty: from %d is after to %d",
+			window.From, window.To))
+	}
+
+	return window, nil
+}
+
+// Contains tells if the time is within the window
+func (window TimeWindow) Contains(t int64) bool {
+	return window.From <= t && t <= window.To
+}
+
+// Export pages through all records of a kind in the order of their keys. Bookmark is the key of the last record of
+// the previous page, in the form the chaincode returns it, and empty for the first page. Records written or deleted
+// between pages don't shift it.
+type Export struct {
+	PageSize    int
+	Bookmark    string
+	WithHistory bool
+}
+
+// ParseExport reads the optional page size, bookmark and history flag of an export
+func ParseExport(args []string) (Export, error) {
+	//     0            1           2
+	// [pageSize], [bookmark], [history]
+	export := Export{PageSize: DefaultPageSize}
+
+	if len(args) > 0 && len(args[0]) > 0 {
+		pageSize, err := strconv.Atoi(args[0])
+		if err != nil || pageSize <= 0 || pageSize > MaxPageSize {
+			return Export{}, errors.New(fmt.Sprintf("page size is invalid: %s (must be from 1 to %d)",
+				args[0], MaxPageSize))
+		}
+		export.PageSize = pageSize
+	}
+
+	if len(args) > 1 {
+		export.Bookmark = args[1]
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		withHistory, err := strconv.ParseBool(args[2])
+		if err != nil {
+			return Export{}, errors.New(fmt.Sprintf("history flag is invalid: %s (must be true or false)",
+				args[2]))
+		}
+		export.WithHistory = withHistory
+	}
+
+	return export, nil
+}
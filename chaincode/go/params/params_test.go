@@ -0,0 +1,56 @@
+package params
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected TimeWindow
+		ok       bool
+	}{
+		{[]string{}, TimeWindow{0, math.MaxInt64}, true},
+		{[]string{"", ""}, TimeWindow{0, math.MaxInt64}, true},
+		{[]string{"10"}, TimeWindow{10, math.MaxInt64}, true},
+		{[]string{"", "10"}, TimeWindow{0, 10}, true},
+		{[]string{"10", "10"}, TimeWindow{10, 10}, true},
+		{[]string{"11", "10"}, TimeWindow{}, false},
+		{[]string{"-1"}, TimeWindow{}, false},
+		{[]string{"", "now"}, TimeWindow{}, false},
+	}
+
+	for _, test := range tests {
+		window, err := ParseTimeWindow(test.args)
+		if (err == nil) != test.ok || window != test.expected {
+			t.Errorf("%v: expected %+v (ok %t), got %+v, %v", test.args, test.expected, test.ok, window, err)
+		}
+	}
+
+	if window := (TimeWindow{10, 20}); !window.Contains(10) || !window.Contains(20) || window.Contains(21) {
+		t.Errorf("expected %+v to contain its bounds only", window)
+	}
+}
+
+func TestParseExport(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected Export
+		ok       bool
+	}{
+		{[]string{}, Export{PageSize: DefaultPageSize}, true},
+		{[]string{"10", "p20", "true"}, Export{10, "p20", true}, true},
+		{[]string{"", "", "false"}, Export{PageSize: DefaultPageSize}, true},
+		{[]string{"0"}, Export{}, false},
+		{[]string{"1001"}, Export{}, false},
+		{[]string{"10", "p0", "yes"}, Export{}, false},
+	}
+
+	for _, test := range tests {
+		export, err := ParseExport(test.args)
+		if (err == nil) != test.ok || export != test.expected {
+			t.Errorf("%v: expected %+v (ok %t), got %+v, %v", test.args, test.expected, test.ok, export, err)
+		}
+	}
+}
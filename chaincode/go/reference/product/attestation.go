@@ -0,0 +1,112 @@
+package product
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+
+	"attestation"
+)
+
+const (
+	// queryChaincodeName is the system chaincode that reads blocks of the channel ledger
+	queryChaincodeName = "qscc"
+	maxNonceLength     = 256
+)
+
+// newAttestation states who owns the product and since when. The nonce is the challenge of the party the
+// attestation is for.
+func newAttestation(stub shim.ChaincodeStubInterface, product *Product, nonce string) (attestation.Attestation,
+	error) {
+	if len(nonce) > maxNonceLength || !utf8.ValidString(nonce) {
+		return attestation.Attestation{}, errors.New(fmt.Sprintf(
+			"nonce is invalid: must be a UTF-8 string of up to %d bytes", maxNonceLength))
+	}
+
+	txId, timestamp, err := product.ownedSince(stub)
+	if err != nil {
+		return attestation.Attestation{}, err
+	}
+
+	issued, err := stub.GetTxTimestamp()
+	if err != nil {
+		return attestation.Attestation{}, err
+	}
+
+	return attestation.Attestation{Product: product.Key.Name, Owner: product.Value.Owner, TxId: txId,
+		Timestamp: timestamp, Block: blockReference(stub, txId), Channel: stub.GetChannelID(), Nonce: nonce,
+		Issued: issued.Seconds}, nil
+}
+
+// ownedSince finds the transaction that made the current owner of the product its owner: the first of the latest
+// run of versions with that owner
+func (product *Product) ownedSince(stub shim.ChaincodeStubInterface) (string, int64, error) {
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return "", 0, err
+	}
+
+	it, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return "", 0, err
+	}
+	defer it.Close()
+
+	owner, txId, timestamp := "", "", int64(0)
+	for it.HasNext() {
+		modification, err := it.Next()
+		if err != nil {
+			return "", 0, err
+		}
+
+		if modification.IsDelete {
+			owner = ""
+			continue
+		}
+
+		var value ProductValue
+		if err := json.Unmarshal(modification.Value, &value); err != nil {
+			return "", 0, err
+		}
+		if value.Owner == owner {
+			continue
+		}
+
+		owner, txId = value.Owner, modification.TxId
+		if modification.Timestamp != nil {
+			timestamp = modification.Timestamp.Seconds
+		}
+	}
+
+	if owner != product.Value.Owner {
+		return "", 0, errors.New(fmt.Sprintf("history of product %s doesn't end with its owner %s",
+			product.Key.Name, product.Value.Owner))
+	}
+
+	return txId, timestamp, nil
+}
+
+// blockReference reads the block of the transaction from the ledger of the channel. The transaction of the
+// proposal is not in a block yet, nor is the history of a peer that doesn't keep one, so the reference is optional.
+func blockReference(stub shim.ChaincodeStubInterface, txId string) *attestation.BlockReference {
+	response := stub.InvokeChaincode(queryChaincodeName,
+		[][]byte{[]byte("GetBlockByTxID"), []byte(stub.GetChannelID()), []byte(txId)}, "")
+	if response.Status >= shim.ERRORTHRESHOLD {
+		logger.Info(fmt.Sprintf("cannot find the block of transaction %s: %s", txId, response.Message))
+		return nil
+	}
+
+	var block common.Block
+	if err := proto.Unmarshal(response.Payload, &block); err != nil || block.GetHeader() == nil {
+		logger.Info(fmt.Sprintf("cannot read the block of transaction %s", txId))
+		return nil
+	}
+
+	return &attestation.BlockReference{Number: block.Header.Number, Hash: hex.EncodeToString(block.Header.Hash())}
+}
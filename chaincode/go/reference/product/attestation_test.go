@@ -0,0 +1,127 @@
+package product
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"attestation"
+	"testutil"
+)
+
+// ledgerStub answers GetBlockByTxID of the system chaincode with the block number a transaction is in
+type ledgerStub struct {
+	blocks map[string]uint64
+}
+
+func (q *ledgerStub) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (q *ledgerStub) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	args := stub.GetStringArgs()
+	if args[0] != "GetBlockByTxID" {
+		return shim.Error("unexpected function " + args[0])
+	}
+
+	number, ok := q.blocks[args[2]]
+	if !ok {
+		return shim.Error("no such transaction ID in the index")
+	}
+
+	result, err := proto.Marshal(newBlock(number))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(result)
+}
+
+func newBlock(number uint64) *common.Block {
+	return &common.Block{Header: &common.BlockHeader{Number: number, PreviousHash: []byte("previous"),
+		DataHash: []byte("data")}}
+}
+
+func deployQuery(stub *testutil.MockStub, blocks map[string]uint64) {
+	stub.MockPeerChaincode(queryChaincodeName, shim.NewMockStub(queryChaincodeName, &ledgerStub{blocks: blocks}))
+}
+
+func attest(t *testing.T, stub *testutil.MockStub, id *testutil.Identity, args ...string) attestation.Attestation {
+	response := stub.MockInvokeAs(id, "attest", testutil.Args(append([]string{"attestOwnership"}, args...)...))
+	if response.Status >= 400 {
+		t.Fatalf("attestOwnership failed: %s", response.Message)
+	}
+
+	var statement attestation.Attestation
+	if err := json.Unmarshal(response.Payload, &statement); err != nil {
+		t.Fatalf("cannot unmarshal attestation: %s", err.Error())
+	}
+	return statement
+}
+
+func TestAttestOwnership(t *testing.T) {
+	stub := contractStub(t)
+	a, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate identity of a: %s", err.Error())
+	}
+	b, err := testutil.NewIdentity("b")
+	if err != nil {
+		t.Fatalf("cannot generate identity of b: %s", err.Error())
+	}
+
+	// a later change that keeps the owner doesn't move the start of the ownership
+	if response := stub.MockInvoke("tx4", testutil.Args("updateProduct", "p1", "first product", "2", "b",
+		"400")); response.Status >= 400 {
+		t.Fatalf("updateProduct failed: %s", response.Message)
+	}
+
+	// no block index: the attestation comes without the reference
+	statement := attest(t, stub, b, "p1", "challenge")
+	expected := attestation.Attestation{Product: "p1", Owner: "b", TxId: "tx3", Timestamp: 1519905780,
+		Nonce: "challenge", Issued: statement.Issued}
+	if statement != expected || statement.Issued <= statement.Timestamp {
+		t.Errorf("expected %+v, got %+v", expected, statement)
+	}
+
+	deployQuery(stub, map[string]uint64{"tx3": 12})
+	statement = attest(t, stub, b, "p1")
+	if statement.Block == nil || statement.Block.Number != 12 ||
+		statement.Block.Hash != hex.EncodeToString(newBlock(12).Header.Hash()) {
+		t.Errorf("expected a reference to block 12, got %+v", statement.Block)
+	}
+
+	for _, test := range []struct {
+		id       *testutil.Identity
+		args     []string
+		expected int32
+	}{
+		{a, []string{"p1"}, 403},
+		{b, []string{"p3"}, 404},
+		{b, []string{}, 500},
+		{b, []string{"p1", "\xff"}, 500},
+	} {
+		response := stub.MockInvokeAs(test.id, "attest", testutil.Args(append([]string{"attestOwnership"},
+			test.args...)...))
+		if response.Status != test.expected {
+			t.Errorf("%q: expected status %d, got %d: %s", test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	// an owner that sold the product and bought it back owns it since the second purchase
+	for i, step := range [][]string{{"b", "a"}, {"a", "b"}} {
+		if response := stub.MockInvoke(fmt.Sprintf("tx%d", 5+i), testutil.Args("updateOwner", "p1", step[0], step[1],
+			"500")); response.Status >= 400 {
+			t.Fatalf("updateOwner failed: %s", response.Message)
+		}
+	}
+	if statement := attest(t, stub, b, "p1"); statement.TxId != "tx6" {
+		t.Errorf("expected the ownership since tx6, got %+v", statement)
+	}
+}
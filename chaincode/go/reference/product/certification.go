@@ -0,0 +1,175 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const certificationIndex = "Certification"
+
+// Certification is a certificate, e.g. organic, CE or GMP, or the result of an inspection, issued for a product by
+// an organization with the auditor role. It is valid from ValidFrom until ValidTo, in Unix seconds, unless revoked.
+// Document is the hash of the certificate or the inspection report attached to the product, if any.
+type Certification struct {
+	ID         string      `json:"id"`
+	Product    string      `json:"product"`
+	Type       string      `json:"type"`
+	Scope      string      `json:"scope"`
+	Issuer     string      `json:"issuer"`
+	ValidFrom  int64       `json:"validFrom"`
+	ValidTo    int64       `json:"validTo"`
+	Document   string      `json:"document,omitempty"`
+	TxId       string      `json:"txId"`
+	Timestamp  int64       `json:"timestamp"`
+	Revocation *Revocation `json:"revocation,omitempty"`
+}
+
+// Revocation tells why and when the issuer revoked a certification
+type Revocation struct {
+	Reason    string `json:"reason"`
+	TxId      string `json:"txId"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// certifiedProduct is the response of readProduct: the product with its certifications valid at the time of the
+// transaction
+type certifiedProduct struct {
+	Key            ProductKey      `json:"key"`
+	Value          ProductValue    `json:"value"`
+	Certifications []Certification `json:"certifications"`
+}
+
+// parseCertificationType reads the type of a certification, in lower case so that "GMP" and "gmp" are one type
+func parseCertificationType(s string) (string, error) {
+	if len(s) == 0 || !isValidKeyPart(s) {
+		return "", errors.New("certification type must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+	}
+
+	return strings.ToLower(s), nil
+}
+
+// parseValidity reads the validity period of a certification. An empty start is the time of the transaction.
+func parseValidity(from, to string, now int64) (int64, int64, error) {
+	validFrom := now
+	if len(from) > 0 {
+		value, err := strconv.ParseInt(from, 10, 64)
+		if err != nil || value < 0 {
+			return 0, 0, errors.New(fmt.Sprintf("start of validity is invalid: %s (must be Unix seconds)", from))
+		}
+		validFrom = value
+	}
+
+	validTo, err := strconv.ParseInt(to, 10, 64)
+	if err != nil || validTo <= validFrom {
+		return 0, 0, errors.New(fmt.Sprintf("end of validity is invalid: %s (must be Unix seconds after %d)", to,
+			validFrom))
+	}
+
+	return validFrom, validTo, nil
+}
+
+// parseScope reads what a certification covers, e.g. a site or a process
+func parseScope(s string) (string, error) {
+	if len(s) == 0 || !utf8.ValidString(s) {
+		return "", errors.New("certification scope must be a non-empty UTF-8 string")
+	}
+
+	return s, nil
+}
+
+func certificationKey(stub shim.ChaincodeStubInterface, productName, id string) (string, error) {
+	return stub.CreateCompositeKey(certificationIndex, []string{productName, id})
+}
+
+// loadCertification reads the certification of the product, nil if there is none with the id
+func loadCertification(stub shim.ChaincodeStubInterface, productName, id string) (*Certification, error) {
+	key, err := certificationKey(stub, productName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var certification Certification
+	if err := json.Unmarshal(data, &certification); err != nil {
+		return nil, err
+	}
+
+	return &certification, nil
+}
+
+func (certification *Certification) store(stub shim.ChaincodeStubInterface) error {
+	key, err := certificationKey(stub, certification.Product, certification.ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(certification)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// isValidAt tells if the certification is in its validity period and not revoked at the time
+func (certification *Certification) isValidAt(t int64) bool {
+	return certification.Revocation == nil && certification.ValidFrom <= t && t < certification.ValidTo
+}
+
+// listCertifications returns the certifications of the product in the order they were issued
+func listCertifications(stub shim.ChaincodeStubInterface, productName string) ([]Certification, error) {
+	it, err := stub.GetStateByPartialCompositeKey(certificationIndex, []string{productName})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	certifications := []Certification{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var certification Certification
+		if err := json.Unmarshal(response.Value, &certification); err != nil {
+			return nil, err
+		}
+		certifications = append(certifications, certification)
+	}
+
+	// the index goes by id
+	sort.SliceStable(certifications, func(i, j int) bool {
+		return certifications[i].Timestamp < certifications[j].Timestamp
+	})
+
+	return certifications, nil
+}
+
+// validCertifications returns the certifications of the product valid at the time
+func validCertifications(stub shim.ChaincodeStubInterface, productName string, t int64) ([]Certification, error) {
+	certifications, err := listCertifications(stub, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := []Certification{}
+	for _, certification := range certifications {
+		if certification.isValidAt(t) {
+			valid = append(valid, certification)
+		}
+	}
+
+	return valid, nil
+}
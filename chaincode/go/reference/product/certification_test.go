@@ -0,0 +1,148 @@
+package product
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"testutil"
+)
+
+func TestParseValidity(t *testing.T) {
+	if from, to, err := parseValidity("", "2000", 1000); err != nil || from != 1000 || to != 2000 {
+		t.Errorf("expected validity from the transaction time, got %d..%d (%v)", from, to, err)
+	}
+	if from, to, err := parseValidity("500", "2000", 1000); err != nil || from != 500 || to != 2000 {
+		t.Errorf("expected validity from 500, got %d..%d (%v)", from, to, err)
+	}
+
+	for _, bounds := range [][]string{{"", ""}, {"", "1000"}, {"-1", "2000"}, {"3000", "2000"}, {"x", "2000"}} {
+		if _, _, err := parseValidity(bounds[0], bounds[1], 1000); err == nil {
+			t.Errorf("expected an error for %q", bounds)
+		}
+	}
+}
+
+func TestAuditors(t *testing.T) {
+	stub := getInitializedStub(t)
+
+	auditors := func() []string {
+		response := stub.MockInvoke("auditors", testutil.Args("getAuditors"))
+		var auditors []string
+		if err := json.Unmarshal(response.Payload, &auditors); err != nil {
+			t.Fatalf("cannot unmarshal auditors: %s", err.Error())
+		}
+		return auditors
+	}
+
+	if registered := auditors(); len(registered) != 0 {
+		t.Errorf("expected no auditors, got %v", registered)
+	}
+
+	for _, test := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"init", "auditors", "Regulator", "lab"}, []string{"lab", "regulator"}},
+		{[]string{"init", "a", "100", "b", "100"}, []string{"lab", "regulator"}},
+		{[]string{"init"}, []string{"lab", "regulator"}},
+		{[]string{"init", "auditors", "lab"}, []string{"lab"}},
+	} {
+		if response := stub.MockInit("upgrade", testutil.Args(test.args...)); response.Status >= 400 {
+			t.Fatalf("init failed: %s", response.Message)
+		}
+		if registered := auditors(); !reflect.DeepEqual(registered, test.expected) {
+			t.Errorf("%v: expected auditors %v, got %v", test.args, test.expected, registered)
+		}
+	}
+
+	if response := stub.MockInit("upgrade", testutil.Args("init", "auditors", "")); response.Status < 400 {
+		t.Error("expected an error for an empty organization")
+	}
+}
+
+func TestCertification(t *testing.T) {
+	stub := getInitializedStub(t)
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+	const hash = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	identities := testutil.NewIdentities(t, "a", "lab", "regulator")
+
+	if response := stub.MockInit("upgrade", testutil.Args("init", "auditors", "lab", "regulator")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+	if response := stub.MockInvoke("tx1", testutil.Args("initProduct", "p1", "desc", "1", "a", "100")); response.Status >= 400 {
+		t.Fatalf("initProduct failed: %s", response.Message)
+	}
+
+	// organic is valid now, GMP from 5000 on, CE until 1013
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"a", []string{"issueCertification", "p1", "c1", "organic", "farm 7", "", "100000"}, 403},
+		{"lab", []string{"issueCertification", "p2", "c1", "organic", "farm 7", "", "100000"}, 404},
+		{"lab", []string{"issueCertification", "p1", "c1", "", "farm 7", "", "100000"}, 500},
+		{"lab", []string{"issueCertification", "p1", "c1", "organic", "", "", "100000"}, 500},
+		{"lab", []string{"issueCertification", "p1", "c1", "organic", "farm 7", "", "10"}, 500},
+		{"lab", []string{"issueCertification", "p1", "c1", "organic", "farm 7", "", "100000", "not a hash"}, 500},
+		{"lab", []string{"issueCertification", "p1", "c1", "Organic", "farm 7", "", "100000", hash}, 200},
+		{"lab", []string{"issueCertification", "p1", "c1", "organic", "farm 7", "", "100000"}, 409},
+		{"regulator", []string{"issueCertification", "p1", "c2", "GMP", "plant 2", "5000", "100000"}, 200},
+		{"regulator", []string{"issueCertification", "p1", "c3", "CE", "machine", "", "1013"}, 200},
+		{"regulator", []string{"issueCertification", "p1", "c4", "inspection", "batch 12 passed", "", "100000"}, 200},
+		{"lab", []string{"revokeCertification", "p1", "c4", "sample mix-up"}, 403},
+		{"regulator", []string{"revokeCertification", "p1", "c5", "sample mix-up"}, 404},
+		{"regulator", []string{"revokeCertification", "p1", "c4", ""}, 500},
+		{"regulator", []string{"revokeCertification", "p1", "c4", "sample mix-up"}, 200},
+		{"regulator", []string{"revokeCertification", "p1", "c4", "sample mix-up"}, 409},
+		{"a", []string{"listCertifications", "p2"}, 404},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "certify", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	// the clock is past 1013 by now
+	response := stub.MockInvoke("read", testutil.Args("readProduct", "p1"))
+	var product certifiedProduct
+	if err := json.Unmarshal(response.Payload, &product); err != nil {
+		t.Fatalf("cannot unmarshal product: %s", err.Error())
+	}
+	if product.Value.Owner != "a" || len(product.Certifications) != 1 || product.Certifications[0].ID != "c1" ||
+		product.Certifications[0].Type != "organic" || product.Certifications[0].Document != hash ||
+		product.Certifications[0].Issuer != "lab" {
+		t.Errorf("expected the product with the organic certification only, got %+v", product)
+	}
+
+	response = stub.MockInvoke("list", testutil.Args("listCertifications", "p1"))
+	var certifications []Certification
+	if err := json.Unmarshal(response.Payload, &certifications); err != nil {
+		t.Fatalf("cannot unmarshal certifications: %s", err.Error())
+	}
+	ids := []string{}
+	for _, certification := range certifications {
+		ids = append(ids, certification.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"c1", "c2", "c3", "c4"}) {
+		t.Errorf("expected all certifications in the order they were issued, got %v", ids)
+	}
+	if revocation := certifications[3].Revocation; revocation == nil || revocation.Reason != "sample mix-up" {
+		t.Errorf("expected c4 revoked, got %+v", certifications[3])
+	}
+
+	// GMP becomes valid later
+	stub.Now = testutil.FixedClock(time.Unix(6000, 0), time.Second)
+	response = stub.MockInvoke("read", testutil.Args("readProduct", "p1"))
+	if err := json.Unmarshal(response.Payload, &product); err != nil {
+		t.Fatalf("cannot unmarshal product: %s", err.Error())
+	}
+	if len(product.Certifications) != 2 || product.Certifications[1].Type != "gmp" {
+		t.Errorf("expected the organic and GMP certifications, got %+v", product.Certifications)
+	}
+}
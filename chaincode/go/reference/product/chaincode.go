@@ -0,0 +1,2378 @@
+// Package product implements the reference chaincode deployed to the common channel: the registry of products
+// and their owners. It is a library so that other chaincodes can run it in-process in their tests.
+package product
+
+import (
+	"strconv"
+	"encoding/json"
+	"fmt"
+	"time"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/pem"
+	"crypto/x509"
+	"strings"
+	"unicode/utf8"
+	"document"
+	"params"
+)
+
+var logger = shim.NewLogger("ProductChaincode")
+
+// ProductChaincode example simple Chaincode implementation
+type ProductChaincode struct {
+}
+
+// Init initializes chaincode. The arguments "auditors" org... register the organizations with the auditor role and
+// "admins" org... the ones with the admin role, replacing the ones there were; a role not given, e.g. on upgrade,
+// keeps its organizations.
+// ===========================
+func (t *ProductChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	logger.Debug("Init")
+
+	_, args := stub.GetFunctionAndParameters()
+	for role, orgs := range parseInitRoles(args) {
+		if err := storeRole(stub, role, orgs); err != nil {
+			return shim.Error(err.Error())
+		}
+		logger.Info(role + " organizations are " + strings.Join(orgs, ", "))
+	}
+
+	return shim.Success(nil)
+}
+
+// Invoke - Our entry point for Invocations
+// ========================================
+func (t *ProductChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	logger.Debug("Invoke")
+
+	function, args := stub.GetFunctionAndParameters()
+	logger.Debug("invoke is running " + function)
+
+	// Handle different functions
+	if function == "initProduct" { //create a new product
+		return t.initProduct(stub, args)
+	} else if function == "updateProduct" { //update an existing product
+		return t.updateProduct(stub, args)
+	} else if function == "updateOwner" { //update an owner of an existing product
+		return t.updateOwner(stub, args)
+	} else if function == "readProduct" { //read a product
+		return t.readProduct(stub, args)
+	} else if function == "queryProductsByOwner" { //find products for the owner X using rich query
+		return t.queryProductsByOwner(stub, args)
+	} else if function == "queryProductsByState" { //find products in the state X using rich query
+		return t.queryProductsByState(stub, args)
+	} else if function == "queryProducts" { //find products based on an ad hoc rich query
+		return t.queryProducts(stub, args)
+	} else if function == "getHistoryForProduct" { //get history of values for a product
+		return t.getHistoryForProduct(stub, args)
+	} else if function == "getCustodyTrail" { //get owners of a product with the transfers between them
+		return t.getCustodyTrail(stub, args)
+	} else if function == "getInventorySnapshot" { //find products an owner held at a given time by history replay
+		return t.getInventorySnapshot(stub, args)
+	} else if function == "exportProducts" { //page through all products, with their history on request
+		return t.exportProducts(stub, args)
+	} else if function == "getProductStatistics" { //count products per state and per owner
+		return t.getProductStatistics(stub, args)
+	} else if function == "productsChangedSince" { //page through product changes in time order
+		return t.productsChangedSince(stub, args)
+	} else if function == "reindexProducts" { //set docType and rebuild indexes of products written by older versions
+		return t.reindexProducts(stub, args)
+	} else if function == "attachDocument" { //anchor the hash of an off-chain document of a product
+		return t.attachDocument(stub, args)
+	} else if function == "listDocuments" { //list documents attached to a product
+		return t.listDocuments(stub, args)
+	} else if function == "verifyDocument" { //check the hash of a file against documents of a product
+		return t.verifyDocument(stub, args)
+	} else if function == "attestOwnership" { //state who owns a product since when, for a third party
+		return t.attestOwnership(stub, args)
+	} else if function == "assignLot" { //record the GTIN and the lot a product was made in
+		return t.assignLot(stub, args)
+	} else if function == "initRecall" { //recall the products of a lot or a list of products
+		return t.initRecall(stub, args)
+	} else if function == "readRecall" { //read a recall with the products it affected
+		return t.readRecall(stub, args)
+	} else if function == "createShipment" { //put products in the custody of a shipment
+		return t.createShipment(stub, args)
+	} else if function == "handOverShipment" { //offer custody of a shipment to another organization
+		return t.handOverShipment(stub, args)
+	} else if function == "acceptShipment" { //take custody of a shipment offered to the caller
+		return t.acceptShipment(stub, args)
+	} else if function == "readShipment" { //read a shipment with its legs and handoffs
+		return t.readShipment(stub, args)
+	} else if function == "getProductCustody" { //tell who holds a product and where
+		return t.getProductCustody(stub, args)
+	} else if function == "queryProductsByCustodian" { //find products held by the custodian X
+		return t.queryProductsByCustodian(stub, args)
+	} else if function == "setThresholdRule" { //bound a sensor metric for the products of a GTIN
+		return t.setThresholdRule(stub, args)
+	} else if function == "readThresholdRules" { //read the sensor bounds of a GTIN
+		return t.readThresholdRules(stub, args)
+	} else if function == "recordReadings" { //append sensor readings of a product or a shipment
+		return t.recordReadings(stub, args)
+	} else if function == "listReadings" { //list sensor readings of a product or a shipment
+		return t.listReadings(stub, args)
+	} else if function == "listBreaches" { //list threshold breaches of a product
+		return t.listBreaches(stub, args)
+	} else if function == "clearHold" { //release a product from quality hold
+		return t.clearHold(stub, args)
+	} else if function == "getAuditors" { //list the organizations with the auditor role
+		return t.getAuditors(stub, args)
+	} else if function == "issueCertification" { //certify a product or record an inspection, by an auditor
+		return t.issueCertification(stub, args)
+	} else if function == "revokeCertification" { //revoke a certification by its issuer
+		return t.revokeCertification(stub, args)
+	} else if function == "listCertifications" { //list certifications of a product, revoked and expired ones too
+		return t.listCertifications(stub, args)
+	} else if function == "transform" { //consume input products and create output products made of them
+		return t.transform(stub, args)
+	} else if function == "readTransformation" { //read a transformation with its inputs and outputs
+		return t.readTransformation(stub, args)
+	} else if function == "traceBackward" { //walk the lineage of a product back to what it was made of
+		return t.traceBackward(stub, args)
+	} else if function == "traceForward" { //walk the lineage of a product forward to what was made of it
+		return t.traceForward(stub, args)
+	} else if function == "setQuantity" { //record the quantity and the unit of measure of bulk goods
+		return t.setQuantity(stub, args)
+	} else if function == "splitLot" { //divide a lot into child lots whose quantities sum to it
+		return t.splitLot(stub, args)
+	} else if function == "mergeLots" { //combine compatible lots into one
+		return t.mergeLots(stub, args)
+	}
+
+	logger.Debug("invoke did not find func: " + function) //error
+	return pb.Response{Status: 403, Message: "Invalid invoke function name."}
+}
+
+// ============================================================
+// initProduct - create a new product, store into chaincode state
+// ============================================================
+func (t *ProductChaincode) initProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var product Product
+	if err := product.FillFromArguments(args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if product.ExistsIn(stub) {
+		compositeKey, _ := product.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("product with the key %s already exists", compositeKey))
+	}
+
+	// TODO: set owner from GetCreatorOrg
+	product.Value.State = stateRegistered
+
+	if err := product.applyEncryption(stub, nil); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// updateProduct - update an existing product, store into chaincode state
+// ============================================================
+func (t *ProductChaincode) updateProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var product, productToUpdate Product
+	if err := product.FillFromArguments(args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	productToUpdate.Key = product.Key
+
+	if !productToUpdate.ExistsIn(stub) {
+		compositeKey, _ := productToUpdate.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("product with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := productToUpdate.LoadFrom(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if !checkStateValidity(productStateMachine, productToUpdate.Value.State, product.Value.State) {
+		return shim.Error(fmt.Sprintf("product state cannot be updated from %d to %d",
+			productToUpdate.Value.State, product.Value.State))
+	}
+
+	// TODO; check if creator == productToUpdate owner
+	if productToUpdate.Value.Owner != product.Value.Owner {
+		return shim.Error(fmt.Sprintf("ownership cannot be transferred via product updating (from %s to %s)",
+			productToUpdate.Value.Owner, product.Value.Owner))
+	}
+
+	previous := productToUpdate.Value
+	productToUpdate.Value.Desc = product.Value.Desc
+	productToUpdate.Value.State = product.Value.State
+	productToUpdate.Value.LastUpdated = product.Value.LastUpdated
+
+	if err := productToUpdate.applyEncryption(stub, &previous); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := productToUpdate.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ===============================================
+// readProduct - read a product from chaincode state
+// ===============================================
+func (t *ProductChaincode) readProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < keyFieldsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			keyFieldsNumber, len(args)))
+	}
+
+	var product Product
+	if err := product.FillFromCompositeKeyParts(args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if !product.ExistsIn(stub) {
+		compositeKey, _ := product.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("product with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := product.LoadFrom(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	c.decrypt(product.Key, &product.Value)
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	certifications, err := validCertifications(stub, product.Key.Name, timestamp.Seconds)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(certifiedProduct{Key: product.Key, Value: product.Value, Certifications: certifications})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ===== Parameterized rich query =========================================================
+// queryProductsByOwner queries for products based on a passed in owner.
+// The query logic is baked into the chaincode, see productQuery for the optional arguments:
+// page size, bookmark, sort order and fields to return.
+// Runs on CouchDB with the bundled indexes and falls back to the owner~name index on LevelDB.
+// =========================================================================================
+func (t *ProductChaincode) queryProductsByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.queryProductsByField(stub, "owner", args)
+}
+
+// queryProductsByState is the same as queryProductsByOwner but for a state of products.
+func (t *ProductChaincode) queryProductsByState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.queryProductsByField(stub, "state", args)
+}
+
+// queryProductsByCustodian is the same as queryProductsByOwner but for the organization holding shipped products.
+func (t *ProductChaincode) queryProductsByCustodian(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.queryProductsByField(stub, "custodian", args)
+}
+
+func (t *ProductChaincode) queryProductsByField(stub shim.ChaincodeStubInterface, field string,
+	args []string) pb.Response {
+	query, err := parseProductQuery(field, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if query.Cipher, err = transientFieldCipher(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	page, err := query.Execute(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// =======Rich queries =========================================================================
+// Two examples of rich queries are provided below (parameterized query and ad hoc query).
+// Rich queries pass a query string to the state database.
+// Rich queries are only supported by state database implementations
+//  that support rich query (e.g. CouchDB).
+// The query string is in the syntax of the underlying state database.
+// With rich queries there is no guarantee that the result set hasn't changed between
+//  endorsement time and commit time, aka 'phantom reads'.
+// Therefore, rich queries should not be used in update transactions, unless the
+// application handles the possibility of result set changes between endorsement and commit time.
+// Rich queries can be used for point-in-time queries against a peer.
+// ============================================================================================
+
+// ===== Example: Ad hoc rich query ========================================================
+// queryProducts uses a query string to perform a query for products.
+// Query string matching state database syntax is passed in and executed as is.
+// Supports ad hoc queries that can be defined at runtime by the client.
+// If this is not desired, follow the queryProductsForOwner example for parameterized queries.
+// Only available on state databases that support rich query (e.g. CouchDB)
+// =========================================================================================
+func (t *ProductChaincode) queryProducts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(productIndex, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer it.Close()
+
+	entries := []Product{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entry := Product{}
+
+		if err := entry.FillFromLedgerValue(response.Value); err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if err := entry.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return shim.Error(err.Error())
+		}
+		c.decrypt(entry.Key, &entry.Value)
+
+		entries = append(entries, entry)
+	}
+
+	result, err := json.Marshal(entries)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// productHistory is an entry of getHistoryForProduct response
+type productHistory struct {
+	Value ProductValue `json:"value"`
+	TxId string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete bool `json:"isDelete"`
+}
+
+func (t *ProductChaincode) getHistoryForProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var product Product
+	if err := product.FillFromCompositeKeyParts(args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	entries := []productHistory{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entry := productHistory{}
+
+		if err := json.Unmarshal(response.Value, &entry.Value); err != nil {
+			return shim.Error(err.Error())
+		}
+		c.decrypt(product.Key, &entry.Value)
+
+		entry.TxId = response.TxId
+		entry.Timestamp = time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String()
+		entry.IsDelete = response.IsDelete
+
+		entries = append(entries, entry)
+	}
+
+	result, err := json.Marshal(entries)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// getCustodyTrail - list owners of a product in order, each with the accepted transfer from the previous one
+// ============================================================
+func (t *ProductChaincode) getCustodyTrail(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var product Product
+	if err := product.FillFromCompositeKeyParts(args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historyIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer historyIterator.Close()
+
+	tracer := newCustodyTracer(stub, product.Key.Name)
+	if err := tracer.trace(historyIterator); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(tracer.trail.Entries) == 0 {
+		return pb.Response{Status: 404, Message: fmt.Sprintf("product with the key %s doesn't exist", compositeKey)}
+	}
+
+	result, err := json.Marshal(tracer.trail)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// getInventorySnapshot - replay history of every product to find what owners held as of the given time
+// ============================================================
+func (t *ProductChaincode) getInventorySnapshot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//     0        1
+	// timestamp, [owner]
+	const expectedArgumentsNumber = 1
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	asOf, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || asOf < 0 {
+		return shim.Error(fmt.Sprintf("snapshot time is invalid: %s (must be non-negative int)", args[0]))
+	}
+
+	owner := ""
+	if len(args) > 1 {
+		owner = strings.ToLower(args[1])
+	}
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	replay := NewInventoryReplay(asOf, owner)
+
+	// products are never deleted from the state, so the current keys are the keys of all products ever registered
+	it, err := stub.GetStateByPartialCompositeKey(productIndex, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var product Product
+		if err := product.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return shim.Error(err.Error())
+		}
+
+		historyIterator, err := stub.GetHistoryForKey(response.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		for historyIterator.HasNext() {
+			modification, err := historyIterator.Next()
+			if err != nil {
+				historyIterator.Close()
+				return shim.Error(err.Error())
+			}
+
+			entry := ProductModification{Key: product.Key, TxId: modification.TxId, IsDelete: modification.IsDelete}
+			if modification.Timestamp != nil {
+				entry.Timestamp = modification.Timestamp.Seconds
+			}
+			if entry.Timestamp > asOf {
+				// history goes from the oldest modification, the rest is later still
+				break
+			}
+			if !modification.IsDelete {
+				if err := json.Unmarshal(modification.Value, &entry.Value); err != nil {
+					historyIterator.Close()
+					return shim.Error(err.Error())
+				}
+				c.decrypt(product.Key, &entry.Value)
+			}
+
+			replay.Apply(entry)
+		}
+		historyIterator.Close()
+	}
+
+	result, err := json.Marshal(replay.Snapshot())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// exportProducts - read a page of all products in the order of their keys for an extract
+// ============================================================
+func (t *ProductChaincode) exportProducts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	export, err := params.ParseExport(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	page, err := exportRequest{Export: export, Cipher: c}.Execute(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// getProductStatistics - count products last updated within an optional window by state and by owner
+// ============================================================
+func (t *ProductChaincode) getProductStatistics(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0       1
+	// [from], [to] in seconds of transaction time
+	window, err := params.ParseTimeWindow(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	statistics, err := collectProductStatistics(stub, window)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(statistics)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// productsChangedSince - read changes of products from a time or a cursor on, for incremental sync
+// ============================================================
+func (t *ProductChaincode) productsChangedSince(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	request, err := parseChangesRequest(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if request.Cipher, err = transientFieldCipher(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	page, err := request.Execute(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// reindexProducts rewrites a page of products, so the ones stored before docType and the composite-key indexes were
+// maintained become visible to queryProductsByOwner and queryProductsByState. Only organizations with the admin role
+// may run it. It is safe to run more than once.
+func (t *ProductChaincode) reindexProducts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//     0           1
+	// [pageSize], [bookmark]
+	creator := GetCreatorOrganization(stub)
+	if admin, err := hasRole(stub, roleAdmin, creator); err != nil {
+		return shim.Error(err.Error())
+	} else if !admin {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to reindex products: organization %s is not an admin", creator)}
+	}
+
+	pageSize := defaultPageSize
+	if len(args) > 0 && len(args[0]) > 0 {
+		var err error
+		if pageSize, err = strconv.Atoi(args[0]); err != nil || pageSize <= 0 || pageSize > maxPageSize {
+			return shim.Error(fmt.Sprintf("page size is invalid: %s (must be from 1 to %d)", args[0], maxPageSize))
+		}
+	}
+	bookmark := ""
+	if len(args) > 1 {
+		bookmark = args[1]
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(productIndex, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer it.Close()
+
+	page := reindexPage{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entry := Product{}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if err := entry.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// the bookmark is the last product of the previous page, keys come in the order of the names
+		if entry.Key.Name <= bookmark {
+			continue
+		}
+		if page.Reindexed == pageSize {
+			page.Bookmark = bookmark
+			break
+		}
+
+		if err := entry.FillFromLedgerValue(response.Value); err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if err := entry.UpdateOrInsertIn(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+		page.Reindexed++
+		bookmark = entry.Key.Name
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// attachDocument - store the hash and metadata of a document of the product, e.g. a certificate of origin
+// ============================================================
+func (t *ProductChaincode) attachDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0         1     2       3       4
+	// productName, hash, type, issuer, [uri]
+	const expectedArgumentsNumber = keyFieldsNumber + document.ArgumentsNumber
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	attachment, err := document.ParseDocument(args[keyFieldsNumber:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	attachment.Org = GetCreatorOrganization(stub)
+	if attachment.Org != product.Value.Owner {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to attach documents to a product of %s (caller is from organization %s)",
+			product.Value.Owner, attachment.Org)}
+	}
+
+	if err := document.Attach(stub, product.documentTarget(), &attachment); err == document.ErrAlreadyAttached {
+		return pb.Response{Status: 409, Message: err.Error()}
+	} else if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	product.Value.LastDocument = attachment.Hash
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(attachment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// listDocuments - read documents attached to the product in the order they were attached
+// ============================================================
+func (t *ProductChaincode) listDocuments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	product, response := loadExistingProduct(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	documents, err := document.List(stub, product.documentTarget())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(documents)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// verifyDocument - tell if a file with the hash is attached to the product
+// ============================================================
+func (t *ProductChaincode) verifyDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0         1
+	// productName, hash
+	const expectedArgumentsNumber = keyFieldsNumber + 1
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	hash, err := document.ParseHash(args[keyFieldsNumber])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	verification, err := document.Verify(stub, product.documentTarget(), hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// attestOwnership - state who owns the product and since which transaction, leaving out the owners before.
+// The endorsement of the response by the peer is the signature, see package attestation.
+// ============================================================
+func (t *ProductChaincode) attestOwnership(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0          1
+	// productName, [nonce]
+	product, response := loadExistingProduct(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	if creator := GetCreatorOrganization(stub); creator != product.Value.Owner {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to attest ownership of a product of %s (caller is from organization %s)",
+			product.Value.Owner, creator)}
+	}
+
+	nonce := ""
+	if len(args) > keyFieldsNumber {
+		nonce = args[keyFieldsNumber]
+	}
+
+	statement, err := newAttestation(stub, &product, nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(statement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// assignLot - record the GTIN and the lot of the product, so a recall of the lot finds it. They are set once.
+// ============================================================
+func (t *ProductChaincode) assignLot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0        1     2
+	// productName, gtin, lot
+	const expectedArgumentsNumber = keyFieldsNumber + 2
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	if creator := GetCreatorOrganization(stub); creator != product.Value.Owner {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to assign a lot to a product of %s (caller is from organization %s)",
+			product.Value.Owner, creator)}
+	}
+
+	if len(product.Value.GTIN) > 0 {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is already of lot %s of GTIN %s",
+			product.Key.Name, product.Value.Lot, product.Value.GTIN)}
+	}
+
+	gtin, lot := args[keyFieldsNumber], args[keyFieldsNumber + 1]
+	if err := parseGTIN(gtin); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(lot) == 0 || !isValidKeyPart(lot) {
+		return shim.Error("lot must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+	}
+
+	product.Value.GTIN = gtin
+	product.Value.Lot = lot
+
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// initRecall - move the products of a lot, of every lot of a GTIN if the lot is empty, and the listed products to
+// the recalled state. Only the organization that registered a product may recall it. The recall is stored and
+// emitted as an event with the affected products and their owners. Transfers of recalled products are refused.
+// ============================================================
+func (t *ProductChaincode) initRecall(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//    0        1      2     3          4...
+	// recallId, reason, gtin, lot, [productName...]
+	const expectedArgumentsNumber = 4
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	recall := Recall{ID: args[0], Reason: args[1], GTIN: args[2], Lot: args[3], Products: []RecalledProduct{}}
+	if len(recall.ID) == 0 || !isValidKeyPart(recall.ID) {
+		return shim.Error("recall id must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+	}
+	if len(recall.Reason) == 0 || !utf8.ValidString(recall.Reason) {
+		return shim.Error("recall reason must be a non-empty UTF-8 string")
+	}
+	if len(recall.GTIN) > 0 {
+		if err := parseGTIN(recall.GTIN); err != nil {
+			return shim.Error(err.Error())
+		}
+	} else if len(recall.Lot) > 0 {
+		return shim.Error("lot of a recall must come with its GTIN")
+	}
+	if len(recall.GTIN) == 0 && len(args) == expectedArgumentsNumber {
+		return shim.Error("recall must target a GTIN or products")
+	}
+
+	if existing, err := loadRecall(stub, recall.ID); err != nil {
+		return shim.Error(err.Error())
+	} else if existing != nil {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("recall %s already exists", recall.ID)}
+	}
+
+	targets, err := recall.targets(stub, args[expectedArgumentsNumber:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(targets) == 0 {
+		return pb.Response{Status: 404, Message: fmt.Sprintf("no products of GTIN %s lot %s", recall.GTIN,
+			recall.Lot)}
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recall.Issuer = GetCreatorOrganization(stub)
+	recall.TxId = stub.GetTxID()
+	recall.Timestamp = timestamp.Seconds
+
+	for _, name := range targets {
+		product, response := loadExistingProduct(stub, []string{name})
+		if response != nil {
+			return *response
+		}
+
+		registrant, err := product.registrant(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if registrant != recall.Issuer {
+			return pb.Response{Status: 403, Message: fmt.Sprintf(
+				"no privileges to recall product %s registered by %s (caller is from organization %s)",
+				name, registrant, recall.Issuer)}
+		}
+
+		// a product recalled before stays with that recall
+		if product.Value.State == stateRecalled {
+			continue
+		}
+
+		product.Value.State = stateRecalled
+		product.Value.LastUpdated = int(timestamp.Seconds)
+		if err := product.UpdateOrInsertIn(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+
+		recall.Products = append(recall.Products, RecalledProduct{Name: name, Owner: product.Value.Owner})
+	}
+
+	if len(recall.Products) == 0 {
+		return pb.Response{Status: 409, Message: "all products of the recall are already recalled"}
+	}
+
+	if err := recall.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(recall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// readRecall - read a recall with the products it affected
+// ============================================================
+func (t *ProductChaincode) readRecall(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//    0
+	// recallId
+	if len(args) < 1 {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d", 1, len(args)))
+	}
+
+	recall, err := loadRecall(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if recall == nil {
+		return pb.Response{Status: 404, Message: fmt.Sprintf("recall %s doesn't exist", args[0])}
+	}
+
+	result, err := json.Marshal(recall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// createShipment - put products in the custody of the caller at the origin, to be carried to the destination.
+// The caller must hold every product and none may be in another shipment on the way.
+// ============================================================
+func (t *ProductChaincode) createShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//     0          1         2           3          4...
+	// shipmentId, origin, destination, carrier, productName...
+	const expectedArgumentsNumber = 5
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	if len(args[0]) == 0 || !isValidKeyPart(args[0]) {
+		return shim.Error("shipment id must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+	}
+	for _, location := range args[1:3] {
+		if err := parseLocation(location); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	carrier, err := parseOrganization(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if existing, err := loadShipment(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	} else if existing != nil {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("shipment %s already exists", args[0])}
+	}
+
+	created, err := sign(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	shipment := Shipment{ID: args[0], Shipper: created.Org, Carrier: carrier, Origin: args[1],
+		Destination: args[2], Products: []string{}, Status: shipmentStatusCreated, Custodian: created.Org,
+		Location: args[1], Legs: []ShipmentLeg{{Custodian: created.Org, From: args[1], Started: created.Timestamp}},
+		Handoffs: []Handoff{}, Created: created}
+
+	listed := map[string]bool{}
+	for _, name := range args[expectedArgumentsNumber - 1:] {
+		if listed[name] {
+			continue
+		}
+		listed[name] = true
+
+		product, response := loadExistingProduct(stub, []string{name})
+		if response != nil {
+			return *response
+		}
+
+		if custodian := product.custody().Custodian; custodian != created.Org {
+			return pb.Response{Status: 403, Message: fmt.Sprintf(
+				"no privileges to ship product %s held by %s (caller is from organization %s)",
+				name, custodian, created.Org)}
+		}
+		if product.Value.State == stateRecalled {
+			return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is recalled", name)}
+		}
+		if product.Value.State == stateConsumed {
+			return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is consumed", name)}
+		}
+		if len(product.Value.Shipment) > 0 {
+			previous, err := loadShipment(stub, product.Value.Shipment)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if previous != nil && previous.Status != shipmentStatusDelivered {
+				return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is in shipment %s",
+					name, previous.ID)}
+			}
+		}
+
+		shipment.Products = append(shipment.Products, name)
+	}
+
+	if err := shipment.moveProducts(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := shipment.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// handOverShipment - offer custody of the shipment at a location to another organization. Only the custodian may
+// offer it; a new offer replaces the pending one.
+// ============================================================
+func (t *ProductChaincode) handOverShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//     0           1         2
+	// shipmentId, receiver, location
+	const expectedArgumentsNumber = 3
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	shipment, response := loadExistingShipment(stub, args[0])
+	if response != nil {
+		return *response
+	}
+
+	receiver, err := parseOrganization(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := parseLocation(args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	offered, err := sign(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if offered.Org != shipment.Custodian {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to hand over shipment %s held by %s (caller is from organization %s)",
+			shipment.ID, shipment.Custodian, offered.Org)}
+	}
+	if shipment.Status == shipmentStatusDelivered {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("shipment %s is delivered", shipment.ID)}
+	}
+	if receiver == offered.Org {
+		return shim.Error("custody cannot be handed over to its custodian")
+	}
+
+	shipment.Pending = &Handoff{Location: args[2], From: offered, To: CustodySignature{Org: receiver}}
+
+	if err := shipment.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// acceptShipment - take custody of the shipment offered to the caller, at the location of the offer
+// ============================================================
+func (t *ProductChaincode) acceptShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//     0
+	// shipmentId
+	if len(args) < 1 {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d", 1, len(args)))
+	}
+
+	shipment, response := loadExistingShipment(stub, args[0])
+	if response != nil {
+		return *response
+	}
+
+	accepted, err := sign(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if shipment.Pending == nil {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("shipment %s is not handed over", shipment.ID)}
+	}
+	if accepted.Org != shipment.Pending.To.Org {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to accept shipment %s handed over to %s (caller is from organization %s)",
+			shipment.ID, shipment.Pending.To.Org, accepted.Org)}
+	}
+
+	shipment.accept(accepted)
+
+	if err := shipment.moveProducts(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := shipment.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// readShipment - read a shipment with its legs and handoffs
+// ============================================================
+func (t *ProductChaincode) readShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//     0
+	// shipmentId
+	if len(args) < 1 {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d", 1, len(args)))
+	}
+
+	shipment, response := loadExistingShipment(stub, args[0])
+	if response != nil {
+		return *response
+	}
+
+	result, err := json.Marshal(shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// getProductCustody - tell who holds the product and where, apart from who owns it
+// ============================================================
+func (t *ProductChaincode) getProductCustody(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0
+	// productName
+	product, response := loadExistingProduct(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	result, err := json.Marshal(product.custody())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// setThresholdRule - bound the values of a metric for the products of a GTIN. An empty bound is no bound.
+// Only organizations with the auditor role set rules.
+// ============================================================
+func (t *ProductChaincode) setThresholdRule(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0      1       2    3
+	// gtin, metric, min, max
+	const expectedArgumentsNumber = 4
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	if err := parseGTIN(args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[1]) == 0 || !utf8.ValidString(args[1]) {
+		return shim.Error("metric must be a non-empty UTF-8 string")
+	}
+
+	rule := ThresholdRule{Metric: args[1]}
+	var err error
+	if rule.Min, err = parseBound(args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if rule.Max, err = parseBound(args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if rule.Min == nil && rule.Max == nil || rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+		return shim.Error("threshold rule must have a bound and its minimum must not exceed its maximum")
+	}
+
+	creator := GetCreatorOrganization(stub)
+	if auditor, err := isAuditor(stub, creator); err != nil {
+		return shim.Error(err.Error())
+	} else if !auditor {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to set threshold rules: organization %s is not an auditor", creator)}
+	}
+
+	rules, err := loadThresholdRules(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rules == nil {
+		rules = &ThresholdRules{GTIN: args[0], Rules: []ThresholdRule{}}
+	}
+
+	rules.Org = creator
+	rules.set(rule)
+
+	if err := rules.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// readThresholdRules - read the threshold rules of a GTIN
+// ============================================================
+func (t *ProductChaincode) readThresholdRules(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//  0
+	// gtin
+	if len(args) < 1 {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d", 1, len(args)))
+	}
+
+	if err := parseGTIN(args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rules, err := loadThresholdRules(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rules == nil {
+		return pb.Response{Status: 404, Message: fmt.Sprintf("GTIN %s has no threshold rules", args[0])}
+	}
+
+	result, err := json.Marshal(rules)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// recordReadings - append sensor readings of a product, or of a shipment on the way and so of all of its products.
+// Only the custodian records them. Readings out of the bounds of the rules of a product are recorded as breaches,
+// put the product on quality hold and are emitted as an event.
+// ============================================================
+func (t *ProductChaincode) recordReadings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0           1                   2...
+	// product|shipment, id, [device, time, metric, value]...
+	const expectedArgumentsNumber = 2 + readingFieldsNumber
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	readings, err := parseReadings(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creator := GetCreatorOrganization(stub)
+	products, shipment, response := loadTelemetryTarget(stub, args[0], args[1])
+	if response != nil {
+		return *response
+	}
+
+	custodian := ""
+	if shipment != nil {
+		custodian = shipment.Custodian
+		if shipment.Status == shipmentStatusDelivered {
+			return pb.Response{Status: 409, Message: fmt.Sprintf("shipment %s is delivered", shipment.ID)}
+		}
+	} else {
+		custodian = products[0].custody().Custodian
+	}
+	if creator != custodian {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to record readings of %s %s held by %s (caller is from organization %s)",
+			args[0], args[1], custodian, creator)}
+	}
+
+	record := telemetryRecord{Breaches: []Breach{}}
+	recorded := []Reading{}
+	for _, reading := range readings {
+		reading.Org = creator
+		reading.TxId = stub.GetTxID()
+
+		added, err := appendReading(stub, []string{args[0], args[1]}, reading)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if added {
+			recorded = append(recorded, reading)
+		}
+	}
+	record.Recorded = len(recorded)
+
+	shipmentID, sequence := "", 0
+	if shipment != nil {
+		shipmentID = shipment.ID
+	}
+	for i := range products {
+		breaches, err := products[i].checkReadings(stub, shipmentID, recorded, &sequence)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		record.Breaches = append(record.Breaches, breaches...)
+	}
+
+	result, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(record.Breaches) > 0 {
+		payload, err := json.Marshal(record.Breaches)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := stub.SetEvent(breachEventName, payload); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// listReadings - list the sensor readings of a product or a shipment in time order
+// ============================================================
+func (t *ProductChaincode) listReadings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0           1
+	// product|shipment, id
+	const expectedArgumentsNumber = 2
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	if _, _, response := loadTelemetryTarget(stub, args[0], args[1]); response != nil {
+		return *response
+	}
+
+	readings, err := listReadings(stub, args[:expectedArgumentsNumber])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(readings)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// listBreaches - list the threshold breaches of a product, the cleared ones too
+// ============================================================
+func (t *ProductChaincode) listBreaches(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0
+	// productName
+	product, response := loadExistingProduct(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	breaches, err := listBreaches(stub, product.Key.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(breaches)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// clearHold - release the product from quality hold and mark its open breaches cleared. Only organizations with the
+// auditor role may clear it.
+// ============================================================
+func (t *ProductChaincode) clearHold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0
+	// productName
+	product, response := loadExistingProduct(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	if len(product.Value.Hold) == 0 {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is not on hold", product.Key.Name)}
+	}
+
+	cleared, err := sign(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if auditor, err := isAuditor(stub, cleared.Org); err != nil {
+		return shim.Error(err.Error())
+	} else if !auditor {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to clear the hold of product %s: organization %s is not an auditor",
+			product.Key.Name, cleared.Org)}
+	}
+
+	breaches, err := listBreaches(stub, product.Key.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for i := range breaches {
+		if breaches[i].Cleared != nil {
+			continue
+		}
+		breaches[i].Cleared = &cleared
+		if err := breaches[i].store(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	product.Value.Hold = ""
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// getAuditors - list the organizations with the auditor role, registered by Init
+// ============================================================
+func (t *ProductChaincode) getAuditors(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	auditors, err := loadRole(stub, roleAuditor)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(auditors)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// issueCertification - certify a product, e.g. organic, CE or GMP, or record the result of an inspection as a
+// certification of its type. Only organizations with the auditor role issue certifications. An empty start of the
+// validity is the time of the transaction.
+// ============================================================
+func (t *ProductChaincode) issueCertification(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0            1       2     3        4          5            6
+	// productName, certId, type, scope, validFrom, validTo, [documentHash]
+	const expectedArgumentsNumber = keyFieldsNumber + 5
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	creator := GetCreatorOrganization(stub)
+	if auditor, err := isAuditor(stub, creator); err != nil {
+		return shim.Error(err.Error())
+	} else if !auditor {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to issue certifications: organization %s is not an auditor", creator)}
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	certification := Certification{ID: args[keyFieldsNumber], Product: product.Key.Name, Issuer: creator,
+		TxId: stub.GetTxID(), Timestamp: timestamp.Seconds}
+	if len(certification.ID) == 0 || !isValidKeyPart(certification.ID) {
+		return shim.Error("certification id must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+	}
+	if certification.Type, err = parseCertificationType(args[keyFieldsNumber + 1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if certification.Scope, err = parseScope(args[keyFieldsNumber + 2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	certification.ValidFrom, certification.ValidTo, err = parseValidity(args[keyFieldsNumber + 3],
+		args[keyFieldsNumber + 4], timestamp.Seconds)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) > expectedArgumentsNumber && len(args[expectedArgumentsNumber]) > 0 {
+		if certification.Document, err = document.ParseHash(args[expectedArgumentsNumber]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	if existing, err := loadCertification(stub, product.Key.Name, certification.ID); err != nil {
+		return shim.Error(err.Error())
+	} else if existing != nil {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("certification %s of product %s already exists",
+			certification.ID, product.Key.Name)}
+	}
+
+	if err := certification.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(certification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// revokeCertification - withdraw a certification before the end of its validity. Only its issuer may revoke it.
+// ============================================================
+func (t *ProductChaincode) revokeCertification(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0            1       2
+	// productName, certId, reason
+	const expectedArgumentsNumber = keyFieldsNumber + 2
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	certification, err := loadCertification(stub, product.Key.Name, args[keyFieldsNumber])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if certification == nil {
+		return pb.Response{Status: 404, Message: fmt.Sprintf("certification %s of product %s doesn't exist",
+			args[keyFieldsNumber], product.Key.Name)}
+	}
+
+	if creator := GetCreatorOrganization(stub); creator != certification.Issuer {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to revoke a certification issued by %s (caller is from organization %s)",
+			certification.Issuer, creator)}
+	}
+
+	if certification.Revocation != nil {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("certification %s of product %s is already revoked",
+			certification.ID, product.Key.Name)}
+	}
+
+	reason := args[keyFieldsNumber + 1]
+	if len(reason) == 0 || !utf8.ValidString(reason) {
+		return shim.Error("revocation reason must be a non-empty UTF-8 string")
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certification.Revocation = &Revocation{Reason: reason, TxId: stub.GetTxID(), Timestamp: timestamp.Seconds}
+
+	if err := certification.store(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(certification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// listCertifications - list the certifications of a product in the order they were issued, the revoked and the
+// expired ones too
+// ============================================================
+func (t *ProductChaincode) listCertifications(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0
+	// productName
+	product, response := loadExistingProduct(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	certifications, err := listCertifications(stub, product.Key.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(certifications)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// transform - consume the input products and create the output products made of them in one transaction. The
+// caller must own and hold every input. The outputs are registered to the caller, and the transformation links
+// them to the inputs in the lineage graph.
+// ============================================================
+func (t *ProductChaincode) transform(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//        0              1        2...           n+2...
+	// transformationId, inputCount, input..., [output, description]...
+	const expectedArgumentsNumber = 5
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	transformation, response := newTransformation(stub, args[0], "")
+	if response != nil {
+		return *response
+	}
+
+	inputCount, err := strconv.Atoi(args[1])
+	if err != nil || inputCount <= 0 || inputCount > len(args) - 2 {
+		return shim.Error(fmt.Sprintf("input count is invalid: %s (must be from 1 to %d)", args[1], len(args) - 2))
+	}
+	outputArgs := args[2 + inputCount:]
+	if len(outputArgs) == 0 || len(outputArgs) % 2 != 0 {
+		return shim.Error("outputs must be given in pairs of product name and description")
+	}
+
+	names := map[string]bool{}
+	inputs := []Product{}
+	for _, name := range args[2:2 + inputCount] {
+		if names[name] {
+			return shim.Error(fmt.Sprintf("product %s is given twice", name))
+		}
+		names[name] = true
+
+		product, response := loadTransformationInput(stub, name, transformation.Org)
+		if response != nil {
+			return *response
+		}
+
+		inputs = append(inputs, product)
+		transformation.Inputs = append(transformation.Inputs, name)
+	}
+
+	outputs := []Product{}
+	for i := 0; i < len(outputArgs); i += 2 {
+		product, response := newTransformationOutput(stub, outputArgs[i], names)
+		if response != nil {
+			return *response
+		}
+
+		product.Value = ProductValue{Desc: outputArgs[i + 1], State: stateRegistered, Owner: transformation.Org,
+			LastUpdated: int(transformation.Timestamp)}
+		outputs = append(outputs, product)
+		transformation.Outputs = append(transformation.Outputs, product.Key.Name)
+	}
+
+	if err := transformation.apply(stub, inputs, outputs); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(transformation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// readTransformation - read a transformation with its inputs and outputs
+// ============================================================
+func (t *ProductChaincode) readTransformation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//        0
+	// transformationId
+	if len(args) < 1 {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d", 1, len(args)))
+	}
+
+	transformation, err := loadTransformation(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if transformation == nil {
+		return pb.Response{Status: 404, Message: fmt.Sprintf("transformation %s doesn't exist", args[0])}
+	}
+
+	result, err := json.Marshal(transformation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// traceBackward - walk the lineage graph from a product back to the inputs it was made of, their inputs and so on,
+// through at most the given number of transformations
+// ============================================================
+func (t *ProductChaincode) traceBackward(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.trace(stub, traceBackward, args)
+}
+
+// ============================================================
+// traceForward - walk the lineage graph from a product forward to the outputs made of it, e.g. to find the finished
+// goods a recalled raw material went into
+// ============================================================
+func (t *ProductChaincode) traceForward(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.trace(stub, traceForward, args)
+}
+
+func (t *ProductChaincode) trace(stub shim.ChaincodeStubInterface, direction string, args []string) pb.Response {
+	//      0          1
+	// productName, [depth]
+	if len(args) < keyFieldsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			keyFieldsNumber, len(args)))
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	depth := defaultTraceDepth
+	if len(args) > keyFieldsNumber {
+		var err error
+		if depth, err = parseTraceDepth(args[keyFieldsNumber]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	lineage, err := traceLineage(stub, product, direction, depth)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(lineage)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// setQuantity - record the quantity of bulk goods, e.g. grain or chemicals, and its unit of measure. They are set
+// once: later operations only divide or combine the quantity.
+// ============================================================
+func (t *ProductChaincode) setQuantity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0          1       2
+	// productName, quantity, unit
+	const expectedArgumentsNumber = keyFieldsNumber + 2
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	product, response := loadExistingProduct(stub, args[:keyFieldsNumber])
+	if response != nil {
+		return *response
+	}
+
+	if creator := GetCreatorOrganization(stub); creator != product.Value.Owner {
+		return pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to set the quantity of a product of %s (caller is from organization %s)",
+			product.Value.Owner, creator)}
+	}
+
+	if product.isLot() {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s already has a quantity of %d %s",
+			product.Key.Name, product.Value.Quantity, product.Value.Unit)}
+	}
+	if product.Value.State == stateRecalled || product.Value.State == stateConsumed {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is in state %d", product.Key.Name,
+			product.Value.State)}
+	}
+
+	quantity, err := parseQuantity(args[keyFieldsNumber])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	unit, err := parseUnit(args[keyFieldsNumber + 1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	product.Value.Quantity = quantity
+	product.Value.Unit = unit
+
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ============================================================
+// splitLot - divide a lot into child lots of the caller. The quantities of the children must sum to the quantity of
+// the lot, which is consumed by the split.
+// ============================================================
+func (t *ProductChaincode) splitLot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//    0          1           2...
+	// splitId, productName, [child, quantity]...
+	const expectedArgumentsNumber = 6
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+	if len(args) % 2 != 0 {
+		return shim.Error("children must be given in pairs of product name and quantity")
+	}
+
+	transformation, response := newTransformation(stub, args[0], transformationSplit)
+	if response != nil {
+		return *response
+	}
+
+	names := map[string]bool{args[1]: true}
+	lot, response := loadTransformationInput(stub, args[1], transformation.Org)
+	if response != nil {
+		return *response
+	}
+	if !lot.isLot() {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s has no quantity", lot.Key.Name)}
+	}
+	transformation.Inputs = append(transformation.Inputs, lot.Key.Name)
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	children := []Product{}
+	quantities := []int64{}
+	for i := 2; i < len(args); i += 2 {
+		child, response := newTransformationOutput(stub, args[i], names)
+		if response != nil {
+			return *response
+		}
+
+		quantity, err := parseQuantity(args[i + 1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		childLot, err := lot.childLot(c, stub.GetTxID(), child.Key.Name, quantity, transformation.Org,
+			transformation.Timestamp)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		children = append(children, childLot)
+		quantities = append(quantities, quantity)
+		transformation.Outputs = append(transformation.Outputs, child.Key.Name)
+	}
+
+	if sum, err := sumQuantities(quantities); err != nil || sum != lot.Value.Quantity {
+		return pb.Response{Status: 409, Message: fmt.Sprintf(
+			"quantities of the children must sum to the %d %s of product %s", lot.Value.Quantity, lot.Value.Unit,
+			lot.Key.Name)}
+	}
+
+	if err := transformation.apply(stub, []Product{lot}, children); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(transformation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// ============================================================
+// mergeLots - combine lots of the caller into a new lot of their total quantity. The lots must be of the same unit,
+// GTIN and lot number. They are consumed by the merge.
+// ============================================================
+func (t *ProductChaincode) mergeLots(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//    0          1         2...
+	// mergeId, productName, lot...
+	const expectedArgumentsNumber = 4
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	transformation, response := newTransformation(stub, args[0], transformationMerge)
+	if response != nil {
+		return *response
+	}
+
+	names := map[string]bool{}
+	lots := []Product{}
+	quantities := []int64{}
+	for _, name := range args[2:] {
+		if names[name] {
+			return shim.Error(fmt.Sprintf("product %s is given twice", name))
+		}
+		names[name] = true
+
+		lot, response := loadTransformationInput(stub, name, transformation.Org)
+		if response != nil {
+			return *response
+		}
+		if !lot.isLot() {
+			return pb.Response{Status: 409, Message: fmt.Sprintf("product %s has no quantity", name)}
+		}
+		if len(lots) > 0 && !lots[0].compatibleWith(lot) {
+			return pb.Response{Status: 409, Message: fmt.Sprintf(
+				"lots %s and %s cannot be merged: they differ in unit, GTIN or lot", lots[0].Key.Name, name)}
+		}
+
+		lots = append(lots, lot)
+		quantities = append(quantities, lot.Value.Quantity)
+		transformation.Inputs = append(transformation.Inputs, name)
+	}
+
+	output, response := newTransformationOutput(stub, args[1], names)
+	if response != nil {
+		return *response
+	}
+
+	sum, err := sumQuantities(quantities)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transformation.Outputs = append(transformation.Outputs, output.Key.Name)
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	merged, err := lots[0].childLot(c, stub.GetTxID(), output.Key.Name, sum, transformation.Org,
+		transformation.Timestamp)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := transformation.apply(stub, lots, []Product{merged}); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(transformation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+// loadTelemetryTarget reads the product, or the shipment and its products still in it, that readings are of
+func loadTelemetryTarget(stub shim.ChaincodeStubInterface, targetType, id string) ([]Product, *Shipment,
+	*pb.Response) {
+	switch targetType {
+	case telemetryTargetProduct:
+		product, response := loadExistingProduct(stub, []string{id})
+		if response != nil {
+			return nil, nil, response
+		}
+		return []Product{product}, nil, nil
+	case telemetryTargetShipment:
+		shipment, response := loadExistingShipment(stub, id)
+		if response != nil {
+			return nil, nil, response
+		}
+
+		products := []Product{}
+		for _, name := range shipment.Products {
+			product := Product{Key: ProductKey{Name: name}}
+			if err := product.LoadFrom(stub); err != nil {
+				response := shim.Error(err.Error())
+				return nil, nil, &response
+			}
+			if product.Value.Shipment == shipment.ID {
+				products = append(products, product)
+			}
+		}
+		return products, shipment, nil
+	}
+
+	response := shim.Error(fmt.Sprintf("readings target is invalid: %s (must be %s or %s)", targetType,
+		telemetryTargetProduct, telemetryTargetShipment))
+	return nil, nil, &response
+}
+
+// loadExistingShipment reads the shipment and answers 404 if there is none
+func loadExistingShipment(stub shim.ChaincodeStubInterface, id string) (*Shipment, *pb.Response) {
+	shipment, err := loadShipment(stub, id)
+	if err != nil {
+		response := shim.Error(err.Error())
+		return nil, &response
+	}
+	if shipment == nil {
+		return nil, &pb.Response{Status: 404, Message: fmt.Sprintf("shipment %s doesn't exist", id)}
+	}
+
+	return shipment, nil
+}
+
+// loadExistingProduct reads the product by the key parts, a 404 response if there is no such product
+func loadExistingProduct(stub shim.ChaincodeStubInterface, args []string) (Product, *pb.Response) {
+	var product Product
+	if err := product.FillFromCompositeKeyParts(args); err != nil {
+		response := shim.Error(err.Error())
+		return Product{}, &response
+	}
+
+	if !product.ExistsIn(stub) {
+		compositeKey, _ := product.ToCompositeKey(stub)
+		return Product{}, &pb.Response{Status: 404,
+			Message: fmt.Sprintf("product with the key %s doesn't exist", compositeKey)}
+	}
+
+	if err := product.LoadFrom(stub); err != nil {
+		response := shim.Error(err.Error())
+		return Product{}, &response
+	}
+
+	return product, nil
+}
+
+// newTransformation starts a transformation of the caller at the time of the transaction, a 409 response if there
+// is one with the id already
+func newTransformation(stub shim.ChaincodeStubInterface, id, kind string) (Transformation, *pb.Response) {
+	if len(id) == 0 || !isValidKeyPart(id) {
+		response := shim.Error("transformation id must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+		return Transformation{}, &response
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		response := shim.Error(err.Error())
+		return Transformation{}, &response
+	}
+
+	if existing, err := loadTransformation(stub, id); err != nil {
+		response := shim.Error(err.Error())
+		return Transformation{}, &response
+	} else if existing != nil {
+		return Transformation{}, &pb.Response{Status: 409, Message: fmt.Sprintf("transformation %s already exists", id)}
+	}
+
+	return Transformation{ID: id, Kind: kind, Inputs: []string{}, Outputs: []string{},
+		Org: GetCreatorOrganization(stub), TxId: stub.GetTxID(), Timestamp: timestamp.Seconds}, nil
+}
+
+// loadTransformationInput reads a product the organization transforms, splits or merges. The organization must
+// own and hold it, and it must be neither recalled, consumed nor on quality hold.
+func loadTransformationInput(stub shim.ChaincodeStubInterface, name, org string) (Product, *pb.Response) {
+	product, response := loadExistingProduct(stub, []string{name})
+	if response != nil {
+		return Product{}, response
+	}
+
+	if custody := product.custody(); custody.Owner != org || custody.Custodian != org {
+		return Product{}, &pb.Response{Status: 403, Message: fmt.Sprintf(
+			"no privileges to transform product %s owned by %s and held by %s (caller is from organization %s)",
+			name, custody.Owner, custody.Custodian, org)}
+	}
+	switch {
+	case product.Value.State == stateRecalled:
+		return Product{}, &pb.Response{Status: 409, Message: fmt.Sprintf("product %s is recalled", name)}
+	case product.Value.State == stateConsumed:
+		return Product{}, &pb.Response{Status: 409, Message: fmt.Sprintf("product %s is consumed", name)}
+	case len(product.Value.Hold) > 0:
+		return Product{}, &pb.Response{Status: 409, Message: fmt.Sprintf("product %s is on quality hold", name)}
+	}
+
+	return product, nil
+}
+
+// newTransformationOutput checks the name of a product a transformation creates: it's not given twice, the names
+// given so far being in names, and there is no product with it yet
+func newTransformationOutput(stub shim.ChaincodeStubInterface, name string, names map[string]bool) (Product,
+	*pb.Response) {
+	var product Product
+	if err := product.FillFromCompositeKeyParts([]string{name}); err != nil {
+		response := shim.Error(err.Error())
+		return Product{}, &response
+	}
+	if names[name] {
+		response := shim.Error(fmt.Sprintf("product %s is given twice", name))
+		return Product{}, &response
+	}
+	names[name] = true
+
+	if product.ExistsIn(stub) {
+		return Product{}, &pb.Response{Status: 409, Message: fmt.Sprintf("product %s already exists", name)}
+	}
+
+	return product, nil
+}
+
+// ============================================================
+// updateOwner - transfer a product to the new owner. With a quantity less than the one of a lot, the lot is split
+// in two: the old owner keeps the rest as <productName>/1, the new owner gets the quantity as <productName>/2.
+// ============================================================
+func (t *ProductChaincode) updateOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//      0          1         2          3           4
+	// productName, oldOwner, newOwner, timestamp, [quantity]
+	const expectedArgumentsNumber = 4
+	if len(args) < expectedArgumentsNumber {
+		return shim.Error(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args)))
+	}
+
+	var product Product
+	if err := product.FillFromCompositeKeyParts(args[:keyFieldsNumber]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Input sanitation ====
+	for k, v := range args[1:expectedArgumentsNumber] {
+		if len(v) == 0 {
+			return shim.Error(fmt.Sprintf("argument #%d must be a non-empty string", k + 1))
+		}
+	}
+
+	oldOwner := args[keyFieldsNumber]
+	newOwner := args[keyFieldsNumber + 1]
+	lastUpdated, err := strconv.Atoi(args[keyFieldsNumber + 2])
+	if err != nil || lastUpdated < 0 {
+		return shim.Error(fmt.Sprintf("product last change time is invalid: %s (must be non-negative int)",
+			args[keyFieldsNumber + 2]))
+	}
+
+	// TODO: check if creator org and oldOwner are the same
+	//if GetCreatorOrganization(stub) != oldOwner {
+	//	return shim.Error(fmt.Sprintf("no privileges to send request from the side of %s", oldOwner))
+	//}
+
+	if !product.ExistsIn(stub) {
+		compositeKey, _ := product.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("product with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := product.LoadFrom(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if product.Value.Owner != oldOwner {
+		return shim.Error("the specified product doesn't belong to the specified owner")
+	}
+
+	if product.Value.State == stateRecalled {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is recalled", product.Key.Name)}
+	}
+
+	if product.Value.State == stateConsumed {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is consumed", product.Key.Name)}
+	}
+
+	if len(product.Value.Hold) > 0 {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is on quality hold", product.Key.Name)}
+	}
+
+	if len(args) > expectedArgumentsNumber && len(args[expectedArgumentsNumber]) > 0 {
+		// a partial transfer splits the lot and consumes it, only its owner may do that
+		if creator := GetCreatorOrganization(stub); creator != oldOwner {
+			return pb.Response{Status: 403, Message: fmt.Sprintf(
+				"no privileges to transfer a part of product %s from the side of %s (caller is from organization %s)",
+				product.Key.Name, oldOwner, creator)}
+		}
+
+		quantity, err := parseQuantity(args[expectedArgumentsNumber])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if !product.isLot() {
+			return pb.Response{Status: 409, Message: fmt.Sprintf("product %s has no quantity", product.Key.Name)}
+		}
+		if quantity > product.Value.Quantity {
+			return pb.Response{Status: 409, Message: fmt.Sprintf("product %s has only %d %s", product.Key.Name,
+				product.Value.Quantity, product.Value.Unit)}
+		}
+		if quantity < product.Value.Quantity {
+			return t.transferPart(stub, product, newOwner, quantity, lastUpdated)
+		}
+	}
+
+	product.Value.Owner = newOwner
+	product.Value.LastUpdated = lastUpdated
+
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// transferPart splits the lot between its owner and the new owner, who gets the quantity. It returns the split
+// transformation, whose outputs are the names of the two lots: <name>/1 of the owner and <name>/2 of the new owner.
+// The relationship chaincode records <name>/2 on the accepted transfer.
+func (t *ProductChaincode) transferPart(stub shim.ChaincodeStubInterface, lot Product, newOwner string,
+	quantity int64, lastUpdated int) pb.Response {
+	if custody := lot.custody(); custody.Custodian != lot.Value.Owner {
+		return pb.Response{Status: 409, Message: fmt.Sprintf("product %s is held by %s", lot.Key.Name,
+			custody.Custodian)}
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transformation := Transformation{ID: stub.GetTxID(), Kind: transformationSplit, Inputs: []string{lot.Key.Name},
+		Outputs: []string{}, Org: lot.Value.Owner, TxId: stub.GetTxID(), Timestamp: timestamp.Seconds}
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	names := map[string]bool{lot.Key.Name: true}
+	children := []Product{}
+	for _, part := range []struct {
+		suffix   string
+		owner    string
+		quantity int64
+	}{
+		{remainderSuffix, lot.Value.Owner, lot.Value.Quantity - quantity},
+		{transferredSuffix, newOwner, quantity},
+	} {
+		child, response := newTransformationOutput(stub, lot.Key.Name + part.suffix, names)
+		if response != nil {
+			return *response
+		}
+
+		childLot, err := lot.childLot(c, stub.GetTxID(), child.Key.Name, part.quantity, part.owner,
+			int64(lastUpdated))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		children = append(children, childLot)
+		transformation.Outputs = append(transformation.Outputs, child.Key.Name)
+	}
+
+	if err := transformation.apply(stub, []Product{lot}, children); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := json.Marshal(transformation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(result)
+}
+
+func getOrganization(certificate []byte) string {
+	data := certificate[strings.Index(string(certificate), "-----") : strings.LastIndex(string(certificate), "-----")+5]
+	block, _ := pem.Decode([]byte(data))
+	cert, _ := x509.ParseCertificate(block.Bytes)
+	organization := cert.Issuer.Organization[0]
+	return strings.Split(organization, ".")[0]
+}
+
+func GetCreatorOrganization(stub shim.ChaincodeStubInterface) string {
+	certificate, _ := stub.GetCreator()
+	return getOrganization(certificate)
+}
@@ -0,0 +1,471 @@
+package product
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"document"
+	"testutil"
+)
+
+// seededProductStub returns a stub with n products generated from a fixed seed, so runs are comparable.
+func seededProductStub(b *testing.B, n int) *testutil.MockStub {
+	return seededProductStubWith(b, n, nil)
+}
+
+// seededProductStubWith is seededProductStub with products changed by customize, if any, before they are stored
+// with their indexes.
+func seededProductStubWith(b *testing.B, n int, customize func(i int, product *Product)) *testutil.MockStub {
+	stub := testutil.NewMockStub("reference", new(ProductChaincode))
+	random := rand.New(rand.NewSource(int64(n)))
+	owners := []string{"a", "b", "c"}
+
+	keys := make([]string, 0, 3*n)
+	values := make([][]byte, 0, 3*n)
+	for i := 0; i < n; i++ {
+		product := Product{
+			Key: ProductKey{Name: fmt.Sprintf("product%08d", i)},
+			Value: ProductValue{
+				ObjectType:  productObjectType,
+				Desc:        fmt.Sprintf("description of product %d", random.Int()),
+				State:       stateRegistered + random.Intn(stateInactive),
+				Owner:       owners[random.Intn(len(owners))],
+				LastUpdated: random.Intn(1 << 30),
+			},
+		}
+		if customize != nil {
+			customize(i, &product)
+		}
+
+		key, err := product.ToCompositeKey(stub)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		value, err := product.ToLedgerValue()
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		keys, values = append(keys, key), append(values, value)
+
+		indexKeys, err := product.indexKeys(stub)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		for _, indexKey := range indexKeys {
+			keys, values = append(keys, indexKey), append(values, []byte{0x00})
+		}
+	}
+	stub.SeedState(keys, values)
+
+	return stub
+}
+
+// seededProductHistoryStub is seededProductStub with the current value of every product in its history
+func seededProductHistoryStub(b *testing.B, n int) *testutil.MockStub {
+	stub := seededProductStub(b, n)
+
+	prefix, err := stub.CreateCompositeKey(productIndex, []string{})
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	for key, value := range stub.State {
+		if strings.HasPrefix(key, prefix) {
+			stub.SeedHistory(key, [][]byte{value})
+		}
+	}
+
+	return stub
+}
+
+func benchmarkInvoke(b *testing.B, stub *testutil.MockStub, records int, args ...string) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if response := stub.MockInvoke("bench", testutil.Args(args...)); response.Status >= 400 {
+			b.Fatalf("%s failed: %s", args[0], response.Message)
+		}
+	}
+	b.ReportMetric(float64(records), "records")
+}
+
+func BenchmarkQueryProducts(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededProductStub(b, n), n, "queryProducts")
+		})
+	}
+}
+
+func BenchmarkReadProduct(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededProductStub(b, n), 1, "readProduct", fmt.Sprintf("product%08d", n/2))
+		})
+	}
+}
+
+// BenchmarkQueryProductsByOwner measures the first sorted page of an owner with a third of the products,
+// on the composite-key index (LevelDB) and on the rich query emulation (CouchDB).
+func BenchmarkQueryProductsByOwner(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		for _, richQuery := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%d/rich=%t", n, richQuery), func(b *testing.B) {
+				stub := seededProductStub(b, n)
+				stub.RichQuery = richQuery
+				benchmarkInvoke(b, stub, n, "queryProductsByOwner", "a", "100", "", "lastUpdated:desc")
+			})
+		}
+	}
+}
+
+// BenchmarkQueryProductsByState measures the first sorted page of a state with a quarter of the products, on the
+// state~name index (LevelDB) and on the rich query emulation (CouchDB).
+func BenchmarkQueryProductsByState(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		for _, richQuery := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%d/rich=%t", n, richQuery), func(b *testing.B) {
+				stub := seededProductStub(b, n)
+				stub.RichQuery = richQuery
+				benchmarkInvoke(b, stub, n, "queryProductsByState", strconv.Itoa(stateActive), "100", "",
+					"lastUpdated:desc")
+			})
+		}
+	}
+}
+
+// BenchmarkQueryProductsByCustodian measures the first sorted page of a carrier holding a third of the products
+// for shipments of the others, on the custodian~name index (LevelDB) and on the rich query emulation (CouchDB).
+func BenchmarkQueryProductsByCustodian(b *testing.B) {
+	carriers := []string{"c1", "c2", "c3"}
+	for _, n := range testutil.LedgerSizes(b) {
+		for _, richQuery := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%d/rich=%t", n, richQuery), func(b *testing.B) {
+				stub := seededProductStubWith(b, n, func(i int, product *Product) {
+					product.Value.Custodian = carriers[i%len(carriers)]
+					product.Value.Shipment = fmt.Sprintf("shipment%08d", i/100)
+					product.Value.Location = "port"
+				})
+				stub.RichQuery = richQuery
+				benchmarkInvoke(b, stub, n, "queryProductsByCustodian", "c1", "100", "", "lastUpdated:desc")
+			})
+		}
+	}
+}
+
+// BenchmarkGetCustodyTrail walks a history of n modifications of one product with a change of owner every 10 of
+// them, each one backed by an accepted transfer.
+func BenchmarkGetCustodyTrail(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := testutil.NewMockStub("reference", new(ProductChaincode))
+			owners := []string{"a", "b", "c"}
+			transfers := map[string][]transferDetails{}
+
+			product := Product{Key: ProductKey{Name: "p1"}, Value: ProductValue{ObjectType: productObjectType}}
+			key, err := product.ToCompositeKey(stub)
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+
+			values := make([][]byte, n)
+			for i := range values {
+				product.Value.State = stateRegistered + i%stateInactive
+				product.Value.LastUpdated = i
+				if owner := owners[i/10%len(owners)]; owner != product.Value.Owner {
+					if i > 0 {
+						channel := bilateralChannelName(product.Value.Owner, owner)
+						transfers[channel] = append(transfers[channel],
+							newTransfer("p1", owner, product.Value.Owner, transferStatusAccepted, int64(i)))
+					}
+					product.Value.Owner = owner
+				}
+
+				if values[i], err = product.ToLedgerValue(); err != nil {
+					b.Fatal(err.Error())
+				}
+			}
+			stub.SeedHistory(key, values)
+			stub.SeedState([]string{key}, values[n-1:])
+
+			for channel, channelTransfers := range transfers {
+				deployRelationship(stub, channel, channelTransfers...)
+			}
+
+			benchmarkInvoke(b, stub, n, "getCustodyTrail", "p1")
+		})
+	}
+}
+
+// seededTelemetryStub returns a stub with the product p1 and n readings of it from 10 devices, every 10th of them
+// out of bounds and recorded as a breach that put the product on hold.
+func seededTelemetryStub(b *testing.B, n int) *testutil.MockStub {
+	stub := testutil.NewMockStub("reference", new(ProductChaincode))
+	max := 8.0
+	rule := ThresholdRule{Metric: "temperature", Max: &max}
+
+	product := Product{Key: ProductKey{Name: "p1"}, Value: ProductValue{ObjectType: productObjectType,
+		State: stateRegistered, Owner: "a", GTIN: "g1", Lot: "l1", Hold: "0.0"}}
+	key, err := product.ToCompositeKey(stub)
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	value, err := product.ToLedgerValue()
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+
+	keys, values := []string{key}, [][]byte{value}
+	target := []string{telemetryTargetProduct, product.Key.Name}
+	for i := 0; i < n; i++ {
+		reading := Reading{Device: fmt.Sprintf("d%d", i%10), Time: int64(i / 10), Metric: rule.Metric,
+			Value: 4, Org: "a", TxId: strconv.Itoa(i / 100)}
+		if i%10 == 0 {
+			reading.Value = 12
+			breach := Breach{ID: fmt.Sprintf("%s.%d", reading.TxId, i%100), Product: product.Key.Name,
+				Reading: reading, Rule: rule}
+			if key, err = breachKey(stub, breach.Product, breach.ID); err != nil {
+				b.Fatal(err.Error())
+			}
+			if value, err = json.Marshal(breach); err != nil {
+				b.Fatal(err.Error())
+			}
+			keys, values = append(keys, key), append(values, value)
+		}
+
+		if key, err = readingKey(stub, target, reading); err != nil {
+			b.Fatal(err.Error())
+		}
+		if value, err = json.Marshal(reading); err != nil {
+			b.Fatal(err.Error())
+		}
+		keys, values = append(keys, key), append(values, value)
+	}
+	stub.SeedState(keys, values)
+
+	return stub
+}
+
+func BenchmarkListReadings(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededTelemetryStub(b, n), n, "listReadings", telemetryTargetProduct, "p1")
+		})
+	}
+}
+
+func BenchmarkListBreaches(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededTelemetryStub(b, n), n/10, "listBreaches", "p1")
+		})
+	}
+}
+
+// BenchmarkListCertifications lists n certifications of one product by 3 auditors, every 10th of them revoked.
+func BenchmarkListCertifications(b *testing.B) {
+	auditors := []string{"lab1", "lab2", "lab3"}
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := seededProductStub(b, n)
+			name := fmt.Sprintf("product%08d", n/2)
+
+			keys := make([]string, 0, n)
+			values := make([][]byte, 0, n)
+			for i := 0; i < n; i++ {
+				certification := Certification{ID: fmt.Sprintf("c%08d", i), Product: name, Type: "organic",
+					Scope: "EU", Issuer: auditors[i%len(auditors)], ValidFrom: int64(i), ValidTo: int64(i + 1000),
+					TxId: strconv.Itoa(i), Timestamp: int64(i)}
+				if i%10 == 0 {
+					certification.Revocation = &Revocation{Reason: "withdrawn", TxId: strconv.Itoa(i + 1),
+						Timestamp: int64(i + 1)}
+				}
+
+				key, err := certificationKey(stub, certification.Product, certification.ID)
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				value, err := json.Marshal(certification)
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				keys, values = append(keys, key), append(values, value)
+			}
+			stub.SeedState(keys, values)
+
+			benchmarkInvoke(b, stub, n, "listCertifications", name)
+		})
+	}
+}
+
+// seededLineageStub returns a stub with a binary tree of n products rooted at product00000000. Every product with
+// children is linked to them by a transformation: made of them to trace backward, split into them to trace forward.
+func seededLineageStub(b *testing.B, n int, direction string) *testutil.MockStub {
+	stub := testutil.NewMockStub("reference", new(ProductChaincode))
+
+	products := make([]Product, n)
+	for i := range products {
+		products[i] = Product{Key: ProductKey{Name: fmt.Sprintf("product%08d", i)},
+			Value: ProductValue{ObjectType: productObjectType, State: stateRegistered, Owner: "a"}}
+	}
+
+	keys := make([]string, 0, 2*n)
+	values := make([][]byte, 0, 2*n)
+	for i := 0; 2*i+1 < n; i++ {
+		last := 2*i + 3
+		if last > n {
+			last = n
+		}
+		children := products[2*i+1 : last]
+
+		transformation := Transformation{ID: fmt.Sprintf("t%08d", i), Org: "a", TxId: strconv.Itoa(i),
+			Timestamp: int64(i)}
+		parent := &products[i]
+		for c := range children {
+			child := &children[c]
+			if direction == traceBackward {
+				transformation.Inputs = append(transformation.Inputs, child.Key.Name)
+				child.Value.State, child.Value.ConsumedBy = stateConsumed, transformation.ID
+			} else {
+				transformation.Outputs = append(transformation.Outputs, child.Key.Name)
+				child.Value.ProducedBy = transformation.ID
+			}
+		}
+		if direction == traceBackward {
+			transformation.Outputs = []string{parent.Key.Name}
+			parent.Value.ProducedBy = transformation.ID
+		} else {
+			transformation.Inputs = []string{parent.Key.Name}
+			parent.Value.State, parent.Value.ConsumedBy = stateConsumed, transformation.ID
+		}
+
+		key, err := transformationKey(stub, transformation.ID)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		value, err := json.Marshal(transformation)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		keys, values = append(keys, key), append(values, value)
+	}
+
+	for _, product := range products {
+		key, err := product.ToCompositeKey(stub)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		value, err := product.ToLedgerValue()
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		keys, values = append(keys, key), append(values, value)
+	}
+	stub.SeedState(keys, values)
+
+	return stub
+}
+
+// BenchmarkTraceBackward walks the whole tree from its root back to the leaves.
+func BenchmarkTraceBackward(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededLineageStub(b, n, traceBackward), n, "traceBackward", "product00000000",
+				strconv.Itoa(maxTraceDepth))
+		})
+	}
+}
+
+// BenchmarkTraceForward walks the whole tree from its root forward to the leaves.
+func BenchmarkTraceForward(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededLineageStub(b, n, traceForward), n, "traceForward", "product00000000",
+				strconv.Itoa(maxTraceDepth))
+		})
+	}
+}
+
+// BenchmarkListDocuments lists n documents attached to one product. They are seeded under the key the document
+// package stores them with: Document~product~name~hash.
+func BenchmarkListDocuments(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := seededProductStub(b, n)
+			product := Product{Key: ProductKey{Name: fmt.Sprintf("product%08d", n/2)}}
+
+			keys := make([]string, 0, n)
+			values := make([][]byte, 0, n)
+			for i := 0; i < n; i++ {
+				attachment := document.Document{Hash: fmt.Sprintf("%x", sha256.Sum256([]byte(strconv.Itoa(i)))),
+					Type: "invoice", Issuer: "a", URI: fmt.Sprintf("https://documents.example.com/%d", i), Org: "a",
+					TxId: strconv.Itoa(i), Timestamp: int64(i)}
+
+				key, err := stub.CreateCompositeKey("Document", append(product.documentTarget(), attachment.Hash))
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				value, err := json.Marshal(attachment)
+				if err != nil {
+					b.Fatal(err.Error())
+				}
+				keys, values = append(keys, key), append(values, value)
+			}
+			stub.SeedState(keys, values)
+
+			benchmarkInvoke(b, stub, n, "listDocuments", product.Key.Name)
+		})
+	}
+}
+
+// BenchmarkGetInventorySnapshot replays the history of every product, one modification each, for a third of them.
+func BenchmarkGetInventorySnapshot(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededProductHistoryStub(b, n), n, "getInventorySnapshot", "2000000000", "a")
+		})
+	}
+}
+
+// BenchmarkExportProducts reads the last page of the export, which skips every product before it.
+func BenchmarkExportProducts(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededProductStub(b, n), n, "exportProducts", "1000", fmt.Sprintf("product%08d", n-1001))
+		})
+	}
+}
+
+// BenchmarkProductsChangedSince reads a page from the middle of a change index with an entry for every product, and
+// the history of the product of each change.
+func BenchmarkProductsChangedSince(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := seededProductHistoryStub(b, n)
+
+			keys := make([]string, 0, n)
+			values := make([][]byte, 0, n)
+			for i := 0; i < n; i++ {
+				// SeedHistory names the only version of each product seed0
+				keys = append(keys, fmt.Sprintf("%s%020d.%09d/%s/product%08d", changeKeyPrefix, i, 0, "seed0", i))
+				values = append(values, []byte{0x00})
+			}
+			stub.SeedState(keys, values)
+
+			benchmarkInvoke(b, stub, n, "productsChangedSince", strconv.Itoa(n/2), "100")
+		})
+	}
+}
+
+// BenchmarkGetProductStatistics reads the history of every product to filter them by a time window.
+func BenchmarkGetProductStatistics(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededProductHistoryStub(b, n), n, "getProductStatistics", "0", "2000000000")
+		})
+	}
+}
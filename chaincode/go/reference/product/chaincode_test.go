@@ -0,0 +1,408 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"testutil"
+)
+
+func getInitializedStub(t *testing.T) *testutil.MockStub {
+	stub := testutil.NewMockStub("reference", new(ProductChaincode))
+
+	identity, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate creator identity: %s", err.Error())
+	}
+	if err := stub.SetCreator(identity); err != nil {
+		t.Fatalf("cannot set creator: %s", err.Error())
+	}
+
+	if response := stub.MockInit("init", testutil.Args("init")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+
+	return stub
+}
+
+// invokeSteps invokes each step as the transaction tx<index> and fails the test at the first error
+func invokeSteps(t *testing.T, stub *testutil.MockStub, steps [][]string) {
+	t.Helper()
+
+	for i, step := range steps {
+		if response := stub.MockInvoke(fmt.Sprintf("tx%d", i), testutil.Args(step...)); response.Status >= 400 {
+			t.Fatalf("%s failed: %s", step[0], response.Message)
+		}
+	}
+}
+
+// invokeStepsAs is invokeSteps with the organization of the creator at the start of each step
+func invokeStepsAs(t *testing.T, stub *testutil.MockStub, identities map[string]*testutil.Identity,
+	steps [][]string) {
+	t.Helper()
+
+	for i, step := range steps {
+		response := stub.MockInvokeAs(identities[step[0]], fmt.Sprintf("tx%d", i), testutil.Args(step[1:]...))
+		if response.Status >= 400 {
+			t.Fatalf("%s failed: %s", step[1], response.Message)
+		}
+	}
+}
+
+// putProduct writes the product directly to the ledger bypassing state machine checks.
+func putProduct(t *testing.T, stub *testutil.MockStub, product Product) {
+	stub.MockTransactionStart("seed")
+	defer stub.MockTransactionEnd("seed")
+
+	if err := product.UpdateOrInsertIn(stub); err != nil {
+		t.Fatalf("cannot seed product %s: %s", product.Key.Name, err.Error())
+	}
+}
+
+func loadProduct(t *testing.T, stub *testutil.MockStub, name string) Product {
+	product := Product{Key: ProductKey{Name: name}}
+	if !product.ExistsIn(stub) {
+		t.Fatalf("product %s doesn't exist", name)
+	}
+	if err := product.LoadFrom(stub); err != nil {
+		t.Fatalf("cannot load product %s: %s", name, err.Error())
+	}
+
+	return product
+}
+
+func TestInvokeUnknownFunction(t *testing.T) {
+	stub := getInitializedStub(t)
+
+	response := stub.MockInvoke("1", testutil.Args("noSuchFunction"))
+	if response.Status != 403 {
+		t.Errorf("expected status 403, got %d (%s)", response.Status, response.Message)
+	}
+}
+
+func TestInitProduct(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		existing bool
+		wantErr  string
+	}{
+		{"valid", []string{"p1", "desc", "1", "A", "100"}, false, ""},
+		{"empty description", []string{"p1", "", "1", "a", "100"}, false, ""},
+		{"state is ignored", []string{"p1", "desc", "4", "a", "100"}, false, ""},
+		{"already exists", []string{"p1", "desc", "1", "a", "100"}, true, "already exists"},
+		{"too few arguments", []string{"p1", "desc", "1", "a"}, false, "incorrect number of arguments"},
+		{"empty name", []string{"", "desc", "1", "a", "100"}, false, "argument #1 must be a non-empty string"},
+		{"empty owner", []string{"p1", "desc", "1", "", "100"}, false, "argument #4 must be a non-empty string"},
+		{"state is not a number", []string{"p1", "desc", "x", "a", "100"}, false, "product state is invalid"},
+		{"unknown state", []string{"p1", "desc", "5", "a", "100"}, false, "product is invalid"},
+		{"time is not a number", []string{"p1", "desc", "1", "a", "x"}, false, "last change time is invalid"},
+		{"negative time", []string{"p1", "desc", "1", "a", "-1"}, false, "last change time is invalid"},
+		{"separator in name", []string{"p\x001", "desc", "1", "a", "100"}, false, "key part #1 must be a valid UTF-8 string"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := getInitializedStub(t)
+			if test.existing {
+				putProduct(t, stub, Product{Key: ProductKey{Name: "p1"}, Value: ProductValue{State: stateActive, Owner: "b"}})
+			}
+
+			response := stub.MockInvoke("1", testutil.Args(append([]string{"initProduct"}, test.args...)...))
+			if test.wantErr != "" {
+				if response.Status < 400 || !strings.Contains(response.Message, test.wantErr) {
+					t.Fatalf("expected error containing %q, got %d (%s)", test.wantErr, response.Status, response.Message)
+				}
+				return
+			}
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			product := loadProduct(t, stub, test.args[0])
+			if product.Value.State != stateRegistered {
+				t.Errorf("expected state %d, got %d", stateRegistered, product.Value.State)
+			}
+			if product.Value.Owner != strings.ToLower(test.args[3]) {
+				t.Errorf("expected owner %s, got %s", strings.ToLower(test.args[3]), product.Value.Owner)
+			}
+			if product.Value.Desc != test.args[1] {
+				t.Errorf("expected description %q, got %q", test.args[1], product.Value.Desc)
+			}
+			if strconv.Itoa(product.Value.LastUpdated) != test.args[4] {
+				t.Errorf("expected last update time %s, got %d", test.args[4], product.Value.LastUpdated)
+			}
+		})
+	}
+}
+
+func TestUpdateProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"valid", []string{"p1", "new desc", "2", "a", "200"}, ""},
+		{"same state", []string{"p1", "new desc", "1", "a", "200"}, ""},
+		{"owner is lower-cased", []string{"p1", "new desc", "2", "A", "200"}, ""},
+		{"doesn't exist", []string{"p2", "desc", "2", "a", "200"}, "doesn't exist"},
+		{"invalid transition", []string{"p1", "desc", "4", "a", "200"}, "cannot be updated from 1 to 4"},
+		{"owner change", []string{"p1", "desc", "2", "b", "200"}, "ownership cannot be transferred"},
+		{"too few arguments", []string{"p1", "desc", "2", "a"}, "incorrect number of arguments"},
+		{"unknown state", []string{"p1", "desc", "-1", "a", "200"}, "product is invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := getInitializedStub(t)
+			putProduct(t, stub, Product{Key: ProductKey{Name: "p1"},
+				Value: ProductValue{Desc: "desc", State: stateRegistered, Owner: "a", LastUpdated: 100}})
+
+			response := stub.MockInvoke("1", testutil.Args(append([]string{"updateProduct"}, test.args...)...))
+			product := loadProduct(t, stub, "p1")
+			if test.wantErr != "" {
+				if response.Status < 400 || !strings.Contains(response.Message, test.wantErr) {
+					t.Fatalf("expected error containing %q, got %d (%s)", test.wantErr, response.Status, response.Message)
+				}
+				if product.Value.Desc != "desc" || product.Value.State != stateRegistered || product.Value.LastUpdated != 100 {
+					t.Errorf("product was changed by a failed update: %+v", product.Value)
+				}
+				return
+			}
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			state, _ := strconv.Atoi(test.args[2])
+			if product.Value.Desc != test.args[1] || product.Value.State != state || product.Value.LastUpdated != 200 {
+				t.Errorf("product wasn't updated: %+v", product.Value)
+			}
+			if product.Value.Owner != "a" {
+				t.Errorf("expected owner a, got %s", product.Value.Owner)
+			}
+		})
+	}
+}
+
+func TestUpdateProductStateTransitions(t *testing.T) {
+	states := []int{stateUnknown, stateRegistered, stateActive, stateDecisionMaking, stateInactive}
+
+	for _, from := range states {
+		for _, to := range states {
+			t.Run(fmt.Sprintf("%d->%d", from, to), func(t *testing.T) {
+				stub := getInitializedStub(t)
+				putProduct(t, stub, Product{Key: ProductKey{Name: "p1"}, Value: ProductValue{State: from, Owner: "a"}})
+
+				response := stub.MockInvoke("1", testutil.Args("updateProduct", "p1", "desc", strconv.Itoa(to), "a", "1"))
+
+				allowed := checkStateValidity(productStateMachine, from, to)
+				if allowed && response.Status >= 400 {
+					t.Errorf("transition is allowed but failed: %s", response.Message)
+				}
+				if !allowed && response.Status < 400 {
+					t.Errorf("transition is forbidden but succeeded")
+				}
+
+				expected := from
+				if allowed {
+					expected = to
+				}
+				if product := loadProduct(t, stub, "p1"); product.Value.State != expected {
+					t.Errorf("expected state %d, got %d", expected, product.Value.State)
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"valid", []string{"p1", "a", "b", "200"}, ""},
+		{"doesn't exist", []string{"p2", "a", "b", "200"}, "doesn't exist"},
+		{"wrong old owner", []string{"p1", "c", "b", "200"}, "doesn't belong to the specified owner"},
+		{"too few arguments", []string{"p1", "a", "b"}, "incorrect number of arguments"},
+		{"empty name", []string{"", "a", "b", "200"}, "key part #1 must be a non-empty string"},
+		{"empty new owner", []string{"p1", "a", "", "200"}, "argument #2 must be a non-empty string"},
+		{"time is not a number", []string{"p1", "a", "b", "x"}, "last change time is invalid"},
+		{"negative time", []string{"p1", "a", "b", "-200"}, "last change time is invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := getInitializedStub(t)
+			putProduct(t, stub, Product{Key: ProductKey{Name: "p1"},
+				Value: ProductValue{State: stateActive, Owner: "a", LastUpdated: 100}})
+
+			response := stub.MockInvoke("1", testutil.Args(append([]string{"updateOwner"}, test.args...)...))
+			product := loadProduct(t, stub, "p1")
+			if test.wantErr != "" {
+				if response.Status < 400 || !strings.Contains(response.Message, test.wantErr) {
+					t.Fatalf("expected error containing %q, got %d (%s)", test.wantErr, response.Status, response.Message)
+				}
+				if product.Value.Owner != "a" || product.Value.LastUpdated != 100 {
+					t.Errorf("product was changed by a failed update: %+v", product.Value)
+				}
+				return
+			}
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			if product.Value.Owner != "b" || product.Value.LastUpdated != 200 {
+				t.Errorf("owner wasn't updated: %+v", product.Value)
+			}
+			if product.Value.State != stateActive {
+				t.Errorf("state was changed by owner update: %d", product.Value.State)
+			}
+		})
+	}
+}
+
+func TestReadProduct(t *testing.T) {
+	stub := getInitializedStub(t)
+	expected := Product{Key: ProductKey{Name: "p1"},
+		Value: ProductValue{ObjectType: productObjectType, Desc: "desc", State: stateActive, Owner: "a", LastUpdated: 100}}
+	putProduct(t, stub, expected)
+
+	response := stub.MockInvoke("1", testutil.Args("readProduct", "p1"))
+	if response.Status >= 400 {
+		t.Fatalf("unexpected error: %s", response.Message)
+	}
+
+	var actual Product
+	if err := json.Unmarshal(response.Payload, &actual); err != nil {
+		t.Fatalf("cannot unmarshal response: %s", err.Error())
+	}
+	if actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no arguments", []string{}, "incorrect number of arguments"},
+		{"empty name", []string{""}, "key part #1 must be a non-empty string"},
+		{"doesn't exist", []string{"p2"}, "doesn't exist"},
+	}
+
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			response := stub.MockInvoke("1", testutil.Args(append([]string{"readProduct"}, test.args...)...))
+			if response.Status < 400 || !strings.Contains(response.Message, test.wantErr) {
+				t.Errorf("expected error containing %q, got %d (%s)", test.wantErr, response.Status, response.Message)
+			}
+		})
+	}
+}
+
+func TestQueryProducts(t *testing.T) {
+	stub := getInitializedStub(t)
+
+	response := stub.MockInvoke("1", testutil.Args("queryProducts"))
+	if response.Status >= 400 {
+		t.Fatalf("unexpected error: %s", response.Message)
+	}
+	if string(response.Payload) != "[]" {
+		t.Errorf("expected an empty list, got %s", string(response.Payload))
+	}
+
+	expected := []Product{
+		{Key: ProductKey{Name: "p1"}, Value: ProductValue{ObjectType: productObjectType, Desc: "one", State: stateActive, Owner: "a", LastUpdated: 1}},
+		{Key: ProductKey{Name: "p2"}, Value: ProductValue{ObjectType: productObjectType, Desc: "two", State: stateInactive, Owner: "b", LastUpdated: 2}},
+		{Key: ProductKey{Name: "p3"}, Value: ProductValue{ObjectType: productObjectType, Desc: "three", State: stateRegistered, Owner: "c", LastUpdated: 3}},
+	}
+	for _, product := range expected {
+		putProduct(t, stub, product)
+	}
+
+	response = stub.MockInvoke("1", testutil.Args("queryProducts"))
+	if response.Status >= 400 {
+		t.Fatalf("unexpected error: %s", response.Message)
+	}
+
+	var actual []Product
+	if err := json.Unmarshal(response.Payload, &actual); err != nil {
+		t.Fatalf("cannot unmarshal response: %s", err.Error())
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d products, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], actual[i])
+		}
+	}
+}
+
+func TestGetHistoryForProduct(t *testing.T) {
+	stub := getInitializedStub(t)
+
+	steps := [][]string{
+		{"initProduct", "p1", "desc", "1", "a", "100"},
+		{"updateProduct", "p1", "desc", "2", "a", "200"},
+		{"updateOwner", "p1", "a", "b", "300"},
+	}
+	invokeSteps(t, stub, steps)
+
+	response := stub.MockInvoke("1", testutil.Args("getHistoryForProduct", "p1"))
+	if response.Status >= 400 {
+		t.Fatalf("unexpected error: %s", response.Message)
+	}
+
+	var history []struct {
+		Value    ProductValue `json:"value"`
+		TxId     string       `json:"txId"`
+		IsDelete bool         `json:"isDelete"`
+	}
+	if err := json.Unmarshal(response.Payload, &history); err != nil {
+		t.Fatalf("cannot unmarshal response: %s", err.Error())
+	}
+
+	expected := []struct {
+		txId  string
+		value ProductValue
+	}{
+		{"tx0", ProductValue{ObjectType: productObjectType, Desc: "desc", State: stateRegistered, Owner: "a", LastUpdated: 100}},
+		{"tx1", ProductValue{ObjectType: productObjectType, Desc: "desc", State: stateActive, Owner: "a", LastUpdated: 200}},
+		{"tx2", ProductValue{ObjectType: productObjectType, Desc: "desc", State: stateActive, Owner: "b", LastUpdated: 300}},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %d history entries, got %d", len(expected), len(history))
+	}
+	for i := range expected {
+		if history[i].TxId != expected[i].txId || history[i].Value != expected[i].value || history[i].IsDelete {
+			t.Errorf("entry #%d: expected %+v, got %+v", i, expected[i], history[i])
+		}
+	}
+
+	response = stub.MockInvoke("1", testutil.Args("getHistoryForProduct"))
+	if response.Status < 400 {
+		t.Errorf("expected an argument error")
+	}
+}
+
+func TestGetCreatorOrganization(t *testing.T) {
+	for _, org := range []string{"a", "b", "org3"} {
+		stub := testutil.NewMockStub("reference", new(ProductChaincode))
+		identity, err := testutil.NewIdentity(org)
+		if err != nil {
+			t.Fatalf("cannot generate identity: %s", err.Error())
+		}
+		if err := stub.SetCreator(identity); err != nil {
+			t.Fatalf("cannot set creator: %s", err.Error())
+		}
+
+		if actual := GetCreatorOrganization(stub); actual != org {
+			t.Errorf("expected organization %s, got %s", org, actual)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// The change index is a log of product versions under simple keys change/<seconds>.<nanoseconds>/<txId>/<name>.
+// Unlike composite keys they can be read by a range from any key on, which is what a cursor needs. The key is all an
+// entry holds: the version itself is read from the history of the product when the change is served.
+//
+// Changes are ordered by the transaction timestamp the client set in its proposal, not by the order of commits, and
+// a transaction can commit after another one with a later timestamp. A poller at the end of the log could then miss a
+// change that sorts behind its cursor. So the cursor of the last page stays changeSafetyWindow behind the time of
+// the query, and the next poll reads the changes of the window again: the ones committed late, and the ones
+// returned before, which pollers skip by txId and name.
+const (
+	changeKeyPrefix = "change/"
+	// changeKeyEnd follows every key of the change index: '0' is the character after '/'
+	changeKeyEnd = "change0"
+	// changeSafetyWindow is how long before the time of the query, in seconds, the cursor of the last page stays
+	changeSafetyWindow = 60
+)
+
+// changeCursorFormat is a position in the change index: the time of a change and its transaction and product or,
+// for the safety window, the time alone
+var changeCursorFormat = regexp.MustCompile(`^[0-9]{20}\.[0-9]{9}(/[^/]+/.+)?$`)
+
+// productChange is a version of a product written by the transaction at Timestamp in seconds
+type productChange struct {
+	Key       ProductKey   `json:"key"`
+	Value     ProductValue `json:"value"`
+	TxId      string       `json:"txId"`
+	Timestamp int64        `json:"timestamp"`
+}
+
+// productChangePage is a response of productsChangedSince. Cursor is the position after the last change
+// returned: it's passed back to get the next page or, when More is false, to poll for changes later. On the last
+// page it's at most changeSafetyWindow before the time of the query.
+type productChangePage struct {
+	Changes []productChange `json:"changes"`
+	Cursor  string          `json:"cursor"`
+	More    bool            `json:"more"`
+}
+
+// recordChange appends the key of the version the transaction writes to the change index
+func (product *Product) recordChange(stub shim.ChaincodeStubInterface) error {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	// timestamps are padded so that keys sort by time
+	key := fmt.Sprintf("%s%020d.%09d/%s/%s", changeKeyPrefix, timestamp.Seconds, timestamp.Nanos, stub.GetTxID(),
+		product.Key.Name)
+	return stub.PutState(key, []byte{0x00})
+}
+
+// parseChange reads the product, the transaction and its time in seconds from a position in the change index
+func parseChange(position string) (productChange, error) {
+	parts := strings.SplitN(position, "/", 3)
+	if len(parts) != 3 || !changeCursorFormat.MatchString(position) {
+		return productChange{}, errors.New(fmt.Sprintf("change index key is invalid: %s", position))
+	}
+
+	seconds, err := strconv.ParseInt(strings.SplitN(parts[0], ".", 2)[0], 10, 64)
+	if err != nil {
+		return productChange{}, err
+	}
+
+	return productChange{Key: ProductKey{Name: parts[2]}, TxId: parts[1], Timestamp: seconds}, nil
+}
+
+// load reads the version of the product the transaction of the change wrote from its history, or the current value
+// if the history doesn't have it
+func (change *productChange) load(stub shim.ChaincodeStubInterface) error {
+	product := Product{Key: change.Key}
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	historyIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return err
+	}
+	defer historyIterator.Close()
+
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return err
+		}
+		if modification.TxId == change.TxId && !modification.IsDelete {
+			return json.Unmarshal(modification.Value, &change.Value)
+		}
+	}
+
+	if err := product.LoadFrom(stub); err != nil {
+		return err
+	}
+	change.Value = product.Value
+	return nil
+}
+
+// changesRequest reads the change index from the time Since on or, if Cursor is set, after the cursor. Cipher, if
+// set, decrypts the values.
+type changesRequest struct {
+	Since    int64
+	PageSize int
+	Cursor   string
+	Cipher   *fieldCipher
+}
+
+func parseChangesRequest(args []string) (changesRequest, error) {
+	//   0          1          2
+	// since, [pageSize], [cursor]
+	if len(args) < 1 {
+		return changesRequest{}, errors.New("incorrect number of arguments: expected since")
+	}
+
+	since, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || since < 0 {
+		return changesRequest{}, errors.New(fmt.Sprintf("time is invalid: %s (must be non-negative int)", args[0]))
+	}
+	request := changesRequest{Since: since, PageSize: defaultPageSize}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		pageSize, err := strconv.Atoi(args[1])
+		if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+			return changesRequest{}, errors.New(fmt.Sprintf("page size is invalid: %s (must be from 1 to %d)",
+				args[1], maxPageSize))
+		}
+		request.PageSize = pageSize
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		if !changeCursorFormat.MatchString(args[2]) || !isValidKeyPart(args[2]) {
+			return changesRequest{}, errors.New(fmt.Sprintf("cursor is invalid: %s", args[2]))
+		}
+		request.Cursor = args[2]
+	}
+
+	return request, nil
+}
+
+// Execute reads a page of changes in the order of their proposal timestamps. Transactions of the same time come in
+// the order of their ids. Each change costs a read of the history of its product. The cursor of the last page is
+// moved back to the safety window.
+func (request changesRequest) Execute(stub shim.ChaincodeStubInterface) (productChangePage, error) {
+	startKey := fmt.Sprintf("%s%020d", changeKeyPrefix, request.Since)
+	if len(request.Cursor) > 0 {
+		startKey = changeKeyPrefix + request.Cursor
+	}
+
+	it, err := stub.GetStateByRange(startKey, changeKeyEnd)
+	if err != nil {
+		return productChangePage{}, err
+	}
+	defer it.Close()
+
+	page := productChangePage{Changes: []productChange{}, Cursor: request.Cursor}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return productChangePage{}, err
+		}
+
+		position := strings.TrimPrefix(response.Key, changeKeyPrefix)
+		if position == request.Cursor {
+			continue
+		}
+		if len(page.Changes) == request.PageSize {
+			page.More = true
+			break
+		}
+
+		change, err := parseChange(position)
+		if err != nil {
+			return productChangePage{}, err
+		}
+		if err := change.load(stub); err != nil {
+			return productChangePage{}, err
+		}
+		request.Cipher.decrypt(change.Key, &change.Value)
+
+		page.Changes = append(page.Changes, change)
+		page.Cursor = position
+	}
+
+	if !page.More && len(page.Cursor) > 0 {
+		timestamp, err := stub.GetTxTimestamp()
+		if err != nil {
+			return productChangePage{}, err
+		}
+		if window := changeWindowPosition(timestamp.Seconds); window < page.Cursor {
+			page.Cursor = window
+		}
+	}
+
+	return page, nil
+}
+
+// changeWindowPosition is the position in the change index changeSafetyWindow before the time in seconds: it
+// sorts before the changes of that second
+func changeWindowPosition(seconds int64) string {
+	seconds -= changeSafetyWindow
+	if seconds < 0 {
+		seconds = 0
+	}
+
+	return fmt.Sprintf("%020d.%09d", seconds, 0)
+}
@@ -0,0 +1,174 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"testutil"
+)
+
+// changesStub registers p1 and p2, hands p1 over to b, reindexes as admin a and updates p2, a transaction a second
+// from 1000
+func changesStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t)
+	if response := stub.MockInit("init", testutil.Args("init", "admins", "a")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+
+	steps := [][]string{
+		{"initProduct", "p1", "", "1", "a", "1"},
+		{"initProduct", "p2", "", "1", "a", "2"},
+		{"updateOwner", "p1", "a", "b", "3"},
+		{"reindexProducts"},
+		{"updateProduct", "p2", "", "2", "a", "5"},
+	}
+	invokeSteps(t, stub, steps)
+
+	return stub
+}
+
+func productsChangedSince(t *testing.T, stub *testutil.MockStub, args ...string) productChangePage {
+	response := stub.MockInvoke("changes", testutil.Args(append([]string{"productsChangedSince"}, args...)...))
+	if response.Status >= 400 {
+		t.Fatalf("productsChangedSince failed: %s", response.Message)
+	}
+
+	var page productChangePage
+	if err := json.Unmarshal(response.Payload, &page); err != nil {
+		t.Fatalf("cannot unmarshal changes: %s", err.Error())
+	}
+	return page
+}
+
+func changedTxIds(changes []productChange) []string {
+	txIds := []string{}
+	for _, change := range changes {
+		txIds = append(txIds, change.TxId)
+	}
+	return txIds
+}
+
+func TestProductsChangedSince(t *testing.T) {
+	stub := changesStub(t)
+
+	tests := []struct {
+		since    string
+		expected []string
+	}{
+		{"0", []string{"tx0", "tx1", "tx2", "tx4"}},
+		{"1002", []string{"tx2", "tx4"}},
+		{"1003", []string{"tx4"}},
+		{"1005", []string{}},
+	}
+
+	for _, test := range tests {
+		page := productsChangedSince(t, stub, test.since)
+		if txIds := changedTxIds(page.Changes); fmt.Sprint(txIds) != fmt.Sprint(test.expected) || page.More {
+			t.Errorf("since %s: expected %v, got %v (more %t)", test.since, test.expected, txIds, page.More)
+		}
+	}
+
+	change := productsChangedSince(t, stub, "1002", "1").Changes[0]
+	if change.Key.Name != "p1" || change.Value.Owner != "b" || change.Timestamp != 1002 {
+		t.Errorf("expected p1 handed over to b at 1002, got %+v", change)
+	}
+
+	// the index holds keys only, the versions come from the history
+	for key, value := range stub.State {
+		if strings.HasPrefix(key, changeKeyPrefix) && len(value) != 1 {
+			t.Errorf("expected no value under %s, got %s", key, value)
+		}
+	}
+}
+
+func TestProductsChangedSinceCursor(t *testing.T) {
+	stub := changesStub(t)
+	// the polls are made long after the changes, out of the safety window
+	stub.Now = testutil.FixedClock(time.Unix(2000, 0), time.Second)
+
+	var txIds []string
+	cursor := ""
+	for i := 0; ; i++ {
+		page := productsChangedSince(t, stub, "0", "1", cursor)
+		txIds = append(txIds, changedTxIds(page.Changes)...)
+		cursor = page.Cursor
+		if !page.More {
+			break
+		}
+		if i > 4 {
+			t.Fatalf("paging doesn't end, got %v", txIds)
+		}
+	}
+	if fmt.Sprint(txIds) != "[tx0 tx1 tx2 tx4]" {
+		t.Fatalf("expected every change once in order, got %v", txIds)
+	}
+
+	page := productsChangedSince(t, stub, "0", "", cursor)
+	if len(page.Changes) != 0 || page.Cursor != cursor {
+		t.Errorf("expected no changes and the same cursor, got %+v", page)
+	}
+
+	if response := stub.MockInvoke("tx5", testutil.Args("updateOwner", "p2", "a", "c", "6")); response.Status >= 400 {
+		t.Fatalf("updateOwner failed: %s", response.Message)
+	}
+
+	page = productsChangedSince(t, stub, "0", "", cursor)
+	if fmt.Sprint(changedTxIds(page.Changes)) != "[tx5]" || page.Changes[0].Value.Owner != "c" {
+		t.Errorf("expected the change made after the cursor, got %+v", page.Changes)
+	}
+
+	// an earlier change still carries the version it wrote
+	page = productsChangedSince(t, stub, "1004")
+	if fmt.Sprint(changedTxIds(page.Changes)) != "[tx4 tx5]" || page.Changes[0].Value.Owner != "a" {
+		t.Errorf("expected p2 of a in tx4, got %+v", page.Changes)
+	}
+}
+
+func TestProductsChangedSinceLateCommit(t *testing.T) {
+	stub := changesStub(t)
+
+	// tx5 is proposed at 1990 but commits after tx6 of 1995 was polled
+	stub.Now = testutil.FixedClock(time.Unix(1995, 0), time.Second)
+	if response := stub.MockInvoke("tx6", testutil.Args("updateOwner", "p2", "a", "c", "6")); response.Status >= 400 {
+		t.Fatalf("updateOwner failed: %s", response.Message)
+	}
+	stub.Now = testutil.FixedClock(time.Unix(2000, 0), time.Second)
+	page := productsChangedSince(t, stub, "1005")
+	if fmt.Sprint(changedTxIds(page.Changes)) != "[tx6]" || page.Cursor != changeWindowPosition(2000) {
+		t.Fatalf("expected tx6 and the cursor at the safety window, got %+v", page)
+	}
+
+	stub.Now = testutil.FixedClock(time.Unix(1990, 0), time.Second)
+	if response := stub.MockInvoke("tx5", testutil.Args("updateProduct", "p1", "", "2", "b", "5")); response.Status >= 400 {
+		t.Fatalf("updateProduct failed: %s", response.Message)
+	}
+	stub.Now = testutil.FixedClock(time.Unix(2001, 0), time.Second)
+	page = productsChangedSince(t, stub, "1005", "", page.Cursor)
+	if fmt.Sprint(changedTxIds(page.Changes)) != "[tx5 tx6]" || page.Cursor != changeWindowPosition(2001) {
+		t.Errorf("expected the late tx5 and tx6 again, got %+v", page)
+	}
+}
+
+func TestProductsChangedSinceErrors(t *testing.T) {
+	stub := changesStub(t)
+
+	tests := [][]string{
+		{},
+		{"-1"},
+		{"yesterday"},
+		{"0", "0"},
+		{"0", "1001"},
+		{"0", "", "tx1"},
+	}
+
+	for _, args := range tests {
+		response := stub.MockInvoke("changes", testutil.Args(append([]string{"productsChangedSince"}, args...)...))
+		if response.Status < 400 {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
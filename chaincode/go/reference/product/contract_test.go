@@ -0,0 +1,297 @@
+package product
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"attestation"
+	"document"
+	"testutil"
+)
+
+// contractStub returns a stub with a fixed clock and a ledger built by the same transactions every run.
+func contractStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t)
+	stub.Now = testutil.FixedClock(time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC), time.Minute)
+
+	steps := [][]string{
+		{"initProduct", "p1", "first product", "1", "a", "100"},
+		{"initProduct", "p2", "", "1", "b", "110"},
+		{"updateProduct", "p1", "first product, active", "2", "a", "200"},
+		{"updateOwner", "p1", "a", "b", "300"},
+	}
+	invokeSteps(t, stub, steps)
+
+	accepted := time.Date(2018, 3, 1, 12, 2, 30, 0, time.UTC).Unix()
+	deployRelationship(stub, "a-b", newTransfer("p1", "b", "a", "Accepted", accepted))
+
+	return stub
+}
+
+// historyInUTC puts the timestamps of a getHistoryForProduct response in UTC. The chaincode formats them in the
+// local time zone of the peer, which would make the golden file depend on the machine running the tests.
+func historyInUTC(t *testing.T, payload []byte) []byte {
+	var history []productHistory
+	if err := json.Unmarshal(payload, &history); err != nil {
+		t.Fatalf("cannot read the history: %s", err.Error())
+	}
+
+	for i, entry := range history {
+		timestamp, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", entry.Timestamp)
+		if err != nil {
+			t.Fatalf("cannot read the timestamp of entry #%d: %s", i+1, err.Error())
+		}
+		history[i].Timestamp = timestamp.In(time.UTC).String()
+	}
+
+	result, err := json.Marshal(history)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return result
+}
+
+// contractDocument is the SHA-256 of the certificate of origin attached to p1 in the contract tests
+const contractDocument = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestResponseContracts(t *testing.T) {
+	stub := contractStub(t)
+
+	owner, err := testutil.NewIdentity("b")
+	if err != nil {
+		t.Fatalf("cannot generate identity of b: %s", err.Error())
+	}
+	lab, err := testutil.NewIdentity("lab")
+	if err != nil {
+		t.Fatalf("cannot generate identity of lab: %s", err.Error())
+	}
+	response := stub.MockInvokeAs(owner, "document", testutil.Args("attachDocument", "p1", contractDocument,
+		"certificateOfOrigin", "Chamber of Commerce", "https://docs.b.example.com/p1/origin.pdf"))
+	if response.Status >= 400 {
+		t.Fatalf("attachDocument failed: %s", response.Message)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		v    interface{}
+	}{
+		{"readProduct", []string{"readProduct", "p1"}, certifiedProduct{}},
+		{"queryProducts", []string{"queryProducts"}, []Product{}},
+		{"getHistoryForProduct", []string{"getHistoryForProduct", "p1"}, []productHistory{}},
+		{"queryProductsByOwner", []string{"queryProductsByOwner", "b", "1"}, productPage{}},
+		{"queryProductsByState", []string{"queryProductsByState", "2", "", "", "lastUpdated:desc", "owner,lastUpdated"},
+			productPage{}},
+		{"getCustodyTrail", []string{"getCustodyTrail", "p1"}, custodyTrail{}},
+		{"getInventorySnapshot", []string{"getInventorySnapshot", "1519905720"}, InventorySnapshot{}},
+		{"exportProducts", []string{"exportProducts", "1", "", "true"}, productExportPage{}},
+		{"getProductStatistics", []string{"getProductStatistics"}, productStatistics{}},
+		{"productsChangedSince", []string{"productsChangedSince", "1519905660", "2"}, productChangePage{}},
+		{"listDocuments", []string{"listDocuments", "p1"}, []document.Document{}},
+		{"verifyDocument", []string{"verifyDocument", "p1", contractDocument}, document.Verification{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := stub.MockInvoke("contract", testutil.Args(test.args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			payload := response.Payload
+			if test.name == "getHistoryForProduct" {
+				payload = historyInUTC(t, payload)
+			}
+			testutil.AssertContract(t, test.name, payload, test.v)
+		})
+	}
+
+	// only the owner attests ownership
+	t.Run("attestOwnership", func(t *testing.T) {
+		deployQuery(stub, map[string]uint64{"tx3": 12})
+		response := stub.MockInvokeAs(owner, "contract", testutil.Args("attestOwnership", "p1", "challenge"))
+		if response.Status >= 400 {
+			t.Fatalf("unexpected error: %s", response.Message)
+		}
+
+		testutil.AssertContract(t, "attestOwnership", response.Payload, attestation.Attestation{})
+	})
+
+	// shipping p1 changes its custody, so it goes after the contracts of products
+	t.Run("readShipment", func(t *testing.T) {
+		carrier, err := testutil.NewIdentity("c")
+		if err != nil {
+			t.Fatalf("cannot generate identity of c: %s", err.Error())
+		}
+
+		for _, step := range []struct {
+			id   *testutil.Identity
+			args []string
+		}{
+			{owner, []string{"createShipment", "s1", "DEHAM", "USNYC", "c", "p1"}},
+			{owner, []string{"handOverShipment", "s1", "c", "DEHAM"}},
+			{carrier, []string{"acceptShipment", "s1"}},
+		} {
+			if response := stub.MockInvokeAs(step.id, "shipment", testutil.Args(step.args...)); response.Status >= 400 {
+				t.Fatalf("%s failed: %s", step.args[0], response.Message)
+			}
+		}
+
+		for _, test := range []struct {
+			args []string
+			v    interface{}
+		}{
+			{[]string{"readShipment", "s1"}, Shipment{}},
+			{[]string{"getProductCustody", "p1"}, ProductCustody{}},
+			{[]string{"queryProductsByCustodian", "c"}, productPage{}},
+		} {
+			response := stub.MockInvoke("contract", testutil.Args(test.args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, test.args[0], response.Payload, test.v)
+		}
+	})
+
+	// the breach puts p1 on hold, so it goes after the contracts of shipments. The rule is set by lab, an auditor
+	// registered on upgrade.
+	t.Run("recordReadings", func(t *testing.T) {
+		carrier, err := testutil.NewIdentity("c")
+		if err != nil {
+			t.Fatalf("cannot generate identity of c: %s", err.Error())
+		}
+
+		if response := stub.MockInit("upgrade", testutil.Args("init", "auditors", "lab")); response.Status >= 400 {
+			t.Fatalf("init failed: %s", response.Message)
+		}
+
+		for _, step := range []struct {
+			id   *testutil.Identity
+			args []string
+		}{
+			{owner, []string{"assignLot", "p1", "4006381333931", "L0"}},
+			{lab, []string{"setThresholdRule", "4006381333931", "temperature", "2", "8"}},
+		} {
+			if response := stub.MockInvokeAs(step.id, "rule", testutil.Args(step.args...)); response.Status >= 400 {
+				t.Fatalf("%s failed: %s", step.args[0], response.Message)
+			}
+		}
+
+		for _, test := range []struct {
+			id   *testutil.Identity
+			args []string
+			v    interface{}
+		}{
+			{owner, []string{"readThresholdRules", "4006381333931"}, ThresholdRules{}},
+			{carrier, []string{"recordReadings", "shipment", "s1", "t1", "1519905600", "temperature", "9.5"},
+				telemetryRecord{}},
+			{owner, []string{"listReadings", "shipment", "s1"}, []Reading{}},
+			{owner, []string{"listBreaches", "p1"}, []Breach{}},
+		} {
+			response := stub.MockInvokeAs(test.id, "contract", testutil.Args(test.args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, test.args[0], response.Payload, test.v)
+		}
+	})
+
+	// certifications are issued by lab, the auditor of the threshold rule
+	t.Run("issueCertification", func(t *testing.T) {
+		if response := stub.MockInvokeAs(lab, "inspection", testutil.Args("issueCertification", "p1", "c2",
+			"inspection", "batch 12 passed", "", "1551398400")); response.Status >= 400 {
+			t.Fatalf("issueCertification failed: %s", response.Message)
+		}
+
+		for _, test := range []struct {
+			args []string
+			v    interface{}
+		}{
+			{[]string{"issueCertification", "p1", "c1", "organic", "farm 7", "1519862400", "1551398400",
+				contractDocument}, Certification{}},
+			{[]string{"revokeCertification", "p1", "c2", "sample mix-up"}, Certification{}},
+			{[]string{"listCertifications", "p1"}, []Certification{}},
+			{[]string{"getAuditors"}, []string{}},
+		} {
+			response := stub.MockInvokeAs(lab, "contract", testutil.Args(test.args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, test.args[0], response.Payload, test.v)
+		}
+	})
+
+	// the recall changes p2, so it goes last
+	t.Run("initRecall", func(t *testing.T) {
+		if response := stub.MockInvokeAs(owner, "lot", testutil.Args("assignLot", "p2", "4006381333931",
+			"L1")); response.Status >= 400 {
+			t.Fatalf("assignLot failed: %s", response.Message)
+		}
+
+		for _, args := range [][]string{
+			{"initRecall", "r1", "contamination", "4006381333931", "L1"},
+			{"readRecall", "r1"},
+		} {
+			response := stub.MockInvokeAs(owner, "recall", testutil.Args(args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, args[0], response.Payload, Recall{})
+		}
+	})
+
+	// the transformation makes a product of its own, after the contracts that list products
+	t.Run("transform", func(t *testing.T) {
+		if response := stub.MockInvokeAs(owner, "raw", testutil.Args("initProduct", "p3", "green coffee", "1", "b",
+			"120")); response.Status >= 400 {
+			t.Fatalf("initProduct failed: %s", response.Message)
+		}
+
+		for _, test := range []struct {
+			args []string
+			v    interface{}
+		}{
+			{[]string{"transform", "t1", "1", "p3", "p4", "roasted coffee"}, Transformation{}},
+			{[]string{"readTransformation", "t1"}, Transformation{}},
+			{[]string{"traceBackward", "p4", "5"}, Lineage{}},
+			{[]string{"traceForward", "p3"}, Lineage{}},
+		} {
+			response := stub.MockInvokeAs(owner, "contract", testutil.Args(test.args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, test.args[0], response.Payload, test.v)
+		}
+	})
+
+	t.Run("splitLot", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"initProduct", "p5", "wheat", "1", "b", "130"},
+			{"setQuantity", "p5", "1000", "kg"},
+		} {
+			if response := stub.MockInvokeAs(owner, "bulk", testutil.Args(args...)); response.Status >= 400 {
+				t.Fatalf("%s failed: %s", args[0], response.Message)
+			}
+		}
+
+		for _, args := range [][]string{
+			{"splitLot", "s1", "p5", "p6", "600", "p7", "400"},
+			{"mergeLots", "m1", "p8", "p6", "p7"},
+			{"updateOwner", "p8", "b", "a", "140", "250"},
+		} {
+			response := stub.MockInvokeAs(owner, args[1], testutil.Args(args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, args[0], response.Payload, Transformation{})
+		}
+	})
+}
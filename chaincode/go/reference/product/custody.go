@@ -0,0 +1,272 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	// bilateralChaincodeName is the name OwnershipChaincode is instantiated with on bilateral channels
+	bilateralChaincodeName = "relationship"
+	transferStatusAccepted = "Accepted"
+)
+
+const (
+	gapMissingTransfer = "missingTransfer"
+	gapUnverifiable    = "unverifiable"
+	gapDeleted         = "deleted"
+)
+
+// transferDetails mirrors TransferDetails of OwnershipChaincode as returned by its history function. Part is the lot
+// the receiver of a partial transfer got.
+type transferDetails struct {
+	Key struct {
+		ProductKey      string `json:"productKey"`
+		RequestSender   string `json:"requestSender"`
+		RequestReceiver string `json:"requestReceiver"`
+	} `json:"key"`
+	Value struct {
+		Status    string `json:"status"`
+		Message   string `json:"message"`
+		Timestamp int64  `json:"timestamp"`
+		Part      string `json:"part,omitempty"`
+	} `json:"value"`
+}
+
+// custodyEvent is the transaction on the common channel that started or ended a custody
+type custodyEvent struct {
+	TxId      string `json:"txId"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// custodyTransfer links a change of owner to the accepted transfer on the bilateral channel
+type custodyTransfer struct {
+	Channel string          `json:"channel"`
+	Details transferDetails `json:"details"`
+}
+
+// custodyEntry is a period of time the product belonged to one owner. Released is nil for the current owner,
+// Transfer is nil for the owner the product was registered by and when the transfer could not be found.
+type custodyEntry struct {
+	Owner    string           `json:"owner"`
+	Acquired custodyEvent     `json:"acquired"`
+	Released *custodyEvent    `json:"released,omitempty"`
+	Transfer *custodyTransfer `json:"transfer,omitempty"`
+}
+
+// custodyGap points to the entry of the trail which doesn't chain to the previous one and tells why
+type custodyGap struct {
+	Entry  int    `json:"entry"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// custodyTrail is the response of getCustodyTrail. Verified is true when there are no gaps.
+type custodyTrail struct {
+	ProductKey string         `json:"productKey"`
+	Entries    []custodyEntry `json:"entries"`
+	Gaps       []custodyGap   `json:"gaps"`
+	Verified   bool           `json:"verified"`
+}
+
+// bilateralChannelName returns the name of the channel between two organizations, e.g. a-b
+func bilateralChannelName(org1, org2 string) string {
+	orgs := []string{org1, org2}
+	sort.Strings(orgs)
+	return strings.Join(orgs, "-")
+}
+
+// custodyTracer builds a trail from the history of a product. It reads transfers of each product on each bilateral
+// channel once.
+type custodyTracer struct {
+	stub      shim.ChaincodeStubInterface
+	trail     custodyTrail
+	transfers map[string][]transferDetails
+	errors    map[string]error
+}
+
+func newCustodyTracer(stub shim.ChaincodeStubInterface, productKey string) *custodyTracer {
+	return &custodyTracer{
+		stub:      stub,
+		trail:     custodyTrail{ProductKey: productKey, Entries: []custodyEntry{}, Gaps: []custodyGap{}},
+		transfers: map[string][]transferDetails{},
+		errors:    map[string]error{},
+	}
+}
+
+// trace walks the history of the product from the oldest modification and opens an entry on every change of owner
+func (tracer *custodyTracer) trace(history shim.HistoryQueryIteratorInterface) error {
+	deleted := false
+	for history.HasNext() {
+		modification, err := history.Next()
+		if err != nil {
+			return err
+		}
+
+		event := custodyEvent{TxId: modification.TxId}
+		if modification.Timestamp != nil {
+			event.Timestamp = modification.Timestamp.Seconds
+		}
+
+		current := tracer.current()
+
+		if modification.IsDelete {
+			if current != nil {
+				current.Released = &event
+			}
+			deleted = true
+			continue
+		}
+
+		var value ProductValue
+		if err := json.Unmarshal(modification.Value, &value); err != nil {
+			return errors.New(fmt.Sprintf("cannot unmarshal product value of transaction %s: %s",
+				modification.TxId, err.Error()))
+		}
+
+		if current != nil && !deleted && current.Owner == value.Owner {
+			continue
+		}
+
+		entry := custodyEntry{Owner: value.Owner, Acquired: event}
+		index := len(tracer.trail.Entries)
+		if deleted && current != nil {
+			tracer.gap(index, gapDeleted, fmt.Sprintf("product was deleted by transaction %s and registered again",
+				current.Released.TxId))
+		} else if current != nil {
+			current.Released = &event
+			entry.Transfer = tracer.findTransfer(index, current, &entry)
+		} else {
+			entry.Transfer = tracer.findPartTransfer(index, value)
+		}
+		deleted = false
+		tracer.trail.Entries = append(tracer.trail.Entries, entry)
+	}
+
+	tracer.trail.Verified = len(tracer.trail.Gaps) == 0
+	return nil
+}
+
+func (tracer *custodyTracer) current() *custodyEntry {
+	if len(tracer.trail.Entries) == 0 {
+		return nil
+	}
+
+	return &tracer.trail.Entries[len(tracer.trail.Entries)-1]
+}
+
+func (tracer *custodyTracer) gap(entry int, kind, reason string) {
+	tracer.trail.Gaps = append(tracer.trail.Gaps, custodyGap{Entry: entry, Kind: kind, Reason: reason})
+}
+
+// findTransfer returns the latest transfer from the previous owner to the next one accepted while the previous
+// owner held the product. A gap is recorded and nil returned when there is no such transfer or it can't be read.
+func (tracer *custodyTracer) findTransfer(index int, previous, next *custodyEntry) *custodyTransfer {
+	channel := bilateralChannelName(previous.Owner, next.Owner)
+
+	transfers, err := tracer.loadTransfers(channel, tracer.trail.ProductKey)
+	if err != nil {
+		tracer.gap(index, gapUnverifiable, err.Error())
+		return nil
+	}
+
+	var found *transferDetails
+	for i, transfer := range transfers {
+		if transfer.Value.Status == transferStatusAccepted &&
+			transfer.Key.RequestReceiver == previous.Owner && transfer.Key.RequestSender == next.Owner &&
+			transfer.Value.Timestamp >= previous.Acquired.Timestamp &&
+			transfer.Value.Timestamp <= next.Acquired.Timestamp {
+			found = &transfers[i]
+		}
+	}
+
+	if found == nil {
+		tracer.gap(index, gapMissingTransfer, fmt.Sprintf(
+			"no transfer from %s to %s accepted on channel %s between %d and %d",
+			previous.Owner, next.Owner, channel, previous.Acquired.Timestamp, next.Acquired.Timestamp))
+		return nil
+	}
+
+	return &custodyTransfer{Channel: channel, Details: *found}
+}
+
+// findPartTransfer returns the accepted transfer a partial transfer split the product off its lot for. Only the
+// part the new owner got, <lot>/2 owned by another organization than the one that split the lot, has one: nil is
+// returned for other products. A gap is recorded when the transfer can't be found or read.
+func (tracer *custodyTracer) findPartTransfer(index int, value ProductValue) *custodyTransfer {
+	if len(value.ProducedBy) == 0 {
+		return nil
+	}
+
+	transformation, err := loadTransformation(tracer.stub, value.ProducedBy)
+	if err != nil {
+		tracer.gap(index, gapUnverifiable, err.Error())
+		return nil
+	}
+	if transformation == nil || transformation.Kind != transformationSplit || len(transformation.Inputs) != 1 ||
+		transformation.Org == value.Owner || transformation.Inputs[0]+transferredSuffix != tracer.trail.ProductKey {
+		return nil
+	}
+
+	lot := transformation.Inputs[0]
+	channel := bilateralChannelName(transformation.Org, value.Owner)
+	transfers, err := tracer.loadTransfers(channel, lot)
+	if err != nil {
+		tracer.gap(index, gapUnverifiable, err.Error())
+		return nil
+	}
+
+	var found *transferDetails
+	for i, transfer := range transfers {
+		if transfer.Value.Status == transferStatusAccepted && transfer.Value.Part == tracer.trail.ProductKey &&
+			transfer.Key.RequestReceiver == transformation.Org && transfer.Key.RequestSender == value.Owner &&
+			transfer.Value.Timestamp <= transformation.Timestamp {
+			found = &transfers[i]
+		}
+	}
+
+	if found == nil {
+		tracer.gap(index, gapMissingTransfer, fmt.Sprintf(
+			"no transfer of %s from %s to %s for part %s accepted on channel %s before %d", lot,
+			transformation.Org, value.Owner, tracer.trail.ProductKey, channel, transformation.Timestamp))
+		return nil
+	}
+
+	return &custodyTransfer{Channel: channel, Details: *found}
+}
+
+// loadTransfers queries the history of transfers of the product on the channel. The peer must have joined it.
+func (tracer *custodyTracer) loadTransfers(channel, productKey string) ([]transferDetails, error) {
+	cacheKey := productKey + "@" + channel
+	if err, ok := tracer.errors[cacheKey]; ok {
+		return nil, err
+	}
+	if transfers, ok := tracer.transfers[cacheKey]; ok {
+		return transfers, nil
+	}
+
+	response := tracer.stub.InvokeChaincode(bilateralChaincodeName,
+		[][]byte{[]byte("history"), []byte(productKey)}, channel)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		err := errors.New(fmt.Sprintf("unable to read transfers of product %s from channel %s: %s",
+			productKey, channel, response.Message))
+		tracer.errors[cacheKey] = err
+		return nil, err
+	}
+
+	var transfers []transferDetails
+	if err := json.Unmarshal(response.Payload, &transfers); err != nil {
+		err = errors.New(fmt.Sprintf("unable to unmarshal transfers of product %s from channel %s: %s",
+			productKey, channel, err.Error()))
+		tracer.errors[cacheKey] = err
+		return nil, err
+	}
+
+	tracer.transfers[cacheKey] = transfers
+	return transfers, nil
+}
@@ -0,0 +1,246 @@
+package product
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"testutil"
+)
+
+// relationshipStub answers history of OwnershipChaincode with the transfers it was created with
+type relationshipStub struct {
+	transfers []transferDetails
+}
+
+func (r *relationshipStub) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (r *relationshipStub) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function != "history" {
+		return shim.Error("unexpected function " + function)
+	}
+
+	transfers := []transferDetails{}
+	for _, transfer := range r.transfers {
+		if transfer.Key.ProductKey == args[0] {
+			transfers = append(transfers, transfer)
+		}
+	}
+
+	result, err := json.Marshal(transfers)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(result)
+}
+
+func newTransfer(productKey, sender, receiver, status string, timestamp int64) transferDetails {
+	var transfer transferDetails
+	transfer.Key.ProductKey = productKey
+	transfer.Key.RequestSender = sender
+	transfer.Key.RequestReceiver = receiver
+	transfer.Value.Status = status
+	transfer.Value.Timestamp = timestamp
+	return transfer
+}
+
+func deployRelationship(stub *testutil.MockStub, channel string, transfers ...transferDetails) {
+	stub.MockPeerChaincode(bilateralChaincodeName+"/"+channel,
+		shim.NewMockStub(bilateralChaincodeName, &relationshipStub{transfers: transfers}))
+}
+
+// custodyStub registers p1 by a at 1000 and hands it over to b at 1002 and to c at 1004
+func custodyStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t)
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+
+	steps := [][]string{
+		{"initProduct", "p1", "", "1", "a", "1"},
+		{"updateProduct", "p1", "", "2", "a", "2"},
+		{"updateOwner", "p1", "a", "b", "3"},
+		{"updateProduct", "p1", "", "3", "b", "4"},
+		{"updateOwner", "p1", "b", "c", "5"},
+	}
+	invokeSteps(t, stub, steps)
+
+	return stub
+}
+
+func getCustodyTrail(t *testing.T, stub *testutil.MockStub, productKey string) custodyTrail {
+	response := stub.MockInvoke("trail", testutil.Args("getCustodyTrail", productKey))
+	if response.Status >= 400 {
+		t.Fatalf("getCustodyTrail failed: %s", response.Message)
+	}
+
+	var trail custodyTrail
+	if err := json.Unmarshal(response.Payload, &trail); err != nil {
+		t.Fatalf("cannot unmarshal custody trail: %s", err.Error())
+	}
+	return trail
+}
+
+func TestGetCustodyTrail(t *testing.T) {
+	stub := custodyStub(t)
+	deployRelationship(stub, "a-b",
+		newTransfer("p1", "b", "a", "Initiated", 1001),
+		newTransfer("p1", "b", "a", "Accepted", 1002),
+		newTransfer("p2", "b", "a", "Accepted", 1002))
+	deployRelationship(stub, "b-c",
+		newTransfer("p1", "c", "b", "Rejected", 997),
+		newTransfer("p1", "c", "b", "Accepted", 1003))
+
+	trail := getCustodyTrail(t, stub, "p1")
+
+	if !trail.Verified || len(trail.Gaps) != 0 {
+		t.Fatalf("expected a verified trail, got gaps %+v", trail.Gaps)
+	}
+
+	expected := []struct {
+		owner              string
+		acquired, released string
+		channel            string
+		transferTimestamp  int64
+	}{
+		{"a", "tx0", "tx2", "", 0},
+		{"b", "tx2", "tx4", "a-b", 1002},
+		{"c", "tx4", "", "b-c", 1003},
+	}
+	if len(trail.Entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), trail.Entries)
+	}
+
+	for i, e := range expected {
+		entry := trail.Entries[i]
+		if entry.Owner != e.owner || entry.Acquired.TxId != e.acquired {
+			t.Errorf("entry %d: expected %s acquired by %s, got %+v", i, e.owner, e.acquired, entry)
+		}
+		if (entry.Released == nil) != (e.released == "") ||
+			entry.Released != nil && entry.Released.TxId != e.released {
+			t.Errorf("entry %d: expected release by %q, got %+v", i, e.released, entry.Released)
+		}
+		if i < len(expected)-1 && entry.Released != nil && entry.Released.TxId != trail.Entries[i+1].Acquired.TxId {
+			t.Errorf("entry %d isn't released by the transaction the next one is acquired by", i)
+		}
+
+		if e.channel == "" {
+			if entry.Transfer != nil {
+				t.Errorf("entry %d: expected no transfer, got %+v", i, entry.Transfer)
+			}
+			continue
+		}
+		if entry.Transfer == nil || entry.Transfer.Channel != e.channel ||
+			entry.Transfer.Details.Value.Timestamp != e.transferTimestamp ||
+			entry.Transfer.Details.Key.RequestSender != e.owner {
+			t.Errorf("entry %d: expected transfer on %s at %d, got %+v", i, e.channel, e.transferTimestamp,
+				entry.Transfer)
+		}
+	}
+}
+
+func TestGetCustodyTrailGaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		transfers map[string][]transferDetails
+		kinds     []string
+	}{
+		{"channels unavailable", map[string][]transferDetails{},
+			[]string{gapUnverifiable, gapUnverifiable}},
+		{"no transfers", map[string][]transferDetails{"a-b": {}, "b-c": {}},
+			[]string{gapMissingTransfer, gapMissingTransfer}},
+		{"not accepted", map[string][]transferDetails{
+			"a-b": {newTransfer("p1", "b", "a", "Accepted", 1002)},
+			"b-c": {newTransfer("p1", "c", "b", "Cancelled", 1003)},
+		}, []string{gapMissingTransfer}},
+		{"reversed", map[string][]transferDetails{
+			"a-b": {newTransfer("p1", "a", "b", "Accepted", 1002)},
+			"b-c": {newTransfer("p1", "c", "b", "Accepted", 1003)},
+		}, []string{gapMissingTransfer}},
+		{"accepted before the previous owner acquired", map[string][]transferDetails{
+			"a-b": {newTransfer("p1", "b", "a", "Accepted", 1002)},
+			"b-c": {newTransfer("p1", "c", "b", "Accepted", 1001)},
+		}, []string{gapMissingTransfer}},
+		{"accepted after the owner changed", map[string][]transferDetails{
+			"a-b": {newTransfer("p1", "b", "a", "Accepted", 1005)},
+			"b-c": {newTransfer("p1", "c", "b", "Accepted", 1003)},
+		}, []string{gapMissingTransfer}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := custodyStub(t)
+			for channel, transfers := range test.transfers {
+				deployRelationship(stub, channel, transfers...)
+			}
+
+			trail := getCustodyTrail(t, stub, "p1")
+
+			if trail.Verified || len(trail.Gaps) != len(test.kinds) {
+				t.Fatalf("expected gaps %v, got %+v", test.kinds, trail.Gaps)
+			}
+			for i, kind := range test.kinds {
+				gap := trail.Gaps[i]
+				if gap.Kind != kind || gap.Entry == 0 || trail.Entries[gap.Entry].Transfer != nil {
+					t.Errorf("gap %d: expected %s on an entry without transfer, got %+v", i, kind, gap)
+				}
+			}
+			if len(trail.Entries) != 3 || trail.Entries[2].Owner != "c" {
+				t.Errorf("gaps must not break the trail, got %+v", trail.Entries)
+			}
+		})
+	}
+}
+
+func TestGetCustodyTrailDeletedProduct(t *testing.T) {
+	stub := custodyStub(t)
+	deployRelationship(stub, "a-b", newTransfer("p1", "b", "a", "Accepted", 1002))
+	deployRelationship(stub, "b-c", newTransfer("p1", "c", "b", "Accepted", 1003))
+
+	product := Product{Key: ProductKey{Name: "p1"}}
+	key, _ := product.ToCompositeKey(stub)
+	stub.MockTransactionStart("delete")
+	stub.DelState(key)
+	stub.MockTransactionEnd("delete")
+
+	if response := stub.MockInvoke("recreate", testutil.Args("initProduct", "p1", "", "1", "c", "6")); response.Status >= 400 {
+		t.Fatalf("initProduct failed: %s", response.Message)
+	}
+
+	trail := getCustodyTrail(t, stub, "p1")
+
+	if len(trail.Entries) != 4 || trail.Entries[2].Released == nil || trail.Entries[2].Released.TxId != "delete" {
+		t.Fatalf("expected the custody of c to end with the deletion, got %+v", trail.Entries)
+	}
+	if trail.Verified || len(trail.Gaps) != 1 || trail.Gaps[0].Kind != gapDeleted || trail.Gaps[0].Entry != 3 {
+		t.Fatalf("expected a deletion gap before the last entry, got %+v", trail.Gaps)
+	}
+}
+
+func TestGetCustodyTrailErrors(t *testing.T) {
+	stub := custodyStub(t)
+
+	response := stub.MockInvoke("trail", testutil.Args("getCustodyTrail", "p2"))
+	if response.Status != 404 || !strings.Contains(response.Message, "doesn't exist") {
+		t.Errorf("expected 404 for an unknown product, got %d %q", response.Status, response.Message)
+	}
+
+	response = stub.MockInvoke("trail", testutil.Args("getCustodyTrail"))
+	if response.Status < 400 {
+		t.Errorf("expected an error without a product key")
+	}
+}
+
+func TestBilateralChannelName(t *testing.T) {
+	if name := bilateralChannelName("b", "a"); name != "a-b" {
+		t.Errorf("expected a-b, got %s", name)
+	}
+	if name := bilateralChannelName("a", "c"); name != "a-c" {
+		t.Errorf("expected a-c, got %s", name)
+	}
+}
@@ -0,0 +1,52 @@
+package product
+
+import (
+	"encoding/json"
+	"testing"
+
+	"testutil"
+)
+
+func TestAttachDocument(t *testing.T) {
+	stub := getInitializedStub(t)
+	const hash = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	identities := testutil.NewIdentities(t, "a", "b")
+
+	if response := stub.MockInvoke("tx1", testutil.Args("initProduct", "p1", "first", "1", "a", "100")); response.Status >= 400 {
+		t.Fatalf("initProduct failed: %s", response.Message)
+	}
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"b", []string{"attachDocument", "p1", hash, "invoice", "a"}, 403},
+		{"a", []string{"attachDocument", "p2", hash, "invoice", "a"}, 404},
+		{"a", []string{"attachDocument", "p1", "not a hash", "invoice", "a"}, 500},
+		{"a", []string{"attachDocument", "p1", hash, "invoice"}, 500},
+		{"a", []string{"attachDocument", "p1", hash, "invoice", "a", "https://docs/1"}, 200},
+		{"a", []string{"attachDocument", "p1", hash, "invoice", "a"}, 409},
+		{"b", []string{"verifyDocument", "p1", hash}, 200},
+		{"b", []string{"verifyDocument", "p2", hash}, 404},
+		{"b", []string{"listDocuments", "p2"}, 404},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "document", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	// the attachment is a new version of the product
+	response := stub.MockInvoke("history", testutil.Args("getHistoryForProduct", "p1"))
+	var history []productHistory
+	if err := json.Unmarshal(response.Payload, &history); err != nil {
+		t.Fatalf("cannot unmarshal history: %s", err.Error())
+	}
+	if len(history) != 2 || history[0].Value.LastDocument != "" || history[1].Value.LastDocument != hash {
+		t.Errorf("expected the attachment in the history of p1, got %+v", history)
+	}
+}
@@ -0,0 +1,198 @@
+package product
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// transientEncryptionKey is the transient field with the AES key, 16, 24 or 32 bytes long. Encryptable fields
+// may be passed in the transient map under their JSON names too, so that their plain values don't get into the
+// block with the arguments.
+const transientEncryptionKey = "encryptionKey"
+
+// encryptedMarker is the JSON name of ProductValue.Encrypted
+const encryptedMarker = "encrypted"
+
+// encryptableFields are the fields of ProductValue that may be stored encrypted, in the order they are listed in
+// the encrypted marker. Owner, state and lastUpdated can't be: indexes, queries and the state machine read them.
+var encryptableFields = []string{"desc"}
+
+// encryptableField returns the address of the field of the product value by its JSON name
+func encryptableField(value *ProductValue, field string) *string {
+	switch field {
+	case "desc":
+		return &value.Desc
+	}
+
+	return nil
+}
+
+// fieldCipher encrypts fields of product values with AES-GCM. A field is stored as base64 of the nonce followed by
+// the ciphertext, and the product key and the field name are authenticated with it, so a ciphertext can't be
+// moved to another product or field.
+type fieldCipher struct {
+	key  []byte
+	aead cipher.AEAD
+}
+
+func newFieldCipher(key []byte) (*fieldCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("transient field %s is invalid: must be an AES key of 16, 24 or 32 bytes",
+			transientEncryptionKey))
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fieldCipher{key: key, aead: aead}, nil
+}
+
+// transientFieldCipher makes a cipher of the key passed in the transient map. It returns nil if there is none.
+func transientFieldCipher(stub shim.ChaincodeStubInterface) (*fieldCipher, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := transient[transientEncryptionKey]
+	if !ok {
+		return nil, nil
+	}
+
+	return newFieldCipher(key)
+}
+
+func associatedData(key ProductKey, field string) []byte {
+	return []byte(key.Name + "\x00" + field)
+}
+
+// nonce derives the nonce from the key and the transaction, so every endorser writes the same ciphertext, and
+// a field of a product written by another transaction gets another nonce
+func (c *fieldCipher) nonce(txId string, key ProductKey, field string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(txId + "\x00" + key.Name + "\x00" + field))
+	return mac.Sum(nil)[:c.aead.NonceSize()]
+}
+
+func (c *fieldCipher) seal(txId string, key ProductKey, field, plaintext string) string {
+	nonce := c.nonce(txId, key, field)
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(plaintext), associatedData(key, field)))
+}
+
+func (c *fieldCipher) open(key ProductKey, field, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, associatedData(key, field))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// encryptedFields returns the fields listed in the encrypted marker of the value
+func encryptedFields(value ProductValue) []string {
+	if len(value.Encrypted) == 0 {
+		return nil
+	}
+
+	return strings.Split(value.Encrypted, ",")
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyEncryption encrypts the fields of the product being written according to the transient map. With a key,
+// the fields passed in the transient map are encrypted, or all encryptable fields if none is. Without a key, a
+// field of the previous value stays encrypted only as long as it is written back unchanged, as ciphertext.
+func (product *Product) applyEncryption(stub shim.ChaincodeStubInterface, previous *ProductValue) error {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return err
+	}
+
+	c, err := transientFieldCipher(stub)
+	if err != nil {
+		return err
+	}
+
+	chosen := []string{}
+	if c != nil {
+		for _, field := range encryptableFields {
+			if plaintext, ok := transient[field]; ok {
+				*encryptableField(&product.Value, field) = string(plaintext)
+				chosen = append(chosen, field)
+			}
+		}
+		if len(chosen) == 0 {
+			chosen = encryptableFields
+		}
+	}
+
+	encrypted := []string{}
+	for _, field := range encryptableFields {
+		value := encryptableField(&product.Value, field)
+
+		if containsField(chosen, field) {
+			*value = c.seal(stub.GetTxID(), product.Key, field, *value)
+			encrypted = append(encrypted, field)
+		} else if previous != nil && containsField(encryptedFields(*previous), field) &&
+			*value == *encryptableField(previous, field) {
+			encrypted = append(encrypted, field)
+		}
+	}
+
+	product.Value.Encrypted = strings.Join(encrypted, ",")
+	return nil
+}
+
+// decrypt replaces the encrypted fields of the value with their plain values and drops the marker. If the cipher
+// is nil or any of the fields was encrypted with another key, the value is left as it is.
+func (c *fieldCipher) decrypt(key ProductKey, value *ProductValue) {
+	fields := encryptedFields(*value)
+	if c == nil || len(fields) == 0 {
+		return
+	}
+
+	plain := *value
+	for _, field := range fields {
+		sealed := encryptableField(&plain, field)
+		if sealed == nil {
+			return
+		}
+
+		plaintext, err := c.open(key, field, *sealed)
+		if err != nil {
+			return
+		}
+		*sealed = plaintext
+	}
+
+	plain.Encrypted = ""
+	*value = plain
+}
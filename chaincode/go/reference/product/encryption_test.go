@@ -0,0 +1,220 @@
+package product
+
+import (
+	"encoding/json"
+	"testing"
+
+	"testutil"
+)
+
+var (
+	encryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	otherKey      = []byte("fedcba9876543210fedcba9876543210")
+)
+
+// readWith reads the product passing the transient map, nil for none
+func readWith(t *testing.T, stub *testutil.MockStub, transient map[string][]byte, name string) ProductValue {
+	stub.Transient = transient
+	defer func() { stub.Transient = nil }()
+
+	response := stub.MockInvoke("read", testutil.Args("readProduct", name))
+	if response.Status >= 400 {
+		t.Fatalf("readProduct failed: %s", response.Message)
+	}
+
+	var product Product
+	if err := json.Unmarshal(response.Payload, &product); err != nil {
+		t.Fatalf("cannot unmarshal product: %s", err.Error())
+	}
+
+	return product.Value
+}
+
+func invokeWith(t *testing.T, stub *testutil.MockStub, transient map[string][]byte, txId string, args ...string) {
+	stub.Transient = transient
+	defer func() { stub.Transient = nil }()
+
+	if response := stub.MockInvoke(txId, testutil.Args(args...)); response.Status >= 400 {
+		t.Fatalf("%s failed: %s", args[0], response.Message)
+	}
+}
+
+func TestFieldEncryption(t *testing.T) {
+	stub := getInitializedStub(t)
+	key := map[string][]byte{transientEncryptionKey: encryptionKey}
+
+	// the description is passed in the transient map, so the argument is empty
+	invokeWith(t, stub, map[string][]byte{transientEncryptionKey: encryptionKey, "desc": []byte("secret recipe")},
+		"tx1", "initProduct", "p1", "", "1", "a", "100")
+
+	stored := readWith(t, stub, nil, "p1")
+	if stored.Encrypted != "desc" || stored.Desc == "secret recipe" || len(stored.Desc) == 0 {
+		t.Fatalf("expected an encrypted description with the marker, got %+v", stored)
+	}
+	if value := readWith(t, stub, key, "p1"); value.Desc != "secret recipe" || value.Encrypted != "" {
+		t.Errorf("expected the plain description for the key holder, got %+v", value)
+	}
+	if value := readWith(t, stub, map[string][]byte{transientEncryptionKey: otherKey}, "p1"); value != stored {
+		t.Errorf("expected the ciphertext for another key, got %+v", value)
+	}
+
+	// an update without the key that writes the ciphertext back keeps the description encrypted
+	invokeWith(t, stub, nil, "tx2", "updateProduct", "p1", stored.Desc, "2", "a", "200")
+	if value := readWith(t, stub, key, "p1"); value.Desc != "secret recipe" || value.State != stateActive {
+		t.Errorf("expected the description to stay encrypted, got %+v", value)
+	}
+
+	// the same plain value encrypted by another transaction gets another nonce
+	invokeWith(t, stub, key, "tx3", "updateProduct", "p1", "secret recipe", "2", "a", "300")
+	if value := readWith(t, stub, nil, "p1"); value.Encrypted != "desc" || value.Desc == stored.Desc {
+		t.Errorf("expected a new ciphertext, got %+v", value)
+	}
+
+	// a new plain description without the key drops the marker
+	invokeWith(t, stub, nil, "tx4", "updateProduct", "p1", "public recipe", "2", "a", "400")
+	if value := readWith(t, stub, nil, "p1"); value.Desc != "public recipe" || value.Encrypted != "" {
+		t.Errorf("expected a plain description, got %+v", value)
+	}
+}
+
+func TestFieldEncryptionQueries(t *testing.T) {
+	stub := getInitializedStub(t)
+	key := map[string][]byte{transientEncryptionKey: encryptionKey}
+
+	invokeWith(t, stub, key, "tx1", "initProduct", "p1", "secret recipe", "1", "a", "100")
+	invokeWith(t, stub, nil, "tx2", "initProduct", "p2", "public recipe", "1", "a", "100")
+
+	for _, test := range []struct {
+		transient map[string][]byte
+		expected  map[string]string
+	}{
+		{nil, map[string]string{"p2": "public recipe"}},
+		{key, map[string]string{"p1": "secret recipe", "p2": "public recipe"}},
+	} {
+		stub.Transient = test.transient
+		response := stub.MockInvoke("query", testutil.Args("queryProductsByOwner", "a", "", "", "", "desc"))
+		stub.Transient = nil
+		if response.Status >= 400 {
+			t.Fatalf("queryProductsByOwner failed: %s", response.Message)
+		}
+
+		var page productPage
+		if err := json.Unmarshal(response.Payload, &page); err != nil {
+			t.Fatalf("cannot unmarshal page: %s", err.Error())
+		}
+
+		for _, record := range page.Records {
+			_, encrypted := record.Value[encryptedMarker]
+			expected, plain := test.expected[record.Key.Name]
+			if plain && (encrypted || record.Value["desc"] != expected) {
+				t.Errorf("expected %s to read %q, got %v", record.Key.Name, expected, record.Value)
+			}
+			if !plain && !encrypted {
+				t.Errorf("expected %s to come with the encrypted marker, got %v", record.Key.Name, record.Value)
+			}
+		}
+	}
+
+	stub.Transient = key
+	response := stub.MockInvoke("history", testutil.Args("getHistoryForProduct", "p1"))
+	stub.Transient = nil
+
+	var history []productHistory
+	if err := json.Unmarshal(response.Payload, &history); err != nil {
+		t.Fatalf("cannot unmarshal history: %s", err.Error())
+	}
+	if len(history) != 1 || history[0].Value.Desc != "secret recipe" {
+		t.Errorf("expected the decrypted history, got %+v", history)
+	}
+}
+
+// payloadWith invokes the function passing the transient map and returns the payload
+func payloadWith(t *testing.T, stub *testutil.MockStub, transient map[string][]byte, args ...string) []byte {
+	stub.Transient = transient
+	defer func() { stub.Transient = nil }()
+
+	response := stub.MockInvoke("read", testutil.Args(args...))
+	if response.Status >= 400 {
+		t.Fatalf("%s failed: %s", args[0], response.Message)
+	}
+
+	return response.Payload
+}
+
+func TestFieldEncryptionExports(t *testing.T) {
+	stub := getInitializedStub(t)
+	key := map[string][]byte{transientEncryptionKey: encryptionKey}
+
+	invokeWith(t, stub, key, "tx1", "initProduct", "p1", "secret recipe", "1", "a", "100")
+	stored := readWith(t, stub, nil, "p1")
+
+	for _, test := range []struct {
+		transient map[string][]byte
+		desc      string
+	}{{nil, stored.Desc}, {key, "secret recipe"}} {
+		var export productExportPage
+		if err := json.Unmarshal(payloadWith(t, stub, test.transient, "exportProducts", "", "", "true"),
+			&export); err != nil {
+			t.Fatalf("cannot unmarshal export: %s", err.Error())
+		}
+		if len(export.Records) != 1 || export.Records[0].Value.Desc != test.desc ||
+			len(export.Records[0].History) != 1 || export.Records[0].History[0].Value.Desc != test.desc {
+			t.Errorf("expected the export to read %q, got %+v", test.desc, export)
+		}
+
+		var changes productChangePage
+		if err := json.Unmarshal(payloadWith(t, stub, test.transient, "productsChangedSince", "0"),
+			&changes); err != nil {
+			t.Fatalf("cannot unmarshal changes: %s", err.Error())
+		}
+		if len(changes.Changes) != 1 || changes.Changes[0].Value.Desc != test.desc {
+			t.Errorf("expected the change to read %q, got %+v", test.desc, changes)
+		}
+
+		var snapshot InventorySnapshot
+		if err := json.Unmarshal(payloadWith(t, stub, test.transient, "getInventorySnapshot", "2000000000"),
+			&snapshot); err != nil {
+			t.Fatalf("cannot unmarshal snapshot: %s", err.Error())
+		}
+		if len(snapshot.Inventories) != 1 || snapshot.Inventories[0].Products[0].Value.Desc != test.desc {
+			t.Errorf("expected the snapshot to read %q, got %+v", test.desc, snapshot)
+		}
+	}
+}
+
+func TestFieldEncryptionLots(t *testing.T) {
+	stub := getInitializedStub(t)
+	key := map[string][]byte{transientEncryptionKey: encryptionKey}
+
+	invokeWith(t, stub, key, "tx1", "initProduct", "w1", "secret blend", "1", "a", "100")
+	invokeWith(t, stub, nil, "tx2", "setQuantity", "w1", "1000", "kg")
+
+	// the description of the children can't be sealed without the key
+	if response := stub.MockInvoke("tx3", testutil.Args("splitLot", "s1", "w1", "w2", "600", "w3",
+		"400")); response.Status < 400 {
+		t.Fatal("expected an error for a split of an encrypted lot without the key")
+	}
+
+	invokeWith(t, stub, key, "tx4", "splitLot", "s1", "w1", "w2", "600", "w3", "400")
+	invokeWith(t, stub, key, "tx5", "mergeLots", "m1", "w4", "w2", "w3")
+	for _, name := range []string{"w2", "w3", "w4"} {
+		if value := readWith(t, stub, nil, name); value.Encrypted != "desc" || value.Desc == "secret blend" {
+			t.Errorf("expected %s to keep the description encrypted, got %+v", name, value)
+		}
+		if value := readWith(t, stub, key, name); value.Desc != "secret blend" {
+			t.Errorf("expected %s to read the description of w1 with the key, got %+v", name, value)
+		}
+	}
+}
+
+func TestFieldEncryptionErrors(t *testing.T) {
+	stub := getInitializedStub(t)
+
+	stub.Transient = map[string][]byte{transientEncryptionKey: []byte("short")}
+	if response := stub.MockInvoke("tx1", testutil.Args("initProduct", "p1", "x", "1", "a", "100")); response.Status < 400 {
+		t.Error("expected an error for a key of 5 bytes")
+	}
+	if response := stub.MockInvoke("tx2", testutil.Args("readProduct", "p1")); response.Status < 400 {
+		t.Error("expected an error for a read with a key of 5 bytes")
+	}
+}
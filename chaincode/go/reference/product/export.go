@@ -0,0 +1,116 @@
+package product
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"params"
+)
+
+// productExport is a product with, on request, all of its versions oldest first
+type productExport struct {
+	Key     ProductKey            `json:"key"`
+	Value   ProductValue          `json:"value"`
+	History []ProductModification `json:"history,omitempty"`
+}
+
+// productExportPage is a response of exportProducts. Bookmark is empty on the last page.
+type productExportPage struct {
+	Records  []productExport `json:"records"`
+	Bookmark string          `json:"bookmark"`
+}
+
+// exportRequest pages through all products in the order of their keys. Cipher, if set, decrypts the values.
+type exportRequest struct {
+	params.Export
+	Cipher *fieldCipher
+}
+
+// Execute reads the page of products. The bookmark is the name of the last product of the previous page, as for
+// reindexProducts: keys come in the order of the names. Fabric 1.1 can't start a range of composite keys in the
+// middle, so the page still scans the keys before the bookmark.
+func (request exportRequest) Execute(stub shim.ChaincodeStubInterface) (productExportPage, error) {
+	it, err := stub.GetStateByPartialCompositeKey(productIndex, []string{})
+	if err != nil {
+		return productExportPage{}, err
+	}
+	defer it.Close()
+
+	page := productExportPage{Records: []productExport{}}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return productExportPage{}, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return productExportPage{}, err
+		}
+
+		if len(compositeKeyParts) > 0 && compositeKeyParts[0] <= request.Bookmark {
+			continue
+		}
+		if len(page.Records) == request.PageSize {
+			page.Bookmark = page.Records[len(page.Records)-1].Key.Name
+			break
+		}
+
+		var record productExport
+		if err := record.fill(stub, request.Cipher, compositeKeyParts, response.Key, response.Value,
+			request.WithHistory); err != nil {
+			return productExportPage{}, err
+		}
+
+		page.Records = append(page.Records, record)
+	}
+
+	return page, nil
+}
+
+func (record *productExport) fill(stub shim.ChaincodeStubInterface, c *fieldCipher, compositeKeyParts []string,
+	compositeKey string, value []byte, withHistory bool) error {
+	var product Product
+	if err := product.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+		return err
+	}
+	if err := product.FillFromLedgerValue(value); err != nil {
+		return err
+	}
+
+	c.decrypt(product.Key, &product.Value)
+	record.Key, record.Value = product.Key, product.Value
+	if !withHistory {
+		return nil
+	}
+
+	historyIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return err
+	}
+	defer historyIterator.Close()
+
+	record.History = []ProductModification{}
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		entry := ProductModification{Key: product.Key, TxId: modification.TxId, IsDelete: modification.IsDelete}
+		if modification.Timestamp != nil {
+			entry.Timestamp = modification.Timestamp.Seconds
+		}
+		if !modification.IsDelete {
+			if err := json.Unmarshal(modification.Value, &entry.Value); err != nil {
+				return err
+			}
+			c.decrypt(product.Key, &entry.Value)
+		}
+
+		record.History = append(record.History, entry)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"testutil"
+)
+
+func exportPage(t *testing.T, stub *testutil.MockStub, args ...string) productExportPage {
+	response := stub.MockInvoke("export", testutil.Args(append([]string{"exportProducts"}, args...)...))
+	if response.Status >= 400 {
+		t.Fatalf("exportProducts failed: %s", response.Message)
+	}
+
+	var page productExportPage
+	if err := json.Unmarshal(response.Payload, &page); err != nil {
+		t.Fatalf("cannot unmarshal export page: %s", err.Error())
+	}
+	return page
+}
+
+func TestExportProducts(t *testing.T) {
+	stub := getInitializedStub(t)
+	for i := 0; i < 7; i++ {
+		putProduct(t, stub, Product{Key: ProductKey{Name: fmt.Sprintf("p%d", i)},
+			Value: ProductValue{Desc: "desc", State: stateRegistered, Owner: "a", LastUpdated: i}})
+	}
+
+	for _, pageSize := range []int{1, 3, 7, 10} {
+		t.Run(fmt.Sprint(pageSize), func(t *testing.T) {
+			names, bookmark, pages := []string{}, "", 0
+			for {
+				page := exportPage(t, stub, fmt.Sprint(pageSize), bookmark)
+				pages++
+				if len(page.Records) > pageSize {
+					t.Fatalf("page of %d records exceeds the page size", len(page.Records))
+				}
+				for _, record := range page.Records {
+					if record.History != nil {
+						t.Errorf("history of %s was not requested", record.Key.Name)
+					}
+					names = append(names, record.Key.Name)
+				}
+
+				if bookmark = page.Bookmark; bookmark == "" {
+					break
+				}
+			}
+
+			if expected := []string{"p0", "p1", "p2", "p3", "p4", "p5", "p6"}; !reflect.DeepEqual(names, expected) {
+				t.Errorf("expected %v, got %v", expected, names)
+			}
+			if expected := (7 + pageSize - 1) / pageSize; pages != expected {
+				t.Errorf("expected %d pages, got %d", expected, pages)
+			}
+		})
+	}
+}
+
+func TestExportProductsWithHistory(t *testing.T) {
+	stub := snapshotStub(t)
+
+	page := exportPage(t, stub, "", "", "true")
+
+	if len(page.Records) != 2 || page.Bookmark != "" {
+		t.Fatalf("expected both products on a single page, got %+v", page)
+	}
+
+	for i, test := range []struct {
+		owner string
+		txIDs []string
+	}{{"b", []string{"tx0", "tx2"}}, {"c", []string{"tx1", "tx3", "tx4"}}} {
+		record := page.Records[i]
+
+		txIDs := []string{}
+		for _, modification := range record.History {
+			if modification.Key != record.Key {
+				t.Errorf("modification of %s has key %s", record.Key.Name, modification.Key.Name)
+			}
+			txIDs = append(txIDs, modification.TxId)
+		}
+		if record.Value.Owner != test.owner || !reflect.DeepEqual(txIDs, test.txIDs) {
+			t.Errorf("%s: expected owner %s and history %v, got %s and %v", record.Key.Name, test.owner,
+				test.txIDs, record.Value.Owner, txIDs)
+		}
+		if last := record.History[len(record.History)-1]; last.Value != record.Value {
+			t.Errorf("%s: the last version of history differs from the state", record.Key.Name)
+		}
+	}
+}
+
+func TestExportProductsErrors(t *testing.T) {
+	stub := getInitializedStub(t)
+
+	for _, args := range [][]string{{"0"}, {"1001"}, {"x"}, {"10", "", "yes"}} {
+		response := stub.MockInvoke("export", testutil.Args(append([]string{"exportProducts"}, args...)...))
+		if response.Status < 400 {
+			t.Errorf("expected an error for arguments %v", args)
+		}
+	}
+
+	if page := exportPage(t, stub, "10", "~"); len(page.Records) != 0 || page.Bookmark != "" {
+		t.Errorf("expected an empty last page past the end, got %+v", page)
+	}
+}
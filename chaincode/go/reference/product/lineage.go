@@ -0,0 +1,204 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	transformationIndex = "Transformation"
+	// transformationEventName is the event transform emits with the transformation
+	transformationEventName = "Transformation.Completed"
+
+	traceForward  = "forward"
+	traceBackward = "backward"
+
+	defaultTraceDepth = 10
+	maxTraceDepth     = 100
+)
+
+// Transformation turns input products into output products, e.g. raw materials into finished goods. The inputs
+// are consumed, the outputs are created by Org, the organization that owned the inputs. Kind is split or merge for
+// transformations that only divide or combine lots of bulk goods, empty for manufacturing.
+type Transformation struct {
+	ID        string   `json:"id"`
+	Kind      string   `json:"kind,omitempty"`
+	Inputs    []string `json:"inputs"`
+	Outputs   []string `json:"outputs"`
+	Org       string   `json:"org"`
+	TxId      string   `json:"txId"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// LineageNode is a product reached by a trace, Depth transformations away from the product the trace started at
+type LineageNode struct {
+	Product string `json:"product"`
+	Owner   string `json:"owner"`
+	State   int    `json:"state"`
+	Depth   int    `json:"depth"`
+}
+
+// LineageEdge links an input of a transformation to one of its outputs
+type LineageEdge struct {
+	Input          string `json:"input"`
+	Output         string `json:"output"`
+	Transformation string `json:"transformation"`
+}
+
+// Lineage is the part of the lineage graph a trace walked: the products in the order they were reached and the
+// edges between them. Truncated tells that the graph goes on beyond Depth.
+type Lineage struct {
+	Product   string        `json:"product"`
+	Direction string        `json:"direction"`
+	Depth     int           `json:"depth"`
+	Nodes     []LineageNode `json:"nodes"`
+	Edges     []LineageEdge `json:"edges"`
+	Truncated bool          `json:"truncated"`
+}
+
+// parseTraceDepth reads the number of transformations a trace walks through
+func parseTraceDepth(s string) (int, error) {
+	if len(s) == 0 {
+		return defaultTraceDepth, nil
+	}
+
+	depth, err := strconv.Atoi(s)
+	if err != nil || depth <= 0 || depth > maxTraceDepth {
+		return 0, errors.New(fmt.Sprintf("trace depth is invalid: %s (must be from 1 to %d)", s, maxTraceDepth))
+	}
+
+	return depth, nil
+}
+
+func transformationKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(transformationIndex, []string{id})
+}
+
+// loadTransformation reads the transformation, nil if there is none with the id
+func loadTransformation(stub shim.ChaincodeStubInterface, id string) (*Transformation, error) {
+	key, err := transformationKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var transformation Transformation
+	if err := json.Unmarshal(data, &transformation); err != nil {
+		return nil, err
+	}
+
+	return &transformation, nil
+}
+
+// store saves the transformation and emits it as an event
+func (transformation *Transformation) store(stub shim.ChaincodeStubInterface) error {
+	key, err := transformationKey(stub, transformation.ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(transformation)
+	if err != nil {
+		return err
+	}
+
+	if err := stub.PutState(key, value); err != nil {
+		return err
+	}
+
+	return stub.SetEvent(transformationEventName, value)
+}
+
+// apply consumes the inputs, writes the outputs as produced by the transformation, then stores the transformation
+func (transformation *Transformation) apply(stub shim.ChaincodeStubInterface, inputs, outputs []Product) error {
+	for _, product := range inputs {
+		product.Value.State = stateConsumed
+		product.Value.ConsumedBy = transformation.ID
+		product.Value.LastUpdated = int(transformation.Timestamp)
+		if err := product.UpdateOrInsertIn(stub); err != nil {
+			return err
+		}
+	}
+	for _, product := range outputs {
+		product.Value.ProducedBy = transformation.ID
+		if err := product.UpdateOrInsertIn(stub); err != nil {
+			return err
+		}
+	}
+
+	return transformation.store(stub)
+}
+
+// traceLineage walks the lineage graph from the product through at most depth transformations: backward to the
+// inputs it was made of, or forward to the outputs it went into. Every product is visited once.
+func traceLineage(stub shim.ChaincodeStubInterface, root Product, direction string, depth int) (Lineage, error) {
+	lineage := Lineage{Product: root.Key.Name, Direction: direction, Depth: depth, Nodes: []LineageNode{},
+		Edges: []LineageEdge{}}
+
+	visited := map[string]bool{root.Key.Name: true}
+	level := []Product{root}
+	lineage.Nodes = append(lineage.Nodes, LineageNode{Product: root.Key.Name, Owner: root.Value.Owner,
+		State: root.Value.State})
+
+	for d := 1; len(level) > 0; d++ {
+		next := []Product{}
+		for _, product := range level {
+			id := product.Value.ProducedBy
+			if direction == traceForward {
+				id = product.Value.ConsumedBy
+			}
+			if len(id) == 0 {
+				continue
+			}
+			if d > depth {
+				lineage.Truncated = true
+				return lineage, nil
+			}
+
+			transformation, err := loadTransformation(stub, id)
+			if err != nil {
+				return lineage, err
+			}
+			if transformation == nil {
+				return lineage, errors.New(fmt.Sprintf("transformation %s of product %s doesn't exist", id,
+					product.Key.Name))
+			}
+
+			linked := transformation.Inputs
+			if direction == traceForward {
+				linked = transformation.Outputs
+			}
+			for _, name := range linked {
+				edge := LineageEdge{Input: name, Output: product.Key.Name, Transformation: id}
+				if direction == traceForward {
+					edge = LineageEdge{Input: product.Key.Name, Output: name, Transformation: id}
+				}
+				lineage.Edges = append(lineage.Edges, edge)
+
+				if visited[name] {
+					continue
+				}
+				visited[name] = true
+
+				linkedProduct := Product{Key: ProductKey{Name: name}}
+				if err := linkedProduct.LoadFrom(stub); err != nil {
+					return lineage, err
+				}
+				lineage.Nodes = append(lineage.Nodes, LineageNode{Product: name, Owner: linkedProduct.Value.Owner,
+					State: linkedProduct.Value.State, Depth: d})
+				next = append(next, linkedProduct)
+			}
+		}
+		level = next
+	}
+
+	return lineage, nil
+}
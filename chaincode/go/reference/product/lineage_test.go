@@ -0,0 +1,162 @@
+package product
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"testutil"
+)
+
+// lineageStub makes m1 of p1 and p2, then f1 and f2 of m1 and p3, all by a
+func lineageStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t)
+
+	invokeSteps(t, stub, [][]string{
+		{"initProduct", "p1", "raw", "1", "a", "100"},
+		{"initProduct", "p2", "raw", "1", "a", "100"},
+		{"initProduct", "p3", "raw", "1", "a", "100"},
+		{"transform", "t1", "2", "p1", "p2", "m1", "blend"},
+		{"transform", "t2", "2", "m1", "p3", "f1", "bottle", "f2", "can"},
+	})
+
+	return stub
+}
+
+func trace(t *testing.T, stub *testutil.MockStub, args ...string) Lineage {
+	response := stub.MockInvoke("trace", testutil.Args(args...))
+	if response.Status >= 400 {
+		t.Fatalf("%s failed: %s", args[0], response.Message)
+	}
+
+	var lineage Lineage
+	if err := json.Unmarshal(response.Payload, &lineage); err != nil {
+		t.Fatalf("cannot unmarshal lineage: %s", err.Error())
+	}
+
+	return lineage
+}
+
+func nodeNames(lineage Lineage) []string {
+	names := []string{}
+	for _, node := range lineage.Nodes {
+		names = append(names, node.Product)
+	}
+	return names
+}
+
+func TestTransform(t *testing.T) {
+	stub := lineageStub(t)
+
+	other, err := testutil.NewIdentity("b")
+	if err != nil {
+		t.Fatalf("cannot generate identity of b: %s", err.Error())
+	}
+	if response := stub.MockInvoke("init", testutil.Args("initProduct", "p4", "raw", "1", "a", "100")); response.Status >= 400 {
+		t.Fatalf("initProduct failed: %s", response.Message)
+	}
+
+	for _, test := range []struct {
+		args     []string
+		expected int32
+	}{
+		{[]string{"transform", "t3", "1", "p4"}, 500},
+		{[]string{"transform", "t3", "0", "p4", "x1", "desc"}, 500},
+		{[]string{"transform", "t3", "2", "p4", "x1", "desc"}, 500},
+		{[]string{"transform", "t3", "1", "p4", "x1", "desc", "x2"}, 500},
+		{[]string{"transform", "t3", "2", "p4", "p4", "x1", "desc"}, 500},
+		{[]string{"transform", "t3", "1", "p4", "p4", "desc"}, 500},
+		{[]string{"transform", "t1", "1", "p4", "x1", "desc"}, 409},
+		{[]string{"transform", "t3", "1", "p9", "x1", "desc"}, 404},
+		{[]string{"transform", "t3", "1", "p1", "x1", "desc"}, 409},
+		{[]string{"transform", "t3", "1", "p4", "f1", "desc"}, 409},
+		{[]string{"updateOwner", "p1", "a", "b", "200"}, 409},
+		{[]string{"readTransformation", "t9"}, 404},
+	} {
+		response := stub.MockInvoke("transform", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("%v: expected status %d, got %d: %s", test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	if response := stub.MockInvokeAs(other, "transform", testutil.Args("transform", "t3", "1", "p4", "x1",
+		"desc")); response.Status != 403 {
+		t.Errorf("expected status 403 for an input of another organization, got %d: %s", response.Status,
+			response.Message)
+	}
+
+	for _, test := range []struct {
+		name     string
+		state    int
+		produced string
+		consumed string
+	}{
+		{"p1", stateConsumed, "", "t1"},
+		{"m1", stateConsumed, "t1", "t2"},
+		{"f1", stateRegistered, "t2", ""},
+		{"f2", stateRegistered, "t2", ""},
+	} {
+		product := Product{Key: ProductKey{Name: test.name}}
+		if err := product.LoadFrom(stub); err != nil {
+			t.Fatalf("cannot load %s: %s", test.name, err.Error())
+		}
+		if product.Value.State != test.state || product.Value.ProducedBy != test.produced ||
+			product.Value.ConsumedBy != test.consumed || product.Value.Owner != "a" {
+			t.Errorf("%s: expected state %d produced by %q and consumed by %q, got %+v", test.name, test.state,
+				test.produced, test.consumed, product.Value)
+		}
+	}
+
+	response := stub.MockInvoke("read", testutil.Args("readTransformation", "t2"))
+	var transformation Transformation
+	if err := json.Unmarshal(response.Payload, &transformation); err != nil {
+		t.Fatalf("cannot unmarshal transformation: %s", err.Error())
+	}
+	if !reflect.DeepEqual(transformation.Inputs, []string{"m1", "p3"}) ||
+		!reflect.DeepEqual(transformation.Outputs, []string{"f1", "f2"}) || transformation.TxId != "tx4" {
+		t.Errorf("expected t2 of m1 and p3 into f1 and f2, got %+v", transformation)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	stub := lineageStub(t)
+
+	backward := trace(t, stub, "traceBackward", "f1")
+	if names := nodeNames(backward); !reflect.DeepEqual(names, []string{"f1", "m1", "p3", "p1", "p2"}) ||
+		backward.Truncated || backward.Depth != defaultTraceDepth {
+		t.Errorf("expected f1 back to all raw products, got %v (%+v)", names, backward)
+	}
+	expected := []LineageEdge{{"m1", "f1", "t2"}, {"p3", "f1", "t2"}, {"p1", "m1", "t1"}, {"p2", "m1", "t1"}}
+	if !reflect.DeepEqual(backward.Edges, expected) {
+		t.Errorf("expected edges %+v, got %+v", expected, backward.Edges)
+	}
+	if backward.Nodes[3].Depth != 2 || backward.Nodes[3].State != stateConsumed {
+		t.Errorf("expected p1 consumed at depth 2, got %+v", backward.Nodes[3])
+	}
+
+	if shallow := trace(t, stub, "traceBackward", "f1", "1"); !reflect.DeepEqual(nodeNames(shallow),
+		[]string{"f1", "m1", "p3"}) || !shallow.Truncated {
+		t.Errorf("expected the trace truncated after m1 and p3, got %+v", shallow)
+	}
+
+	forward := trace(t, stub, "traceForward", "p1")
+	if names := nodeNames(forward); !reflect.DeepEqual(names, []string{"p1", "m1", "f1", "f2"}) || forward.Truncated {
+		t.Errorf("expected p1 forward to the finished goods, got %v (%+v)", names, forward)
+	}
+
+	if leaf := trace(t, stub, "traceForward", "f2"); !reflect.DeepEqual(nodeNames(leaf), []string{"f2"}) ||
+		len(leaf.Edges) != 0 || leaf.Truncated {
+		t.Errorf("expected nothing made of f2, got %+v", leaf)
+	}
+
+	for _, args := range [][]string{
+		{"traceForward", "p1", "0"},
+		{"traceForward", "p1", "101"},
+		{"traceBackward", "p9"},
+	} {
+		if response := stub.MockInvoke("trace", testutil.Args(args...)); response.Status < 400 {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// kinds of transformations that only divide or combine quantities of the same goods
+	transformationSplit = "split"
+	transformationMerge = "merge"
+
+	// remainderSuffix and transferredSuffix name the lots a partial transfer splits a product into: what the old
+	// owner keeps and what the new owner gets
+	remainderSuffix   = "/1"
+	transferredSuffix = "/2"
+)
+
+// parseQuantity reads a quantity of bulk goods, a positive integer in the unit of the product
+func parseQuantity(s string) (int64, error) {
+	quantity, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || quantity <= 0 {
+		return 0, errors.New(fmt.Sprintf("quantity is invalid: %s (must be a positive integer)", s))
+	}
+
+	return quantity, nil
+}
+
+// parseUnit reads a unit of measure, e.g. kg or l
+func parseUnit(s string) (string, error) {
+	if len(s) == 0 || !isValidKeyPart(s) || strings.IndexFunc(s, unicode.IsSpace) >= 0 {
+		return "", errors.New("unit must be a non-empty UTF-8 string without spaces, U+0000 and U+10FFFF")
+	}
+
+	return s, nil
+}
+
+// sumQuantities adds up quantities, an error if the sum doesn't fit
+func sumQuantities(quantities []int64) (int64, error) {
+	var sum int64
+	for _, quantity := range quantities {
+		if quantity > math.MaxInt64-sum {
+			return 0, errors.New("sum of quantities is too large")
+		}
+		sum += quantity
+	}
+
+	return sum, nil
+}
+
+// isLot tells if the product is bulk goods with a quantity
+func (product *Product) isLot() bool {
+	return product.Value.Quantity > 0
+}
+
+// compatibleWith tells if two lots may be merged: same goods, lot and unit
+func (product *Product) compatibleWith(other Product) bool {
+	return product.Value.Unit == other.Value.Unit && product.Value.GTIN == other.Value.GTIN &&
+		product.Value.Lot == other.Value.Lot
+}
+
+// childLot returns a new lot of the quantity of the product for the owner. It's the same goods: the child takes the
+// description, the state, the GTIN and the lot of the product. Encrypted fields are bound to the name of the product,
+// so they are decrypted and sealed again for the child by the transaction txId, which needs the key.
+func (product *Product) childLot(c *fieldCipher, txId, name string, quantity int64, owner string,
+	timestamp int64) (Product, error) {
+	child := Product{Key: ProductKey{Name: name}}
+	child.Value = ProductValue{Desc: product.Value.Desc, State: product.Value.State, Owner: owner,
+		LastUpdated: int(timestamp), GTIN: product.Value.GTIN, Lot: product.Value.Lot, Quantity: quantity,
+		Unit: product.Value.Unit, Encrypted: product.Value.Encrypted}
+
+	for _, field := range encryptedFields(product.Value) {
+		if c == nil {
+			return Product{}, errors.New(fmt.Sprintf("product %s has encrypted fields: pass transient field %s "+
+				"to divide or combine it", product.Key.Name, transientEncryptionKey))
+		}
+
+		plaintext, err := c.open(product.Key, field, *encryptableField(&product.Value, field))
+		if err != nil {
+			return Product{}, errors.New(fmt.Sprintf("cannot decrypt %s of product %s: %s", field,
+				product.Key.Name, err.Error()))
+		}
+		*encryptableField(&child.Value, field) = c.seal(txId, child.Key, field, plaintext)
+	}
+
+	return child, nil
+}
@@ -0,0 +1,194 @@
+package product
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"testutil"
+)
+
+func TestParseQuantity(t *testing.T) {
+	if quantity, err := parseQuantity("1200"); err != nil || quantity != 1200 {
+		t.Errorf("expected 1200, got %d (%v)", quantity, err)
+	}
+	for _, s := range []string{"", "0", "-5", "1.5", "1e3", "9223372036854775808"} {
+		if _, err := parseQuantity(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+
+	if unit, err := parseUnit("kg"); err != nil || unit != "kg" {
+		t.Errorf("expected kg, got %q (%v)", unit, err)
+	}
+	for _, s := range []string{"", "metric ton", "k\x00g"} {
+		if _, err := parseUnit(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+
+	if sum, err := sumQuantities([]int64{600, 400}); err != nil || sum != 1000 {
+		t.Errorf("expected 1000, got %d (%v)", sum, err)
+	}
+	if _, err := sumQuantities([]int64{math.MaxInt64, 1}); err == nil {
+		t.Error("expected an error for a sum that overflows")
+	}
+}
+
+// lotStub has w1 of 1000 kg of lot L1 and w2 of 500 kg of lot L2, both of a
+func lotStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t)
+
+	invokeSteps(t, stub, [][]string{
+		{"initProduct", "w1", "wheat", "1", "a", "100"},
+		{"assignLot", "w1", "4006381333931", "L1"},
+		{"setQuantity", "w1", "1000", "kg"},
+		{"initProduct", "w2", "wheat", "1", "a", "100"},
+		{"assignLot", "w2", "4006381333931", "L2"},
+		{"setQuantity", "w2", "500", "kg"},
+		{"initProduct", "item", "tractor", "1", "a", "100"},
+	})
+
+	return stub
+}
+
+func loadLot(t *testing.T, stub *testutil.MockStub, name string) ProductValue {
+	product := Product{Key: ProductKey{Name: name}}
+	if err := product.LoadFrom(stub); err != nil {
+		t.Fatalf("cannot load %s: %s", name, err.Error())
+	}
+
+	return product.Value
+}
+
+func TestSplitAndMergeLots(t *testing.T) {
+	stub := lotStub(t)
+
+	for _, test := range []struct {
+		args     []string
+		expected int32
+	}{
+		{[]string{"setQuantity", "w1", "900", "kg"}, 409},
+		{[]string{"setQuantity", "item", "0", "pc"}, 500},
+		{[]string{"setQuantity", "item", "1", ""}, 500},
+		{[]string{"splitLot", "s1", "w1", "w3", "600"}, 500},
+		{[]string{"splitLot", "s1", "w1", "w3", "600", "w4"}, 500},
+		{[]string{"splitLot", "s1", "item", "i1", "1", "i2", "1"}, 409},
+		{[]string{"splitLot", "s1", "w1", "w3", "600", "w4", "300"}, 409},
+		{[]string{"splitLot", "s1", "w1", "w3", "600", "w4", "500"}, 409},
+		{[]string{"splitLot", "s1", "w1", "w3", "600", "w3", "400"}, 500},
+		{[]string{"splitLot", "s1", "w1", "w3", "600", "w2", "400"}, 409},
+		{[]string{"splitLot", "s1", "w1", "w3", "-600", "w4", "1600"}, 500},
+		{[]string{"splitLot", "s1", "w1", "w3", "600", "w4", "400"}, 200},
+		{[]string{"splitLot", "s1", "w3", "w5", "300", "w6", "300"}, 409},
+		{[]string{"splitLot", "s2", "w1", "w5", "500", "w6", "500"}, 409},
+		{[]string{"mergeLots", "m1", "w5", "w3"}, 500},
+		{[]string{"mergeLots", "m1", "w5", "w3", "w3"}, 500},
+		{[]string{"mergeLots", "m1", "w5", "w3", "item"}, 409},
+		{[]string{"mergeLots", "m1", "w5", "w3", "w2"}, 409},
+		{[]string{"mergeLots", "m1", "w4", "w3", "w4"}, 500},
+		{[]string{"mergeLots", "m1", "w2", "w3", "w4"}, 409},
+		{[]string{"mergeLots", "m1", "w5", "w3", "w4"}, 200},
+		{[]string{"updateProduct", "w5", "flour", "2", "a", "110"}, 200},
+	} {
+		response := stub.MockInvoke("lot", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("%v: expected status %d, got %d: %s", test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		state    int
+		quantity int64
+		produced string
+		consumed string
+	}{
+		{"w1", stateConsumed, 1000, "", "s1"},
+		{"w3", stateConsumed, 600, "s1", "m1"},
+		{"w4", stateConsumed, 400, "s1", "m1"},
+		{"w5", stateActive, 1000, "m1", ""},
+	} {
+		value := loadLot(t, stub, test.name)
+		if value.State != test.state || value.Quantity != test.quantity || value.Unit != "kg" ||
+			value.Lot != "L1" || value.ProducedBy != test.produced || value.ConsumedBy != test.consumed {
+			t.Errorf("%s: expected %d kg of L1 in state %d produced by %q and consumed by %q, got %+v", test.name,
+				test.quantity, test.state, test.produced, test.consumed, value)
+		}
+	}
+
+	response := stub.MockInvoke("read", testutil.Args("readTransformation", "s1"))
+	var transformation Transformation
+	if err := json.Unmarshal(response.Payload, &transformation); err != nil {
+		t.Fatalf("cannot unmarshal transformation: %s", err.Error())
+	}
+	if transformation.Kind != transformationSplit || !reflect.DeepEqual(transformation.Outputs,
+		[]string{"w3", "w4"}) {
+		t.Errorf("expected the split of w1 into w3 and w4, got %+v", transformation)
+	}
+
+	if backward := trace(t, stub, "traceBackward", "w5"); !reflect.DeepEqual(nodeNames(backward),
+		[]string{"w5", "w3", "w4", "w1"}) {
+		t.Errorf("expected w5 back to w1 through the split and the merge, got %+v", backward)
+	}
+
+	other, err := testutil.NewIdentity("b")
+	if err != nil {
+		t.Fatalf("cannot generate identity of b: %s", err.Error())
+	}
+	if response := stub.MockInvokeAs(other, "quantity", testutil.Args("setQuantity", "item", "1",
+		"pc")); response.Status != 403 {
+		t.Errorf("expected status 403 for a product of another organization, got %d: %s", response.Status,
+			response.Message)
+	}
+}
+
+func TestPartialTransfer(t *testing.T) {
+	stub := lotStub(t)
+
+	// a partial transfer is a split named after its transaction
+	for i, test := range []struct {
+		args     []string
+		expected int32
+	}{
+		{[]string{"updateOwner", "item", "a", "b", "200", "1"}, 409},
+		{[]string{"updateOwner", "w2", "a", "b", "200", "0"}, 500},
+		{[]string{"updateOwner", "w2", "a", "b", "200", "501"}, 409},
+		{[]string{"updateOwner", "w2", "a", "b", "200", "500"}, 200},
+		{[]string{"updateOwner", "w1", "a", "b", "200", "250"}, 200},
+		{[]string{"updateOwner", "w1", "a", "b", "200", "250"}, 409},
+		{[]string{"updateOwner", "w1/1", "a", "c", "300", ""}, 200},
+	} {
+		response := stub.MockInvoke("tx"+strconv.Itoa(i), testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("%v: expected status %d, got %d: %s", test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		owner    string
+		state    int
+		quantity int64
+	}{
+		{"w2", "b", stateRegistered, 500},
+		{"w1", "a", stateConsumed, 1000},
+		{"w1/1", "c", stateRegistered, 750},
+		{"w1/2", "b", stateRegistered, 250},
+	} {
+		value := loadLot(t, stub, test.name)
+		if value.Owner != test.owner || value.State != test.state || value.Quantity != test.quantity {
+			t.Errorf("%s: expected %d kg of %s in state %d, got %+v", test.name, test.quantity, test.owner,
+				test.state, value)
+		}
+	}
+
+	if forward := trace(t, stub, "traceForward", "w1"); !reflect.DeepEqual(nodeNames(forward),
+		[]string{"w1", "w1/1", "w1/2"}) {
+		t.Errorf("expected w1 forward to both parts, got %+v", forward)
+	}
+}
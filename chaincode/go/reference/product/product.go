@@ -0,0 +1,335 @@
+package product
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"errors"
+	"fmt"
+	"encoding/json"
+)
+
+const (
+	productIndex = "product"
+	productObjectType = "product"
+	ownerIndexName = "owner~name"
+	stateIndexName = "state~name"
+)
+
+const (
+	basicArgumentsNumber = 5
+	keyFieldsNumber = 1
+)
+
+const (
+	stateUnknown = iota
+	stateRegistered
+	stateActive
+	stateDecisionMaking
+	stateInactive
+	// stateRecalled is set by recalls only: it's not in productStateMachine, so updates can neither enter nor leave it
+	stateRecalled
+	// stateConsumed is set by transformations only, for their inputs, and is not in productStateMachine either
+	stateConsumed
+)
+
+var productStateMachine = map[int][]int{
+	stateUnknown: {},
+	stateRegistered: {stateRegistered, stateActive},
+	stateActive: {stateActive, stateDecisionMaking},
+	stateDecisionMaking: {stateActive, stateDecisionMaking, stateInactive},
+	stateInactive: {stateInactive},
+}
+
+func contains(m map[int][]int, key int) bool {
+	_, ok := m[key]
+	if !ok {
+		return false
+	}
+
+	return true
+}
+
+func checkStateValidity(statesAutomaton map[int][]int, oldState, newState int) bool {
+	possibleStates, ok := statesAutomaton[oldState]
+	if ok {
+		for _, state := range possibleStates {
+			if state == newState {
+				return true
+			}
+		}
+	}
+	
+	return false
+}
+
+// isValidKeyPart checks that the string can be an attribute of a composite key: CreateCompositeKey uses U+0000
+// as a separator and U+10FFFF as the upper bound of partial key ranges, so neither may appear inside a part.
+func isValidKeyPart(part string) bool {
+	return utf8.ValidString(part) && !strings.ContainsRune(part, 0) && !strings.ContainsRune(part, utf8.MaxRune)
+}
+
+type Product struct {
+	Key   ProductKey   `json:"key"`
+	Value ProductValue `json:"value"`
+}
+
+type ProductKey struct {
+	Name string `json:"name"`
+}
+
+// ProductValue is the state of a product. Encrypted lists the fields stored as AES-GCM ciphertext, comma separated.
+// LastDocument is the hash of the document attached last: attaching one writes a new version of the product.
+// GTIN and Lot identify the batch the product was made in, for recalls. Custodian holds the product at Location
+// in the course of Shipment, the last one it was in; empty Custodian means the owner holds it. Hold is the first
+// breach of a threshold rule while the product is on quality hold. ProducedBy is the transformation that created
+// the product and ConsumedBy the one that consumed it. Bulk goods carry a Quantity in Unit, e.g. 1200 kg; products
+// without a quantity are single items.
+type ProductValue struct {
+	ObjectType   string `json:"docType"`
+	Desc         string `json:"desc"`
+	State        int    `json:"state"`
+	LastUpdated  int    `json:"lastUpdated"`
+	Owner        string `json:"owner"`
+	Encrypted    string `json:"encrypted,omitempty"`
+	LastDocument string `json:"lastDocument,omitempty"`
+	GTIN         string `json:"gtin,omitempty"`
+	Lot          string `json:"lot,omitempty"`
+	Shipment     string `json:"shipment,omitempty"`
+	Custodian    string `json:"custodian,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Hold         string `json:"hold,omitempty"`
+	ProducedBy   string `json:"producedBy,omitempty"`
+	ConsumedBy   string `json:"consumedBy,omitempty"`
+	Quantity     int64  `json:"quantity,omitempty"`
+	Unit         string `json:"unit,omitempty"`
+}
+
+func (product *Product) FillFromArguments(args []string) error {
+	//      0            1         2       3        4
+	// productName, description, status, owner, timestamp
+	if len(args) < basicArgumentsNumber {
+		return errors.New(fmt.Sprintf("incorrect number of arguments: expected %d, got %d",
+			basicArgumentsNumber, len(args)))
+	}
+
+	// ==== Input sanitation ====
+	for k, v := range args {
+		if k != 1 && len(v) == 0 {
+			return errors.New(fmt.Sprintf("argument #%d must be a non-empty string", k + 1))
+		}
+	}
+
+	if err := product.FillFromCompositeKeyParts(args[:keyFieldsNumber]); err != nil {
+		return err
+	}
+
+	desc := args[keyFieldsNumber]
+	state, err := strconv.Atoi(args[keyFieldsNumber + 1])
+	if err != nil {
+		return errors.New(fmt.Sprintf("product state is invalid: %s (must be int)", args[keyFieldsNumber + 1]))
+	}
+	owner := strings.ToLower(args[keyFieldsNumber + 2])
+	lastUpdated, err := strconv.Atoi(args[keyFieldsNumber + 3])
+	if err != nil || lastUpdated < 0 {
+		return errors.New(fmt.Sprintf("product last change time is invalid: %s (must be non-negative int)",
+			args[keyFieldsNumber + 3]))
+	}
+	
+	if !contains(productStateMachine, state) {
+		return errors.New(fmt.Sprintf("product is invalid: %d (must be from 0 to 4)", state))
+	}
+
+	product.Value.Desc = desc
+	product.Value.State = state
+	product.Value.Owner = owner
+	product.Value.LastUpdated = lastUpdated
+
+	return nil
+}
+
+func (product *Product) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < keyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d item(s)",
+			keyFieldsNumber))
+	}
+
+	for k, v := range compositeKeyParts {
+		if len(v) == 0 {
+			return errors.New(fmt.Sprintf("key part #%d must be a non-empty string", k + 1))
+		}
+		if !isValidKeyPart(v) {
+			return errors.New(fmt.Sprintf("key part #%d must be a valid UTF-8 string without U+0000 and U+10FFFF",
+				k + 1))
+		}
+	}
+
+	product.Key.Name = compositeKeyParts[0]
+
+	return nil
+}
+
+func (product *Product) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &product.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (product *Product) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string {
+		product.Key.Name,
+	}
+
+	return stub.CreateCompositeKey(productIndex, compositeKeyParts)
+}
+
+// documentTarget identifies the product among the records documents are attached to
+func (product *Product) documentTarget() []string {
+	return []string{productObjectType, product.Key.Name}
+}
+
+func (product *Product) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(product.Value)
+}
+
+func (product *Product) ExistsIn(stub shim.ChaincodeStubInterface) bool {
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return false
+	}
+
+	if data, err := stub.GetState(compositeKey); err != nil || data == nil {
+		return false
+	}
+
+	return true
+}
+
+func (product *Product) LoadFrom(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	data, err := stub.GetState(compositeKey)
+	if err != nil {
+		return err
+	}
+
+	return product.FillFromLedgerValue(data)
+}
+
+func (product *Product) UpdateOrInsertIn(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	var previous *Product
+	if product.ExistsIn(stub) {
+		previous = &Product{Key: product.Key}
+		if err := previous.LoadFrom(stub); err != nil {
+			return err
+		}
+	}
+
+	product.Value.ObjectType = productObjectType
+
+	value, err := product.ToLedgerValue()
+	if err != nil {
+		return err
+	}
+
+	if err = stub.PutState(compositeKey, value); err != nil {
+		return err
+	}
+
+	if err := product.updateIndexes(stub, previous); err != nil {
+		return err
+	}
+
+	if previous != nil && previous.Value == product.Value {
+		return nil
+	}
+
+	return product.recordChange(stub)
+}
+
+// indexKeys returns the keys of the owner~name and state~name composite-key indexes of the product, of the
+// gtin~lot~name index if it has a lot and of the custodian~name index if it was shipped. They let state databases
+// without rich query support (LevelDB) find products by owner, state and custodian, and recalls find the products
+// of a lot on any state database.
+func (product *Product) indexKeys(stub shim.ChaincodeStubInterface) ([]string, error) {
+	ownerIndexKey, err := stub.CreateCompositeKey(ownerIndexName, []string{product.Value.Owner, product.Key.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	stateIndexKey, err := stub.CreateCompositeKey(stateIndexName,
+		[]string{strconv.Itoa(product.Value.State), product.Key.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{ownerIndexKey, stateIndexKey}
+
+	if len(product.Value.GTIN) > 0 {
+		lotIndexKey, err := stub.CreateCompositeKey(lotIndexName,
+			[]string{product.Value.GTIN, product.Value.Lot, product.Key.Name})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, lotIndexKey)
+	}
+
+	if len(product.Value.Custodian) > 0 {
+		custodianIndexKey, err := stub.CreateCompositeKey(custodianIndexName,
+			[]string{product.Value.Custodian, product.Key.Name})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, custodianIndexKey)
+	}
+
+	return keys, nil
+}
+
+// updateIndexes deletes index entries of the previous value of the product and puts the current ones.
+// Only the key is needed, so the value is the null character: a nil value would delete the key.
+func (product *Product) updateIndexes(stub shim.ChaincodeStubInterface, previous *Product) error {
+	keys, err := product.indexKeys(stub)
+	if err != nil {
+		return err
+	}
+
+	if previous != nil {
+		previousKeys, err := previous.indexKeys(stub)
+		if err != nil {
+			return err
+		}
+
+		current := map[string]bool{}
+		for _, key := range keys {
+			current[key] = true
+		}
+
+		for _, key := range previousKeys {
+			if !current[key] {
+				if err := stub.DelState(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if err := stub.PutState(key, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,238 @@
+package product
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"testutil"
+)
+
+var productStates = []int{stateUnknown, stateRegistered, stateActive, stateDecisionMaking, stateInactive}
+
+// checkProductKeyRoundTrip asserts that a key accepted by FillFromCompositeKeyParts survives the ledger unchanged.
+func checkProductKeyRoundTrip(t *testing.T, stub shim.ChaincodeStubInterface, parts []string) {
+	var product Product
+	if err := product.FillFromCompositeKeyParts(parts); err != nil {
+		return
+	}
+
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		t.Fatalf("accepted key parts %q cannot form a composite key: %s", parts, err.Error())
+	}
+
+	objectType, splitParts, err := stub.SplitCompositeKey(compositeKey)
+	if err != nil {
+		t.Fatalf("cannot split composite key %q: %s", compositeKey, err.Error())
+	}
+	if objectType != productIndex {
+		t.Fatalf("expected object type %s, got %s", productIndex, objectType)
+	}
+
+	var restored Product
+	if err := restored.FillFromCompositeKeyParts(splitParts); err != nil {
+		t.Fatalf("cannot restore key from parts %q: %s", splitParts, err.Error())
+	}
+	if restored.Key != product.Key {
+		t.Fatalf("key changed in round trip: %+v -> %+v", product.Key, restored.Key)
+	}
+}
+
+func FuzzProductFillFromCompositeKeyParts(f *testing.F) {
+	f.Add("p1", "")
+	f.Add("", "")
+	f.Add("p\x001", "x")
+	f.Add("\U0010FFFF", "")
+	f.Add("\xff\xfe", "")
+	f.Add(strings.Repeat("p", 1<<16), "")
+
+	stub := shim.NewMockStub("reference", new(ProductChaincode))
+	f.Fuzz(func(t *testing.T, name, extra string) {
+		checkProductKeyRoundTrip(t, stub, []string{name})
+		checkProductKeyRoundTrip(t, stub, []string{name, extra})
+	})
+}
+
+func FuzzProductFillFromArguments(f *testing.F) {
+	f.Add("p1", "desc", "1", "a", "100")
+	f.Add("p1", "", "0", "A", "0")
+	f.Add("", "", "", "", "")
+	f.Add("p\x00", "desc", "1", "a", "100")
+	f.Add("p1", "desc", "-1", "a", "-100")
+	f.Add("p1", "desc", "99999999999999999999", "a", "99999999999999999999")
+	f.Add("p1", "desc\x00", " 1", "a\U0010FFFF", "1e3")
+
+	stub := shim.NewMockStub("reference", new(ProductChaincode))
+	f.Fuzz(func(t *testing.T, name, desc, state, owner, lastUpdated string) {
+		var product Product
+		if err := product.FillFromArguments([]string{name, desc, state, owner, lastUpdated}); err != nil {
+			return
+		}
+
+		if !contains(productStateMachine, product.Value.State) {
+			t.Errorf("accepted unknown state %d", product.Value.State)
+		}
+		if product.Value.LastUpdated < 0 {
+			t.Errorf("accepted negative last change time %d", product.Value.LastUpdated)
+		}
+		if len(product.Value.Owner) == 0 || product.Value.Owner != strings.ToLower(owner) {
+			t.Errorf("owner %q is stored as %q", owner, product.Value.Owner)
+		}
+		if product.Value.Desc != desc {
+			t.Errorf("description %q is stored as %q", desc, product.Value.Desc)
+		}
+		checkProductKeyRoundTrip(t, stub, []string{product.Key.Name})
+
+		// the value must survive the ledger as well
+		data, err := product.ToLedgerValue()
+		if err != nil {
+			t.Fatalf("cannot marshal value: %s", err.Error())
+		}
+		restored := Product{Key: product.Key}
+		if err := restored.FillFromLedgerValue(data); err != nil {
+			t.Fatalf("cannot unmarshal value %s: %s", string(data), err.Error())
+		}
+		if utf8.ValidString(desc) && utf8.ValidString(owner) && restored != product {
+			t.Errorf("value changed in round trip: %+v -> %+v", product.Value, restored.Value)
+		}
+	})
+}
+
+func FuzzCheckStateValidity(f *testing.F) {
+	for _, from := range productStates {
+		for _, to := range productStates {
+			f.Add(from, to)
+		}
+	}
+	f.Add(-1, 0)
+	f.Add(0, -1)
+
+	f.Fuzz(func(t *testing.T, from, to int) {
+		valid := checkStateValidity(productStateMachine, from, to)
+
+		expected := false
+		for _, state := range productStateMachine[from] {
+			expected = expected || state == to
+		}
+		if valid != expected {
+			t.Errorf("transition %d -> %d: expected %t, got %t", from, to, expected, valid)
+		}
+		if valid && !contains(productStateMachine, to) {
+			t.Errorf("transition %d -> %d leads out of the state machine", from, to)
+		}
+	})
+}
+
+// FuzzUpdateProductStates drives a product through a random sequence of updateProduct calls: every accepted
+// update must be a valid transition and every rejected one must leave the ledger intact.
+func FuzzUpdateProductStates(f *testing.F) {
+	f.Add([]byte{2, 3, 4})
+	f.Add([]byte{4, 0, 2, 3, 2, 3, 4, 1})
+	f.Add([]byte{255, 128, 5})
+
+	f.Fuzz(func(t *testing.T, states []byte) {
+		stub := testutil.NewMockStub("reference", new(ProductChaincode))
+		if response := stub.MockInvoke("init", testutil.Args("initProduct", "p1", "desc", "1", "a", "0")); response.Status >= 400 {
+			t.Fatalf("initProduct failed: %s", response.Message)
+		}
+
+		current := stateRegistered
+		for i, b := range states {
+			next := int(int8(b)) % (stateInactive + 2)
+			response := stub.MockInvoke("update",
+				testutil.Args("updateProduct", "p1", "desc", strconv.Itoa(next), "a", strconv.Itoa(i+1)))
+
+			if response.Status < 400 {
+				if !checkStateValidity(productStateMachine, current, next) {
+					t.Fatalf("step %d: forbidden transition %d -> %d was accepted", i, current, next)
+				}
+				current = next
+			}
+
+			product := Product{Key: ProductKey{Name: "p1"}}
+			if err := product.LoadFrom(stub); err != nil {
+				t.Fatalf("step %d: cannot load product: %s", i, err.Error())
+			}
+			if product.Value.State != current {
+				t.Fatalf("step %d: expected state %d, got %d", i, current, product.Value.State)
+			}
+			if product.Value.State == stateUnknown {
+				t.Fatalf("step %d: product reached the unknown state", i)
+			}
+		}
+	})
+}
+
+func TestStateMachineProperties(t *testing.T) {
+	for state, next := range productStateMachine {
+		for _, n := range next {
+			if n == stateUnknown {
+				t.Errorf("state %d leads to the unknown state", state)
+			}
+			if !contains(productStateMachine, n) {
+				t.Errorf("state %d leads to %d which is not in the state machine", state, n)
+			}
+		}
+		if state != stateUnknown && !checkStateValidity(productStateMachine, state, state) {
+			t.Errorf("state %d cannot be updated without changing it", state)
+		}
+	}
+
+	if !reflect.DeepEqual(productStateMachine[stateInactive], []int{stateInactive}) {
+		t.Errorf("inactive state must be terminal, got %v", productStateMachine[stateInactive])
+	}
+
+	// every state but unknown is reachable from the initial one
+	reached := map[int]bool{stateRegistered: true}
+	queue := []int{stateRegistered}
+	for len(queue) > 0 {
+		for _, n := range productStateMachine[queue[0]] {
+			if !reached[n] {
+				reached[n] = true
+				queue = append(queue, n)
+			}
+		}
+		queue = queue[1:]
+	}
+	for state := range productStateMachine {
+		if state != stateUnknown && !reached[state] {
+			t.Errorf("state %d is not reachable from %d", state, stateRegistered)
+		}
+	}
+}
+
+func TestProductKeyProperties(t *testing.T) {
+	stub := shim.NewMockStub("reference", new(ProductChaincode))
+
+	roundTrip := func(name string) bool {
+		checkProductKeyRoundTrip(t, stub, []string{name})
+		return !t.Failed()
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+
+	// a key part accepted by FillFromCompositeKeyParts never contains the composite key separator
+	noSeparator := func(name string) bool {
+		var product Product
+		return product.FillFromCompositeKeyParts([]string{name}) != nil || !strings.ContainsRune(product.Key.Name, 0)
+	}
+	if err := quick.Check(noSeparator, nil); err != nil {
+		t.Error(err)
+	}
+
+	// timestamps are accepted if and only if they are non-negative integers
+	timestamps := func(lastUpdated int64) bool {
+		var product Product
+		err := product.FillFromArguments([]string{"p1", "", "1", "a", strconv.FormatInt(lastUpdated, 10)})
+		return (err == nil) == (lastUpdated >= 0 && lastUpdated == int64(int(lastUpdated)))
+	}
+	if err := quick.Check(timestamps, nil); err != nil {
+		t.Error(err)
+	}
+}
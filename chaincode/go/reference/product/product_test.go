@@ -0,0 +1,63 @@
+package product
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckStateValidity(t *testing.T) {
+	allowed := map[[2]int]bool{
+		{stateRegistered, stateRegistered}:         true,
+		{stateRegistered, stateActive}:             true,
+		{stateActive, stateActive}:                 true,
+		{stateActive, stateDecisionMaking}:         true,
+		{stateDecisionMaking, stateActive}:         true,
+		{stateDecisionMaking, stateDecisionMaking}: true,
+		{stateDecisionMaking, stateInactive}:       true,
+		{stateInactive, stateInactive}:             true,
+	}
+
+	for from := stateUnknown - 1; from <= stateInactive+1; from++ {
+		for to := stateUnknown - 1; to <= stateInactive+1; to++ {
+			if actual := checkStateValidity(productStateMachine, from, to); actual != allowed[[2]int{from, to}] {
+				t.Errorf("transition %d -> %d: expected %t, got %t", from, to, allowed[[2]int{from, to}], actual)
+			}
+		}
+	}
+}
+
+func TestProductFillFromArguments(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected Product
+		wantErr  string
+	}{
+		{"valid", []string{"p1", "desc", "2", "Org", "10"},
+			Product{Key: ProductKey{Name: "p1"}, Value: ProductValue{Desc: "desc", State: 2, Owner: "org", LastUpdated: 10}}, ""},
+		{"extra arguments", []string{"p1", "", "0", "a", "10", "extra"},
+			Product{Key: ProductKey{Name: "p1"}, Value: ProductValue{State: 0, Owner: "a", LastUpdated: 10}}, ""},
+		{"nil", nil, Product{}, "expected 5, got 0"},
+		{"empty timestamp", []string{"p1", "desc", "2", "a", ""}, Product{}, "argument #5 must be a non-empty string"},
+		{"float state", []string{"p1", "desc", "2.0", "a", "10"}, Product{}, "product state is invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var product Product
+			err := product.FillFromArguments(test.args)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if product != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, product)
+			}
+		})
+	}
+}
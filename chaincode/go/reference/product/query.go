@@ -0,0 +1,353 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize = 1000
+	// richQueryUnsupported is in the error of GetQueryResult on a peer with LevelDB state database
+	richQueryUnsupported = "not supported for leveldb"
+)
+
+// productFields are the fields of ProductValue in JSON, the ones a query can sort by or return
+var productFields = []string{"docType", "desc", "state", "lastUpdated", "owner", "lastDocument", "gtin", "lot",
+	"shipment", "custodian", "location", "hold", "producedBy", "consumedBy", "quantity", "unit"}
+
+// queryIndexes are CouchDB indexes bundled in META-INF/statedb/couchdb/indexes, by the field they select on
+var queryIndexes = map[string][]string{
+	"owner": {"_design/indexOwnerDoc", "indexOwner"},
+	"state": {"_design/indexStateDoc", "indexState"},
+	"custodian": {"_design/indexCustodianDoc", "indexCustodian"},
+}
+
+// fieldIndexes are the composite-key indexes of the fields for state databases without rich queries
+var fieldIndexes = map[string]string{
+	"owner": ownerIndexName,
+	"state": stateIndexName,
+	"custodian": custodianIndexName,
+}
+
+// productQuery selects products by the value of one indexed field: owner, state or custodian.
+type productQuery struct {
+	Field      string
+	Value      string
+	PageSize   int
+	Offset     int
+	SortBy     string
+	Descending bool
+	Fields     []string
+	// Cipher decrypts the fields of the products encrypted with its key, nil if no key was passed
+	Cipher *fieldCipher
+}
+
+// productRecord is a product with its value reduced to the requested fields
+type productRecord struct {
+	Key   ProductKey             `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// productPage is a response of a parameterized query. Bookmark is empty on the last page, otherwise it is passed
+// back to get the next one.
+type productPage struct {
+	Records  []productRecord `json:"records"`
+	Bookmark string          `json:"bookmark"`
+}
+
+// reindexPage is the response of reindexProducts: the number of products rewritten and, unless it was the last page,
+// the bookmark to pass back for the next one
+type reindexPage struct {
+	Reindexed int    `json:"reindexed"`
+	Bookmark  string `json:"bookmark"`
+}
+
+func parseProductQuery(field string, args []string) (productQuery, error) {
+	//   0         1           2          3                     4
+	// value, [pageSize], [bookmark], [lastUpdated[:desc]], [desc,state,...]
+	if len(args) < 1 || len(args[0]) == 0 {
+		return productQuery{}, errors.New(fmt.Sprintf("incorrect number of arguments: expected %s", field))
+	}
+
+	query := productQuery{Field: field, Value: args[0], PageSize: defaultPageSize}
+
+	switch field {
+	case "owner", "custodian":
+		query.Value = strings.ToLower(query.Value)
+	case "state":
+		state, err := strconv.Atoi(query.Value)
+		if err != nil || !contains(productStateMachine, state) && state != stateRecalled && state != stateConsumed {
+			return productQuery{}, errors.New(fmt.Sprintf("product state is invalid: %s", query.Value))
+		}
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		pageSize, err := strconv.Atoi(args[1])
+		if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+			return productQuery{}, errors.New(fmt.Sprintf("page size is invalid: %s (must be from 1 to %d)",
+				args[1], maxPageSize))
+		}
+		query.PageSize = pageSize
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		offset, err := strconv.Atoi(args[2])
+		if err != nil || offset < 0 {
+			return productQuery{}, errors.New(fmt.Sprintf("bookmark is invalid: %s", args[2]))
+		}
+		query.Offset = offset
+	}
+
+	if len(args) > 3 && len(args[3]) > 0 {
+		parts := strings.Split(args[3], ":")
+		if parts[0] != "lastUpdated" || len(parts) > 2 || len(parts) == 2 && parts[1] != "asc" && parts[1] != "desc" {
+			return productQuery{}, errors.New(fmt.Sprintf("sort order is invalid: %s (must be lastUpdated[:asc|:desc])",
+				args[3]))
+		}
+		query.SortBy = parts[0]
+		query.Descending = len(parts) == 2 && parts[1] == "desc"
+	}
+
+	if len(args) > 4 && len(args[4]) > 0 {
+		for _, f := range strings.Split(args[4], ",") {
+			if !isProductField(f) {
+				return productQuery{}, errors.New(fmt.Sprintf("field is invalid: %s (must be one of %s)",
+					f, strings.Join(productFields, ", ")))
+			}
+			query.Fields = append(query.Fields, f)
+		}
+	}
+
+	return query, nil
+}
+
+func isProductField(field string) bool {
+	for _, f := range productFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Execute runs the query as a CouchDB rich query and, if the state database doesn't support them,
+// on the composite-key index of the field. Other errors of the rich query are returned.
+func (query productQuery) Execute(stub shim.ChaincodeStubInterface) (productPage, error) {
+	records, err := query.executeRichQuery(stub)
+	if err != nil {
+		if !strings.Contains(err.Error(), richQueryUnsupported) {
+			return productPage{}, err
+		}
+		logger.Info(fmt.Sprintf("rich query failed, falling back to %s~name index: %s", query.Field, err.Error()))
+		if records, err = query.executeOnIndex(stub); err != nil {
+			return productPage{}, err
+		}
+	}
+
+	page := productPage{Records: records}
+	// one record more than the page size is fetched to know if there is a next page
+	if len(records) > query.PageSize {
+		page.Records = records[:query.PageSize]
+		page.Bookmark = strconv.Itoa(query.Offset + query.PageSize)
+	}
+
+	return page, nil
+}
+
+// CouchDBQuery renders the query in CouchDB syntax using the bundled indexes.
+func (query productQuery) CouchDBQuery() (string, error) {
+	var value interface{} = query.Value
+	if query.Field == "state" {
+		value, _ = strconv.Atoi(query.Value)
+	}
+
+	couchQuery := map[string]interface{}{
+		"selector":  map[string]interface{}{"docType": productObjectType, query.Field: value},
+		"use_index": queryIndexes[query.Field],
+		"limit":     query.PageSize + 1,
+		"skip":      query.Offset,
+	}
+
+	if len(query.SortBy) > 0 {
+		direction := "asc"
+		if query.Descending {
+			direction = "desc"
+		}
+		// CouchDB sorts on an index only if all of its fields are listed in the same direction
+		couchQuery["sort"] = []map[string]string{
+			{"docType": direction}, {query.Field: direction}, {query.SortBy: direction},
+		}
+	}
+
+	if len(query.Fields) > 0 {
+		// the encrypted marker comes with whichever fields are selected
+		couchQuery["fields"] = append(append([]string{}, query.Fields...), encryptedMarker)
+	}
+
+	result, err := json.Marshal(couchQuery)
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+func (query productQuery) executeRichQuery(stub shim.ChaincodeStubInterface) ([]productRecord, error) {
+	queryString, err := query.CouchDBQuery()
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("rich query: " + queryString)
+
+	it, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	records := []productRecord{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		var product Product
+		if err := product.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return nil, err
+		}
+
+		record, err := query.project(product.Key, response.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// executeOnIndex runs the query on LevelDB: it reads all products of the field value from the composite-key
+// index, then sorts and pages them the way CouchDB would.
+func (query productQuery) executeOnIndex(stub shim.ChaincodeStubInterface) ([]productRecord, error) {
+	it, err := stub.GetStateByPartialCompositeKey(fieldIndexes[query.Field], []string{query.Value})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	products := []Product{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		var product Product
+		if err := product.FillFromCompositeKeyParts(compositeKeyParts[1:]); err != nil {
+			return nil, err
+		}
+
+		if err := product.LoadFrom(stub); err != nil {
+			return nil, err
+		}
+
+		products = append(products, product)
+	}
+
+	if len(query.SortBy) > 0 {
+		sort.SliceStable(products, func(i, j int) bool {
+			if query.Descending {
+				return products[i].Value.LastUpdated > products[j].Value.LastUpdated
+			}
+			return products[i].Value.LastUpdated < products[j].Value.LastUpdated
+		})
+	}
+
+	if query.Offset >= len(products) {
+		return []productRecord{}, nil
+	}
+	products = products[query.Offset:]
+	if len(products) > query.PageSize+1 {
+		products = products[:query.PageSize+1]
+	}
+
+	records := make([]productRecord, 0, len(products))
+	for _, product := range products {
+		value, err := product.ToLedgerValue()
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := query.project(product.Key, value)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// project makes a record of the product value with only the requested fields, or all of them, and the encrypted
+// marker if any of them is left encrypted
+func (query productQuery) project(key ProductKey, value []byte) (productRecord, error) {
+	if query.Cipher != nil {
+		product := Product{Key: key}
+		if err := product.FillFromLedgerValue(value); err != nil {
+			return productRecord{}, err
+		}
+		query.Cipher.decrypt(product.Key, &product.Value)
+
+		var err error
+		if value, err = product.ToLedgerValue(); err != nil {
+			return productRecord{}, err
+		}
+	}
+
+	record := productRecord{Key: key}
+	if err := json.Unmarshal(value, &record.Value); err != nil {
+		return productRecord{}, err
+	}
+
+	for field := range record.Value {
+		if field == encryptedMarker {
+			continue
+		}
+		if !isProductField(field) || len(query.Fields) > 0 && !query.selects(field) {
+			delete(record.Value, field)
+		}
+	}
+
+	return record, nil
+}
+
+func (query productQuery) selects(field string) bool {
+	for _, f := range query.Fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,360 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"testutil"
+)
+
+// queryStub returns a stub with products p0..p9: even ones belong to a, odd ones to b,
+// p0..p4 are active and the rest are registered, p9 was updated first and p0 last.
+func queryStub(t *testing.T, richQuery bool) *testutil.MockStub {
+	stub := getInitializedStub(t)
+	stub.RichQuery = richQuery
+
+	steps := [][]string{}
+	for i := 0; i < 10; i++ {
+		owner := []string{"a", "b"}[i%2]
+		name := fmt.Sprintf("p%d", i)
+		lastUpdated := fmt.Sprintf("%d", 100-i)
+
+		steps = append(steps, []string{"initProduct", name, "desc " + name, "1", owner, lastUpdated})
+		if i < 5 {
+			steps = append(steps, []string{"updateProduct", name, "desc " + name, "2", owner, lastUpdated})
+		}
+	}
+	invokeSteps(t, stub, steps)
+
+	return stub
+}
+
+func queryPage(t *testing.T, stub *testutil.MockStub, args ...string) productPage {
+	response := stub.MockInvoke("query", testutil.Args(args...))
+	if response.Status >= 400 {
+		t.Fatalf("%s failed: %s", args[0], response.Message)
+	}
+
+	var page productPage
+	if err := json.Unmarshal(response.Payload, &page); err != nil {
+		t.Fatalf("cannot unmarshal response: %s", err.Error())
+	}
+
+	return page
+}
+
+func recordNames(records []productRecord) string {
+	names := []string{}
+	for _, record := range records {
+		names = append(names, record.Key.Name)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestQueryProductsByField(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{"by owner", []string{"queryProductsByOwner", "a"}, []string{"p0,p2,p4,p6,p8"}},
+		{"owner is lower-cased", []string{"queryProductsByOwner", "B"}, []string{"p1,p3,p5,p7,p9"}},
+		{"unknown owner", []string{"queryProductsByOwner", "c"}, []string{""}},
+		{"by state", []string{"queryProductsByState", "2"}, []string{"p0,p1,p2,p3,p4"}},
+		{"pages", []string{"queryProductsByOwner", "a", "2"}, []string{"p0,p2", "p4,p6", "p8"}},
+		{"exact pages", []string{"queryProductsByState", "1", "5"}, []string{"p5,p6,p7,p8,p9"}},
+		{"sorted", []string{"queryProductsByOwner", "b", "", "", "lastUpdated"}, []string{"p9,p7,p5,p3,p1"}},
+		{"sorted ascending", []string{"queryProductsByOwner", "b", "", "", "lastUpdated:asc"}, []string{"p9,p7,p5,p3,p1"}},
+		{"sorted descending pages", []string{"queryProductsByState", "1", "3", "", "lastUpdated:desc"},
+			[]string{"p5,p6,p7", "p8,p9"}},
+		{"from bookmark", []string{"queryProductsByOwner", "a", "2", "3"}, []string{"p6,p8"}},
+		{"bookmark after the end", []string{"queryProductsByOwner", "a", "2", "10"}, []string{""}},
+	}
+
+	for _, richQuery := range []bool{false, true} {
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s/rich=%t", test.name, richQuery), func(t *testing.T) {
+				stub := queryStub(t, richQuery)
+				// function, value, page size, bookmark...
+				args := append([]string{}, test.args...)
+				for len(args) < 4 {
+					args = append(args, "")
+				}
+
+				for i, expected := range test.expected {
+					page := queryPage(t, stub, args...)
+					if actual := recordNames(page.Records); actual != expected {
+						t.Fatalf("page %d: expected %s, got %s", i, expected, actual)
+					}
+
+					last := i == len(test.expected)-1
+					if last != (page.Bookmark == "") {
+						t.Fatalf("page %d: unexpected bookmark %q", i, page.Bookmark)
+					}
+					args[3] = page.Bookmark
+				}
+			})
+		}
+	}
+}
+
+func TestQueryProductsByFieldBackendsAgree(t *testing.T) {
+	queries := [][]string{
+		{"queryProductsByOwner", "a"},
+		{"queryProductsByOwner", "b", "2", "2", "lastUpdated:desc", "desc,lastUpdated"},
+		{"queryProductsByState", "1", "", "", "", "owner"},
+		{"queryProductsByState", "2", "10", "0", "lastUpdated", "docType,desc,state,lastUpdated,owner"},
+	}
+
+	levelDB, couchDB := queryStub(t, false), queryStub(t, true)
+	for _, query := range queries {
+		expected := levelDB.MockInvoke("query", testutil.Args(query...))
+		actual := couchDB.MockInvoke("query", testutil.Args(query...))
+		if expected.Status >= 400 || actual.Status >= 400 {
+			t.Fatalf("%v failed: %s %s", query, expected.Message, actual.Message)
+		}
+		if string(expected.Payload) != string(actual.Payload) {
+			t.Errorf("%v: index fallback returned\n%s\nrich query returned\n%s",
+				query, string(expected.Payload), string(actual.Payload))
+		}
+	}
+}
+
+// failingQueryStub is a peer whose CouchDB fails rich queries
+type failingQueryStub struct {
+	*testutil.MockStub
+}
+
+func (stub failingQueryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errors.New("request timed out")
+}
+
+func TestQueryProductsByFieldErrors(t *testing.T) {
+	stub := queryStub(t, false)
+	query, err := parseProductQuery("owner", []string{"a"})
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err.Error())
+	}
+
+	stub.MockTransactionStart("query")
+	defer stub.MockTransactionEnd("query")
+
+	// only the answer of LevelDB falls back to the index, a failure of CouchDB is an error
+	if page, err := query.Execute(stub); err != nil || len(page.Records) != 5 {
+		t.Errorf("expected 5 products of a on the index, got %+v (%v)", page, err)
+	}
+	if _, err := query.Execute(failingQueryStub{stub}); err == nil || err.Error() != "request timed out" {
+		t.Errorf("expected the error of the rich query, got %v", err)
+	}
+}
+
+func TestQueryProductsByFieldProjection(t *testing.T) {
+	for _, richQuery := range []bool{false, true} {
+		stub := queryStub(t, richQuery)
+
+		page := queryPage(t, stub, "queryProductsByOwner", "a", "1", "", "", "owner,state")
+		expected := []productRecord{{Key: ProductKey{Name: "p0"},
+			Value: map[string]interface{}{"owner": "a", "state": float64(stateActive)}}}
+		if !reflect.DeepEqual(page.Records, expected) {
+			t.Errorf("rich=%t: expected %+v, got %+v", richQuery, expected, page.Records)
+		}
+	}
+}
+
+func TestQueryProductsByFieldArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no owner", []string{"queryProductsByOwner"}, "incorrect number of arguments"},
+		{"empty owner", []string{"queryProductsByOwner", ""}, "incorrect number of arguments"},
+		{"state is not a number", []string{"queryProductsByState", "active"}, "product state is invalid"},
+		{"unknown state", []string{"queryProductsByState", "7"}, "product state is invalid"},
+		{"page size is not a number", []string{"queryProductsByOwner", "a", "x"}, "page size is invalid"},
+		{"zero page size", []string{"queryProductsByOwner", "a", "0"}, "page size is invalid"},
+		{"huge page size", []string{"queryProductsByOwner", "a", "1001"}, "page size is invalid"},
+		{"negative bookmark", []string{"queryProductsByOwner", "a", "", "-1"}, "bookmark is invalid"},
+		{"unindexed sort", []string{"queryProductsByOwner", "a", "", "", "desc"}, "sort order is invalid"},
+		{"unknown direction", []string{"queryProductsByOwner", "a", "", "", "lastUpdated:up"}, "sort order is invalid"},
+		{"unknown field", []string{"queryProductsByOwner", "a", "", "", "", "desc,_id"}, "field is invalid"},
+	}
+
+	stub := getInitializedStub(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := stub.MockInvoke("query", testutil.Args(test.args...))
+			if response.Status < 400 || !strings.Contains(response.Message, test.wantErr) {
+				t.Errorf("expected error containing %q, got %d (%s)", test.wantErr, response.Status, response.Message)
+			}
+		})
+	}
+}
+
+func TestCouchDBQuery(t *testing.T) {
+	tests := []struct {
+		args     []string
+		field    string
+		expected string
+	}{
+		{[]string{"Org\"}"}, "owner",
+			`{"limit":101,"selector":{"docType":"product","owner":"org\"}"},"skip":0,` +
+				`"use_index":["_design/indexOwnerDoc","indexOwner"]}`},
+		{[]string{"2", "10", "20", "lastUpdated:desc", "desc"}, "state",
+			`{"fields":["desc","encrypted"],"limit":11,"selector":{"docType":"product","state":2},"skip":20,` +
+				`"sort":[{"docType":"desc"},{"state":"desc"},{"lastUpdated":"desc"}],` +
+				`"use_index":["_design/indexStateDoc","indexState"]}`},
+	}
+
+	for _, test := range tests {
+		query, err := parseProductQuery(test.field, test.args)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		actual, err := query.CouchDBQuery()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if actual != test.expected {
+			t.Errorf("expected\n%s\ngot\n%s", test.expected, actual)
+		}
+	}
+}
+
+func TestProductIndexesFollowUpdates(t *testing.T) {
+	for _, richQuery := range []bool{false, true} {
+		stub := queryStub(t, richQuery)
+
+		if response := stub.MockInvoke("owner", testutil.Args("updateOwner", "p0", "a", "c", "200")); response.Status >= 400 {
+			t.Fatalf("updateOwner failed: %s", response.Message)
+		}
+		if response := stub.MockInvoke("state", testutil.Args("updateProduct", "p0", "desc", "3", "c", "201")); response.Status >= 400 {
+			t.Fatalf("updateProduct failed: %s", response.Message)
+		}
+
+		expected := map[string]string{
+			"queryProductsByOwner/a": "p2,p4,p6,p8",
+			"queryProductsByOwner/c": "p0",
+			"queryProductsByState/2": "p1,p2,p3,p4",
+			"queryProductsByState/3": "p0",
+		}
+		for query, names := range expected {
+			parts := strings.Split(query, "/")
+			if actual := recordNames(queryPage(t, stub, parts...).Records); actual != names {
+				t.Errorf("rich=%t %s: expected %s, got %s", richQuery, query, names, actual)
+			}
+		}
+	}
+}
+
+func TestReindexProducts(t *testing.T) {
+	stub := getInitializedStub(t)
+	if response := stub.MockInit("init", testutil.Args("init", "admins", "a")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+
+	// products written by a chaincode version that set neither docType nor indexes
+	stub.MockTransactionStart("legacy")
+	for _, name := range []string{"l1", "l2", "l3"} {
+		key, _ := stub.CreateCompositeKey(productIndex, []string{name})
+		stub.PutState(key, []byte(`{"docType":"","desc":"old","state":2,"lastUpdated":1,"owner":"a"}`))
+	}
+	stub.MockTransactionEnd("legacy")
+
+	if names := recordNames(queryPage(t, stub, "queryProductsByOwner", "a").Records); names != "" {
+		t.Fatalf("legacy products must not be indexed yet, got %s", names)
+	}
+
+	other, err := testutil.NewIdentity("b")
+	if err != nil {
+		t.Fatalf("cannot generate identity of b: %s", err.Error())
+	}
+	if response := stub.MockInvokeAs(other, "reindex", testutil.Args("reindexProducts")); response.Status != 403 {
+		t.Errorf("expected status 403 for an organization without the admin role, got %d: %s", response.Status,
+			response.Message)
+	}
+	owner, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate identity of a: %s", err.Error())
+	}
+	if response := stub.MockInvokeAs(owner, "reindex", testutil.Args("reindexProducts", "0")); response.Status != 500 {
+		t.Errorf("expected status 500 for page size 0, got %d: %s", response.Status, response.Message)
+	}
+
+	// a second run reindexes the same products again
+	for i := 0; i < 2; i++ {
+		pages := []reindexPage{}
+		for bookmark := ""; len(pages) == 0 || len(bookmark) > 0; {
+			response := stub.MockInvoke("reindex", testutil.Args("reindexProducts", "2", bookmark))
+			var page reindexPage
+			if response.Status >= 400 || json.Unmarshal(response.Payload, &page) != nil {
+				t.Fatalf("reindexProducts failed: %d (%s%s)", response.Status, response.Message,
+					string(response.Payload))
+			}
+			pages = append(pages, page)
+			bookmark = page.Bookmark
+		}
+		if !reflect.DeepEqual(pages, []reindexPage{{2, "l2"}, {1, ""}}) {
+			t.Errorf("expected pages of 2 and 1 products, got %+v", pages)
+		}
+	}
+
+	for _, richQuery := range []bool{false, true} {
+		stub.RichQuery = richQuery
+		if names := recordNames(queryPage(t, stub, "queryProductsByOwner", "a").Records); names != "l1,l2,l3" {
+			t.Errorf("rich=%t: expected l1,l2,l3, got %s", richQuery, names)
+		}
+	}
+}
+
+func TestCouchDBIndexDefinitions(t *testing.T) {
+	indexes := map[string][]string{}
+	for _, name := range []string{"indexOwner", "indexState", "indexCustodian", "indexLastUpdated"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "META-INF", "statedb", "couchdb", "indexes", name+".json"))
+		if err != nil {
+			t.Fatalf("cannot read index %s: %s", name, err.Error())
+		}
+
+		var definition struct {
+			Index struct {
+				Fields []string `json:"fields"`
+			} `json:"index"`
+			Ddoc string `json:"ddoc"`
+			Name string `json:"name"`
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &definition); err != nil {
+			t.Fatalf("index %s is not valid JSON: %s", name, err.Error())
+		}
+		if definition.Name != name || definition.Type != "json" || definition.Index.Fields[0] != "docType" {
+			t.Errorf("index %s is malformed: %+v", name, definition)
+		}
+		for _, field := range definition.Index.Fields {
+			if !isProductField(field) {
+				t.Errorf("index %s refers to unknown field %s", name, field)
+			}
+		}
+		indexes["_design/"+definition.Ddoc+"/"+definition.Name] = definition.Index.Fields
+	}
+
+	// queries select on docType and the field and sort by lastUpdated, in the order of the index fields
+	for field, index := range queryIndexes {
+		fields, ok := indexes[strings.Join(index, "/")]
+		if !ok {
+			t.Errorf("query on %s uses index %v which is not bundled", field, index)
+			continue
+		}
+		if !reflect.DeepEqual(fields, []string{"docType", field, "lastUpdated"}) {
+			t.Errorf("query on %s cannot use index %v with fields %v", field, index, fields)
+		}
+	}
+}
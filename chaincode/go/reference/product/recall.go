@@ -0,0 +1,183 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	recallIndex  = "Recall"
+	lotIndexName = "gtin~lot~name"
+	// recallEventName is the event initRecall emits with the recall, so every owner of a product can act on it
+	recallEventName = "Recall.Initiated"
+)
+
+// Recall moves products to the recalled state: the products of a lot, or of every lot of a GTIN if Lot is empty,
+// and the products listed by name. Products lists the ones the recall affected with their owners at the time.
+type Recall struct {
+	ID        string            `json:"id"`
+	Reason    string            `json:"reason"`
+	GTIN      string            `json:"gtin,omitempty"`
+	Lot       string            `json:"lot,omitempty"`
+	Issuer    string            `json:"issuer"`
+	Products  []RecalledProduct `json:"products"`
+	TxId      string            `json:"txId"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// RecalledProduct is a product a recall affected and the organization that owned it
+type RecalledProduct struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+}
+
+// parseGTIN checks a GS1 trade item number: 8, 12, 13 or 14 digits, the last one the check digit
+func parseGTIN(gtin string) error {
+	invalid := errors.New(fmt.Sprintf("GTIN is invalid: %s (must be 8, 12, 13 or 14 digits with a check digit)",
+		gtin))
+
+	if n := len(gtin); n != 8 && n != 12 && n != 13 && n != 14 {
+		return invalid
+	}
+
+	// digits are weighted 3 and 1 alternately from the right, the check digit excluded
+	sum := 0
+	for i := len(gtin) - 2; i >= 0; i-- {
+		digit := int(gtin[i] - '0')
+		if digit < 0 || digit > 9 {
+			return invalid
+		}
+		if (len(gtin)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	if check := int(gtin[len(gtin)-1] - '0'); check != (10-sum%10)%10 {
+		return invalid
+	}
+
+	return nil
+}
+
+func recallKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(recallIndex, []string{id})
+}
+
+// loadRecall reads the recall, nil if there is none with the id
+func loadRecall(stub shim.ChaincodeStubInterface, id string) (*Recall, error) {
+	key, err := recallKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var recall Recall
+	if err := json.Unmarshal(data, &recall); err != nil {
+		return nil, err
+	}
+
+	return &recall, nil
+}
+
+// store writes the recall and emits it as the event of the transaction
+func (recall *Recall) store(stub shim.ChaincodeStubInterface) error {
+	key, err := recallKey(stub, recall.ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(recall)
+	if err != nil {
+		return err
+	}
+
+	if err := stub.PutState(key, value); err != nil {
+		return err
+	}
+
+	return stub.SetEvent(recallEventName, value)
+}
+
+// targets returns the names of the products of the lot, or of every lot of the GTIN if the lot is empty, and the
+// listed ones, sorted and without duplicates
+func (recall *Recall) targets(stub shim.ChaincodeStubInterface, names []string) ([]string, error) {
+	unique := map[string]bool{}
+	for _, name := range names {
+		unique[name] = true
+	}
+
+	if len(recall.GTIN) > 0 {
+		attributes := []string{recall.GTIN}
+		if len(recall.Lot) > 0 {
+			attributes = append(attributes, recall.Lot)
+		}
+
+		it, err := stub.GetStateByPartialCompositeKey(lotIndexName, attributes)
+		if err != nil {
+			return nil, err
+		}
+		defer it.Close()
+
+		for it.HasNext() {
+			response, err := it.Next()
+			if err != nil {
+				return nil, err
+			}
+
+			_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+			if err != nil {
+				return nil, err
+			}
+			unique[compositeKeyParts[len(compositeKeyParts)-1]] = true
+		}
+	}
+
+	targets := make([]string, 0, len(unique))
+	for name := range unique {
+		targets = append(targets, name)
+	}
+	sort.Strings(targets)
+
+	return targets, nil
+}
+
+// registrant returns the organization that registered the product, the owner of its first version
+func (product *Product) registrant(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKey, err := product.ToCompositeKey(stub)
+	if err != nil {
+		return "", err
+	}
+
+	it, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return "", err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		modification, err := it.Next()
+		if err != nil {
+			return "", err
+		}
+		if modification.IsDelete {
+			continue
+		}
+
+		var value ProductValue
+		if err := json.Unmarshal(modification.Value, &value); err != nil {
+			return "", err
+		}
+		return value.Owner, nil
+	}
+
+	return "", errors.New(fmt.Sprintf("product %s has no history", product.Key.Name))
+}
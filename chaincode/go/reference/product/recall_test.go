@@ -0,0 +1,201 @@
+package product
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"testutil"
+)
+
+const (
+	gtinA = "4006381333931"
+	gtinB = "5901234123457"
+)
+
+func TestParseGTIN(t *testing.T) {
+	for _, test := range []struct {
+		gtin  string
+		valid bool
+	}{
+		{"96385074", true},
+		{"036000291452", true},
+		{gtinA, true},
+		{"10036000291459", true},
+		{"4006381333932", false},
+		{"400638133393", false},
+		{"40063813339x1", false},
+		{"", false},
+	} {
+		if err := parseGTIN(test.gtin); (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.gtin, test.valid, err)
+		}
+	}
+}
+
+// recallStub registers p1 and p2 of lot L1 and p3 of lot L2 of gtinA, p4 of gtinB, and p5 without a lot, all by
+// a. p2 is sold to b.
+func recallStub(t *testing.T) (*testutil.MockStub, map[string]*testutil.Identity) {
+	stub := getInitializedStub(t)
+
+	identities := testutil.NewIdentities(t, "a", "b")
+
+	steps := [][]string{
+		{"assignLot", "p1", gtinA, "L1"},
+		{"assignLot", "p2", gtinA, "L1"},
+		{"assignLot", "p3", gtinA, "L2"},
+		{"assignLot", "p4", gtinB, "L1"},
+		{"updateOwner", "p2", "a", "b", "200"},
+	}
+	for _, name := range []string{"p1", "p2", "p3", "p4", "p5"} {
+		steps = append([][]string{{"initProduct", name, "desc", "1", "a", "100"}}, steps...)
+	}
+	invokeSteps(t, stub, steps)
+
+	return stub, identities
+}
+
+func TestAssignLot(t *testing.T) {
+	stub, identities := recallStub(t)
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"a", []string{"p1", gtinB, "L9"}, 409},
+		{"b", []string{"p5", gtinA, "L1"}, 403},
+		{"a", []string{"p9", gtinA, "L1"}, 404},
+		{"a", []string{"p5", "123", "L1"}, 500},
+		{"a", []string{"p5", gtinA, ""}, 500},
+		{"a", []string{"p5", gtinA}, 500},
+		{"a", []string{"p5", gtinA, "L1"}, 200},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "lot", testutil.Args(append([]string{"assignLot"},
+			test.args...)...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	// an update keeps the lot
+	if response := stub.MockInvoke("update", testutil.Args("updateProduct", "p5", "new", "2", "a", "300")); response.Status >= 400 {
+		t.Fatalf("updateProduct failed: %s", response.Message)
+	}
+	p5 := Product{Key: ProductKey{Name: "p5"}}
+	if err := p5.LoadFrom(stub); err != nil || p5.Value.GTIN != gtinA || p5.Value.Lot != "L1" {
+		t.Errorf("expected p5 to stay in lot L1 of %s, got %+v (%v)", gtinA, p5.Value, err)
+	}
+}
+
+func recalled(t *testing.T, stub *testutil.MockStub, id *testutil.Identity, args ...string) (Recall, int32) {
+	response := stub.MockInvokeAs(id, "recall", testutil.Args(append([]string{"initRecall"}, args...)...))
+	if response.Status >= 400 {
+		return Recall{}, response.Status
+	}
+
+	var recall Recall
+	if err := json.Unmarshal(response.Payload, &recall); err != nil {
+		t.Fatalf("cannot unmarshal recall: %s", err.Error())
+	}
+	return recall, response.Status
+}
+
+func TestInitRecall(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		args     []string
+		expected []RecalledProduct
+	}{
+		{"lot", []string{gtinA, "L1"}, []RecalledProduct{{"p1", "a"}, {"p2", "b"}}},
+		{"GTIN", []string{gtinA, ""}, []RecalledProduct{{"p1", "a"}, {"p2", "b"}, {"p3", "a"}}},
+		{"products", []string{"", "", "p5", "p4", "p5"}, []RecalledProduct{{"p4", "a"}, {"p5", "a"}}},
+		{"lot and products", []string{gtinB, "L1", "p1"}, []RecalledProduct{{"p1", "a"}, {"p4", "a"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stub, identities := recallStub(t)
+
+			recall, status := recalled(t, stub, identities["a"], append([]string{"r1", "contamination"},
+				test.args...)...)
+			if status != 200 {
+				t.Fatalf("expected status 200, got %d", status)
+			}
+			if !reflect.DeepEqual(recall.Products, test.expected) || recall.Issuer != "a" || recall.TxId != "recall" {
+				t.Errorf("expected products %+v recalled by a, got %+v", test.expected, recall)
+			}
+
+			event := stub.LastEvent()
+			if event == nil || event.EventName != recallEventName {
+				t.Fatalf("expected event %s, got %+v", recallEventName, event)
+			}
+			var emitted Recall
+			if err := json.Unmarshal(event.Payload, &emitted); err != nil || !reflect.DeepEqual(emitted, recall) {
+				t.Errorf("expected the recall as the event payload, got %s", event.Payload)
+			}
+
+			for _, p := range test.expected {
+				product := Product{Key: ProductKey{Name: p.Name}}
+				if err := product.LoadFrom(stub); err != nil || product.Value.State != stateRecalled {
+					t.Errorf("expected %s to be recalled, got %+v (%v)", p.Name, product.Value, err)
+				}
+			}
+
+			response := stub.MockInvoke("read", testutil.Args("readRecall", "r1"))
+			var stored Recall
+			if err := json.Unmarshal(response.Payload, &stored); err != nil || !reflect.DeepEqual(stored, recall) {
+				t.Errorf("expected readRecall to return the recall, got %s", response.Payload)
+			}
+		})
+	}
+}
+
+func TestInitRecallErrors(t *testing.T) {
+	stub, identities := recallStub(t)
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"a", []string{"r1", "contamination", "", ""}, 500},
+		{"a", []string{"r1", "contamination", "", "L1", "p1"}, 500},
+		{"a", []string{"r1", "contamination", "123", "L1"}, 500},
+		{"a", []string{"r1", "", gtinA, "L1"}, 500},
+		{"a", []string{"", "contamination", gtinA, "L1"}, 500},
+		{"a", []string{"r1", "contamination", gtinA}, 500},
+		{"a", []string{"r1", "contamination", gtinA, "L9"}, 404},
+		{"a", []string{"r1", "contamination", "", "", "p9"}, 404},
+		// b owns p2 but didn't register it
+		{"b", []string{"r1", "contamination", "", "", "p2"}, 403},
+		{"a", []string{"r1", "contamination", gtinA, "L2"}, 200},
+		{"a", []string{"r1", "contamination", gtinB, "L1"}, 409},
+		{"a", []string{"r2", "contamination", gtinA, "L2"}, 409},
+		{"a", []string{"r2", "contamination", "", "", "p3", "p5"}, 200},
+	}
+	for i, test := range tests {
+		if _, status := recalled(t, stub, identities[test.org], test.args...); status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d", i, test.args, test.expected, status)
+		}
+	}
+
+	response := stub.MockInvoke("query", testutil.Args("queryProductsByState", strconv.Itoa(stateRecalled)))
+	var page productPage
+	if err := json.Unmarshal(response.Payload, &page); err != nil || len(page.Records) != 2 {
+		t.Errorf("expected 2 recalled products, got %s", response.Payload)
+	}
+
+	if response := stub.MockInvoke("read", testutil.Args("readRecall", "r9")); response.Status != 404 {
+		t.Errorf("expected status 404 for an unknown recall, got %d", response.Status)
+	}
+
+	// recalled products can neither be updated nor change hands
+	if response := stub.MockInvoke("update", testutil.Args("updateProduct", "p3", "desc", "2", "a", "300")); response.Status < 400 {
+		t.Error("expected an error updating a recalled product")
+	}
+	if response := stub.MockInvoke("owner", testutil.Args("updateOwner", "p5", "a", "b", "300")); response.Status != 409 {
+		t.Errorf("expected status 409 for a new owner of a recalled product, got %d", response.Status)
+	}
+}
@@ -0,0 +1,112 @@
+package product
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	roleIndex = "Role"
+	// roleAuditor issues certifications, sets threshold rules and clears quality holds
+	roleAuditor = "auditor"
+	// roleAdmin maintains the chaincode data, e.g. reindexes products after an upgrade
+	roleAdmin = "admin"
+)
+
+// initRoles are the arguments of Init that register the organizations following them with a role
+var initRoles = map[string]string{
+	"auditors": roleAuditor,
+	"admins":   roleAdmin,
+}
+
+// parseInitRoles reads the arguments of Init, e.g. "auditors" lab "admins" a, into the organizations of each role.
+// A role that isn't among them is left out.
+func parseInitRoles(args []string) map[string][]string {
+	roles := map[string][]string{}
+	role := ""
+	for _, arg := range args {
+		if r, ok := initRoles[arg]; ok {
+			role = r
+			roles[role] = []string{}
+		} else if len(role) > 0 {
+			roles[role] = append(roles[role], arg)
+		}
+	}
+
+	return roles
+}
+
+func roleKey(stub shim.ChaincodeStubInterface, role string) (string, error) {
+	return stub.CreateCompositeKey(roleIndex, []string{role})
+}
+
+// loadRole reads the organizations with the role
+func loadRole(stub shim.ChaincodeStubInterface, role string) ([]string, error) {
+	key, err := roleKey(stub, role)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := []string{}
+	if data == nil {
+		return orgs, nil
+	}
+	if err := json.Unmarshal(data, &orgs); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// storeRole replaces the organizations with the role
+func storeRole(stub shim.ChaincodeStubInterface, role string, orgs []string) error {
+	parsed := []string{}
+	for _, org := range orgs {
+		org, err := parseOrganization(org)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, org)
+	}
+	sort.Strings(parsed)
+
+	key, err := roleKey(stub, role)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(parsed)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// hasRole tells if the organization has the role
+func hasRole(stub shim.ChaincodeStubInterface, role, org string) (bool, error) {
+	orgs, err := loadRole(stub, role)
+	if err != nil {
+		return false, err
+	}
+
+	for _, o := range orgs {
+		if o == org {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isAuditor tells if the organization has the auditor role
+func isAuditor(stub shim.ChaincodeStubInterface, org string) (bool, error) {
+	return hasRole(stub, roleAuditor, org)
+}
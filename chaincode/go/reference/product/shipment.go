@@ -0,0 +1,194 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	shipmentIndex      = "Shipment"
+	custodianIndexName = "custodian~name"
+)
+
+const (
+	shipmentStatusCreated   = "Created"
+	shipmentStatusInTransit = "InTransit"
+	shipmentStatusDelivered = "Delivered"
+)
+
+// Shipment moves products from Origin to Destination in the custody of organizations other than their owners:
+// the shipper that created it, the contracted Carrier and whoever they hand the goods over to. Custodian and
+// Location are where the goods are now. Every handoff is signed by both sides: the custodian offers it, Pending
+// until the receiving organization accepts. A handoff accepted at the destination delivers the shipment.
+type Shipment struct {
+	ID          string           `json:"id"`
+	Shipper     string           `json:"shipper"`
+	Carrier     string           `json:"carrier"`
+	Origin      string           `json:"origin"`
+	Destination string           `json:"destination"`
+	Products    []string         `json:"products"`
+	Status      string           `json:"status"`
+	Custodian   string           `json:"custodian"`
+	Location    string           `json:"location"`
+	Legs        []ShipmentLeg    `json:"legs"`
+	Handoffs    []Handoff        `json:"handoffs"`
+	Pending     *Handoff         `json:"pending,omitempty"`
+	Created     CustodySignature `json:"created"`
+}
+
+// ShipmentLeg is the stretch of the route one custodian covered, from the location it took the goods at to the
+// one it handed them over at. To and Ended are empty for the current custodian.
+type ShipmentLeg struct {
+	Custodian string `json:"custodian"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	Started   int64  `json:"started"`
+	Ended     int64  `json:"ended,omitempty"`
+}
+
+// Handoff passes custody of the goods at Location. From is the transaction of the custodian that offered it, To
+// the one of the organization that accepted it; To has the organization only while the handoff is pending.
+type Handoff struct {
+	Location string           `json:"location"`
+	From     CustodySignature `json:"from"`
+	To       CustodySignature `json:"to"`
+}
+
+// CustodySignature is a transaction of an organization, which the organization signed as its creator
+type CustodySignature struct {
+	Org       string `json:"org"`
+	TxId      string `json:"txId,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// ProductCustody is who holds a product, apart from who owns it. A product that was never shipped is held by its
+// owner where it was registered, so its location is unknown.
+type ProductCustody struct {
+	Product   string `json:"product"`
+	Owner     string `json:"owner"`
+	Custodian string `json:"custodian"`
+	Location  string `json:"location,omitempty"`
+	Shipment  string `json:"shipment,omitempty"`
+}
+
+// custody returns who holds the product
+func (product *Product) custody() ProductCustody {
+	custody := ProductCustody{Product: product.Key.Name, Owner: product.Value.Owner,
+		Custodian: product.Value.Custodian, Location: product.Value.Location, Shipment: product.Value.Shipment}
+	if len(custody.Custodian) == 0 {
+		custody.Custodian = product.Value.Owner
+	}
+
+	return custody
+}
+
+// parseLocation checks a location: any non-empty UTF-8 string, e.g. a UN/LOCODE or an address
+func parseLocation(location string) error {
+	if len(location) == 0 || !utf8.ValidString(location) {
+		return errors.New("location must be a non-empty UTF-8 string")
+	}
+
+	return nil
+}
+
+// parseOrganization reads an organization name the way product owners are stored, in lower case
+func parseOrganization(org string) (string, error) {
+	if len(org) == 0 || !isValidKeyPart(org) {
+		return "", errors.New("organization must be a non-empty UTF-8 string without U+0000 and U+10FFFF")
+	}
+
+	return strings.ToLower(org), nil
+}
+
+func shipmentKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(shipmentIndex, []string{id})
+}
+
+// loadShipment reads the shipment, nil if there is none with the id
+func loadShipment(stub shim.ChaincodeStubInterface, id string) (*Shipment, error) {
+	key, err := shipmentKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var shipment Shipment
+	if err := json.Unmarshal(data, &shipment); err != nil {
+		return nil, err
+	}
+
+	return &shipment, nil
+}
+
+func (shipment *Shipment) store(stub shim.ChaincodeStubInterface) error {
+	key, err := shipmentKey(stub, shipment.ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(shipment)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// sign returns the signature of the caller on the current transaction
+func sign(stub shim.ChaincodeStubInterface) (CustodySignature, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return CustodySignature{}, err
+	}
+
+	return CustodySignature{Org: GetCreatorOrganization(stub), TxId: stub.GetTxID(), Timestamp: timestamp.Seconds},
+		nil
+}
+
+// accept completes the pending handoff: the receiving organization becomes the custodian at its location
+func (shipment *Shipment) accept(signature CustodySignature) {
+	handoff := *shipment.Pending
+	handoff.To = signature
+	shipment.Handoffs = append(shipment.Handoffs, handoff)
+	shipment.Pending = nil
+
+	last := &shipment.Legs[len(shipment.Legs)-1]
+	last.To = handoff.Location
+	last.Ended = signature.Timestamp
+	shipment.Legs = append(shipment.Legs, ShipmentLeg{Custodian: signature.Org, From: handoff.Location,
+		Started: signature.Timestamp})
+
+	shipment.Custodian = signature.Org
+	shipment.Location = handoff.Location
+	shipment.Status = shipmentStatusInTransit
+	if handoff.Location == shipment.Destination {
+		shipment.Status = shipmentStatusDelivered
+	}
+}
+
+// moveProducts sets the custody of the products of the shipment to its custodian and location
+func (shipment *Shipment) moveProducts(stub shim.ChaincodeStubInterface) error {
+	for _, name := range shipment.Products {
+		product := Product{Key: ProductKey{Name: name}}
+		if err := product.LoadFrom(stub); err != nil {
+			return err
+		}
+
+		product.Value.Shipment = shipment.ID
+		product.Value.Custodian = shipment.Custodian
+		product.Value.Location = shipment.Location
+		if err := product.UpdateOrInsertIn(stub); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package product
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"testutil"
+)
+
+func TestShipment(t *testing.T) {
+	stub := getInitializedStub(t)
+	identities := testutil.NewIdentities(t, "a", "b", "c", "d")
+
+	for _, name := range []string{"p1", "p2", "p3"} {
+		if response := stub.MockInvoke("init", testutil.Args("initProduct", name, "desc", "1", "a", "100")); response.Status >= 400 {
+			t.Fatalf("initProduct failed: %s", response.Message)
+		}
+	}
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"b", []string{"createShipment", "s1", "DEHAM", "USNYC", "c", "p1"}, 403},
+		{"a", []string{"createShipment", "s1", "DEHAM", "USNYC", "c", "p9"}, 404},
+		{"a", []string{"createShipment", "s1", "", "USNYC", "c", "p1"}, 500},
+		{"a", []string{"createShipment", "s1", "DEHAM", "USNYC", "c"}, 500},
+		{"a", []string{"createShipment", "s1", "DEHAM", "USNYC", "C", "p1", "p2", "p1"}, 200},
+		{"a", []string{"createShipment", "s1", "DEHAM", "USNYC", "c", "p3"}, 409},
+		{"a", []string{"createShipment", "s2", "DEHAM", "USNYC", "c", "p2"}, 409},
+		{"c", []string{"acceptShipment", "s1"}, 409},
+		{"c", []string{"handOverShipment", "s1", "d", "DEHAM"}, 403},
+		{"a", []string{"handOverShipment", "s1", "a", "DEHAM"}, 500},
+		{"a", []string{"handOverShipment", "s9", "c", "DEHAM"}, 404},
+		// the offer to the wrong organization is replaced
+		{"a", []string{"handOverShipment", "s1", "d", "DEHAM"}, 200},
+		{"a", []string{"handOverShipment", "s1", "c", "DEHAM"}, 200},
+		{"d", []string{"acceptShipment", "s1"}, 403},
+		{"c", []string{"acceptShipment", "s1"}, 200},
+		// ownership changes while the carrier holds the goods
+		{"a", []string{"updateOwner", "p1", "a", "b", "200"}, 200},
+		{"c", []string{"handOverShipment", "s1", "d", "NLRTM"}, 200},
+		{"d", []string{"acceptShipment", "s1"}, 200},
+		{"d", []string{"handOverShipment", "s1", "b", "USNYC"}, 200},
+		{"b", []string{"acceptShipment", "s1"}, 200},
+		{"b", []string{"handOverShipment", "s1", "c", "USNYC"}, 409},
+		// delivered goods can be shipped again by their custodian
+		{"a", []string{"createShipment", "s2", "USNYC", "USBOS", "c", "p2"}, 403},
+		{"b", []string{"createShipment", "s2", "USNYC", "USBOS", "c", "p2"}, 200},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "shipment", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	response := stub.MockInvoke("read", testutil.Args("readShipment", "s1"))
+	var shipment Shipment
+	if err := json.Unmarshal(response.Payload, &shipment); err != nil {
+		t.Fatalf("cannot unmarshal shipment: %s", err.Error())
+	}
+	if shipment.Status != shipmentStatusDelivered || shipment.Custodian != "b" || shipment.Location != "USNYC" ||
+		shipment.Carrier != "c" || shipment.Pending != nil || !reflect.DeepEqual(shipment.Products, []string{"p1", "p2"}) {
+		t.Errorf("expected s1 delivered to b in USNYC, got %+v", shipment)
+	}
+
+	route := []string{}
+	for _, leg := range shipment.Legs {
+		route = append(route, leg.Custodian+":"+leg.From+">"+leg.To)
+	}
+	if expected := []string{"a:DEHAM>DEHAM", "c:DEHAM>NLRTM", "d:NLRTM>USNYC", "b:USNYC>"}; !reflect.DeepEqual(route, expected) {
+		t.Errorf("expected legs %v, got %v", expected, route)
+	}
+	for _, handoff := range shipment.Handoffs {
+		if len(handoff.From.TxId) == 0 || len(handoff.To.TxId) == 0 || handoff.From.Org == handoff.To.Org {
+			t.Errorf("expected a handoff signed by both sides, got %+v", handoff)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		expected ProductCustody
+	}{
+		{"p1", ProductCustody{Product: "p1", Owner: "b", Custodian: "b", Location: "USNYC", Shipment: "s1"}},
+		{"p2", ProductCustody{Product: "p2", Owner: "a", Custodian: "b", Location: "USNYC", Shipment: "s2"}},
+		{"p3", ProductCustody{Product: "p3", Owner: "a", Custodian: "a"}},
+	} {
+		response := stub.MockInvoke("custody", testutil.Args("getProductCustody", test.name))
+		var custody ProductCustody
+		if err := json.Unmarshal(response.Payload, &custody); err != nil || custody != test.expected {
+			t.Errorf("expected %+v, got %s", test.expected, response.Payload)
+		}
+	}
+
+	for _, richQuery := range []bool{false, true} {
+		stub.RichQuery = richQuery
+		response := stub.MockInvoke("query", testutil.Args("queryProductsByCustodian", "B", "", "", "", "owner"))
+		var page productPage
+		if err := json.Unmarshal(response.Payload, &page); err != nil || len(page.Records) != 2 {
+			t.Errorf("rich=%t: expected the 2 products held by b, got %s", richQuery, response.Payload)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package product
+
+import (
+	"sort"
+)
+
+// ProductModification is a version of a product from the history database: the value a transaction wrote or
+// the deletion of the product. Timestamp is the time of the transaction in seconds. Ledger dumps keep product
+// history as JSON Lines of it, so the snapshot can be replayed offline the same way the chaincode does.
+type ProductModification struct {
+	Key       ProductKey   `json:"key"`
+	Value     ProductValue `json:"value"`
+	TxId      string       `json:"txId"`
+	Timestamp int64        `json:"timestamp"`
+	IsDelete  bool         `json:"isDelete"`
+}
+
+// OwnerInventory lists the products an owner held, by product name.
+type OwnerInventory struct {
+	Owner    string                `json:"owner"`
+	Products []ProductModification `json:"products"`
+}
+
+// InventorySnapshot is the state of the registry as of the time of a transaction, by owner.
+type InventorySnapshot struct {
+	AsOf        int64            `json:"asOf"`
+	Inventories []OwnerInventory `json:"inventories"`
+}
+
+// InventoryReplay rebuilds an InventorySnapshot from product modifications. They may come in any order of products
+// but the modifications of one product must be applied oldest first, the way GetHistoryForKey returns them.
+type InventoryReplay struct {
+	asOf   int64
+	owner  string
+	latest map[string]ProductModification
+}
+
+// NewInventoryReplay creates a replay of the registry as of asOf for the owner, or for all owners if it's empty.
+func NewInventoryReplay(asOf int64, owner string) *InventoryReplay {
+	return &InventoryReplay{asOf: asOf, owner: owner, latest: map[string]ProductModification{}}
+}
+
+// Apply takes the modification into account unless it happened after the time of the snapshot.
+func (replay *InventoryReplay) Apply(modification ProductModification) {
+	if modification.Timestamp > replay.asOf {
+		return
+	}
+
+	replay.latest[modification.Key.Name] = modification
+}
+
+// Snapshot returns inventories of the owners who held at least one product, ordered by owner.
+func (replay *InventoryReplay) Snapshot() InventorySnapshot {
+	byOwner := map[string][]ProductModification{}
+	for _, modification := range replay.latest {
+		if modification.IsDelete {
+			continue
+		}
+		if len(replay.owner) > 0 && modification.Value.Owner != replay.owner {
+			continue
+		}
+
+		byOwner[modification.Value.Owner] = append(byOwner[modification.Value.Owner], modification)
+	}
+
+	snapshot := InventorySnapshot{AsOf: replay.asOf, Inventories: []OwnerInventory{}}
+	for owner, products := range byOwner {
+		sort.Slice(products, func(i, j int) bool {
+			return products[i].Key.Name < products[j].Key.Name
+		})
+		snapshot.Inventories = append(snapshot.Inventories, OwnerInventory{Owner: owner, Products: products})
+	}
+	sort.Slice(snapshot.Inventories, func(i, j int) bool {
+		return snapshot.Inventories[i].Owner < snapshot.Inventories[j].Owner
+	})
+
+	return snapshot
+}
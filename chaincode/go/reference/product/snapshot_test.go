@@ -0,0 +1,140 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"testutil"
+)
+
+// snapshotStub registers p1 by a at 1000 and p2 by b at 1001, hands p1 over to b at 1002, activates p2 at 1003
+// and hands it over to c at 1004
+func snapshotStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t)
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+
+	steps := [][]string{
+		{"initProduct", "p1", "", "1", "a", "1"},
+		{"initProduct", "p2", "", "1", "b", "2"},
+		{"updateOwner", "p1", "a", "b", "3"},
+		{"updateProduct", "p2", "", "2", "b", "4"},
+		{"updateOwner", "p2", "b", "c", "5"},
+	}
+	invokeSteps(t, stub, steps)
+
+	return stub
+}
+
+// inventoryOf reduces a snapshot to the transactions that wrote the products held, by owner
+func inventoryOf(snapshot InventorySnapshot) map[string][]string {
+	inventory := map[string][]string{}
+	for _, ownerInventory := range snapshot.Inventories {
+		for _, product := range ownerInventory.Products {
+			if product.Value.Owner != ownerInventory.Owner {
+				return map[string][]string{"inconsistent": {product.Key.Name}}
+			}
+			inventory[ownerInventory.Owner] = append(inventory[ownerInventory.Owner],
+				product.Key.Name+"@"+product.TxId)
+		}
+	}
+
+	return inventory
+}
+
+func TestGetInventorySnapshot(t *testing.T) {
+	stub := snapshotStub(t)
+
+	tests := []struct {
+		args     []string
+		expected map[string][]string
+	}{
+		{[]string{"999"}, map[string][]string{}},
+		{[]string{"1000"}, map[string][]string{"a": {"p1@tx0"}}},
+		{[]string{"1001"}, map[string][]string{"a": {"p1@tx0"}, "b": {"p2@tx1"}}},
+		{[]string{"1002"}, map[string][]string{"b": {"p1@tx2", "p2@tx1"}}},
+		{[]string{"1003"}, map[string][]string{"b": {"p1@tx2", "p2@tx3"}}},
+		{[]string{"1004"}, map[string][]string{"b": {"p1@tx2"}, "c": {"p2@tx4"}}},
+		{[]string{"2000000000"}, map[string][]string{"b": {"p1@tx2"}, "c": {"p2@tx4"}}},
+		{[]string{"1001", "a"}, map[string][]string{"a": {"p1@tx0"}}},
+		{[]string{"1001", "B"}, map[string][]string{"b": {"p2@tx1"}}},
+		{[]string{"1002", "a"}, map[string][]string{}},
+		{[]string{"1004", ""}, map[string][]string{"b": {"p1@tx2"}, "c": {"p2@tx4"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.args), func(t *testing.T) {
+			response := stub.MockInvoke("snapshot", testutil.Args(append([]string{"getInventorySnapshot"}, test.args...)...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			var snapshot InventorySnapshot
+			if err := json.Unmarshal(response.Payload, &snapshot); err != nil {
+				t.Fatalf("cannot unmarshal snapshot: %s", err.Error())
+			}
+
+			if inventory := inventoryOf(snapshot); !reflect.DeepEqual(inventory, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, inventory)
+			}
+		})
+	}
+}
+
+func TestGetInventorySnapshotErrors(t *testing.T) {
+	stub := snapshotStub(t)
+
+	for _, args := range [][]string{{}, {"yesterday"}, {"-1"}} {
+		response := stub.MockInvoke("snapshot", testutil.Args(append([]string{"getInventorySnapshot"}, args...)...))
+		if response.Status < 400 {
+			t.Errorf("expected an error for arguments %v", args)
+		}
+	}
+}
+
+func TestInventoryReplay(t *testing.T) {
+	modification := func(name, owner, txID string, timestamp int64, isDelete bool) ProductModification {
+		return ProductModification{Key: ProductKey{Name: name}, Value: ProductValue{Owner: owner},
+			TxId: txID, Timestamp: timestamp, IsDelete: isDelete}
+	}
+
+	// products interleave the way a dump of several histories may, each one stays in order
+	modifications := []ProductModification{
+		modification("p2", "b", "tx1", 10, false),
+		modification("p1", "a", "tx2", 10, false),
+		modification("p2", "", "tx3", 20, true),
+		modification("p1", "b", "tx4", 20, false),
+		modification("p3", "a", "tx5", 30, false),
+		modification("p2", "a", "tx6", 30, false),
+	}
+
+	tests := []struct {
+		asOf     int64
+		owner    string
+		expected map[string][]string
+	}{
+		{9, "", map[string][]string{}},
+		{10, "", map[string][]string{"a": {"p1@tx2"}, "b": {"p2@tx1"}}},
+		{20, "", map[string][]string{"b": {"p1@tx4"}}},
+		{30, "", map[string][]string{"a": {"p2@tx6", "p3@tx5"}, "b": {"p1@tx4"}}},
+		{30, "a", map[string][]string{"a": {"p2@tx6", "p3@tx5"}}},
+		{30, "c", map[string][]string{}},
+	}
+
+	for _, test := range tests {
+		replay := NewInventoryReplay(test.asOf, test.owner)
+		for _, m := range modifications {
+			replay.Apply(m)
+		}
+
+		snapshot := replay.Snapshot()
+		if snapshot.AsOf != test.asOf {
+			t.Errorf("expected snapshot as of %d, got %d", test.asOf, snapshot.AsOf)
+		}
+		if inventory := inventoryOf(snapshot); !reflect.DeepEqual(inventory, test.expected) {
+			t.Errorf("as of %d for %q: expected %v, got %v", test.asOf, test.owner, test.expected, inventory)
+		}
+	}
+}
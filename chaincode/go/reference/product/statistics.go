@@ -0,0 +1,80 @@
+package product
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"params"
+)
+
+// productStatistics is the response of getProductStatistics. States are keys of ByState in decimal.
+type productStatistics struct {
+	Total   int            `json:"total"`
+	ByState map[string]int `json:"byState"`
+	ByOwner map[string]int `json:"byOwner"`
+}
+
+// collectProductStatistics counts products last updated within the window by state and by owner. The window applies
+// to the time of the transaction that last wrote the product, from its history, like the statistics of transfers:
+// lastUpdated is set by clients, in their own units.
+func collectProductStatistics(stub shim.ChaincodeStubInterface, window params.TimeWindow) (productStatistics, error) {
+	statistics := productStatistics{ByState: map[string]int{}, ByOwner: map[string]int{}}
+
+	it, err := stub.GetStateByPartialCompositeKey(productIndex, []string{})
+	if err != nil {
+		return productStatistics{}, err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return productStatistics{}, err
+		}
+
+		var product Product
+		if err := product.FillFromLedgerValue(response.Value); err != nil {
+			return productStatistics{}, err
+		}
+
+		if window != (params.TimeWindow{From: 0, To: math.MaxInt64}) {
+			updated, err := lastModified(stub, response.Key)
+			if err != nil {
+				return productStatistics{}, err
+			}
+			if updated < 0 || !window.Contains(updated) {
+				continue
+			}
+		}
+
+		statistics.Total++
+		statistics.ByState[strconv.Itoa(product.Value.State)]++
+		statistics.ByOwner[product.Value.Owner]++
+	}
+
+	return statistics, nil
+}
+
+// lastModified returns the time in seconds of the last transaction that wrote the key, -1 if it has no history
+func lastModified(stub shim.ChaincodeStubInterface, compositeKey string) (int64, error) {
+	historyIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return 0, err
+	}
+	defer historyIterator.Close()
+
+	updated := int64(-1)
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		if modification.Timestamp != nil {
+			updated = modification.Timestamp.Seconds
+		}
+	}
+
+	return updated, nil
+}
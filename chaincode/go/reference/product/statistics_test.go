@@ -0,0 +1,65 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	"testutil"
+)
+
+func TestGetProductStatistics(t *testing.T) {
+	stub := getInitializedStub(t)
+	// the window applies to the times of the transactions, 100 to 400, not to lastUpdated in milliseconds
+	products := []ProductValue{
+		{State: stateRegistered, Owner: "a", LastUpdated: 100000},
+		{State: stateActive, Owner: "a", LastUpdated: 200000},
+		{State: stateActive, Owner: "b", LastUpdated: 300000},
+		{State: stateInactive, Owner: "c", LastUpdated: 400000},
+	}
+	for i, value := range products {
+		product := Product{Key: ProductKey{Name: fmt.Sprintf("p%d", i)}, Value: value}
+		stub.MockTransactionStart("seed")
+		stub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(100 * (i + 1))}
+		if err := product.UpdateOrInsertIn(stub); err != nil {
+			t.Fatalf("cannot seed product %s: %s", product.Key.Name, err.Error())
+		}
+		stub.MockTransactionEnd("seed")
+	}
+
+	tests := []struct {
+		args     []string
+		expected productStatistics
+	}{
+		{[]string{}, productStatistics{Total: 4,
+			ByState: map[string]int{"1": 1, "2": 2, "4": 1}, ByOwner: map[string]int{"a": 2, "b": 1, "c": 1}}},
+		{[]string{"200"}, productStatistics{Total: 3,
+			ByState: map[string]int{"2": 2, "4": 1}, ByOwner: map[string]int{"a": 1, "b": 1, "c": 1}}},
+		{[]string{"", "200"}, productStatistics{Total: 2,
+			ByState: map[string]int{"1": 1, "2": 1}, ByOwner: map[string]int{"a": 2}}},
+		{[]string{"200", "300"}, productStatistics{Total: 2,
+			ByState: map[string]int{"2": 2}, ByOwner: map[string]int{"a": 1, "b": 1}}},
+		{[]string{"500"}, productStatistics{ByState: map[string]int{}, ByOwner: map[string]int{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.args), func(t *testing.T) {
+			response := stub.MockInvoke("statistics",
+				testutil.Args(append([]string{"getProductStatistics"}, test.args...)...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			var statistics productStatistics
+			if err := json.Unmarshal(response.Payload, &statistics); err != nil {
+				t.Fatalf("cannot unmarshal statistics: %s", err.Error())
+			}
+			if !reflect.DeepEqual(statistics, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, statistics)
+			}
+		})
+	}
+}
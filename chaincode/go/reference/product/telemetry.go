@@ -0,0 +1,314 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	readingIndex        = "Reading"
+	breachIndex         = "Breach"
+	thresholdRulesIndex = "ThresholdRules"
+	// breachEventName is the event of a transaction that recorded readings out of the bounds of the rules
+	breachEventName = "Breach.Detected"
+	// readingFieldsNumber is the number of arguments of a reading: device, time, metric, value
+	readingFieldsNumber = 4
+)
+
+const (
+	telemetryTargetProduct  = "product"
+	telemetryTargetShipment = "shipment"
+)
+
+// Reading is a sensor measurement of a metric, e.g. temperature, at Time in Unix seconds. Org is the custodian
+// that recorded it.
+type Reading struct {
+	Device string  `json:"device"`
+	Time   int64   `json:"time"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Org    string  `json:"org"`
+	TxId   string  `json:"txId"`
+}
+
+// ThresholdRule bounds the values of a metric. A nil bound is no bound.
+type ThresholdRule struct {
+	Metric string   `json:"metric"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// ThresholdRules are the rules for the products of a GTIN, the product type. Organizations with the auditor role
+// set them and clear the quality holds they cause; Org is the one that changed them last.
+type ThresholdRules struct {
+	GTIN  string          `json:"gtin"`
+	Org   string          `json:"org"`
+	Rules []ThresholdRule `json:"rules"`
+}
+
+// Breach is a reading out of the bounds of a rule for a product. Cleared is the transaction of the auditor that
+// released the quality hold, nil while the breach is open.
+type Breach struct {
+	ID       string            `json:"id"`
+	Product  string            `json:"product"`
+	Shipment string            `json:"shipment,omitempty"`
+	Reading  Reading           `json:"reading"`
+	Rule     ThresholdRule     `json:"rule"`
+	Cleared  *CustodySignature `json:"cleared,omitempty"`
+}
+
+// telemetryRecord is the response of recordReadings: the number of new readings and the breaches they caused
+type telemetryRecord struct {
+	Recorded int      `json:"recorded"`
+	Breaches []Breach `json:"breaches"`
+}
+
+// parseReadings reads the readings in groups of device, time, metric, value
+func parseReadings(args []string) ([]Reading, error) {
+	if len(args) == 0 || len(args)%readingFieldsNumber != 0 {
+		return nil, errors.New(fmt.Sprintf("readings must come in groups of %d arguments: device, time, metric, "+
+			"value", readingFieldsNumber))
+	}
+
+	readings := make([]Reading, 0, len(args)/readingFieldsNumber)
+	for i := 0; i < len(args); i += readingFieldsNumber {
+		device, metric := args[i], args[i+2]
+		for _, part := range []string{device, metric} {
+			if len(part) == 0 || !isValidKeyPart(part) {
+				return nil, errors.New(fmt.Sprintf("reading #%d: device and metric must be non-empty UTF-8 "+
+					"strings without U+0000 and U+10FFFF", i/readingFieldsNumber+1))
+			}
+		}
+
+		time, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || time < 0 {
+			return nil, errors.New(fmt.Sprintf("reading #%d: time is invalid: %s (must be Unix seconds)",
+				i/readingFieldsNumber+1, args[i+1]))
+		}
+
+		value, err := parseBound(args[i+3])
+		if err != nil || value == nil {
+			return nil, errors.New(fmt.Sprintf("reading #%d: value is invalid: %s (must be a number)",
+				i/readingFieldsNumber+1, args[i+3]))
+		}
+
+		readings = append(readings, Reading{Device: device, Time: time, Metric: metric, Value: *value})
+	}
+
+	return readings, nil
+}
+
+// parseBound reads a finite number, nil for the empty string
+func parseBound(s string) (*float64, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, errors.New(fmt.Sprintf("number is invalid: %s", s))
+	}
+
+	return &value, nil
+}
+
+// breaches tells if the value is out of the bounds of the rule
+func (rule ThresholdRule) breaches(value float64) bool {
+	return rule.Min != nil && value < *rule.Min || rule.Max != nil && value > *rule.Max
+}
+
+func thresholdRulesKey(stub shim.ChaincodeStubInterface, gtin string) (string, error) {
+	return stub.CreateCompositeKey(thresholdRulesIndex, []string{gtin})
+}
+
+// loadThresholdRules reads the rules of the GTIN, nil if none were set
+func loadThresholdRules(stub shim.ChaincodeStubInterface, gtin string) (*ThresholdRules, error) {
+	key, err := thresholdRulesKey(stub, gtin)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var rules ThresholdRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+func (rules *ThresholdRules) store(stub shim.ChaincodeStubInterface) error {
+	key, err := thresholdRulesKey(stub, rules.GTIN)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// set adds the rule for its metric or replaces the one there is
+func (rules *ThresholdRules) set(rule ThresholdRule) {
+	for i := range rules.Rules {
+		if rules.Rules[i].Metric == rule.Metric {
+			rules.Rules[i] = rule
+			return
+		}
+	}
+
+	rules.Rules = append(rules.Rules, rule)
+}
+
+// readingKey orders the readings of a product or a shipment by time, then device and metric
+func readingKey(stub shim.ChaincodeStubInterface, target []string, reading Reading) (string, error) {
+	return stub.CreateCompositeKey(readingIndex, append(append([]string{}, target...),
+		fmt.Sprintf("%020d", reading.Time), reading.Device, reading.Metric))
+}
+
+// appendReading stores the reading unless there is one of the device and metric at the same time: a batch sent
+// again adds nothing. It tells if the reading is new.
+func appendReading(stub shim.ChaincodeStubInterface, target []string, reading Reading) (bool, error) {
+	key, err := readingKey(stub, target, reading)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data != nil {
+		return false, err
+	}
+
+	value, err := json.Marshal(reading)
+	if err != nil {
+		return false, err
+	}
+
+	return true, stub.PutState(key, value)
+}
+
+// listReadings returns the readings of the product or the shipment in time order
+func listReadings(stub shim.ChaincodeStubInterface, target []string) ([]Reading, error) {
+	it, err := stub.GetStateByPartialCompositeKey(readingIndex, target)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	readings := []Reading{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var reading Reading
+		if err := json.Unmarshal(response.Value, &reading); err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+
+	return readings, nil
+}
+
+func breachKey(stub shim.ChaincodeStubInterface, productName, id string) (string, error) {
+	return stub.CreateCompositeKey(breachIndex, []string{productName, id})
+}
+
+func (breach *Breach) store(stub shim.ChaincodeStubInterface) error {
+	key, err := breachKey(stub, breach.Product, breach.ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(breach)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// listBreaches returns the breaches of the product in the order of the readings
+func listBreaches(stub shim.ChaincodeStubInterface, productName string) ([]Breach, error) {
+	it, err := stub.GetStateByPartialCompositeKey(breachIndex, []string{productName})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	breaches := []Breach{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var breach Breach
+		if err := json.Unmarshal(response.Value, &breach); err != nil {
+			return nil, err
+		}
+		breaches = append(breaches, breach)
+	}
+
+	// the index goes by id
+	sort.SliceStable(breaches, func(i, j int) bool {
+		return breaches[i].Reading.Time < breaches[j].Reading.Time
+	})
+
+	return breaches, nil
+}
+
+// checkReadings records a breach for every reading out of the bounds of a rule of the product and puts the
+// product on quality hold with the first one. Breach ids are the transaction id and a sequence number.
+func (product *Product) checkReadings(stub shim.ChaincodeStubInterface, shipment string, readings []Reading,
+	sequence *int) ([]Breach, error) {
+	breaches := []Breach{}
+	if len(product.Value.GTIN) == 0 {
+		return breaches, nil
+	}
+
+	rules, err := loadThresholdRules(stub, product.Value.GTIN)
+	if err != nil || rules == nil {
+		return breaches, err
+	}
+
+	for _, reading := range readings {
+		for _, rule := range rules.Rules {
+			if rule.Metric != reading.Metric || !rule.breaches(reading.Value) {
+				continue
+			}
+
+			*sequence++
+			breach := Breach{ID: fmt.Sprintf("%s.%d", stub.GetTxID(), *sequence), Product: product.Key.Name,
+				Shipment: shipment, Reading: reading, Rule: rule}
+			if err := breach.store(stub); err != nil {
+				return nil, err
+			}
+			breaches = append(breaches, breach)
+		}
+	}
+
+	if len(breaches) > 0 && len(product.Value.Hold) == 0 {
+		product.Value.Hold = breaches[0].ID
+		if err := product.UpdateOrInsertIn(stub); err != nil {
+			return nil, err
+		}
+	}
+
+	return breaches, nil
+}
@@ -0,0 +1,226 @@
+package product
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"testutil"
+)
+
+func TestParseReadings(t *testing.T) {
+	readings, err := parseReadings([]string{"s1", "1060", "temperature", "9.5", "s1", "1000", "humidity", "-1e1"})
+	expected := []Reading{{Device: "s1", Time: 1060, Metric: "temperature", Value: 9.5},
+		{Device: "s1", Time: 1000, Metric: "humidity", Value: -10}}
+	if err != nil || !reflect.DeepEqual(readings, expected) {
+		t.Errorf("expected %+v, got %+v (%v)", expected, readings, err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"s1", "1000", "temperature"},
+		{"", "1000", "temperature", "1"},
+		{"s1", "-1", "temperature", "1"},
+		{"s1", "1000", "temperature", ""},
+		{"s1", "1000", "temperature", "NaN"},
+		{"s1", "1000", "temperature", "Inf"},
+	} {
+		if _, err := parseReadings(args); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
+// telemetryStub registers p1 and p2 of gtinA and p3 of gtinB by a, ships p1 and p2 in s1 held by carrier c, and
+// has auditor q bound temperature of gtinA to 2..8 and humidity to at most 60
+func telemetryStub(t *testing.T) (*testutil.MockStub, map[string]*testutil.Identity) {
+	stub := getInitializedStub(t)
+	if response := stub.MockInit("init", testutil.Args("init", "auditors", "q")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+	identities := testutil.NewIdentities(t, "a", "b", "c", "q")
+
+	invokeStepsAs(t, stub, identities, [][]string{
+		{"a", "initProduct", "p1", "desc", "1", "a", "100"},
+		{"a", "initProduct", "p2", "desc", "1", "a", "100"},
+		{"a", "initProduct", "p3", "desc", "1", "a", "100"},
+		{"a", "assignLot", "p1", gtinA, "L1"},
+		{"a", "assignLot", "p2", gtinA, "L1"},
+		{"a", "assignLot", "p3", gtinB, "L1"},
+		{"q", "setThresholdRule", gtinA, "temperature", "2", "8"},
+		{"q", "setThresholdRule", gtinA, "humidity", "", "60"},
+		{"a", "createShipment", "s1", "DEHAM", "USNYC", "c", "p1", "p2"},
+		{"a", "handOverShipment", "s1", "c", "DEHAM"},
+		{"c", "acceptShipment", "s1"},
+	})
+
+	return stub, identities
+}
+
+func TestThresholdRules(t *testing.T) {
+	stub, identities := telemetryStub(t)
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"b", []string{"setThresholdRule", gtinA, "temperature", "0", "10"}, 403},
+		{"a", []string{"setThresholdRule", gtinB, "temperature", "0", "10"}, 403},
+		{"q", []string{"setThresholdRule", "123", "temperature", "0", "10"}, 500},
+		{"q", []string{"setThresholdRule", gtinA, "temperature", "", ""}, 500},
+		{"q", []string{"setThresholdRule", gtinA, "temperature", "10", "0"}, 500},
+		{"q", []string{"setThresholdRule", gtinA, "temperature", "x", "0"}, 500},
+		{"q", []string{"setThresholdRule", gtinA, "temperature", "0", "10"}, 200},
+		{"b", []string{"readThresholdRules", gtinB}, 404},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "rule", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	response := stub.MockInvoke("read", testutil.Args("readThresholdRules", gtinA))
+	var rules ThresholdRules
+	if err := json.Unmarshal(response.Payload, &rules); err != nil {
+		t.Fatalf("cannot unmarshal rules: %s", err.Error())
+	}
+	if rules.Org != "q" || len(rules.Rules) != 2 || rules.Rules[0].Metric != "temperature" ||
+		*rules.Rules[0].Min != 0 || *rules.Rules[0].Max != 10 || rules.Rules[1].Min != nil {
+		t.Errorf("expected the temperature rule replaced and the humidity one kept, got %+v", rules)
+	}
+}
+
+func TestRecordReadings(t *testing.T) {
+	stub, identities := telemetryStub(t)
+
+	for _, test := range []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"a", []string{"recordReadings", "shipment", "s1", "s1", "1000", "temperature", "5"}, 403},
+		{"c", []string{"recordReadings", "pallet", "s1", "s1", "1000", "temperature", "5"}, 500},
+		{"c", []string{"recordReadings", "shipment", "s9", "s1", "1000", "temperature", "5"}, 404},
+		{"c", []string{"recordReadings", "product", "p9", "s1", "1000", "temperature", "5"}, 404},
+		{"c", []string{"recordReadings", "product", "p3", "s1", "1000", "temperature", "5"}, 403},
+		{"a", []string{"recordReadings", "product", "p3", "s1", "1000", "temperature", "50"}, 200},
+	} {
+		response := stub.MockInvokeAs(identities[test.org], "record", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("%v: expected status %d, got %d: %s", test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	record := func(txId string, readings ...string) telemetryRecord {
+		response := stub.MockInvokeAs(identities["c"], txId, testutil.Args(append([]string{"recordReadings",
+			"shipment", "s1"}, readings...)...))
+		if response.Status >= 400 {
+			t.Fatalf("recordReadings failed: %s", response.Message)
+		}
+
+		var record telemetryRecord
+		if err := json.Unmarshal(response.Payload, &record); err != nil {
+			t.Fatalf("cannot unmarshal record: %s", err.Error())
+		}
+		return record
+	}
+
+	// in bounds, or out of the bounds of no rule
+	if result := record("r1", "s1", "1060", "temperature", "5", "s1", "1000", "pressure", "900"); result.Recorded != 2 ||
+		len(result.Breaches) != 0 {
+		t.Errorf("expected 2 readings and no breaches, got %+v", result)
+	}
+	if event := stub.LastEvent(); event != nil && event.EventName == breachEventName {
+		t.Errorf("expected no breach event, got %+v", event)
+	}
+
+	// the same batch again adds nothing; a breach of the shipment is a breach of each of its products
+	result := record("r2", "s1", "1060", "temperature", "5", "s1", "1120", "temperature", "8.5",
+		"s2", "1120", "humidity", "70")
+	if result.Recorded != 2 || len(result.Breaches) != 4 {
+		t.Fatalf("expected 2 new readings and 4 breaches, got %+v", result)
+	}
+	event := stub.LastEvent()
+	var emitted []Breach
+	if event == nil || event.EventName != breachEventName || json.Unmarshal(event.Payload, &emitted) != nil ||
+		!reflect.DeepEqual(emitted, result.Breaches) {
+		t.Errorf("expected the breaches as the event, got %+v", event)
+	}
+
+	response := stub.MockInvoke("list", testutil.Args("listReadings", "shipment", "s1"))
+	var readings []Reading
+	if err := json.Unmarshal(response.Payload, &readings); err != nil {
+		t.Fatalf("cannot unmarshal readings: %s", err.Error())
+	}
+	times := []int64{}
+	for _, reading := range readings {
+		times = append(times, reading.Time)
+		if reading.Org != "c" {
+			t.Errorf("expected readings recorded by c, got %+v", reading)
+		}
+	}
+	if !reflect.DeepEqual(times, []int64{1000, 1060, 1120, 1120}) {
+		t.Errorf("expected the readings in time order, got %v", times)
+	}
+
+	for _, name := range []string{"p1", "p2"} {
+		product := Product{Key: ProductKey{Name: name}}
+		if err := product.LoadFrom(stub); err != nil || product.Value.Hold != "r2.1" && product.Value.Hold != "r2.3" {
+			t.Errorf("expected %s on hold with the first of its breaches, got %+v (%v)", name, product.Value, err)
+		}
+	}
+
+	// p3 has no rules, so the reading of 50 degrees broke none
+	response = stub.MockInvoke("list", testutil.Args("listBreaches", "p3"))
+	if string(response.Payload) != "[]" {
+		t.Errorf("expected no breaches of p3, got %s", response.Payload)
+	}
+}
+
+func TestClearHold(t *testing.T) {
+	stub, identities := telemetryStub(t)
+
+	if response := stub.MockInvokeAs(identities["c"], "r1", testutil.Args("recordReadings", "product", "p1",
+		"s1", "1000", "temperature", "1", "s1", "1060", "temperature", "9")); response.Status >= 400 {
+		t.Fatalf("recordReadings failed: %s", response.Message)
+	}
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"c", []string{"clearHold", "p1"}, 403},
+		{"a", []string{"clearHold", "p1"}, 403},
+		{"a", []string{"updateOwner", "p1", "a", "b", "200"}, 409},
+		{"q", []string{"clearHold", "p2"}, 409},
+		{"q", []string{"clearHold", "p1"}, 200},
+		{"q", []string{"clearHold", "p1"}, 409},
+		{"a", []string{"updateOwner", "p1", "a", "b", "200"}, 200},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "clear", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	response := stub.MockInvoke("list", testutil.Args("listBreaches", "p1"))
+	var breaches []Breach
+	if err := json.Unmarshal(response.Payload, &breaches); err != nil || len(breaches) != 2 {
+		t.Fatalf("expected 2 breaches, got %s", response.Payload)
+	}
+	for _, breach := range breaches {
+		if breach.Cleared == nil || breach.Cleared.Org != "q" || breach.Cleared.TxId != "clear" {
+			t.Errorf("expected the breach cleared by q, got %+v", breach)
+		}
+	}
+	if breaches[0].Reading.Time != 1000 || breaches[0].Rule.Metric != "temperature" {
+		t.Errorf("expected the breaches in the order of the readings, got %+v", breaches)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"testutil"
+)
+
+// transfersPerProduct is how many counterparties asked for each seeded product and
+// modificationsPerTransfer is how many times each transfer changed (Initiated, edited, Accepted...).
+const (
+	transfersPerProduct      = 2
+	modificationsPerTransfer = 3
+)
+
+// seededTransferStub returns a stub with n transfers generated from a fixed seed, so runs are comparable.
+// When withHistory is set every transfer also gets modificationsPerTransfer history entries.
+func seededTransferStub(b *testing.B, n int, withHistory bool) *testutil.MockStub {
+	stub := testutil.NewMockStub("relationship", new(OwnershipChaincode))
+	random := rand.New(rand.NewSource(int64(n)))
+	senders := []string{"b", "c"}
+	statuses := []string{statusInitiated, statusAccepted, statusRejected, statusCancelled}
+
+	keys := make([]string, n)
+	values := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		details := TransferDetails{
+			Key: TransferDetailsKey{
+				ProductKey:      fmt.Sprintf("product%08d", i/transfersPerProduct),
+				RequestSender:   senders[i%transfersPerProduct],
+				RequestReceiver: "a",
+			},
+		}
+
+		key, err := details.ToCompositeKey(stub)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+
+		var modifications [][]byte
+		for m := 0; m < modificationsPerTransfer; m++ {
+			details.Value = TransferDetailsValue{
+				Status:    statuses[random.Intn(len(statuses))],
+				Message:   fmt.Sprintf("message %d", random.Int()),
+				Timestamp: random.Int63n(1 << 31),
+			}
+			value, err := details.ToLedgerValue()
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+			modifications = append(modifications, value)
+		}
+
+		if withHistory {
+			stub.SeedHistory(key, modifications)
+		}
+		keys[i], values[i] = key, modifications[len(modifications)-1]
+	}
+	stub.SeedState(keys, values)
+
+	return stub
+}
+
+func benchmarkInvoke(b *testing.B, stub *testutil.MockStub, records int, args ...string) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if response := stub.MockInvoke("bench", testutil.Args(args...)); response.Status >= 400 {
+			b.Fatalf("%s failed: %s", args[0], response.Message)
+		}
+	}
+	b.ReportMetric(float64(records), "records")
+}
+
+func BenchmarkQuery(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkInvoke(b, seededTransferStub(b, n, false), n, "query")
+		})
+	}
+}
+
+// BenchmarkHistory measures history of a single product in a ledger of n transfers: the partial key scan
+// plus one history iterator per transfer of the product.
+func BenchmarkHistory(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			productKey := fmt.Sprintf("product%08d", n/transfersPerProduct/2)
+			benchmarkInvoke(b, seededTransferStub(b, n, true), transfersPerProduct*modificationsPerTransfer,
+				"history", productKey)
+		})
+	}
+}
+
+// BenchmarkExportTransfers reads the last page of the export with history, which skips every transfer before it.
+func BenchmarkExportTransfers(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			// the bookmark is the transfer before the last 1000, none if there are no more
+			bookmark := ""
+			if last := n - 1001; last >= 0 {
+				bookmark = fmt.Sprintf(`["product%08d","%s","a"]`, last/transfersPerProduct,
+					[]string{"b", "c"}[last%transfersPerProduct])
+			}
+			benchmarkInvoke(b, seededTransferStub(b, n, true), n, "exportTransfers", "1000", bookmark, "true")
+		})
+	}
+}
+
+// BenchmarkGetTransferStatistics reads the history of every transfer to measure acceptance times.
+func BenchmarkGetTransferStatistics(b *testing.B) {
+	for _, n := range testutil.LedgerSizes(b) {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub := seededTransferStub(b, n, true)
+			identity, err := testutil.NewIdentity("a")
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+			if err := stub.SetCreator(identity); err != nil {
+				b.Fatal(err.Error())
+			}
+
+			benchmarkInvoke(b, stub, n*modificationsPerTransfer, "getTransferStatistics")
+		})
+	}
+}
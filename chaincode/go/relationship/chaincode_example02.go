@@ -2,6 +2,7 @@
 package main
 
 import (
+	"crypto/hmac"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"encoding/pem"
@@ -10,7 +11,8 @@ import (
 	"fmt"
 	"encoding/json"
 	"errors"
-	"time"
+	"document"
+	"params"
 )
 
 var logger = shim.NewLogger("OwnershipChaincode")
@@ -18,6 +20,10 @@ var logger = shim.NewLogger("OwnershipChaincode")
 const (
 	commonChannelName = "common"
 	commonChaincodeName = "reference"
+	// productStateRecalled is the state of a recalled product in the reference chaincode
+	productStateRecalled = 5
+	// productStateConsumed is the state of a product consumed by a transformation in the reference chaincode
+	productStateConsumed = 6
 )
 
 // OwnershipChaincode example simple Chaincode implementation
@@ -47,10 +53,32 @@ func (t *OwnershipChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Respons
 		return t.query(stub, args)
 	} else if function == "history" {
 		return t.history(stub, args)
+	} else if function == "exportTransfers" {
+		return t.exportTransfers(stub, args)
+	} else if function == "getTransferStatistics" {
+		return t.getTransferStatistics(stub, args)
+	} else if function == "getTerms" {
+		return t.getTerms(stub, args)
+	} else if function == "verifyTerms" {
+		return t.verifyTerms(stub, args)
+	} else if function == "attachDocument" {
+		return t.attachDocument(stub, args)
+	} else if function == "listDocuments" {
+		return t.listDocuments(stub, args)
+	} else if function == "verifyDocument" {
+		return t.verifyDocument(stub, args)
+	} else if function == "createPurchaseOrder" {
+		return t.createPurchaseOrder(stub, args)
+	} else if function == "confirmPurchaseOrder" {
+		return t.confirmPurchaseOrder(stub, args)
+	} else if function == "readPurchaseOrder" {
+		return t.readPurchaseOrder(stub, args)
 	}
 
 	message := "invalid invoke function name. " +
-		"Expected one of {sendRequest, transferAccepted, transferRejected, query, history}, but got " + function
+		"Expected one of {sendRequest, editRequest, transferAccepted, transferRejected, query, history, " +
+		"exportTransfers, getTransferStatistics, getTerms, verifyTerms, attachDocument, listDocuments, " +
+		"verifyDocument, createPurchaseOrder, confirmPurchaseOrder, readPurchaseOrder}, but got " + function
 
 	logger.Error(message)
 	return pb.Response{Status:400, Message: message}
@@ -104,15 +132,100 @@ func (t *OwnershipChaincode) sendRequest(stub shim.ChaincodeStubInterface, args
 		}
 	}
 
-	if err := checkProductExistenceAndOwnership(stub, request.Key.ProductKey, request.Key.RequestReceiver); err != nil {
+	product, err := checkProductExistenceAndOwnership(stub, request.Key.ProductKey, request.Key.RequestReceiver)
+	if err != nil {
 		message := err.Error()
 		logger.Error(message)
 		return shim.Error(message)
 	}
 
+	//      0             1               2            3          4             5                  6                 7
+	// productKey, requestSender, requestReceiver, message, [purchaseOrder, orderLine, [requiredCertification, [quantity]]]
+	// or keyed after the message: [po=purchaseOrder] [line=orderLine] [certification=type] [quantity=quantity]
+	options, err := parseRequestOptions(args[expectedArgumentsNumber:])
+	if err != nil {
+		logger.Error(err.Error())
+		return shim.Error(err.Error())
+	}
+
+	request.Value.Quantity = 0
+	if len(options.Quantity) > 0 {
+		quantity, err := parseQuantity(options.Quantity)
+		if err != nil {
+			logger.Error(err.Error())
+			return shim.Error(err.Error())
+		}
+
+		if err := product.checkQuantity(request.Key.ProductKey, quantity); err != nil {
+			logger.Error(err.Error())
+			return pb.Response{Status: 409, Message: err.Error()}
+		}
+		request.Value.Quantity = quantity
+	}
+
+	request.Value.RequiredCertification = ""
+	if len(options.RequiredCertification) > 0 {
+		request.Value.RequiredCertification = strings.ToLower(options.RequiredCertification)
+		if !product.isCertified(request.Value.RequiredCertification) {
+			message := fmt.Sprintf("product %s has no valid %s certification", request.Key.ProductKey,
+				request.Value.RequiredCertification)
+			logger.Error(message)
+			return pb.Response{Status: 409, Message: message}
+		}
+	}
+
+	request.Value.PurchaseOrder, request.Value.OrderLine = "", 0
+	if len(options.PurchaseOrder) > 0 {
+		if len(options.OrderLine) == 0 {
+			message := "purchase order must be given with an order line"
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		number, err := parseOrderLineNumber(options.OrderLine)
+		if err != nil {
+			logger.Error(err.Error())
+			return shim.Error(err.Error())
+		}
+
+		order, err := loadPurchaseOrder(stub, options.PurchaseOrder)
+		if err != nil {
+			message := fmt.Sprintf("unable to read purchase order: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		if order == nil {
+			message := fmt.Sprintf("purchase order %s not found", options.PurchaseOrder)
+			logger.Error(message)
+			return pb.Response{Status: 404, Message: message}
+		}
+
+		if err := order.checkLink(&request, number); err != nil {
+			logger.Error(err.Error())
+			return pb.Response{Status: 409, Message: err.Error()}
+		}
+
+		request.Value.PurchaseOrder, request.Value.OrderLine = order.ID, number
+	}
+
 	request.Value.Status = statusInitiated
 	request.Value.Message = args[basicArgumentsNumber]
-	request.Value.Timestamp = time.Now().UTC().Unix()
+	if err := request.applyTerms(stub, false); err != nil {
+		message := fmt.Sprintf("cannot store commercial terms: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := request.checkMessage(); err != nil {
+		logger.Error(err.Error())
+		return shim.Error(err.Error())
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	request.Value.Timestamp = timestamp
 
 	if err := request.UpdateOrInsertIn(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
@@ -178,7 +291,22 @@ func (t *OwnershipChaincode) editRequest(stub shim.ChaincodeStubInterface, args
 	}
 
 	request.Value.Message = args[basicArgumentsNumber]
-	request.Value.Timestamp = time.Now().UTC().Unix()
+	if err := request.applyTerms(stub, true); err != nil {
+		message := fmt.Sprintf("cannot store commercial terms: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := request.checkMessage(); err != nil {
+		logger.Error(err.Error())
+		return shim.Error(err.Error())
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	request.Value.Timestamp = timestamp
 
 	if err := request.UpdateOrInsertIn(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
@@ -239,15 +367,71 @@ func (t *OwnershipChaincode) transferAccepted(stub shim.ChaincodeStubInterface,
 		return shim.Error(message)
 	}
 
-	if err := checkProductExistenceAndOwnership(stub, details.Key.ProductKey, details.Key.RequestReceiver); err != nil {
+	product, err := checkProductExistenceAndOwnership(stub, details.Key.ProductKey, details.Key.RequestReceiver)
+	if err != nil {
 		// TODO: think about request deletion
 		message := err.Error()
 		logger.Error(message)
 		return shim.Error(message)
 	}
 
+	if len(product.Value.Hold) > 0 {
+		message := fmt.Sprintf("product %s is on quality hold", details.Key.ProductKey)
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the certification may have expired or been revoked since the request
+	if len(details.Value.RequiredCertification) > 0 && !product.isCertified(details.Value.RequiredCertification) {
+		message := fmt.Sprintf("product %s has no valid %s certification", details.Key.ProductKey,
+			details.Value.RequiredCertification)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	// the product must still have the quantity when the transfer is accepted. Less than all of it splits the
+	// product, and the receiver gets the part under another name.
+	details.Value.Part = ""
+	if details.Value.Quantity > 0 {
+		if err := product.checkQuantity(details.Key.ProductKey, details.Value.Quantity); err != nil {
+			logger.Error(err.Error())
+			return pb.Response{Status: 409, Message: err.Error()}
+		}
+		if details.Value.Quantity < product.Value.Quantity {
+			details.Value.Part = details.Key.ProductKey + partSuffix
+		}
+	}
+
 	details.Value.Status = statusAccepted
-	details.Value.Timestamp = time.Now().UTC().Unix()
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	details.Value.Timestamp = timestamp
+
+	if len(details.Value.PurchaseOrder) > 0 {
+		order, err := loadPurchaseOrder(stub, details.Value.PurchaseOrder)
+		if err != nil || order == nil {
+			message := fmt.Sprintf("unable to read purchase order %s", details.Value.PurchaseOrder)
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		transfer := OrderTransfer{ProductKey: details.Key.ProductKey, TxId: stub.GetTxID(), Timestamp: timestamp,
+			Part: details.Value.Part}
+		if err := order.fulfil(details.Value.OrderLine, details.Value.Quantity, transfer); err != nil {
+			logger.Error(err.Error())
+			return pb.Response{Status: 409, Message: err.Error()}
+		}
+
+		if err := order.store(stub); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+	}
 
 	if err := details.UpdateOrInsertIn(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
@@ -323,7 +507,13 @@ func (t *OwnershipChaincode) transferRejected(stub shim.ChaincodeStubInterface,
 		logger.Debug("Rejected by sender")
 		details.Value.Status = statusCancelled
 	}
-	details.Value.Timestamp = time.Now().UTC().Unix()
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	details.Value.Timestamp = timestamp
 
 	if err := details.UpdateOrInsertIn(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
@@ -494,34 +684,554 @@ func (t *OwnershipChaincode) history(stub shim.ChaincodeStubInterface, args []st
 	return shim.Success(result)
 }
 
-func checkProductExistenceAndOwnership(stub shim.ChaincodeStubInterface, productKey, requiredOwner string) error {
-	type simplifiedProduct struct {
-		Value struct {
-			Owner string `json:"owner"`
-		} `json:"value"`
+func (t *OwnershipChaincode) exportTransfers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.exportTransfers is running")
+	logger.Debug("OwnershipChaincode.exportTransfers")
+
+	export, err := params.ParseExport(args)
+	if err != nil {
+		message := fmt.Sprintf("cannot read export request from arguments: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	page, err := exportRequest{export}.Execute(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to read transfers: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.exportTransfers exited without errors")
+	logger.Debug("Success: OwnershipChaincode.exportTransfers")
+	return shim.Success(result)
+}
+
+func (t *OwnershipChaincode) getTransferStatistics(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.getTransferStatistics is running")
+	logger.Debug("OwnershipChaincode.getTransferStatistics")
+
+	window, err := params.ParseTimeWindow(args)
+	if err != nil {
+		message := fmt.Sprintf("cannot read time window from arguments: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	statistics, err := collectTransferStatistics(stub, window, GetCreatorOrganization(stub))
+	if err != nil {
+		message := fmt.Sprintf("unable to collect transfer statistics: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(statistics)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	logger.Debug("Result: " + string(result))
+
+	logger.Info("OwnershipChaincode.getTransferStatistics exited without errors")
+	logger.Debug("Success: OwnershipChaincode.getTransferStatistics")
+	return shim.Success(result)
+}
+
+// commonProduct is the part of a product of the reference chaincode that transfers depend on. Certifications are
+// the ones valid when the product is read.
+type commonProduct struct {
+	Value struct {
+		Owner    string `json:"owner"`
+		State    int    `json:"state"`
+		Hold     string `json:"hold"`
+		Quantity int64  `json:"quantity"`
+		Unit     string `json:"unit"`
+	} `json:"value"`
+	Certifications []struct {
+		Type string `json:"type"`
+	} `json:"certifications"`
+}
+
+// checkQuantity tells why the quantity of a partial transfer cannot be taken from the product, nil if it can
+func (p commonProduct) checkQuantity(productKey string, quantity int64) error {
+	if p.Value.Quantity == 0 {
+		return errors.New(fmt.Sprintf("product %s has no quantity", productKey))
+	}
+	if quantity > p.Value.Quantity {
+		return errors.New(fmt.Sprintf("product %s has only %d %s", productKey, p.Value.Quantity, p.Value.Unit))
+	}
+
+	return nil
+}
+
+// isCertified tells if the product has a valid certification of the type
+func (p commonProduct) isCertified(certificationType string) bool {
+	for _, certification := range p.Certifications {
+		if certification.Type == certificationType {
+			return true
+		}
 	}
 
+	return false
+}
+
+func checkProductExistenceAndOwnership(stub shim.ChaincodeStubInterface, productKey, requiredOwner string) (
+	commonProduct, error) {
+	var p commonProduct
+
 	const queryFunctionName = "readProduct"
 
 	response := stub.InvokeChaincode(commonChaincodeName,
 		[][]byte{[]byte(queryFunctionName), []byte(productKey)}, commonChannelName)
 	if response.Status >= 400 {
-		return errors.New(
+		return p, errors.New(
 			fmt.Sprintf("unable to read product %s from common channel: %s", productKey, response.Message))
 	} else {
-		var p simplifiedProduct
 		if err := json.Unmarshal(response.Payload, &p); err != nil {
-			return errors.New(
+			return p, errors.New(
 				fmt.Sprintf("unable to unmarshal response on product %s from common channel", productKey))
 		}
 
 		if p.Value.Owner != requiredOwner {
-			return errors.New(
+			return p, errors.New(
 				fmt.Sprintf("product %s doesn't belong to organization %s", productKey, requiredOwner))
 		}
+
+		if p.Value.State == productStateRecalled {
+			return p, errors.New(fmt.Sprintf("product %s is recalled", productKey))
+		}
+
+		if p.Value.State == productStateConsumed {
+			return p, errors.New(fmt.Sprintf("product %s is consumed", productKey))
+		}
 	}
 
-	return nil
+	return p, nil
+}
+
+// getTerms reads the commercial terms of a transfer request from the private data collection. Only the sender and
+// the receiver of the request may read them.
+func (t *OwnershipChaincode) getTerms(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.getTerms is running")
+	logger.Debug("OwnershipChaincode.getTerms")
+
+	details, response := t.loadTransferDetails(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	creator := GetCreatorOrganization(stub)
+	if creator != details.Key.RequestSender && creator != details.Key.RequestReceiver {
+		message := fmt.Sprintf("no privileges to read commercial terms from the side of organization %s", creator)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	terms, err := details.loadTerms(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to read commercial terms: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	if terms == nil {
+		message := "transfer request has no commercial terms"
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := json.Marshal(termsRecord{TermsHash: details.Value.TermsHash, Terms: terms.Terms, Salt: terms.Salt})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.getTerms exited without errors")
+	return shim.Success(result)
+}
+
+// verifyTerms checks the terms document and the salt passed in the transient map against the hash of the terms of
+// a transfer request. It reads public state only, so any member of the channel can verify what a party shows them.
+func (t *OwnershipChaincode) verifyTerms(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.verifyTerms is running")
+	logger.Debug("OwnershipChaincode.verifyTerms")
+
+	details, response := t.loadTransferDetails(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	terms, err := readTransientTerms(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot read commercial terms from transient map: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	if terms == nil {
+		message := fmt.Sprintf("transient map must contain %s and %s to verify", transientTerms, transientSalt)
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	verification := termsVerification{TermsHash: details.Value.TermsHash}
+	verification.Matches = len(details.Value.TermsHash) > 0 &&
+		hmac.Equal([]byte(terms.Hash()), []byte(details.Value.TermsHash))
+
+	result, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.verifyTerms exited without errors")
+	return shim.Success(result)
+}
+
+// attachDocument anchors the hash of a document of the transfer, e.g. an invoice, and records it in the history of
+// the request. Only the sender and the receiver of the request may attach documents.
+func (t *OwnershipChaincode) attachDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.attachDocument is running")
+	logger.Debug("OwnershipChaincode.attachDocument")
+
+	//      0             1               2            3     4       5       6
+	// productKey, requestSender, requestReceiver, hash, type, issuer, [uri]
+	const expectedArgumentsNumber = keyFieldsNumber + document.ArgumentsNumber
+	if len(args) < expectedArgumentsNumber {
+		message := fmt.Sprintf("insufficient number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args))
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	details, response := t.loadTransferDetails(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	attachment, err := document.ParseDocument(args[keyFieldsNumber:])
+	if err != nil {
+		message := fmt.Sprintf("cannot read document from arguments: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	attachment.Org = GetCreatorOrganization(stub)
+	if attachment.Org != details.Key.RequestSender && attachment.Org != details.Key.RequestReceiver {
+		message := fmt.Sprintf("no privileges to attach documents from the side of organization %s",
+			attachment.Org)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if err := document.Attach(stub, details.documentTarget(), &attachment); err == document.ErrAlreadyAttached {
+		logger.Error(err.Error())
+		return pb.Response{Status: 409, Message: err.Error()}
+	} else if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	details.Value.LastDocument = attachment.Hash
+	if err := details.UpdateOrInsertIn(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(attachment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.attachDocument exited without errors")
+	return shim.Success(result)
+}
+
+// listDocuments reads the documents attached to a transfer request in the order they were attached
+func (t *OwnershipChaincode) listDocuments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.listDocuments is running")
+	logger.Debug("OwnershipChaincode.listDocuments")
+
+	details, response := t.loadTransferDetails(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	documents, err := document.List(stub, details.documentTarget())
+	if err != nil {
+		message := fmt.Sprintf("unable to read documents: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(documents)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.listDocuments exited without errors")
+	return shim.Success(result)
+}
+
+// verifyDocument tells if a file with the hash is attached to a transfer request
+func (t *OwnershipChaincode) verifyDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.verifyDocument is running")
+	logger.Debug("OwnershipChaincode.verifyDocument")
+
+	//      0             1               2            3
+	// productKey, requestSender, requestReceiver, hash
+	const expectedArgumentsNumber = keyFieldsNumber + 1
+	if len(args) < expectedArgumentsNumber {
+		message := fmt.Sprintf("insufficient number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args))
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	details, response := t.loadTransferDetails(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	hash, err := document.ParseHash(args[keyFieldsNumber])
+	if err != nil {
+		logger.Error(err.Error())
+		return shim.Error(err.Error())
+	}
+
+	verification, err := document.Verify(stub, details.documentTarget(), hash)
+	if err != nil {
+		message := fmt.Sprintf("unable to read documents: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.verifyDocument exited without errors")
+	return shim.Success(result)
+}
+
+// createPurchaseOrder issues a purchase order of the caller to the seller. The seller confirms it before transfer
+// requests may reference its lines.
+func (t *OwnershipChaincode) createPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.createPurchaseOrder is running")
+	logger.Debug("OwnershipChaincode.createPurchaseOrder")
+
+	//     0            1        2        3      4        5      6
+	// purchaseOrder, seller, currency, [item, quantity, price, due]...
+	const expectedArgumentsNumber = 3 + orderLineFieldsNumber
+	if len(args) < expectedArgumentsNumber {
+		message := fmt.Sprintf("insufficient number of arguments: expected %d, got %d",
+			expectedArgumentsNumber, len(args))
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	order := PurchaseOrder{ID: args[0], Buyer: GetCreatorOrganization(stub), Seller: args[1], Currency: args[2],
+		Status: orderIssued, TxId: stub.GetTxID()}
+	if len(order.ID) == 0 || !isValidKeyPart(order.ID) {
+		message := "purchase order id must be a non-empty UTF-8 string without U+0000 and U+10FFFF"
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	if len(order.Seller) == 0 || order.Seller == order.Buyer {
+		message := fmt.Sprintf("seller must be another organization than %s", order.Buyer)
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	if !currencyFormat.MatchString(order.Currency) {
+		message := fmt.Sprintf("currency is invalid: %s (must be up to 32 letters, digits, '.', '-' or '_')",
+			order.Currency)
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	lines, err := parseOrderLines(args[3:])
+	if err != nil {
+		logger.Error(err.Error())
+		return shim.Error(err.Error())
+	}
+	order.Lines = lines
+
+	if existing, err := loadPurchaseOrder(stub, order.ID); err != nil {
+		message := fmt.Sprintf("unable to read purchase order: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	} else if existing != nil {
+		message := fmt.Sprintf("purchase order %s already exists", order.ID)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	order.Timestamp = timestamp
+
+	if err := order.store(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.createPurchaseOrder exited without errors")
+	return shim.Success(result)
+}
+
+// confirmPurchaseOrder is the seller's agreement to the lines and prices of an issued purchase order
+func (t *OwnershipChaincode) confirmPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.confirmPurchaseOrder is running")
+	logger.Debug("OwnershipChaincode.confirmPurchaseOrder")
+
+	order, response := t.loadPurchaseOrder(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	if creator := GetCreatorOrganization(stub); creator != order.Seller {
+		message := fmt.Sprintf(
+			"no privileges to confirm purchase order to organization %s (caller is from organization %s)",
+			order.Seller, creator)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if order.Status != orderIssued {
+		message := fmt.Sprintf("purchase order %s is already confirmed", order.ID)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	order.Status = orderConfirmed
+	order.Confirmed = timestamp
+
+	if err := order.store(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.confirmPurchaseOrder exited without errors")
+	return shim.Success(result)
+}
+
+// readPurchaseOrder reads a purchase order with the fulfilment of its lines
+func (t *OwnershipChaincode) readPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("OwnershipChaincode.readPurchaseOrder is running")
+	logger.Debug("OwnershipChaincode.readPurchaseOrder")
+
+	order, response := t.loadPurchaseOrder(stub, args)
+	if response != nil {
+		return *response
+	}
+
+	result, err := json.Marshal(order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	logger.Info("OwnershipChaincode.readPurchaseOrder exited without errors")
+	return shim.Success(result)
+}
+
+// loadPurchaseOrder reads an existing purchase order by the id in the arguments
+func (t *OwnershipChaincode) loadPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) (PurchaseOrder,
+	*pb.Response) {
+	//     0
+	// purchaseOrder
+	if len(args) < 1 {
+		message := "insufficient number of arguments: expected 1, got 0"
+		logger.Error(message)
+		response := shim.Error(message)
+		return PurchaseOrder{}, &response
+	}
+
+	order, err := loadPurchaseOrder(stub, args[0])
+	if err != nil {
+		message := fmt.Sprintf("unable to read purchase order: %s", err.Error())
+		logger.Error(message)
+		response := shim.Error(message)
+		return PurchaseOrder{}, &response
+	}
+	if order == nil {
+		message := fmt.Sprintf("purchase order %s not found", args[0])
+		logger.Error(message)
+		return PurchaseOrder{}, &pb.Response{Status: 404, Message: message}
+	}
+
+	return *order, nil
+}
+
+// loadTransferDetails reads an existing transfer request by the key parts in the arguments
+func (t *OwnershipChaincode) loadTransferDetails(stub shim.ChaincodeStubInterface, args []string) (TransferDetails,
+	*pb.Response) {
+	//      0             1               2
+	// productKey, requestSender, requestReceiver
+	if len(args) < basicArgumentsNumber {
+		message := fmt.Sprintf("insufficient number of arguments: expected %d, got %d",
+			basicArgumentsNumber, len(args))
+		logger.Error(message)
+		response := shim.Error(message)
+		return TransferDetails{}, &response
+	}
+
+	details := TransferDetails{}
+	if err := details.FillFromArguments(args); err != nil {
+		message := fmt.Sprintf("cannot read transfer details from arguments: %s", err.Error())
+		logger.Error(message)
+		response := shim.Error(message)
+		return TransferDetails{}, &response
+	}
+
+	if !details.ExistsIn(stub) {
+		message := "ownership transfer wasn't initiated"
+		logger.Error(message)
+		return TransferDetails{}, &pb.Response{Status: 404, Message: message}
+	}
+
+	if err := details.LoadFrom(stub); err != nil {
+		message := fmt.Sprintf("cannot load existing transfer details: %s", err.Error())
+		logger.Error(message)
+		response := shim.Error(message)
+		return TransferDetails{}, &response
+	}
+
+	return details, nil
+}
+
+// getTxTimestamp returns the transaction time in seconds: unlike the local clock it is the same on every endorser.
+func getTxTimestamp(stub shim.ChaincodeStubInterface) (int64, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, err
+	}
+
+	return timestamp.Seconds, nil
 }
 
 func getOrganization(certificate []byte) string {
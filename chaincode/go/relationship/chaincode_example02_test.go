@@ -5,6 +5,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"fmt"
+	"testutil"
 )
 
 func toByteArray(args []string) [][]byte {
@@ -16,18 +17,43 @@ func toByteArray(args []string) [][]byte {
 	return res
 }
 
-func getInitializedStub(t *testing.T) *shim.MockStub{
+// referenceStub answers readProduct for any product as if it belonged to owner
+type referenceStub struct {
+	owner string
+}
+
+func (r *referenceStub) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (r *referenceStub) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success([]byte(fmt.Sprintf(`{"value":{"owner":"%s"}}`, r.owner)))
+}
+
+func getInitializedStub(t *testing.T, org string) *testutil.MockStub {
 	cc := new(OwnershipChaincode)
-	stub := shim.NewMockStub("ownership", cc)
+	stub := testutil.NewMockStub("ownership", cc)
+
+	identity, err := testutil.NewIdentity(org)
+	if err != nil {
+		t.Fatalf("cannot generate creator identity: %s", err.Error())
+	}
+	if err := stub.SetCreator(identity); err != nil {
+		t.Fatalf("cannot set creator: %s", err.Error())
+	}
+
+	stub.MockPeerChaincode(commonChaincodeName + "/" + commonChannelName,
+		shim.NewMockStub(commonChaincodeName, &referenceStub{owner: "b"}))
+
 	stub.MockInit("1", toByteArray([]string{"init"}))
 	return stub
 }
 
 func TestQuery(t *testing.T) {
 	var response pb.Response
-	stub := getInitializedStub(t)
+	stub := getInitializedStub(t, "a")
 
-	args := []string{"sendRequest", "product", "sender", "receiver", "message"}
+	args := []string{"sendRequest", "product", "a", "b", "message"}
 	response = stub.MockInvoke("ownership", toByteArray(args))
 	if response.Status < 400 {
 		response = stub.MockInvoke("ownership", toByteArray([]string{"query"}))
@@ -41,4 +67,4 @@ func TestQuery(t *testing.T) {
 		fmt.Print("Send request error")
 		t.FailNow()
 	}
-}
\ No newline at end of file
+}
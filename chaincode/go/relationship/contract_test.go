@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"document"
+	"testutil"
+)
+
+// contractTerms are the commercial terms the request for p1 is edited with
+var contractTerms = map[string][]byte{
+	transientTerms: []byte(`{"price":110,"currency":"USD","incoterms":"FCA"}`),
+	transientSalt:  []byte("0123456789abcdef"),
+}
+
+// contractDocument is the SHA-256 of the invoice attached to the request for p1 in the contract tests
+const contractDocument = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+// contractStub returns a stub with a fixed clock and a ledger built by the same transactions every run.
+func contractStub(t *testing.T) *testutil.MockStub {
+	stub := getInitializedStub(t, "a")
+	stub.Now = testutil.FixedClock(time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC), time.Minute)
+
+	identities := testutil.NewIdentities(t, "a", "b")
+
+	steps := []struct {
+		org       string
+		args      []string
+		transient map[string][]byte
+	}{
+		{"a", []string{"sendRequest", "p1", "a", "b", "delivery to the north gate"}, nil},
+		{"a", []string{"editRequest", "p1", "a", "b", ""}, contractTerms},
+		{"b", []string{"transferAccepted", "p1", "a", "b"}, nil},
+		{"a", []string{"sendRequest", "p2", "a", "b", "delivery to the south gate"}, nil},
+		{"a", []string{"transferRejected", "p2", "a", "b"}, nil},
+	}
+	for i, step := range steps {
+		stub.Transient = step.transient
+		response := stub.MockInvokeAs(identities[step.org], fmt.Sprintf("tx%d", i), testutil.Args(step.args...))
+		if response.Status >= 400 {
+			t.Fatalf("%s failed: %s", step.args[0], response.Message)
+		}
+	}
+
+	return stub
+}
+
+func TestResponseContracts(t *testing.T) {
+	stub := contractStub(t)
+
+	response := stub.MockInvoke("document", testutil.Args("attachDocument", "p1", "a", "b", contractDocument,
+		"invoice", "a", "https://docs.a.example.com/invoices/1001.pdf"))
+	if response.Status >= 400 {
+		t.Fatalf("attachDocument failed: %s", response.Message)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		v         interface{}
+		transient map[string][]byte
+	}{
+		{"query", []string{"query"}, []TransferDetails{}, nil},
+		{"history", []string{"history", "p1"}, []TransferDetails{}, nil},
+		{"exportTransfers", []string{"exportTransfers", "1", "", "true"}, transferExportPage{}, nil},
+		{"getTransferStatistics", []string{"getTransferStatistics"}, transferStatistics{}, nil},
+		{"getTerms", []string{"getTerms", "p1", "a", "b"}, termsRecord{}, nil},
+		{"verifyTerms", []string{"verifyTerms", "p1", "a", "b"}, termsVerification{}, contractTerms},
+		{"listDocuments", []string{"listDocuments", "p1", "a", "b"}, []document.Document{}, nil},
+		{"verifyDocument", []string{"verifyDocument", "p1", "a", "b", contractDocument}, document.Verification{},
+			nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub.Transient = test.transient
+			response := stub.MockInvoke("contract", testutil.Args(test.args...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			testutil.AssertContract(t, test.name, response.Payload, test.v)
+		})
+	}
+
+	// the order is fulfilled by a transfer of its own, so it goes after the contracts of transfers
+	t.Run("readPurchaseOrder", func(t *testing.T) {
+		identities := testutil.NewIdentities(t, "a", "b")
+
+		for _, step := range []struct {
+			org  string
+			args []string
+		}{
+			{"a", []string{"createPurchaseOrder", "po1", "b", "USD", "pallet", "1", "110.00", "1520899200",
+				"crate", "2", "12.50", "1521504000"}},
+			{"b", []string{"confirmPurchaseOrder", "po1"}},
+			{"a", []string{"sendRequest", "p3", "a", "b", "pallet", "po1", "1"}},
+			{"b", []string{"transferAccepted", "p3", "a", "b"}},
+		} {
+			response := stub.MockInvokeAs(identities[step.org], "order", testutil.Args(step.args...))
+			if response.Status >= 400 {
+				t.Fatalf("%s failed: %s", step.args[0], response.Message)
+			}
+		}
+
+		response := stub.MockInvoke("contract", testutil.Args("readPurchaseOrder", "po1"))
+		if response.Status >= 400 {
+			t.Fatalf("unexpected error: %s", response.Message)
+		}
+
+		testutil.AssertContract(t, "readPurchaseOrder", response.Payload, PurchaseOrder{})
+	})
+}
+
+func TestEventContracts(t *testing.T) {
+	stub := contractStub(t)
+
+	if len(stub.Events) != 1 {
+		t.Fatalf("expected a single event, got %d", len(stub.Events))
+	}
+
+	event := stub.Events[0]
+	if event.EventName != transferIndex+"."+statusAccepted {
+		t.Errorf("expected event %s.%s, got %s", transferIndex, statusAccepted, event.EventName)
+	}
+
+	testutil.AssertContract(t, "event."+event.EventName, event.Payload, transferEvent{})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"document"
+	"testutil"
+)
+
+func TestTransferDocuments(t *testing.T) {
+	stub := contractStub(t)
+	const hash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	identities := testutil.NewIdentities(t, "a", "b", "c")
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"c", []string{"attachDocument", "p1", "a", "b", hash, "inspection", "lab"}, 403},
+		{"b", []string{"attachDocument", "p3", "a", "b", hash, "inspection", "lab"}, 404},
+		{"b", []string{"attachDocument", "p1", "a", "b", hash, "inspection"}, 500},
+		{"b", []string{"attachDocument", "p1", "a", "b", hash, "inspection", "lab"}, 200},
+		{"a", []string{"attachDocument", "p1", "a", "b", hash, "inspection", "lab"}, 409},
+		{"c", []string{"verifyDocument", "p1", "a", "b", "abc"}, 500},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "document", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	response := stub.MockInvoke("verify", testutil.Args("verifyDocument", "p2", "a", "b", hash))
+	var verification document.Verification
+	if err := json.Unmarshal(response.Payload, &verification); err != nil {
+		t.Fatalf("cannot unmarshal verification: %s", err.Error())
+	}
+	if verification.Matches {
+		t.Errorf("a document of p1 should not match p2, got %+v", verification)
+	}
+
+	// the attachment is a new version of the accepted request
+	response = stub.MockInvoke("history", testutil.Args("history", "p1"))
+	var history []TransferDetails
+	if err := json.Unmarshal(response.Payload, &history); err != nil {
+		t.Fatalf("cannot unmarshal history: %s", err.Error())
+	}
+	last := history[len(history)-1]
+	if last.Value.LastDocument != hash || last.Value.Status != statusAccepted {
+		t.Errorf("expected the attachment in the history of the request, got %+v", last)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"params"
+)
+
+// TransferModification is a version of transfer details from the history database, Timestamp is the time of
+// the transaction in seconds
+type TransferModification struct {
+	Key       TransferDetailsKey   `json:"key"`
+	Value     TransferDetailsValue `json:"value"`
+	TxId      string               `json:"txId"`
+	Timestamp int64                `json:"timestamp"`
+	IsDelete  bool                 `json:"isDelete"`
+}
+
+// transferExport is transfer details with, on request, all of their versions oldest first
+type transferExport struct {
+	Key     TransferDetailsKey     `json:"key"`
+	Value   TransferDetailsValue   `json:"value"`
+	History []TransferModification `json:"history,omitempty"`
+}
+
+// transferExportPage is a response of exportTransfers. Bookmark is empty on the last page.
+type transferExportPage struct {
+	Records  []transferExport `json:"records"`
+	Bookmark string           `json:"bookmark"`
+}
+
+// exportRequest pages through all transfers in the order of their keys
+type exportRequest struct {
+	params.Export
+}
+
+// Execute reads the page of transfers. The bookmark is the JSON array of the key parts of the last transfer of the
+// previous page. Fabric 1.1 can't start a range of composite keys in the middle, so the page still scans the keys
+// before the bookmark.
+func (request exportRequest) Execute(stub shim.ChaincodeStubInterface) (transferExportPage, error) {
+	after, err := request.bookmarkKey(stub)
+	if err != nil {
+		return transferExportPage{}, err
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(transferIndex, []string{})
+	if err != nil {
+		return transferExportPage{}, err
+	}
+	defer it.Close()
+
+	page := transferExportPage{Records: []transferExport{}}
+	var lastKeyParts []string
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return transferExportPage{}, err
+		}
+
+		if response.Key <= after {
+			continue
+		}
+		if len(page.Records) == request.PageSize {
+			bookmark, err := json.Marshal(lastKeyParts)
+			if err != nil {
+				return transferExportPage{}, err
+			}
+			page.Bookmark = string(bookmark)
+			break
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return transferExportPage{}, err
+		}
+		lastKeyParts = compositeKeyParts
+
+		details := TransferDetails{}
+		if err := details.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return transferExportPage{}, err
+		}
+		if err := details.FillFromLedgerValue(response.Value); err != nil {
+			return transferExportPage{}, err
+		}
+
+		record := transferExport{Key: details.Key, Value: details.Value}
+		if request.WithHistory {
+			if record.History, err = loadTransferHistory(stub, details.Key, response.Key); err != nil {
+				return transferExportPage{}, err
+			}
+		}
+
+		page.Records = append(page.Records, record)
+	}
+
+	return page, nil
+}
+
+// bookmarkKey is the composite key of the last transfer of the previous page, empty for the first page
+func (request exportRequest) bookmarkKey(stub shim.ChaincodeStubInterface) (string, error) {
+	if len(request.Bookmark) == 0 {
+		return "", nil
+	}
+
+	var keyParts []string
+	if err := json.Unmarshal([]byte(request.Bookmark), &keyParts); err != nil || len(keyParts) != keyFieldsNumber {
+		return "", errors.New(fmt.Sprintf("bookmark is invalid: %s", request.Bookmark))
+	}
+
+	return stub.CreateCompositeKey(transferIndex, keyParts)
+}
+
+func loadTransferHistory(stub shim.ChaincodeStubInterface, key TransferDetailsKey,
+	compositeKey string) ([]TransferModification, error) {
+	historyIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return nil, err
+	}
+	defer historyIterator.Close()
+
+	history := []TransferModification{}
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := TransferModification{Key: key, TxId: modification.TxId, IsDelete: modification.IsDelete}
+		if modification.Timestamp != nil {
+			entry.Timestamp = modification.Timestamp.Seconds
+		}
+		if !modification.IsDelete {
+			details := TransferDetails{}
+			if err := details.FillFromLedgerValue(modification.Value); err != nil {
+				return nil, err
+			}
+			entry.Value = details.Value
+		}
+
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
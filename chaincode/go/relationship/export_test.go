@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"testutil"
+)
+
+func TestExportTransfers(t *testing.T) {
+	stub := contractStub(t)
+
+	keys, statuses, histories, bookmark := []string{}, []string{}, []int{}, ""
+	for {
+		response := stub.MockInvoke("export", testutil.Args("exportTransfers", "1", bookmark, "true"))
+		if response.Status >= 400 {
+			t.Fatalf("exportTransfers failed: %s", response.Message)
+		}
+
+		var page transferExportPage
+		if err := json.Unmarshal(response.Payload, &page); err != nil {
+			t.Fatalf("cannot unmarshal export page: %s", err.Error())
+		}
+
+		for _, record := range page.Records {
+			keys = append(keys, fmt.Sprintf("%s/%s/%s", record.Key.ProductKey, record.Key.RequestSender,
+				record.Key.RequestReceiver))
+			statuses = append(statuses, record.Value.Status)
+			histories = append(histories, len(record.History))
+
+			if last := record.History[len(record.History)-1]; last.Value != record.Value || last.Key != record.Key {
+				t.Errorf("the last version of %+v differs from the state", record.Key)
+			}
+		}
+
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+
+	if expected := []string{"p1/a/b", "p2/a/b"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected transfers %v, got %v", expected, keys)
+	}
+	if expected := []string{statusAccepted, statusCancelled}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected statuses %v, got %v", expected, statuses)
+	}
+	if expected := []int{3, 2}; !reflect.DeepEqual(histories, expected) {
+		t.Errorf("expected history lengths %v, got %v", expected, histories)
+	}
+}
+
+func TestExportTransfersErrors(t *testing.T) {
+	stub := contractStub(t)
+
+	for _, args := range [][]string{{"0"}, {"1001"}, {"10", "p1"}, {"10", `["p1","a"]`}, {"10", "", "maybe"}} {
+		response := stub.MockInvoke("export", testutil.Args(append([]string{"exportTransfers"}, args...)...))
+		if response.Status < 400 {
+			t.Errorf("expected an error for arguments %v", args)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"reference/product"
+	"testutil"
+)
+
+const bilateralChannelName = "a-b"
+
+type flow struct {
+	t          *testing.T
+	network    *testutil.Network
+	identities map[string]*testutil.Identity
+}
+
+// newFlow deploys reference to the common channel and relationship to the a-b channel.
+func newFlow(t *testing.T) *flow {
+	f := &flow{t: t, network: testutil.NewNetwork(), identities: testutil.NewIdentities(t, "a", "b", "c")}
+
+	if _, err := f.network.Deploy(commonChannelName, commonChaincodeName, new(product.ProductChaincode)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := f.network.Deploy(bilateralChannelName, "relationship", new(OwnershipChaincode)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return f
+}
+
+func (f *flow) invoke(channel, chaincode, org string, args ...string) (string, bool) {
+	response := f.network.Invoke(channel, chaincode, f.identities[org], args...)
+	return response.Message, response.Status < 400
+}
+
+func (f *flow) mustInvoke(channel, chaincode, org string, args ...string) {
+	if message, ok := f.invoke(channel, chaincode, org, args...); !ok {
+		f.t.Fatalf("%s on %s failed: %s", args[0], channel, message)
+	}
+}
+
+func (f *flow) mustFail(channel, chaincode, org, expected string, args ...string) {
+	message, ok := f.invoke(channel, chaincode, org, args...)
+	if ok || !strings.Contains(message, expected) {
+		f.t.Fatalf("%s on %s: expected error containing %q, got %q", args[0], channel, expected, message)
+	}
+}
+
+// relayAcceptedTransfer does what middleware/orchestrator.js does on TransferDetails.Accepted.
+func (f *flow) relayAcceptedTransfer(org string, timestamp int) {
+	event := f.network.Stub(bilateralChannelName, "relationship").LastEvent()
+	if event == nil || event.EventName != transferIndex+"."+statusAccepted {
+		f.t.Fatalf("expected %s.%s event, got %+v", transferIndex, statusAccepted, event)
+	}
+
+	var details struct {
+		ProductKey string `json:"product_key"`
+		OldOwner   string `json:"old_owner"`
+		NewOwner   string `json:"new_owner"`
+		Quantity   int64  `json:"quantity"`
+	}
+	if err := json.Unmarshal(event.Payload, &details); err != nil {
+		f.t.Fatalf("cannot unmarshal event payload: %s", err.Error())
+	}
+
+	args := []string{"updateOwner", details.ProductKey, details.OldOwner, details.NewOwner, strconv.Itoa(timestamp)}
+	if details.Quantity > 0 {
+		args = append(args, strconv.FormatInt(details.Quantity, 10))
+	}
+	f.mustInvoke(commonChannelName, commonChaincodeName, org, args...)
+}
+
+func (f *flow) assertProduct(name, owner string) {
+	p := product.Product{Key: product.ProductKey{Name: name}}
+	if err := p.LoadFrom(f.network.Stub(commonChannelName, commonChaincodeName)); err != nil {
+		f.t.Fatalf("cannot load product %s: %s", name, err.Error())
+	}
+	if p.Value.Owner != owner {
+		f.t.Errorf("product %s: expected owner %s, got %s", name, owner, p.Value.Owner)
+	}
+}
+
+func (f *flow) assertTransfer(productKey, sender, receiver, status string) {
+	details := TransferDetails{Key: TransferDetailsKey{productKey, sender, receiver}}
+	stub := f.network.Stub(bilateralChannelName, "relationship")
+	if !details.ExistsIn(stub) {
+		f.t.Fatalf("transfer of %s from %s to %s doesn't exist", productKey, receiver, sender)
+	}
+	if err := details.LoadFrom(stub); err != nil {
+		f.t.Fatalf("cannot load transfer details: %s", err.Error())
+	}
+	if details.Value.Status != status {
+		f.t.Errorf("transfer of %s: expected status %s, got %s", productKey, status, details.Value.Status)
+	}
+}
+
+func TestOwnershipTransferFlow(t *testing.T) {
+	f := newFlow(t)
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "desc", "1", "a", "100")
+	f.assertProduct("p1", "a")
+
+	// b asks a to transfer the product
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100")
+	f.assertTransfer("p1", "b", "a", statusInitiated)
+	f.assertProduct("p1", "a")
+
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusAccepted)
+
+	f.relayAcceptedTransfer("a", 200)
+	f.assertProduct("p1", "b")
+
+	// the product now belongs to b, a cannot be asked for it any more
+	f.mustFail(bilateralChannelName, "relationship", "b", "doesn't belong to organization a",
+		"sendRequest", "p1", "b", "a", "again")
+
+	// but a can ask b to give it back
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "sendRequest", "p1", "a", "b", "return")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "transferAccepted", "p1", "a", "b")
+	f.relayAcceptedTransfer("b", 300)
+	f.assertProduct("p1", "a")
+}
+
+func TestOwnershipTransferFlowFailures(t *testing.T) {
+	f := newFlow(t)
+
+	f.mustFail(bilateralChannelName, "relationship", "b", "unable to read product p1 from common channel",
+		"sendRequest", "p1", "b", "a", "no such product")
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "desc", "1", "a", "100")
+
+	f.mustFail(bilateralChannelName, "relationship", "c", "no privileges to send request",
+		"sendRequest", "p1", "b", "a", "on behalf of b")
+	f.mustFail(bilateralChannelName, "relationship", "b", "doesn't belong to organization c",
+		"sendRequest", "p1", "b", "c", "wrong owner")
+
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100")
+	f.mustFail(bilateralChannelName, "relationship", "b", "already initiated",
+		"sendRequest", "p1", "b", "a", "twice")
+	f.mustFail(bilateralChannelName, "relationship", "b", "no privileges to accept transfer",
+		"transferAccepted", "p1", "b", "a")
+
+	// the owner changes on the common channel before a accepts
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "updateOwner", "p1", "a", "c", "150")
+	f.mustFail(bilateralChannelName, "relationship", "a", "doesn't belong to organization a",
+		"transferAccepted", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusInitiated)
+
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferRejected", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusRejected)
+	f.assertProduct("p1", "c")
+}
+
+func TestRecallFlow(t *testing.T) {
+	f := newFlow(t)
+
+	for _, name := range []string{"p1", "p2"} {
+		f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", name, "desc", "1", "a", "100")
+		f.mustInvoke(commonChannelName, commonChaincodeName, "a", "assignLot", name, "4006381333931", "L1")
+	}
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100")
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initRecall", "r1", "contamination",
+		"4006381333931", "L1")
+
+	stub := f.network.Stub(commonChannelName, commonChaincodeName)
+	if event := stub.LastEvent(); event == nil || event.EventName != "Recall.Initiated" ||
+		!strings.Contains(string(event.Payload), `{"name":"p2","owner":"a"}`) {
+		t.Errorf("expected a recall event with the products and their owners, got %+v", event)
+	}
+
+	p := product.Product{Key: product.ProductKey{Name: "p1"}}
+	if err := p.LoadFrom(stub); err != nil || p.Value.State != productStateRecalled {
+		t.Errorf("expected p1 in state %d, got %+v (%v)", productStateRecalled, p.Value, err)
+	}
+
+	// a pending request cannot be accepted and a new one cannot be sent
+	f.mustFail(bilateralChannelName, "relationship", "a", "product p1 is recalled",
+		"transferAccepted", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusInitiated)
+	f.mustFail(bilateralChannelName, "relationship", "b", "product p2 is recalled",
+		"sendRequest", "p2", "b", "a", "price 100")
+}
+
+func TestQualityHoldFlow(t *testing.T) {
+	f := newFlow(t)
+
+	// c is the quality auditor of the consortium, it sets the rules and clears the holds
+	reference := f.network.Stub(commonChannelName, commonChaincodeName)
+	if response := reference.MockInit("upgrade", testutil.Args("init", "auditors", "c")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "vaccine", "1", "a", "100")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "assignLot", "p1", "4006381333931", "L1")
+	f.mustFail(commonChannelName, commonChaincodeName, "a", "organization a is not an auditor",
+		"setThresholdRule", "4006381333931", "temperature", "2", "8")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "c", "setThresholdRule", "4006381333931", "temperature",
+		"2", "8")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100")
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "recordReadings", "product", "p1",
+		"sensor1", "1000", "temperature", "5.5", "sensor1", "1060", "temperature", "9.5")
+	if event := f.network.Stub(commonChannelName, commonChaincodeName).LastEvent(); event == nil ||
+		event.EventName != "Breach.Detected" {
+		t.Errorf("expected a breach event, got %+v", event)
+	}
+
+	f.mustFail(bilateralChannelName, "relationship", "a", "product p1 is on quality hold",
+		"transferAccepted", "p1", "b", "a")
+	f.mustFail(commonChannelName, commonChaincodeName, "a", "no privileges to clear the hold", "clearHold", "p1")
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "c", "clearHold", "p1")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusAccepted)
+}
+
+func TestRequiredCertificationFlow(t *testing.T) {
+	f := newFlow(t)
+
+	// c is the certification body of the consortium
+	reference := f.network.Stub(commonChannelName, commonChaincodeName)
+	if response := reference.MockInit("upgrade", testutil.Args("init", "auditors", "c")); response.Status >= 400 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "coffee", "1", "a", "100")
+	f.mustFail(bilateralChannelName, "relationship", "b", "product p1 has no valid organic certification",
+		"sendRequest", "p1", "b", "a", "price 100", "", "", "organic")
+	f.mustFail(commonChannelName, commonChaincodeName, "a", "organization a is not an auditor",
+		"issueCertification", "p1", "c1", "organic", "farm 7", "", "4102444800")
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "c", "issueCertification", "p1", "c1", "Organic",
+		"farm 7", "", "4102444800")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100", "", "",
+		"Organic")
+
+	// the revocation comes before the acceptance
+	f.mustInvoke(commonChannelName, commonChaincodeName, "c", "revokeCertification", "p1", "c1", "audit failed")
+	f.mustFail(bilateralChannelName, "relationship", "a", "product p1 has no valid organic certification",
+		"transferAccepted", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusInitiated)
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "c", "issueCertification", "p1", "c2", "organic",
+		"farm 7", "", "4102444800")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1", "b", "a")
+	f.assertTransfer("p1", "b", "a", statusAccepted)
+}
+
+func TestTransformationFlow(t *testing.T) {
+	f := newFlow(t)
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "green coffee", "1", "a", "100")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100")
+
+	// the input is consumed while the request for it is pending; the output can be sold instead
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "transform", "t1", "1", "p1", "f1", "roasted coffee")
+	f.mustFail(bilateralChannelName, "relationship", "a", "product p1 is consumed",
+		"transferAccepted", "p1", "b", "a")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "f1", "b", "a", "price 120")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "f1", "b", "a")
+	f.assertTransfer("f1", "b", "a", statusAccepted)
+}
+
+func TestPartialTransferFlow(t *testing.T) {
+	f := newFlow(t)
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "wheat", "1", "a", "100")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p2", "tractor", "1", "a", "100")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "setQuantity", "p1", "1000", "kg")
+
+	f.mustFail(bilateralChannelName, "relationship", "b", "product p1 has only 1000 kg",
+		"sendRequest", "p1", "b", "a", "1500 kg", "", "", "", "1500")
+	f.mustFail(bilateralChannelName, "relationship", "b", "product p2 has no quantity",
+		"sendRequest", "p2", "b", "a", "half a tractor", "", "", "", "1")
+
+	// the old owner keeps the rest of the lot as p1/1, the part moves to b as p1/2
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "300 kg", "", "", "",
+		"300")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1", "b", "a")
+
+	// only the owner of the lot splits it
+	f.mustFail(commonChannelName, commonChaincodeName, "b", "no privileges to transfer a part of product p1",
+		"updateOwner", "p1", "a", "b", "200", "300")
+	f.relayAcceptedTransfer("a", 200)
+
+	f.assertProduct("p1/1", "a")
+	f.assertProduct("p1/2", "b")
+	f.mustFail(bilateralChannelName, "relationship", "b", "product p1 is consumed",
+		"sendRequest", "p1", "b", "a", "the rest")
+
+	// the transfer names the lot b got, and the custody trail of that lot starts with the transfer
+	details := TransferDetails{Key: TransferDetailsKey{"p1", "b", "a"}}
+	if err := details.LoadFrom(f.network.Stub(bilateralChannelName, "relationship")); err != nil {
+		t.Fatalf("cannot load transfer details: %s", err.Error())
+	}
+	if details.Value.Part != "p1/2" {
+		t.Errorf("expected the transfer to record part p1/2, got %q", details.Value.Part)
+	}
+
+	response := f.network.Invoke(commonChannelName, commonChaincodeName, f.identities["b"], "getCustodyTrail", "p1/2")
+	if response.Status >= 400 {
+		t.Fatalf("getCustodyTrail failed: %s", response.Message)
+	}
+	var trail struct {
+		Entries []struct {
+			Owner    string `json:"owner"`
+			Transfer *struct {
+				Details TransferDetails `json:"details"`
+			} `json:"transfer"`
+		} `json:"entries"`
+		Verified bool `json:"verified"`
+	}
+	if err := json.Unmarshal(response.Payload, &trail); err != nil {
+		t.Fatalf("cannot unmarshal custody trail: %s", err.Error())
+	}
+	if len(trail.Entries) != 1 || trail.Entries[0].Owner != "b" || trail.Entries[0].Transfer == nil ||
+		trail.Entries[0].Transfer.Details.Key.ProductKey != "p1" || !trail.Verified {
+		t.Errorf("expected p1/2 to start with the transfer of p1 to b, got %s", string(response.Payload))
+	}
+}
+
+func TestPartialTransferOrderFlow(t *testing.T) {
+	f := newFlow(t)
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "wheat", "1", "a", "100")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "setQuantity", "p1", "1000", "kg")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p2", "wheat", "1", "a", "100")
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "setQuantity", "p2", "1000", "kg")
+
+	// b orders 500 kg of wheat from a, the line counts kg of the lots
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "createPurchaseOrder", "po1", "a", "USD", "wheat", "500",
+		"0.25", "1520000000")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "confirmPurchaseOrder", "po1")
+
+	f.mustFail(bilateralChannelName, "relationship", "b", "would overfill",
+		"sendRequest", "p1", "b", "a", "600 kg", "po1", "1", "", "600")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "300 kg", "po1", "1", "",
+		"300")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p2", "b", "a", "300 kg", "po1", "1", "",
+		"300")
+
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1", "b", "a")
+	f.relayAcceptedTransfer("a", 200)
+	f.assertProduct("p1/2", "b")
+
+	// both requests fit the empty line, but only one of them fits once the other is accepted
+	f.mustFail(bilateralChannelName, "relationship", "a", "would overfill", "transferAccepted", "p2", "b", "a")
+	f.assertTransfer("p2", "b", "a", statusInitiated)
+
+	// the optional arguments may be keyed instead of positional
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1/1", "b", "a", "200 kg", "quantity=200",
+		"po=po1", "line=1")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1/1", "b", "a")
+	f.relayAcceptedTransfer("a", 300)
+
+	order := readPurchaseOrder(t, f.network.Stub(bilateralChannelName, "relationship"), "po1")
+	if line := order.Lines[0]; order.Status != orderFulfilled || line.Fulfilled != 500 || len(line.Transfers) != 2 ||
+		line.Transfers[0].Quantity != 300 || line.Transfers[1].ProductKey != "p1/1" || line.Transfers[1].Quantity != 200 {
+		t.Errorf("expected the line fulfilled by 300 kg of p1 and 200 kg of p1/1, got %+v", order)
+	}
+	if line := order.Lines[0]; len(line.Transfers) == 2 &&
+		(line.Transfers[0].Part != "p1/2" || line.Transfers[1].Part != "p1/1/2") {
+		t.Errorf("expected the line to name the lots b got, p1/2 and p1/1/2, got %+v", line.Transfers)
+	}
+	f.assertProduct("p1/1/2", "b")
+}
+
+func TestCrossChannelInvocationIsReadOnly(t *testing.T) {
+	f := newFlow(t)
+
+	stub := f.network.Stub(bilateralChannelName, "relationship")
+	stub.MockTransactionStart("cross")
+	response := stub.InvokeChaincode(commonChaincodeName,
+		testutil.Args("initProduct", "p1", "desc", "1", "a", "100"), commonChannelName)
+	stub.MockTransactionEnd("cross")
+
+	if response.Status >= 400 {
+		t.Fatalf("unexpected error: %s", response.Message)
+	}
+	if _, ok := f.invoke(commonChannelName, commonChaincodeName, "a", "readProduct", "p1"); ok {
+		t.Errorf("product written by a cross-channel invocation must not be committed")
+	}
+}
+
+func TestCustodyTrailFlow(t *testing.T) {
+	f := newFlow(t)
+
+	// both channels share a clock, so the transfers and the owner updates are ordered the way they happen
+	clock := testutil.FixedClock(time.Unix(1000, 0), time.Second)
+	f.network.Stub(commonChannelName, commonChaincodeName).Now = clock
+	f.network.Stub(bilateralChannelName, "relationship").Now = clock
+
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "initProduct", "p1", "desc", "1", "a", "100")
+
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "sendRequest", "p1", "b", "a", "price 100")
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "transferAccepted", "p1", "b", "a")
+	f.relayAcceptedTransfer("a", 200)
+
+	f.mustInvoke(bilateralChannelName, "relationship", "a", "sendRequest", "p1", "a", "b", "return")
+	f.mustInvoke(bilateralChannelName, "relationship", "b", "transferAccepted", "p1", "a", "b")
+	f.relayAcceptedTransfer("b", 300)
+
+	// the owner changes on the common channel without a transfer, there is no a-c channel to look it up on
+	f.mustInvoke(commonChannelName, commonChaincodeName, "a", "updateOwner", "p1", "a", "c", "400")
+
+	response := f.network.Invoke(commonChannelName, commonChaincodeName, f.identities["a"], "getCustodyTrail", "p1")
+	if response.Status >= 400 {
+		t.Fatalf("getCustodyTrail failed: %s", response.Message)
+	}
+
+	var trail struct {
+		Entries []struct {
+			Owner    string `json:"owner"`
+			Transfer *struct {
+				Channel string          `json:"channel"`
+				Details TransferDetails `json:"details"`
+			} `json:"transfer"`
+		} `json:"entries"`
+		Gaps []struct {
+			Entry int    `json:"entry"`
+			Kind  string `json:"kind"`
+		} `json:"gaps"`
+		Verified bool `json:"verified"`
+	}
+	if err := json.Unmarshal(response.Payload, &trail); err != nil {
+		t.Fatalf("cannot unmarshal custody trail: %s", err.Error())
+	}
+
+	owners := []string{}
+	for _, entry := range trail.Entries {
+		owners = append(owners, entry.Owner)
+	}
+	if strings.Join(owners, ",") != "a,b,a,c" {
+		t.Fatalf("expected owners a,b,a,c, got %v", owners)
+	}
+
+	for i, sender := range []string{"b", "a"} {
+		transfer := trail.Entries[i+1].Transfer
+		if transfer == nil || transfer.Channel != bilateralChannelName ||
+			transfer.Details.Key.RequestSender != sender || transfer.Details.Value.Status != statusAccepted {
+			t.Errorf("entry %d: expected the transfer accepted on %s, got %+v", i+1, bilateralChannelName, transfer)
+		}
+	}
+
+	if trail.Verified || len(trail.Gaps) != 1 || trail.Gaps[0].Entry != 3 || trail.Gaps[0].Kind != "unverifiable" {
+		t.Errorf("expected the change of owner to c to be unverifiable, got %+v", trail.Gaps)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// purchaseOrderIndex keys a purchase order by its id
+const purchaseOrderIndex = "PurchaseOrder"
+
+// orderLineFieldsNumber is the number of arguments of a line: item, quantity, price, due
+const orderLineFieldsNumber = 4
+
+const (
+	orderIssued             = "Issued"
+	orderConfirmed          = "Confirmed"
+	orderPartiallyFulfilled = "PartiallyFulfilled"
+	orderFulfilled          = "Fulfilled"
+
+	lineOpen = "Open"
+)
+
+var (
+	// priceFormat is a non-negative decimal: prices stay exact strings, the chaincode doesn't compute with them
+	priceFormat = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+	// currencyFormat is the format of asset names of the settlement token
+	currencyFormat = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+)
+
+// OrderTransfer is an accepted transfer request that delivered units of a line, Quantity of a lot or else one
+// product. Part is the lot the buyer got when the transfer split the product.
+type OrderTransfer struct {
+	ProductKey string `json:"productKey"`
+	TxId       string `json:"txId"`
+	Timestamp  int64  `json:"timestamp"`
+	Quantity   int64  `json:"quantity,omitempty"`
+	Part       string `json:"part,omitempty"`
+}
+
+// OrderLine is an item ordered in Quantity units at the unit Price, due at Due in Unix seconds. Fulfilled counts
+// the units delivered by the accepted transfers linked to the line: the quantity of a partial transfer of a lot, in
+// the unit of the lot, or one product otherwise.
+type OrderLine struct {
+	Number    int             `json:"number"`
+	Item      string          `json:"item"`
+	Quantity  int64           `json:"quantity"`
+	Price     string          `json:"price"`
+	Due       int64           `json:"due"`
+	Fulfilled int64           `json:"fulfilled"`
+	Status    string          `json:"status"`
+	Transfers []OrderTransfer `json:"transfers"`
+}
+
+// PurchaseOrder is an order of the buyer to the seller, the two members of the bilateral channel. The buyer issues
+// it and the seller confirms the lines and prices; transfer requests of the buyer to the seller then reference its
+// lines.
+type PurchaseOrder struct {
+	ID        string      `json:"id"`
+	Buyer     string      `json:"buyer"`
+	Seller    string      `json:"seller"`
+	Currency  string      `json:"currency"`
+	Status    string      `json:"status"`
+	Lines     []OrderLine `json:"lines"`
+	TxId      string      `json:"txId"`
+	Timestamp int64       `json:"timestamp"`
+	Confirmed int64       `json:"confirmed,omitempty"`
+}
+
+// parseOrderLines reads the lines in groups of item, quantity, price, due and numbers them from 1
+func parseOrderLines(args []string) ([]OrderLine, error) {
+	if len(args) == 0 || len(args)%orderLineFieldsNumber != 0 {
+		return nil, errors.New(fmt.Sprintf("lines must be given in groups of %d arguments: item, quantity, price, due",
+			orderLineFieldsNumber))
+	}
+
+	lines := []OrderLine{}
+	for i := 0; i < len(args); i += orderLineFieldsNumber {
+		line := OrderLine{Number: len(lines) + 1, Item: args[i], Price: args[i+2], Status: lineOpen,
+			Transfers: []OrderTransfer{}}
+
+		if len(line.Item) == 0 || !isValidKeyPart(line.Item) {
+			return nil, errors.New(fmt.Sprintf("item of line %d must be a non-empty UTF-8 string", line.Number))
+		}
+
+		quantity, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || quantity <= 0 {
+			return nil, errors.New(fmt.Sprintf("quantity of line %d is invalid: %s (must be positive int)",
+				line.Number, args[i+1]))
+		}
+		line.Quantity = quantity
+
+		if !priceFormat.MatchString(line.Price) {
+			return nil, errors.New(fmt.Sprintf("price of line %d is invalid: %s (must be non-negative decimal)",
+				line.Number, line.Price))
+		}
+
+		due, err := strconv.ParseInt(args[i+3], 10, 64)
+		if err != nil || due <= 0 {
+			return nil, errors.New(fmt.Sprintf("due date of line %d is invalid: %s (must be Unix seconds)",
+				line.Number, args[i+3]))
+		}
+		line.Due = due
+
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// parseOrderLineNumber reads the number of a line of a purchase order
+func parseOrderLineNumber(s string) (int, error) {
+	number, err := strconv.Atoi(s)
+	if err != nil || number <= 0 {
+		return 0, errors.New(fmt.Sprintf("order line is invalid: %s (must be positive int)", s))
+	}
+
+	return number, nil
+}
+
+func purchaseOrderKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(purchaseOrderIndex, []string{id})
+}
+
+// loadPurchaseOrder reads the purchase order, nil if there is none
+func loadPurchaseOrder(stub shim.ChaincodeStubInterface, id string) (*PurchaseOrder, error) {
+	key, err := purchaseOrderKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetState(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var order PurchaseOrder
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (order *PurchaseOrder) store(stub shim.ChaincodeStubInterface) error {
+	key, err := purchaseOrderKey(stub, order.ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, value)
+}
+
+// line returns the line with the number, nil if there is none
+func (order *PurchaseOrder) line(number int) *OrderLine {
+	if number <= 0 || number > len(order.Lines) {
+		return nil
+	}
+
+	return &order.Lines[number-1]
+}
+
+// checkLink tells why a transfer request of the sender to the receiver can't reference the line, nil if it can
+func (order *PurchaseOrder) checkLink(details *TransferDetails, number int) error {
+	if order.Buyer != details.Key.RequestSender || order.Seller != details.Key.RequestReceiver {
+		return errors.New(fmt.Sprintf("purchase order %s is of organization %s to %s, not %s to %s", order.ID,
+			order.Buyer, order.Seller, details.Key.RequestSender, details.Key.RequestReceiver))
+	}
+
+	if order.Status == orderIssued {
+		return errors.New(fmt.Sprintf("purchase order %s is not confirmed by organization %s", order.ID,
+			order.Seller))
+	}
+
+	line := order.line(number)
+	if line == nil {
+		return errors.New(fmt.Sprintf("purchase order %s has no line %d", order.ID, number))
+	}
+	if line.Status == orderFulfilled {
+		return errors.New(fmt.Sprintf("line %d of purchase order %s is already fulfilled", number, order.ID))
+	}
+
+	return line.checkUnits(order.ID, orderUnits(details.Value.Quantity))
+}
+
+// orderUnits is what a transfer counts toward a line: the quantity of a partial transfer, one product otherwise
+func orderUnits(quantity int64) int64 {
+	if quantity > 0 {
+		return quantity
+	}
+
+	return 1
+}
+
+// checkUnits tells why the units would overfill the line, nil if they fit
+func (line *OrderLine) checkUnits(id string, units int64) error {
+	if units > line.Quantity-line.Fulfilled {
+		return errors.New(fmt.Sprintf("line %d of purchase order %s has %d of %d fulfilled, %d more would overfill it",
+			line.Number, id, line.Fulfilled, line.Quantity, units))
+	}
+
+	return nil
+}
+
+// fulfil counts the accepted transfer of the quantity, zero for a whole product, toward the line and updates the
+// statuses of the line and the order. A line can't be fulfilled over its quantity.
+func (order *PurchaseOrder) fulfil(number int, quantity int64, transfer OrderTransfer) error {
+	line := order.line(number)
+	if line == nil {
+		return errors.New(fmt.Sprintf("purchase order %s has no line %d", order.ID, number))
+	}
+	if line.Fulfilled >= line.Quantity {
+		return errors.New(fmt.Sprintf("line %d of purchase order %s is already fulfilled", number, order.ID))
+	}
+	units := orderUnits(quantity)
+	if err := line.checkUnits(order.ID, units); err != nil {
+		return err
+	}
+
+	line.Fulfilled += units
+	transfer.Quantity = quantity
+	line.Transfers = append(line.Transfers, transfer)
+	if line.Fulfilled == line.Quantity {
+		line.Status = orderFulfilled
+	} else {
+		line.Status = orderPartiallyFulfilled
+	}
+
+	order.Status = orderFulfilled
+	for _, line := range order.Lines {
+		if line.Status != orderFulfilled {
+			order.Status = orderPartiallyFulfilled
+		}
+	}
+
+	return nil
+}
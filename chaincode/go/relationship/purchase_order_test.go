@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"testutil"
+)
+
+func TestParseOrderLines(t *testing.T) {
+	lines, err := parseOrderLines([]string{"pallet", "2", "10.50", "1520000000", "crate", "1", "3", "1520100000"})
+	if err != nil || len(lines) != 2 || lines[1].Number != 2 || lines[0].Quantity != 2 || lines[0].Price != "10.50" ||
+		lines[1].Due != 1520100000 || lines[0].Status != lineOpen {
+		t.Errorf("expected 2 open lines, got %+v (%v)", lines, err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"pallet", "2", "10.50"},
+		{"", "2", "10.50", "1520000000"},
+		{"pallet", "0", "10.50", "1520000000"},
+		{"pallet", "2", "-1", "1520000000"},
+		{"pallet", "2", "1e3", "1520000000"},
+		{"pallet", "2", "10.50", "tomorrow"},
+	} {
+		if _, err := parseOrderLines(args); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestParseRequestOptions(t *testing.T) {
+	for _, test := range []struct {
+		args     []string
+		expected requestOptions
+	}{
+		{[]string{}, requestOptions{}},
+		{[]string{"po1", "1"}, requestOptions{PurchaseOrder: "po1", OrderLine: "1"}},
+		{[]string{"", "", "", "300", "extra"}, requestOptions{Quantity: "300"}},
+		{[]string{"quantity=300", "po=po1", "line=1"}, requestOptions{PurchaseOrder: "po1", OrderLine: "1",
+			Quantity: "300"}},
+		{[]string{"certification=organic"}, requestOptions{RequiredCertification: "organic"}},
+		{[]string{"po=a=b", "line=1"}, requestOptions{PurchaseOrder: "a=b", OrderLine: "1"}},
+	} {
+		if options, err := parseRequestOptions(test.args); err != nil || options != test.expected {
+			t.Errorf("%q: expected %+v, got %+v (%v)", test.args, test.expected, options, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"quantity=300", "po1"},
+		{"quantity=300", "color=red"},
+		{"line=1", "line=2"},
+	} {
+		if _, err := parseRequestOptions(args); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
+func readPurchaseOrder(t *testing.T, stub *testutil.MockStub, id string) PurchaseOrder {
+	response := stub.MockInvoke("read", testutil.Args("readPurchaseOrder", id))
+	if response.Status >= 400 {
+		t.Fatalf("readPurchaseOrder failed: %s", response.Message)
+	}
+
+	var order PurchaseOrder
+	if err := json.Unmarshal(response.Payload, &order); err != nil {
+		t.Fatalf("cannot unmarshal purchase order: %s", err.Error())
+	}
+
+	return order
+}
+
+func TestPurchaseOrder(t *testing.T) {
+	stub := getInitializedStub(t, "a")
+
+	identities := testutil.NewIdentities(t, "a", "b", "c")
+
+	// line 1 is 2 pallets, line 2 a crate; the products belong to b
+	tests := []struct {
+		org      string
+		args     []string
+		expected int32
+	}{
+		{"a", []string{"createPurchaseOrder", "po1", "a", "USD", "pallet", "2", "10", "1520000000"}, 500},
+		{"a", []string{"createPurchaseOrder", "po1", "b", "US D", "pallet", "2", "10", "1520000000"}, 500},
+		{"a", []string{"createPurchaseOrder", "po1", "b", "USD", "pallet", "2", "10", "1520000000", "crate", "1",
+			"3.5", "1520100000"}, 200},
+		{"a", []string{"createPurchaseOrder", "po1", "b", "USD", "pallet", "1", "10", "1520000000"}, 409},
+		{"a", []string{"sendRequest", "p1", "a", "b", "pallet", "po1", "1"}, 409},
+		{"a", []string{"confirmPurchaseOrder", "po1"}, 403},
+		{"b", []string{"confirmPurchaseOrder", "po2"}, 404},
+		{"b", []string{"confirmPurchaseOrder", "po1"}, 200},
+		{"b", []string{"confirmPurchaseOrder", "po1"}, 409},
+		{"a", []string{"sendRequest", "p1", "a", "b", "pallet", "po2", "1"}, 404},
+		{"a", []string{"sendRequest", "p1", "a", "b", "pallet", "po1", "3"}, 409},
+		{"a", []string{"sendRequest", "p1", "a", "b", "pallet", "po1"}, 500},
+		{"a", []string{"sendRequest", "p1", "a", "b", "pallet", "po1", "first"}, 500},
+		{"c", []string{"sendRequest", "p1", "c", "b", "pallet", "po1", "1"}, 409},
+		{"a", []string{"sendRequest", "p1", "a", "b", "pallet", "po1", "1"}, 200},
+		{"a", []string{"sendRequest", "p2", "a", "b", "pallet", "po1", "1"}, 200},
+		{"a", []string{"sendRequest", "p3", "a", "b", "pallet", "po1", "1"}, 200},
+		{"a", []string{"sendRequest", "p4", "a", "b", "crate", "po1", "2"}, 200},
+		{"a", []string{"sendRequest", "p5", "a", "b", "no order", "", ""}, 200},
+		{"b", []string{"transferAccepted", "p1", "a", "b"}, 200},
+	}
+	for i, test := range tests {
+		response := stub.MockInvokeAs(identities[test.org], "order", testutil.Args(test.args...))
+		if response.Status != test.expected {
+			t.Errorf("#%d %v: expected status %d, got %d: %s", i, test.args, test.expected, response.Status,
+				response.Message)
+		}
+	}
+
+	order := readPurchaseOrder(t, stub, "po1")
+	if order.Buyer != "a" || order.Seller != "b" || order.Status != orderPartiallyFulfilled ||
+		order.Lines[0].Status != orderPartiallyFulfilled || order.Lines[0].Fulfilled != 1 ||
+		order.Lines[1].Status != lineOpen {
+		t.Errorf("expected line 1 partially fulfilled, got %+v", order)
+	}
+
+	// p3 is over the quantity of line 1: its acceptance fails and the request stays initiated
+	for _, test := range []struct {
+		product  string
+		expected int32
+	}{
+		{"p2", 200},
+		{"p3", 409},
+		{"p4", 200},
+		{"p5", 200},
+	} {
+		response := stub.MockInvokeAs(identities["b"], "accept", testutil.Args("transferAccepted", test.product, "a",
+			"b"))
+		if response.Status != test.expected {
+			t.Errorf("transferAccepted %s: expected status %d, got %d: %s", test.product, test.expected,
+				response.Status, response.Message)
+		}
+	}
+	if request := loadRequest(t, stub, "p3"); request.Value.Status != statusInitiated || request.Value.OrderLine != 1 {
+		t.Errorf("expected the request of p3 still initiated, got %+v", request.Value)
+	}
+	if request := loadRequest(t, stub, "p5"); request.Value.PurchaseOrder != "" {
+		t.Errorf("expected the request of p5 without purchase order, got %+v", request.Value)
+	}
+
+	order = readPurchaseOrder(t, stub, "po1")
+	if order.Status != orderFulfilled || order.Lines[0].Fulfilled != 2 || order.Lines[1].Fulfilled != 1 {
+		t.Errorf("expected the order fulfilled, got %+v", order)
+	}
+	if transfers := order.Lines[0].Transfers; len(transfers) != 2 || transfers[0].ProductKey != "p1" ||
+		transfers[1].ProductKey != "p2" || transfers[1].TxId != "accept" {
+		t.Errorf("expected the transfers of p1 and p2 in line 1, got %+v", transfers)
+	}
+
+	if response := stub.MockInvokeAs(identities["a"], "again", testutil.Args("sendRequest", "p6", "a", "b",
+		"pallet", "po1", "1")); response.Status != 409 {
+		t.Errorf("expected status 409 for a fulfilled line, got %d: %s", response.Status, response.Message)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"params"
+)
+
+// transferStatistics is the response of getTransferStatistics. Transfers are counted by the status they have
+// now and the time it was set, acceptances by the time they happened.
+type transferStatistics struct {
+	Total                    int            `json:"total"`
+	ByStatus                 map[string]int `json:"byStatus"`
+	OpenByCounterparty       map[string]int `json:"openByCounterparty"`
+	Accepted                 int            `json:"accepted"`
+	AverageAcceptanceSeconds float64        `json:"averageAcceptanceSeconds"`
+}
+
+// collectTransferStatistics counts transfers within the window and measures the time from Initiated to Accepted
+// in their history. Counterparties are the other sides of open transfers of the organization.
+func collectTransferStatistics(stub shim.ChaincodeStubInterface, window params.TimeWindow,
+	organization string) (transferStatistics, error) {
+	statistics := transferStatistics{ByStatus: map[string]int{}, OpenByCounterparty: map[string]int{}}
+	var acceptanceSeconds int64
+
+	it, err := stub.GetStateByPartialCompositeKey(transferIndex, []string{})
+	if err != nil {
+		return transferStatistics{}, err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return transferStatistics{}, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return transferStatistics{}, err
+		}
+
+		details := TransferDetails{}
+		if err := details.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return transferStatistics{}, err
+		}
+		if err := details.FillFromLedgerValue(response.Value); err != nil {
+			return transferStatistics{}, err
+		}
+
+		if window.Contains(details.Value.Timestamp) {
+			statistics.Total++
+			statistics.ByStatus[details.Value.Status]++
+
+			if details.Value.Status == statusInitiated {
+				// on a bilateral channel the organization is one of the sides
+				if details.Key.RequestSender == organization {
+					statistics.OpenByCounterparty[details.Key.RequestReceiver]++
+				} else if details.Key.RequestReceiver == organization {
+					statistics.OpenByCounterparty[details.Key.RequestSender]++
+				}
+			}
+		}
+
+		history, err := loadTransferHistory(stub, details.Key, response.Key)
+		if err != nil {
+			return transferStatistics{}, err
+		}
+
+		// a request is initiated when it's sent, edits keep it initiated until it's answered
+		initiated := int64(-1)
+		for _, modification := range history {
+			switch {
+			case modification.IsDelete:
+				initiated = -1
+			case modification.Value.Status == statusInitiated:
+				if initiated < 0 {
+					initiated = modification.Value.Timestamp
+				}
+			case modification.Value.Status == statusAccepted:
+				if initiated >= 0 && window.Contains(modification.Value.Timestamp) {
+					statistics.Accepted++
+					acceptanceSeconds += modification.Value.Timestamp - initiated
+				}
+				initiated = -1
+			default:
+				initiated = -1
+			}
+		}
+	}
+
+	if statistics.Accepted > 0 {
+		statistics.AverageAcceptanceSeconds = float64(acceptanceSeconds) / float64(statistics.Accepted)
+	}
+
+	return statistics, nil
+}
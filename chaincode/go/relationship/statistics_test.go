@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"testutil"
+)
+
+// statisticsStub extends the contract ledger with a request of p3 from b answered after 5 minutes and an open one
+// of p4 from a. Its clock is at 12:00 and ticks a minute per transaction.
+func statisticsStub(t *testing.T) (*testutil.MockStub, map[string]*testutil.Identity) {
+	stub := contractStub(t)
+
+	identities := testutil.NewIdentities(t, "a", "b")
+
+	stub.MockPeerChaincode(commonChaincodeName+"/"+commonChannelName,
+		shim.NewMockStub(commonChaincodeName, &referenceStub{owner: "a"}))
+
+	steps := []struct {
+		org  string
+		args []string
+	}{
+		{"b", []string{"sendRequest", "p3", "b", "a", "price 10"}},
+		{"b", []string{"editRequest", "p3", "b", "a", "price 11"}},
+		{"b", []string{"editRequest", "p3", "b", "a", "price 12"}},
+		{"b", []string{"editRequest", "p3", "b", "a", "price 13"}},
+		{"b", []string{"editRequest", "p3", "b", "a", "price 14"}},
+		{"a", []string{"transferAccepted", "p3", "b", "a"}},
+		{"b", []string{"sendRequest", "p4", "b", "a", "price 20"}},
+	}
+	for i, step := range steps {
+		response := stub.MockInvokeAs(identities[step.org], fmt.Sprintf("stats%d", i), testutil.Args(step.args...))
+		if response.Status >= 400 {
+			t.Fatalf("%s failed: %s", step.args[0], response.Message)
+		}
+	}
+
+	return stub, identities
+}
+
+func TestGetTransferStatistics(t *testing.T) {
+	stub, identities := statisticsStub(t)
+	minute := func(m int) string {
+		return fmt.Sprint(time.Date(2018, 3, 1, 12, m, 0, 0, time.UTC).Unix())
+	}
+
+	tests := []struct {
+		org      string
+		args     []string
+		expected transferStatistics
+	}{
+		// p1 is accepted in 2 minutes at 12:02, p2 cancelled at 12:04, p3 accepted in 5 minutes at 12:10
+		{"a", []string{}, transferStatistics{Total: 4,
+			ByStatus:           map[string]int{statusAccepted: 2, statusCancelled: 1, statusInitiated: 1},
+			OpenByCounterparty: map[string]int{"b": 1}, Accepted: 2, AverageAcceptanceSeconds: 210}},
+		{"b", []string{}, transferStatistics{Total: 4,
+			ByStatus:           map[string]int{statusAccepted: 2, statusCancelled: 1, statusInitiated: 1},
+			OpenByCounterparty: map[string]int{"a": 1}, Accepted: 2, AverageAcceptanceSeconds: 210}},
+		{"a", []string{minute(3)}, transferStatistics{Total: 3,
+			ByStatus:           map[string]int{statusAccepted: 1, statusCancelled: 1, statusInitiated: 1},
+			OpenByCounterparty: map[string]int{"b": 1}, Accepted: 1, AverageAcceptanceSeconds: 300}},
+		{"a", []string{"", minute(10)}, transferStatistics{Total: 3,
+			ByStatus:           map[string]int{statusAccepted: 2, statusCancelled: 1},
+			OpenByCounterparty: map[string]int{}, Accepted: 2, AverageAcceptanceSeconds: 210}},
+		{"a", []string{minute(5), minute(9)}, transferStatistics{
+			ByStatus: map[string]int{}, OpenByCounterparty: map[string]int{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.org+fmt.Sprint(test.args), func(t *testing.T) {
+			response := stub.MockInvokeAs(identities[test.org], "statistics",
+				testutil.Args(append([]string{"getTransferStatistics"}, test.args...)...))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			var statistics transferStatistics
+			if err := json.Unmarshal(response.Payload, &statistics); err != nil {
+				t.Fatalf("cannot unmarshal statistics: %s", err.Error())
+			}
+			if !reflect.DeepEqual(statistics, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, statistics)
+			}
+		})
+	}
+}
+
+func TestGetTransferStatisticsErrors(t *testing.T) {
+	stub := contractStub(t)
+
+	for _, args := range [][]string{{"x"}, {"-5"}, {"10", "5"}} {
+		response := stub.MockInvoke("statistics", testutil.Args(append([]string{"getTransferStatistics"}, args...)...))
+		if response.Status < 400 {
+			t.Errorf("expected an error for arguments %v", args)
+		}
+	}
+}
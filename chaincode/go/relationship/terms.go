@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	// termsCollection is the private data collection of the two members of a bilateral channel, see
+	// artifact-templates/collections-config-template.json
+	termsCollection = "commercialTerms"
+	transientTerms  = "terms"
+	transientSalt   = "salt"
+	// minSaltLength keeps the hash of short terms, e.g. a price, from being found by trying every value
+	minSaltLength = 16
+)
+
+// commercialTerms is the private part of a transfer request: the terms document and the salt of its hash
+type commercialTerms struct {
+	Terms []byte `json:"terms"`
+	Salt  []byte `json:"salt"`
+}
+
+// termsRecord is a response of getTerms
+type termsRecord struct {
+	TermsHash string `json:"termsHash"`
+	Terms     []byte `json:"terms"`
+	Salt      []byte `json:"salt"`
+}
+
+// termsVerification is a response of verifyTerms
+type termsVerification struct {
+	TermsHash string `json:"termsHash"`
+	Matches   bool   `json:"matches"`
+}
+
+// Hash returns HMAC-SHA256 of the terms keyed with the salt, hex-encoded
+func (terms *commercialTerms) Hash() string {
+	mac := hmac.New(sha256.New, terms.Salt)
+	mac.Write(terms.Terms)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readTransientTerms reads the terms passed in the transient map. It returns nil if there are none.
+func readTransientTerms(stub shim.ChaincodeStubInterface) (*commercialTerms, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+
+	terms, ok := transient[transientTerms]
+	if !ok {
+		return nil, nil
+	}
+
+	salt := transient[transientSalt]
+	if len(salt) < minSaltLength {
+		return nil, errors.New(fmt.Sprintf("transient field %s must be at least %d bytes long to hash terms",
+			transientSalt, minSaltLength))
+	}
+
+	return &commercialTerms{Terms: terms, Salt: salt}, nil
+}
+
+// applyTerms stores the terms passed in the transient map of the transaction in the private data collection and
+// keeps their hash in the public value. Without terms, a new request drops the terms of the previous one and an
+// edit keeps the current ones.
+func (details *TransferDetails) applyTerms(stub shim.ChaincodeStubInterface, keepCurrent bool) error {
+	terms, err := readTransientTerms(stub)
+	if err != nil {
+		return err
+	}
+
+	compositeKey, err := details.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	if terms == nil {
+		if keepCurrent || len(details.Value.TermsHash) == 0 {
+			return nil
+		}
+
+		details.Value.TermsHash = ""
+		return stub.DelPrivateData(termsCollection, compositeKey)
+	}
+
+	value, err := json.Marshal(terms)
+	if err != nil {
+		return err
+	}
+	if err := stub.PutPrivateData(termsCollection, compositeKey, value); err != nil {
+		return err
+	}
+
+	details.Value.TermsHash = terms.Hash()
+	return nil
+}
+
+// checkMessage rejects a message on a request with commercial terms. The message is public, every peer of the
+// channel keeps it, so it's only for notes without commercial content and the terms go in the transient map.
+func (details *TransferDetails) checkMessage() error {
+	if len(details.Value.TermsHash) > 0 && len(details.Value.Message) > 0 {
+		return errors.New("message must be empty for a request with commercial terms: it is visible to every " +
+			"peer of the channel, put it in the terms")
+	}
+
+	return nil
+}
+
+// loadTerms reads the terms of the request from the private data collection. It returns nil if there are none.
+func (details *TransferDetails) loadTerms(stub shim.ChaincodeStubInterface) (*commercialTerms, error) {
+	compositeKey, err := details.ToCompositeKey(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := stub.GetPrivateData(termsCollection, compositeKey)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var terms commercialTerms
+	if err := json.Unmarshal(data, &terms); err != nil {
+		return nil, err
+	}
+
+	return &terms, nil
+}
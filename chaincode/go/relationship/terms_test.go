@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"testutil"
+)
+
+// loadRequest reads the public value of the transfer request of the product from a to b
+func loadRequest(t *testing.T, stub *testutil.MockStub, product string) TransferDetails {
+	request := TransferDetails{}
+	if err := request.FillFromArguments([]string{product, "a", "b"}); err != nil {
+		t.Fatalf("cannot read transfer details: %s", err.Error())
+	}
+	if err := request.LoadFrom(stub); err != nil {
+		t.Fatalf("cannot load request of %s: %s", product, err.Error())
+	}
+
+	return request
+}
+
+func TestCommercialTerms(t *testing.T) {
+	stub := contractStub(t)
+	terms := commercialTerms{Terms: contractTerms[transientTerms], Salt: contractTerms[transientSalt]}
+
+	p1 := loadRequest(t, stub, "p1")
+	if p1.Value.TermsHash != terms.Hash() {
+		t.Errorf("expected terms hash %s, got %q", terms.Hash(), p1.Value.TermsHash)
+	}
+	if stored, err := p1.loadTerms(stub); err != nil || stored == nil || string(stored.Terms) != string(terms.Terms) {
+		t.Errorf("expected the terms of p1 in the private data collection, got %+v (%v)", stored, err)
+	}
+
+	// p2 was cancelled: send it again with terms, cancel it and send it once more without
+	stub.Transient = contractTerms
+	if response := stub.MockInvoke("t1", testutil.Args("sendRequest", "p2", "a", "b", "")); response.Status >= 400 {
+		t.Fatalf("sendRequest failed: %s", response.Message)
+	}
+	stub.Transient = nil
+	if response := stub.MockInvoke("t2", testutil.Args("editRequest", "p2", "a", "b", "")); response.Status >= 400 {
+		t.Fatalf("editRequest failed: %s", response.Message)
+	}
+	if hash := loadRequest(t, stub, "p2").Value.TermsHash; hash != terms.Hash() {
+		t.Errorf("an edit without terms should keep them, got hash %q", hash)
+	}
+
+	if response := stub.MockInvoke("t3", testutil.Args("transferRejected", "p2", "a", "b")); response.Status >= 400 {
+		t.Fatalf("transferRejected failed: %s", response.Message)
+	}
+	if response := stub.MockInvoke("t4", testutil.Args("sendRequest", "p2", "a", "b", "price 80")); response.Status >= 400 {
+		t.Fatalf("sendRequest failed: %s", response.Message)
+	}
+
+	p2 := loadRequest(t, stub, "p2")
+	if p2.Value.TermsHash != "" {
+		t.Errorf("a new request without terms should drop the previous ones, got hash %q", p2.Value.TermsHash)
+	}
+	if stored, err := p2.loadTerms(stub); err != nil || stored != nil {
+		t.Errorf("expected no terms of p2 in the private data collection, got %+v (%v)", stored, err)
+	}
+	if response := stub.MockInvoke("t5", testutil.Args("getTerms", "p2", "a", "b")); response.Status != 404 {
+		t.Errorf("expected 404 for a request without terms, got %d: %s", response.Status, response.Message)
+	}
+}
+
+func TestCommercialTermsErrors(t *testing.T) {
+	stub := contractStub(t)
+
+	stub.Transient = map[string][]byte{transientTerms: []byte(`{"price":60}`), transientSalt: []byte("short")}
+	if response := stub.MockInvoke("t1", testutil.Args("sendRequest", "p2", "a", "b", "price 60")); response.Status < 400 {
+		t.Error("expected an error for a salt shorter than 16 bytes")
+	}
+
+	// the message is public: a request with terms can't carry one, whether the terms are new or kept by an edit
+	stub.Transient = contractTerms
+	if response := stub.MockInvoke("t2", testutil.Args("sendRequest", "p2", "a", "b", "price 60")); response.Status < 400 {
+		t.Error("expected an error for a message next to commercial terms")
+	}
+	if response := stub.MockInvoke("t3", testutil.Args("sendRequest", "p2", "a", "b", "")); response.Status >= 400 {
+		t.Fatalf("sendRequest failed: %s", response.Message)
+	}
+	stub.Transient = nil
+	if response := stub.MockInvoke("t4", testutil.Args("editRequest", "p2", "a", "b", "price 70")); response.Status < 400 {
+		t.Error("expected an error for a message on a request with commercial terms")
+	}
+
+	outsider, err := testutil.NewIdentity("c")
+	if err != nil {
+		t.Fatalf("cannot generate identity of c: %s", err.Error())
+	}
+	if response := stub.MockInvokeAs(outsider, "t5", testutil.Args("getTerms", "p1", "a", "b")); response.Status != 403 {
+		t.Errorf("expected 403 for an organization outside of the request, got %d: %s", response.Status,
+			response.Message)
+	}
+
+	if response := stub.MockInvoke("t6", testutil.Args("verifyTerms", "p1", "a", "b")); response.Status < 400 {
+		t.Error("expected an error for verifyTerms without terms")
+	}
+}
+
+func TestVerifyTerms(t *testing.T) {
+	stub := contractStub(t)
+
+	tests := []struct {
+		terms    string
+		salt     string
+		expected bool
+	}{
+		{string(contractTerms[transientTerms]), string(contractTerms[transientSalt]), true},
+		{`{"price":100,"currency":"USD","incoterms":"FCA"}`, string(contractTerms[transientSalt]), false},
+		{string(contractTerms[transientTerms]), "fedcba9876543210", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.terms+"/"+test.salt, func(t *testing.T) {
+			stub.Transient = map[string][]byte{transientTerms: []byte(test.terms), transientSalt: []byte(test.salt)}
+			response := stub.MockInvoke("verify", testutil.Args("verifyTerms", "p1", "a", "b"))
+			if response.Status >= 400 {
+				t.Fatalf("unexpected error: %s", response.Message)
+			}
+
+			var verification termsVerification
+			if err := json.Unmarshal(response.Payload, &verification); err != nil {
+				t.Fatalf("cannot unmarshal verification: %s", err.Error())
+			}
+			if verification.Matches != test.expected {
+				t.Errorf("expected matches %v, got %v", test.expected, verification.Matches)
+			}
+		})
+	}
+}
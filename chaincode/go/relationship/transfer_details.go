@@ -3,6 +3,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 	"encoding/json"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
@@ -16,6 +19,10 @@ const (
 	keyFieldsNumber = 3
 )
 
+// partSuffix names the lot the receiver of a partial transfer gets: the reference chaincode splits the product into
+// <name>/1, which the old owner keeps, and <name>/2
+const partSuffix = "/2"
+
 const (
 	statusInitiated = "Initiated"
 	statusAccepted = "Accepted"
@@ -23,16 +30,102 @@ const (
 	statusCancelled = "Cancelled"
 )
 
+// parseQuantity reads the quantity of a partial transfer, a positive integer in the unit of the product
+func parseQuantity(s string) (int64, error) {
+	quantity, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || quantity <= 0 {
+		return 0, errors.New(fmt.Sprintf("quantity is invalid: %s (must be a positive integer)", s))
+	}
+
+	return quantity, nil
+}
+
+// requestOptionNames are the optional arguments of sendRequest after the message, in their positional order
+var requestOptionNames = []string{"po", "line", "certification", "quantity"}
+
+// requestOptions are the optional arguments of sendRequest, empty when not given
+type requestOptions struct {
+	PurchaseOrder         string
+	OrderLine             string
+	RequiredCertification string
+	Quantity              string
+}
+
+// isRequestOption tells if the argument is a keyed optional argument: name=value with a name of requestOptionNames
+func isRequestOption(arg string) bool {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	for _, name := range requestOptionNames {
+		if parts[0] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRequestOptions reads the optional arguments of sendRequest. They are keyed, e.g. quantity=300, in any order
+// when the first of them is; otherwise they are positional: poId, line, certification, quantity, with empty strings
+// for the ones skipped.
+func parseRequestOptions(args []string) (requestOptions, error) {
+	values := map[string]string{}
+	keyed := len(args) > 0 && isRequestOption(args[0])
+	for i, arg := range args {
+		if !keyed {
+			if i < len(requestOptionNames) {
+				values[requestOptionNames[i]] = arg
+			}
+			continue
+		}
+
+		if !isRequestOption(arg) {
+			return requestOptions{}, errors.New(fmt.Sprintf("optional argument %s must be name=value, name one of %s",
+				arg, strings.Join(requestOptionNames, ", ")))
+		}
+		parts := strings.SplitN(arg, "=", 2)
+		if _, ok := values[parts[0]]; ok {
+			return requestOptions{}, errors.New(fmt.Sprintf("optional argument %s is given twice", parts[0]))
+		}
+		values[parts[0]] = parts[1]
+	}
+
+	return requestOptions{PurchaseOrder: values["po"], OrderLine: values["line"],
+		RequiredCertification: values["certification"], Quantity: values["quantity"]}, nil
+}
+
+// isValidKeyPart rejects what CreateCompositeKey cannot take as an attribute: invalid UTF-8, U+0000 and U+10FFFF
+func isValidKeyPart(part string) bool {
+	return utf8.ValidString(part) && !strings.ContainsRune(part, 0) && !strings.ContainsRune(part, utf8.MaxRune)
+}
+
 type TransferDetailsKey struct {
 	ProductKey      string `json:"productKey"`
 	RequestSender   string `json:"requestSender"`
 	RequestReceiver string `json:"requestReceiver"`
 }
 
+// TransferDetailsValue is the public part of a transfer request. Commercial terms are kept in a private data
+// collection of the two members, TermsHash lets anyone check a terms document against them. Message is a public
+// note without commercial content, it must be empty when there are terms. LastDocument is the
+// hash of the document attached last, so every attachment shows up in the history of the request. PurchaseOrder
+// and OrderLine reference the line of a purchase order the transfer delivers. RequiredCertification is the type of
+// certification the product must have, when it's requested and when it's accepted. Quantity is the part of a lot of
+// bulk goods the transfer moves, the whole product if it's zero. Part is the name of the lot the receiver gets for
+// a quantity less than the whole product, set when the transfer is accepted.
 type TransferDetailsValue struct {
-	Status    string `json:"status"`
-	Message   string `json:"message"`
-	Timestamp int64  `json:"timestamp"`
+	Status                string `json:"status"`
+	Message               string `json:"message"`
+	Timestamp             int64  `json:"timestamp"`
+	TermsHash             string `json:"termsHash,omitempty"`
+	LastDocument          string `json:"lastDocument,omitempty"`
+	PurchaseOrder         string `json:"purchaseOrder,omitempty"`
+	OrderLine             int    `json:"orderLine,omitempty"`
+	RequiredCertification string `json:"requiredCertification,omitempty"`
+	Quantity              int64  `json:"quantity,omitempty"`
+	Part                  string `json:"part,omitempty"`
 }
 
 type TransferDetails struct {
@@ -57,6 +150,16 @@ func (details *TransferDetails) FillFromCompositeKeyParts(compositeKeyParts []st
 		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", keyFieldsNumber))
 	}
 
+	for k, v := range compositeKeyParts[:keyFieldsNumber] {
+		if len(v) == 0 {
+			return errors.New(fmt.Sprintf("key part #%d must be a non-empty string", k + 1))
+		}
+		if !isValidKeyPart(v) {
+			return errors.New(fmt.Sprintf("key part #%d must be a valid UTF-8 string without U+0000 and U+10FFFF",
+				k + 1))
+		}
+	}
+
 	details.Key.ProductKey = compositeKeyParts[0]
 	details.Key.RequestSender = compositeKeyParts[1]
 	details.Key.RequestReceiver = compositeKeyParts[2]
@@ -82,6 +185,11 @@ func (details *TransferDetails) ToCompositeKey(stub shim.ChaincodeStubInterface)
 	return stub.CreateCompositeKey(transferIndex, compositeKeyParts)
 }
 
+// documentTarget identifies the transfer request among the records documents are attached to
+func (details *TransferDetails) documentTarget() []string {
+	return []string{"transfer", details.Key.ProductKey, details.Key.RequestSender, details.Key.RequestReceiver}
+}
+
 func (details *TransferDetails) ToLedgerValue() ([]byte, error) {
 	return json.Marshal(details.Value)
 }
@@ -131,17 +239,23 @@ func (details *TransferDetails) UpdateOrInsertIn(stub shim.ChaincodeStubInterfac
 	return nil
 }
 
-func (details *TransferDetails) EmitState(stub shim.ChaincodeStubInterface) error {
-	type eventDetails struct {
-		ProductKey string `json:"product_key"`
-		OldOwner   string `json:"old_owner"`
-		NewOwner   string `json:"new_owner"`
-	}
+// transferEvent is the payload of TransferDetails.<status> events. Quantity is set for a partial transfer, Part for
+// one that splits the product.
+type transferEvent struct {
+	ProductKey string `json:"product_key"`
+	OldOwner   string `json:"old_owner"`
+	NewOwner   string `json:"new_owner"`
+	Quantity   int64  `json:"quantity,omitempty"`
+	Part       string `json:"part,omitempty"`
+}
 
-	ed := eventDetails{
+func (details *TransferDetails) EmitState(stub shim.ChaincodeStubInterface) error {
+	ed := transferEvent{
 		ProductKey: details.Key.ProductKey,
 		OldOwner: details.Key.RequestReceiver,
 		NewOwner: details.Key.RequestSender,
+		Quantity: details.Value.Quantity,
+		Part: details.Value.Part,
 	}
 
 	bytes, err := json.Marshal(ed)
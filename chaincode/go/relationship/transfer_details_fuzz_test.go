@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"testutil"
+)
+
+// checkTransferKeyRoundTrip asserts that a key accepted by FillFromCompositeKeyParts survives the ledger unchanged.
+func checkTransferKeyRoundTrip(t *testing.T, stub shim.ChaincodeStubInterface, parts []string) {
+	var details TransferDetails
+	if err := details.FillFromCompositeKeyParts(parts); err != nil {
+		return
+	}
+
+	compositeKey, err := details.ToCompositeKey(stub)
+	if err != nil {
+		t.Fatalf("accepted key parts %q cannot form a composite key: %s", parts, err.Error())
+	}
+
+	objectType, splitParts, err := stub.SplitCompositeKey(compositeKey)
+	if err != nil {
+		t.Fatalf("cannot split composite key %q: %s", compositeKey, err.Error())
+	}
+	if objectType != transferIndex {
+		t.Fatalf("expected object type %s, got %s", transferIndex, objectType)
+	}
+
+	var restored TransferDetails
+	if err := restored.FillFromCompositeKeyParts(splitParts); err != nil {
+		t.Fatalf("cannot restore key from parts %q: %s", splitParts, err.Error())
+	}
+	if restored.Key != details.Key {
+		t.Fatalf("key changed in round trip: %+v -> %+v", details.Key, restored.Key)
+	}
+}
+
+func FuzzTransferDetailsFillFromArguments(f *testing.F) {
+	f.Add("p1", "b", "a", "message")
+	f.Add("", "", "", "")
+	f.Add("p1\x00b", "a", "", "")
+	f.Add("p1", "b\x00a", "c", "")
+	f.Add("p1", "\U0010FFFF", "a", "")
+	f.Add("\xc3\x28", "b", "a", "")
+	f.Add(strings.Repeat("p", 1<<16), "b", "a", strings.Repeat("m", 1<<16))
+
+	stub := shim.NewMockStub("relationship", new(OwnershipChaincode))
+	f.Fuzz(func(t *testing.T, productKey, sender, receiver, message string) {
+		args := []string{productKey, sender, receiver, message}
+
+		var details TransferDetails
+		if err := details.FillFromArguments(args); err != nil {
+			return
+		}
+
+		for i, part := range []string{details.Key.ProductKey, details.Key.RequestSender, details.Key.RequestReceiver} {
+			if part != args[i] {
+				t.Errorf("key part #%d %q is stored as %q", i+1, args[i], part)
+			}
+			if len(part) == 0 || strings.ContainsRune(part, 0) {
+				t.Errorf("key part #%d %q was accepted", i+1, part)
+			}
+		}
+
+		checkTransferKeyRoundTrip(t, stub, args[:keyFieldsNumber])
+	})
+}
+
+// FuzzTransferStatuses runs a random sequence of transfer operations by random parties: a transfer must only
+// leave Initiated through an operation of a party allowed to do it.
+func FuzzTransferStatuses(f *testing.F) {
+	f.Add([]byte{0x00, 0x11})
+	f.Add([]byte{0x00, 0x01, 0x12, 0x00, 0x02, 0x20})
+	f.Add([]byte{0x21, 0x10, 0x32, 0x00, 0x00})
+
+	orgs := []string{"a", "b", "c"}
+	identities := testutil.NewIdentities(f, orgs...)
+
+	functions := []string{"sendRequest", "transferAccepted", "transferRejected", "editRequest"}
+
+	f.Fuzz(func(t *testing.T, operations []byte) {
+		stub := testutil.NewMockStub("relationship", new(OwnershipChaincode))
+		stub.MockPeerChaincode(commonChaincodeName+"/"+commonChannelName,
+			shim.NewMockStub(commonChaincodeName, &referenceStub{owner: "a"}))
+
+		details := TransferDetails{Key: TransferDetailsKey{"p1", "b", "a"}}
+		status := ""
+
+		for i, operation := range operations {
+			function := functions[int(operation&0x0f)%len(functions)]
+			caller := orgs[int(operation>>4)%len(orgs)]
+
+			response := stub.MockInvokeAs(identities[caller], "tx",
+				testutil.Args(function, "p1", "b", "a", "message"))
+
+			expected, allowed := status, true
+			switch {
+			case function == "sendRequest" && caller == "b" && status != statusInitiated:
+				expected = statusInitiated
+			case function == "transferAccepted" && caller == "a" && status == statusInitiated:
+				expected = statusAccepted
+			case function == "transferRejected" && caller == "a" && status == statusInitiated:
+				expected = statusRejected
+			case function == "transferRejected" && caller == "b" && status == statusInitiated:
+				expected = statusCancelled
+			case function == "editRequest" && caller == "b" && status == statusInitiated:
+			default:
+				allowed = false
+			}
+
+			if (response.Status < 400) != allowed {
+				t.Fatalf("step %d: %s by %s in status %q returned %d (%s)",
+					i, function, caller, status, response.Status, response.Message)
+			}
+
+			actual := ""
+			if details.ExistsIn(stub) {
+				if err := details.LoadFrom(stub); err != nil {
+					t.Fatalf("step %d: cannot load transfer details: %s", i, err.Error())
+				}
+				actual = details.Value.Status
+			}
+			if actual != expected {
+				t.Fatalf("step %d: %s by %s: expected status %q, got %q", i, function, caller, expected, actual)
+			}
+			status = actual
+		}
+	})
+}
+
+func TestTransferKeyProperties(t *testing.T) {
+	stub := shim.NewMockStub("relationship", new(OwnershipChaincode))
+
+	roundTrip := func(productKey, sender, receiver string) bool {
+		checkTransferKeyRoundTrip(t, stub, []string{productKey, sender, receiver})
+		return !t.Failed()
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+
+	// different keys never map to the same composite key
+	injective := func(a, b [keyFieldsNumber]string) bool {
+		var first, second TransferDetails
+		if first.FillFromCompositeKeyParts(a[:]) != nil || second.FillFromCompositeKeyParts(b[:]) != nil {
+			return true
+		}
+		firstKey, _ := first.ToCompositeKey(stub)
+		secondKey, _ := second.ToCompositeKey(stub)
+		return (firstKey == secondKey) == (first.Key == second.Key)
+	}
+	if err := quick.Check(injective, nil); err != nil {
+		t.Error(err)
+	}
+	if !injective([keyFieldsNumber]string{"p", "ab", "c"}, [keyFieldsNumber]string{"p", "a", "bc"}) {
+		t.Error("keys with the same concatenation collide")
+	}
+}
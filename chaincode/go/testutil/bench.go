@@ -0,0 +1,29 @@
+package testutil
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ledgerSizes lists the numbers of records benchmarks seed the ledger with, e.g. -ledger.sizes=10000,1000000.
+var ledgerSizes = flag.String("ledger.sizes", "10000,100000,1000000",
+	"comma-separated numbers of records to seed the ledger with in benchmarks")
+
+// LedgerSizes returns the sizes of -ledger.sizes, without the ones over 100000 in short mode.
+func LedgerSizes(b *testing.B) []int {
+	var sizes []int
+	for _, s := range strings.Split(*ledgerSizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || size <= 0 {
+			b.Fatalf("invalid ledger size %q", s)
+		}
+		if testing.Short() && size > 100000 {
+			continue
+		}
+		sizes = append(sizes, size)
+	}
+
+	return sizes
+}
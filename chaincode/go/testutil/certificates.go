@@ -0,0 +1,160 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+const (
+	defaultDomain       = "example.com"
+	certificateValidity = 24 * time.Hour
+)
+
+// CA is a throwaway certificate authority of a single organization, laid out the same way cryptogen does it:
+// the organization of the CA subject is "<org>.<domain>", so GetCreatorOrganization resolves it to "<org>".
+type CA struct {
+	Org         string
+	Domain      string
+	Certificate *x509.Certificate
+	PrivateKey  *ecdsa.PrivateKey
+}
+
+// Identity is a user certificate issued by a CA together with the MSP it belongs to.
+type Identity struct {
+	MSPID       string
+	Certificate *x509.Certificate
+	PrivateKey  *ecdsa.PrivateKey
+}
+
+// NewCA generates a self-signed CA for the organization org of the example.com domain.
+func NewCA(org string) (*CA, error) {
+	return NewCAWithDomain(org, defaultDomain)
+}
+
+// NewCAWithDomain generates a self-signed CA for the organization org of the given domain.
+func NewCAWithDomain(org, domain string) (*CA, error) {
+	if len(org) == 0 {
+		return nil, errors.New("organization name must be a non-empty string")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	orgDomain := org + "." + domain
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject: pkix.Name{
+			Organization: []string{orgDomain},
+			CommonName:   "ca." + orgDomain,
+		},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Org: org, Domain: domain, Certificate: certificate, PrivateKey: key}, nil
+}
+
+// MSPID returns the MSP identifier of the CA organization, e.g. "aMSP".
+func (ca *CA) MSPID() string {
+	return ca.Org + "MSP"
+}
+
+// Issue generates a user certificate signed by the CA, e.g. Issue("User1") gives User1@a.example.com.
+func (ca *CA) Issue(name string) (*Identity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("%s@%s.%s", name, ca.Org, ca.Domain),
+		},
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(certificateValidity),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{MSPID: ca.MSPID(), Certificate: certificate, PrivateKey: key}, nil
+}
+
+// PEM returns the identity certificate PEM-encoded.
+func (id *Identity) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: id.Certificate.Raw})
+}
+
+// Serialize returns the identity in the form the peer passes it as a transaction creator (msp.SerializedIdentity).
+func (id *Identity) Serialize() ([]byte, error) {
+	return proto.Marshal(&msp.SerializedIdentity{Mspid: id.MSPID, IdBytes: id.PEM()})
+}
+
+// NewIdentity is a shortcut that generates a CA for org and issues a User1 certificate from it.
+func NewIdentity(org string) (*Identity, error) {
+	ca, err := NewCA(org)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.Issue("User1")
+}
+
+// NewIdentities generates an identity of each org, by the name of the org, and fails the test if it can't.
+func NewIdentities(t testing.TB, orgs ...string) map[string]*Identity {
+	identities := map[string]*Identity{}
+	for _, org := range orgs {
+		identity, err := NewIdentity(org)
+		if err != nil {
+			t.Fatalf("cannot generate identity of %s: %s", org, err.Error())
+		}
+		identities[org] = identity
+	}
+
+	return identities
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+
+	return serial
+}
@@ -0,0 +1,83 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files and JSON schemas with the actual output")
+
+// AssertGolden compares the JSON document with the golden file at path, both indented the same way, so the key
+// order and every field name of the document is pinned. Run tests with -update to accept a deliberate change.
+func AssertGolden(t *testing.T, path string, actual []byte) {
+	t.Helper()
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, actual, "", "  "); err != nil {
+		t.Fatalf("%s: actual output is not JSON: %s\n%s", path, err.Error(), string(actual))
+	}
+	indented.WriteByte('\n')
+
+	writeOrCompare(t, path, indented.Bytes())
+}
+
+// AssertSchema generates the JSON schema of the type of v and compares it with the published one at path.
+// Run tests with -update to publish a deliberate change.
+func AssertSchema(t *testing.T, path, title string, v interface{}) {
+	t.Helper()
+
+	schema, err := GenerateSchema(title, v)
+	if err != nil {
+		t.Fatalf("%s: cannot generate schema: %s", path, err.Error())
+	}
+
+	writeOrCompare(t, path, schema)
+}
+
+func writeOrCompare(t *testing.T, path string, actual []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read %s (run with -update to create it): %s", path, err.Error())
+	}
+
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("%s doesn't match, run with -update if the change is deliberate\nexpected:\n%s\nactual:\n%s",
+			path, string(expected), string(actual))
+	}
+}
+
+// AssertContract pins the shape of a chaincode response or event payload: the payload must match the golden file
+// testdata/<name>.json, the schema generated from the type of v must match the published schema/<name>.schema.json
+// and the payload must conform to that schema.
+func AssertContract(t *testing.T, name string, payload []byte, v interface{}) {
+	t.Helper()
+
+	schemaPath := filepath.Join("schema", name+".schema.json")
+	AssertGolden(t, filepath.Join("testdata", name+".json"), payload)
+	AssertSchema(t, schemaPath, name, v)
+
+	schema, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatalf("cannot read %s: %s", schemaPath, err.Error())
+	}
+	if err := ValidateSchema(schema, payload); err != nil {
+		t.Errorf("%s doesn't conform to %s: %s", name, schemaPath, err.Error())
+	}
+}
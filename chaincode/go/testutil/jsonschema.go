@@ -0,0 +1,194 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// GenerateSchema builds a JSON schema (draft-07) of the JSON encoding of v from its Go type. Fields are required
+// unless tagged omitempty and objects don't allow fields their types don't declare.
+func GenerateSchema(title string, v interface{}) ([]byte, error) {
+	schema, err := typeSchema(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	schema["$schema"] = schemaDraft
+	schema["title"] = title
+
+	result, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(result, '\n'), nil
+}
+
+func typeSchema(t reflect.Type) (map[string]interface{}, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes byte slices as base64 strings
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys of %s must be strings", t)
+		}
+		values, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	}
+
+	return nil, fmt.Errorf("type %s has no JSON schema", t)
+}
+
+func structSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		omitEmpty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+		}
+
+		schema, err := typeSchema(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", t.Name(), field.Name, err.Error())
+		}
+		properties[name] = schema
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, nil
+}
+
+// ValidateSchema checks the JSON document against a schema made by GenerateSchema. Only the keywords that
+// GenerateSchema emits are supported.
+func ValidateSchema(schema, document []byte) error {
+	var s, d interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return fmt.Errorf("invalid schema: %s", err.Error())
+	}
+	if err := json.Unmarshal(document, &d); err != nil {
+		return fmt.Errorf("invalid document: %s", err.Error())
+	}
+
+	return validate(s.(map[string]interface{}), d, "$")
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					return fmt.Errorf("%s: missing required field %s", path, name)
+				}
+			}
+		}
+		for name, field := range object {
+			if fieldSchema, ok := properties[name]; ok {
+				if err := validate(fieldSchema.(map[string]interface{}), field, path+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s: unexpected field %s", path, name)
+				}
+			case map[string]interface{}:
+				if err := validate(additional, field, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean", path)
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: expected an integer", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected a number", path)
+		}
+	}
+
+	return nil
+}
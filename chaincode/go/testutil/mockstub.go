@@ -0,0 +1,316 @@
+// Package testutil contains helpers for testing chaincodes in-process with shim.MockStub.
+//
+// shim.MockStub of Fabric 1.1 has no transaction creator, history database or rich queries, so any chaincode calling
+// GetCreatorOrganization panics under it and getHistoryForProduct-like functions fail. MockStub of this package
+// wraps the shim one and fills these gaps. Network connects such stubs across channels for cross-chaincode calls.
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// MockStub is shim.MockStub with a transaction creator, a history database and recorded events.
+type MockStub struct {
+	*shim.MockStub
+
+	// Creator is returned by GetCreator, set it with SetCreator.
+	Creator []byte
+	// Events holds all events set by invocations in the order they were set.
+	Events []*pb.ChaincodeEvent
+	// Now, if set, gives transaction timestamps instead of the wall clock.
+	Now func() time.Time
+	// RichQuery makes GetQueryResult evaluate CouchDB queries like a peer with CouchDB state database does,
+	// otherwise it fails the way it does on LevelDB.
+	RichQuery bool
+	// Transient is returned by GetTransient, set it to pass private inputs to the following transactions.
+	Transient map[string][]byte
+	// PrivateData holds private data collections by name, as the side database of a member peer does.
+	PrivateData map[string]map[string][]byte
+
+	cc       shim.Chaincode
+	args     [][]byte
+	history  map[string][]*queryresult.KeyModification
+	network  *Network
+	readOnly bool
+}
+
+// NewMockStub creates a stub for the chaincode cc.
+func NewMockStub(name string, cc shim.Chaincode) *MockStub {
+	return &MockStub{
+		MockStub: shim.NewMockStub(name, cc),
+		cc:       cc,
+		history:  make(map[string][]*queryresult.KeyModification),
+
+		PrivateData: make(map[string]map[string][]byte),
+	}
+}
+
+// SetCreator makes id the creator of the following transactions.
+func (stub *MockStub) SetCreator(id *Identity) error {
+	creator, err := id.Serialize()
+	if err != nil {
+		return err
+	}
+
+	stub.Creator = creator
+	return nil
+}
+
+// MockInit calls Init of the chaincode with the stub itself, so the overridden methods are visible to it.
+func (stub *MockStub) MockInit(uuid string, args [][]byte) pb.Response {
+	stub.args = args
+	stub.startTransaction(uuid)
+	response := stub.cc.Init(stub)
+	stub.MockTransactionEnd(uuid)
+	return response
+}
+
+// MockInvoke calls Invoke of the chaincode with the stub itself, so the overridden methods are visible to it.
+func (stub *MockStub) MockInvoke(uuid string, args [][]byte) pb.Response {
+	stub.args = args
+	stub.startTransaction(uuid)
+	response := stub.cc.Invoke(stub)
+	stub.MockTransactionEnd(uuid)
+	return response
+}
+
+// MockInvokeAs switches the creator to id and invokes the chaincode.
+func (stub *MockStub) MockInvokeAs(id *Identity, uuid string, args [][]byte) pb.Response {
+	if err := stub.SetCreator(id); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return stub.MockInvoke(uuid, args)
+}
+
+func (stub *MockStub) startTransaction(uuid string) {
+	stub.MockTransactionStart(uuid)
+	if stub.Now != nil {
+		now := stub.Now()
+		stub.TxTimestamp = &timestamp.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}
+	}
+}
+
+func (stub *MockStub) GetArgs() [][]byte {
+	return stub.args
+}
+
+func (stub *MockStub) GetStringArgs() []string {
+	args := make([]string, 0, len(stub.args))
+	for _, arg := range stub.args {
+		args = append(args, string(arg))
+	}
+
+	return args
+}
+
+func (stub *MockStub) GetFunctionAndParameters() (string, []string) {
+	args := stub.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+
+	return args[0], args[1:]
+}
+
+func (stub *MockStub) GetCreator() ([]byte, error) {
+	return stub.Creator, nil
+}
+
+func (stub *MockStub) PutState(key string, value []byte) error {
+	if stub.readOnly {
+		return nil
+	}
+
+	if err := stub.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+
+	stub.appendHistory(key, value, false)
+	return nil
+}
+
+func (stub *MockStub) DelState(key string) error {
+	if stub.readOnly {
+		return nil
+	}
+
+	if err := stub.MockStub.DelState(key); err != nil {
+		return err
+	}
+
+	stub.appendHistory(key, nil, true)
+	return nil
+}
+
+func (stub *MockStub) GetTransient() (map[string][]byte, error) {
+	return stub.Transient, nil
+}
+
+func (stub *MockStub) GetPrivateData(collection, key string) ([]byte, error) {
+	return stub.PrivateData[collection][key], nil
+}
+
+func (stub *MockStub) PutPrivateData(collection, key string, value []byte) error {
+	if stub.TxID == "" {
+		return errors.New("cannot PutPrivateData without a transaction")
+	}
+	if stub.readOnly {
+		return nil
+	}
+
+	if stub.PrivateData[collection] == nil {
+		stub.PrivateData[collection] = make(map[string][]byte)
+	}
+	stub.PrivateData[collection][key] = value
+	return nil
+}
+
+func (stub *MockStub) DelPrivateData(collection, key string) error {
+	if stub.readOnly {
+		return nil
+	}
+
+	delete(stub.PrivateData[collection], key)
+	return nil
+}
+
+func (stub *MockStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{modifications: stub.history[key]}, nil
+}
+
+// InvokeChaincode routes the call through the network of the stub if it was deployed to one and falls back to
+// the peers registered with MockPeerChaincode otherwise. Unlike shim.MockStub, a call to a chaincode which is not
+// registered fails instead of panicking, the way a call to a channel the peer hasn't joined does.
+func (stub *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	if stub.network == nil {
+		address := chaincodeName
+		if len(channel) > 0 {
+			address = chaincodeAddress(channel, chaincodeName)
+		}
+		if _, ok := stub.Invokables[address]; !ok {
+			return shim.Error(fmt.Sprintf("chaincode %s is not deployed", address))
+		}
+
+		return stub.MockStub.InvokeChaincode(chaincodeName, args, channel)
+	}
+
+	return stub.network.invoke(stub, chaincodeName, args, channel)
+}
+
+func (stub *MockStub) SetEvent(name string, payload []byte) error {
+	if len(name) == 0 {
+		return errors.New("event name can not be nil string")
+	}
+
+	if stub.readOnly {
+		return nil
+	}
+
+	stub.Events = append(stub.Events, &pb.ChaincodeEvent{TxId: stub.TxID, EventName: name, Payload: payload})
+	return nil
+}
+
+// LastEvent returns the most recently set event or nil if there is none.
+func (stub *MockStub) LastEvent() *pb.ChaincodeEvent {
+	if len(stub.Events) == 0 {
+		return nil
+	}
+
+	return stub.Events[len(stub.Events)-1]
+}
+
+func (stub *MockStub) appendHistory(key string, value []byte, isDelete bool) {
+	stub.history[key] = append(stub.history[key], &queryresult.KeyModification{
+		TxId:      stub.TxID,
+		Value:     value,
+		Timestamp: stub.TxTimestamp,
+		IsDelete:  isDelete,
+	})
+}
+
+// historyIterator returns modifications of a key from the oldest one, the way the Fabric 1.1 history database does.
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+	position      int
+	closed        bool
+}
+
+func (it *historyIterator) HasNext() bool {
+	return !it.closed && it.position < len(it.modifications)
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("history iterator has no element at position %d", it.position)
+	}
+
+	modification := it.modifications[it.position]
+	it.position++
+	return modification, nil
+}
+
+func (it *historyIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+// Args converts invocation arguments to the form MockInit and MockInvoke accept.
+func Args(args ...string) [][]byte {
+	result := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		result = append(result, []byte(arg))
+	}
+
+	return result
+}
+
+// SeedState puts the values straight into the ledger in one go, without transactions and history. It is meant for
+// benchmarks: PutState of shim.MockStub keeps keys in a sorted list and makes seeding a large ledger quadratic.
+func (stub *MockStub) SeedState(keys []string, values [][]byte) {
+	for i, key := range keys {
+		stub.State[key] = values[i]
+	}
+
+	sorted := make([]string, 0, len(stub.State))
+	for key := range stub.State {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	stub.Keys.Init()
+	for _, key := range sorted {
+		stub.Keys.PushBack(key)
+	}
+}
+
+// SeedHistory appends the values to the history of the key as if each one was written by a separate transaction.
+// The last value becomes the current state of the key, use SeedState to put many of them at once.
+func (stub *MockStub) SeedHistory(key string, values [][]byte) {
+	for _, value := range values {
+		number := len(stub.history[key])
+		stub.history[key] = append(stub.history[key], &queryresult.KeyModification{
+			TxId:      fmt.Sprintf("seed%d", number),
+			Value:     value,
+			Timestamp: &timestamp.Timestamp{Seconds: int64(number)},
+		})
+	}
+}
+
+// FixedClock returns a clock for MockStub.Now that starts at start and advances by step on every call.
+func FixedClock(start time.Time, step time.Duration) func() time.Time {
+	next := start
+	return func() time.Time {
+		now := next
+		next = next.Add(step)
+		return now
+	}
+}
@@ -0,0 +1,86 @@
+package testutil
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Network is a set of MockStubs deployed to channels under chaincode names. Stubs of a network call each other
+// through InvokeChaincode the way peers do: an invocation on the same channel may write, an invocation on another
+// channel is read-only and its writes are discarded.
+type Network struct {
+	stubs    map[string]*MockStub
+	txNumber int
+}
+
+// NewNetwork creates an empty network.
+func NewNetwork() *Network {
+	return &Network{stubs: make(map[string]*MockStub)}
+}
+
+// Deploy creates a stub of the chaincode cc named name on the channel and initializes it with args.
+func (network *Network) Deploy(channel, name string, cc shim.Chaincode, args ...string) (*MockStub, error) {
+	address := chaincodeAddress(channel, name)
+	if _, ok := network.stubs[address]; ok {
+		return nil, fmt.Errorf("chaincode %s is already deployed", address)
+	}
+
+	stub := NewMockStub(name, cc)
+	stub.ChannelID = channel
+	stub.network = network
+	network.stubs[address] = stub
+
+	if response := stub.MockInit(network.nextTxID(), Args(append([]string{"init"}, args...)...)); response.Status >= shim.ERRORTHRESHOLD {
+		return nil, fmt.Errorf("cannot instantiate chaincode %s: %s", address, response.Message)
+	}
+
+	return stub, nil
+}
+
+// Stub returns the stub of the chaincode name on the channel or nil if it isn't deployed.
+func (network *Network) Stub(channel, name string) *MockStub {
+	return network.stubs[chaincodeAddress(channel, name)]
+}
+
+// Invoke sends a transaction created by id to the chaincode name on the channel.
+func (network *Network) Invoke(channel, name string, id *Identity, args ...string) pb.Response {
+	stub := network.Stub(channel, name)
+	if stub == nil {
+		return shim.Error(fmt.Sprintf("chaincode %s is not deployed", chaincodeAddress(channel, name)))
+	}
+
+	return stub.MockInvokeAs(id, network.nextTxID(), Args(args...))
+}
+
+func (network *Network) nextTxID() string {
+	network.txNumber++
+	return fmt.Sprintf("tx%d", network.txNumber)
+}
+
+// invoke calls the chaincode on behalf of the caller stub within the caller transaction.
+func (network *Network) invoke(caller *MockStub, name string, args [][]byte, channel string) pb.Response {
+	if len(channel) == 0 {
+		channel = caller.ChannelID
+	}
+
+	callee := network.Stub(channel, name)
+	if callee == nil {
+		return shim.Error(fmt.Sprintf("chaincode %s is not deployed", chaincodeAddress(channel, name)))
+	}
+
+	creator := callee.Creator
+	callee.Creator = caller.Creator
+	callee.readOnly = channel != caller.ChannelID
+	defer func() {
+		callee.Creator = creator
+		callee.readOnly = false
+	}()
+
+	return callee.MockInvoke(caller.TxID, args)
+}
+
+func chaincodeAddress(channel, name string) string {
+	return name + "/" + channel
+}
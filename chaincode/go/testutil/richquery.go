@@ -0,0 +1,179 @@
+package testutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+)
+
+// couchQuery is the subset of CouchDB Mango queries GetQueryResult evaluates: equality selectors on top-level
+// fields, sort, limit, skip and fields. use_index is accepted and ignored.
+type couchQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []map[string]string    `json:"sort"`
+	Limit    *int                   `json:"limit"`
+	Skip     int                    `json:"skip"`
+	Fields   []string               `json:"fields"`
+	UseIndex interface{}            `json:"use_index"`
+}
+
+type couchDocument struct {
+	key   string
+	value map[string]interface{}
+}
+
+// GetQueryResult evaluates the query if RichQuery is set; otherwise it fails the way a peer with LevelDB state
+// database does.
+func (stub *MockStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	if !stub.RichQuery {
+		return nil, errors.New("ExecuteQuery not supported for leveldb")
+	}
+
+	var q couchQuery
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err.Error())
+	}
+	if q.Selector == nil {
+		return nil, errors.New("query must contain a selector")
+	}
+
+	// documents are visited in key order, the way CouchDB returns them without a sort
+	documents := []couchDocument{}
+	for element := stub.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+
+		var value map[string]interface{}
+		if json.Unmarshal(stub.State[key], &value) != nil {
+			// not a JSON document, CouchDB keeps it as an attachment
+			continue
+		}
+
+		matches, err := matchesSelector(q.Selector, value)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			documents = append(documents, couchDocument{key, value})
+		}
+	}
+
+	if len(q.Sort) > 0 {
+		sort.SliceStable(documents, func(i, j int) bool {
+			for _, order := range q.Sort {
+				for field, direction := range order {
+					c := compareJSON(documents[i].value[field], documents[j].value[field])
+					if c != 0 {
+						return c < 0 != (direction == "desc")
+					}
+				}
+			}
+			return false
+		})
+	}
+
+	if q.Skip >= len(documents) {
+		documents = nil
+	} else {
+		documents = documents[q.Skip:]
+	}
+	if q.Limit != nil && *q.Limit < len(documents) {
+		documents = documents[:*q.Limit]
+	}
+
+	results := make([]*queryresult.KV, 0, len(documents))
+	for _, document := range documents {
+		value := document.value
+		if len(q.Fields) > 0 {
+			value = map[string]interface{}{}
+			for _, field := range q.Fields {
+				if v, ok := document.value[field]; ok {
+					value[field] = v
+				}
+			}
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &queryresult.KV{Namespace: stub.Name, Key: document.key, Value: data})
+	}
+
+	return &stateIterator{results: results}, nil
+}
+
+func matchesSelector(selector, document map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		if operators, ok := condition.(map[string]interface{}); ok {
+			expected, ok := operators["$eq"]
+			if !ok || len(operators) != 1 {
+				return false, fmt.Errorf("unsupported selector on %s: only equality is emulated", field)
+			}
+			condition = expected
+		}
+
+		if actual, ok := document[field]; !ok || !reflect.DeepEqual(actual, condition) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// compareJSON orders values of the same JSON type, numbers and strings being the ones worth sorting by
+func compareJSON(a, b interface{}) int {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return 0
+}
+
+type stateIterator struct {
+	results  []*queryresult.KV
+	position int
+	closed   bool
+}
+
+func (it *stateIterator) HasNext() bool {
+	return !it.closed && it.position < len(it.results)
+}
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("query iterator has no element at position %d", it.position)
+	}
+
+	result := it.results[it.position]
+	it.position++
+	return result, nil
+}
+
+func (it *stateIterator) Close() error {
+	it.closed = true
+	return nil
+}
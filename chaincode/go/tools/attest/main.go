@@ -0,0 +1,82 @@
+// Command attest verifies an ownership attestation offline. The input is the proposal response of
+// attestOwnership of the reference chaincode as the peer sent it, serialized protobuf, e.g. as the client SDK
+// writes it:
+//
+//	attest -cert peer0.b.example.com-cert.pem [-product p1] [-nonce challenge] [response.pb]
+//
+// The certificate file holds the signing certificates of the peers trusted to endorse the attestation. The response
+// is read from standard input if no file is given. The attestation is written to standard output as JSON if the
+// signature is valid and the product and the nonce are the expected ones.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"attestation"
+)
+
+func main() {
+	cert := flag.String("cert", "", "PEM file with the signing certificates of the trusted peers")
+	productName := flag.String("product", "", "product the attestation must be about, any if empty")
+	nonce := flag.String("nonce", "", "challenge the attestation must carry, any if empty")
+	flag.Parse()
+
+	if len(*cert) == 0 {
+		fail(errors.New("trusted peer certificates are required, set them with -cert"))
+	}
+
+	data, err := ioutil.ReadFile(*cert)
+	if err != nil {
+		fail(err)
+	}
+	peers, err := attestation.ParseCertificates(data)
+	if err != nil {
+		fail(fmt.Errorf("%s: %s", *cert, err.Error()))
+	}
+
+	var response []byte
+	if flag.NArg() == 0 {
+		response, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		response, err = ioutil.ReadFile(flag.Arg(0))
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	statement, err := attestation.Verify(response, peers)
+	if err != nil {
+		fail(err)
+	}
+	if err := expect(statement, *productName, *nonce); err != nil {
+		fail(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(statement); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "attest:", err.Error())
+	os.Exit(1)
+}
+
+// expect checks the attestation is about the product and answers the challenge, when they are given
+func expect(statement attestation.Attestation, productName, nonce string) error {
+	if len(productName) > 0 && statement.Product != productName {
+		return fmt.Errorf("attestation is about product %s, not %s", statement.Product, productName)
+	}
+	if len(nonce) > 0 && statement.Nonce != nonce {
+		return fmt.Errorf("attestation answers challenge %q, not %q", statement.Nonce, nonce)
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"attestation"
+)
+
+func TestExpect(t *testing.T) {
+	statement := attestation.Attestation{Product: "p1", Owner: "b", TxId: "tx3", Nonce: "challenge"}
+
+	tests := []struct {
+		product string
+		nonce   string
+		valid   bool
+	}{
+		{"", "", true},
+		{"p1", "challenge", true},
+		{"p2", "", false},
+		{"", "other", false},
+		{"p1", "challeng", false},
+	}
+
+	for _, test := range tests {
+		if err := expect(statement, test.product, test.nonce); (err == nil) != test.valid {
+			t.Errorf("product %q, nonce %q: expected valid %v, got %v", test.product, test.nonce, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpoint is what the export has durably written: the bookmark of the next page of every source and the size
+// of every output file after the last committed page. Resuming cuts the files to these sizes, so a page written
+// but not recorded is not duplicated.
+type checkpoint struct {
+	Format  string                  `json:"format"`
+	History bool                    `json:"history"`
+	Sources map[string]*sourceState `json:"sources"`
+	Files   map[string]int64        `json:"files"`
+}
+
+type sourceState struct {
+	Bookmark string `json:"bookmark"`
+	Records  int    `json:"records"`
+	Done     bool   `json:"done"`
+}
+
+func newCheckpoint(format string, history bool) *checkpoint {
+	return &checkpoint{
+		Format:  format,
+		History: history,
+		Sources: map[string]*sourceState{},
+		Files:   map[string]int64{},
+	}
+}
+
+// loadCheckpoint reads the checkpoint at path, it returns nil if there is none.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCheckpoint("", false)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *checkpoint) source(id string) *sourceState {
+	state, ok := c.Sources[id]
+	if !ok {
+		state = &sourceState{}
+		c.Sources[id] = state
+	}
+
+	return state
+}
+
+// save replaces the checkpoint at path atomically: it is written next to it and renamed.
+func (c *checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	productsOutput        = "products"
+	productHistoryOutput  = "product-history"
+	transfersOutput       = "transfers"
+	transferHistoryOutput = "transfer-history"
+)
+
+// Querier evaluates a query function of a chaincode on a channel and returns its payload.
+type Querier interface {
+	Query(channel, chaincode, function string, args ...string) ([]byte, error)
+}
+
+// source is a chaincode export function paged through to the end
+type source struct {
+	channel   string
+	chaincode string
+	function  string
+}
+
+func (s source) id() string {
+	return s.chaincode + "@" + s.channel
+}
+
+// exporter writes products of the common channel and transfers of the bilateral channels to files in dir.
+type exporter struct {
+	querier        Querier
+	dir            string
+	format         string
+	history        bool
+	pageSize       int
+	checkpointPath string
+	commonChannel  string
+	channels       []string
+	log            io.Writer
+
+	checkpoint *checkpoint
+	outputs    map[string]*output
+}
+
+func (e *exporter) sources() []source {
+	sources := []source{{channel: e.commonChannel, chaincode: "reference", function: "exportProducts"}}
+	for _, channel := range e.channels {
+		sources = append(sources, source{channel: channel, chaincode: "relationship", function: "exportTransfers"})
+	}
+
+	return sources
+}
+
+// run exports every source page by page, committing the checkpoint after each one. If the checkpoint exists
+// the export resumes from it.
+func (e *exporter) run() error {
+	c, err := loadCheckpoint(e.checkpointPath)
+	if err != nil {
+		return fmt.Errorf("cannot read checkpoint %s: %s", e.checkpointPath, err.Error())
+	}
+
+	resume := c != nil
+	if !resume {
+		c = newCheckpoint(e.format, e.history)
+	} else if c.Format != e.format || c.History != e.history {
+		return fmt.Errorf("checkpoint %s was made for format %s with history %t, remove it to start over",
+			e.checkpointPath, c.Format, c.History)
+	}
+	e.checkpoint = c
+
+	if err := e.openOutputs(resume); err != nil {
+		return err
+	}
+	defer e.closeOutputs()
+
+	for _, s := range e.sources() {
+		if err := e.export(s); err != nil {
+			return fmt.Errorf("cannot export %s: %s", s.id(), err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (e *exporter) openOutputs(resume bool) error {
+	columns := map[string][]string{productsOutput: productColumns, transfersOutput: transferColumns}
+	if e.history {
+		columns[productHistoryOutput] = productHistoryColumns
+		columns[transferHistoryOutput] = transferHistoryColumns
+	}
+
+	e.outputs = map[string]*output{}
+	for name, c := range columns {
+		o, err := openOutput(e.dir, name, e.format, c, e.checkpoint.Files[name], resume)
+		if err != nil {
+			e.closeOutputs()
+			return fmt.Errorf("cannot open output %s: %s", name, err.Error())
+		}
+		e.outputs[name] = o
+	}
+
+	return nil
+}
+
+func (e *exporter) closeOutputs() {
+	for _, o := range e.outputs {
+		o.Close()
+	}
+}
+
+func (e *exporter) export(s source) error {
+	state := e.checkpoint.source(s.id())
+
+	for !state.Done {
+		payload, err := e.querier.Query(s.channel, s.chaincode, s.function,
+			strconv.Itoa(e.pageSize), state.Bookmark, strconv.FormatBool(e.history))
+		if err != nil {
+			return err
+		}
+
+		var p page
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("cannot unmarshal page at bookmark %q: %s", state.Bookmark, err.Error())
+		}
+		if len(p.Bookmark) > 0 && p.Bookmark == state.Bookmark {
+			return errors.New("bookmark doesn't advance: " + p.Bookmark)
+		}
+
+		for _, record := range p.Records {
+			if err := e.write(s, record); err != nil {
+				return err
+			}
+		}
+
+		// the checkpoint goes after the data: if it isn't saved, resuming cuts the page off and reads it again
+		for name, o := range e.outputs {
+			size, err := o.Commit()
+			if err != nil {
+				return fmt.Errorf("cannot write output %s: %s", name, err.Error())
+			}
+			e.checkpoint.Files[name] = size
+		}
+		state.Bookmark, state.Records, state.Done = p.Bookmark, state.Records+len(p.Records), len(p.Bookmark) == 0
+		if err := e.checkpoint.save(e.checkpointPath); err != nil {
+			return fmt.Errorf("cannot save checkpoint: %s", err.Error())
+		}
+
+		fmt.Fprintf(e.log, "%s: %d records\n", s.id(), state.Records)
+	}
+
+	return nil
+}
+
+func (e *exporter) write(s source, record json.RawMessage) error {
+	var current row
+	var history []row
+	var currentOutput, historyOutput string
+
+	if s.function == "exportProducts" {
+		var r productRecord
+		if err := json.Unmarshal(record, &r); err != nil {
+			return fmt.Errorf("cannot unmarshal product: %s", err.Error())
+		}
+		current, history = productRows(r)
+		currentOutput, historyOutput = productsOutput, productHistoryOutput
+	} else {
+		var r transferRecord
+		if err := json.Unmarshal(record, &r); err != nil {
+			return fmt.Errorf("cannot unmarshal transfer: %s", err.Error())
+		}
+		current, history = transferRows(s.channel, r)
+		currentOutput, historyOutput = transfersOutput, transferHistoryOutput
+	}
+
+	if err := e.outputs[currentOutput].Write(current); err != nil {
+		return err
+	}
+	if !e.history {
+		return nil
+	}
+	for _, r := range history {
+		if err := e.outputs[historyOutput].Write(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"reference/product"
+	"testutil"
+)
+
+// relationshipStub pages through transfers it was created with, sorted by unique product keys, after the key of
+// the last transfer of the previous page the way exportTransfers does
+type relationshipStub struct {
+	transfers []transferRecord
+}
+
+func (r *relationshipStub) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (r *relationshipStub) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	pageSize, _ := strconv.Atoi(args[0])
+	withHistory, _ := strconv.ParseBool(args[2])
+
+	response := struct {
+		Records  []transferRecord `json:"records"`
+		Bookmark string           `json:"bookmark"`
+	}{Records: []transferRecord{}}
+	for _, record := range r.transfers {
+		if record.Key.ProductKey <= args[1] {
+			continue
+		}
+		if len(response.Records) == pageSize {
+			response.Bookmark = response.Records[pageSize-1].Key.ProductKey
+			break
+		}
+		if !withHistory {
+			record.History = nil
+		}
+		response.Records = append(response.Records, record)
+	}
+
+	payload, _ := json.Marshal(response)
+	return shim.Success(payload)
+}
+
+// networkQuerier queries a test network and fails the call number failAt, if set, like a dropped connection
+type networkQuerier struct {
+	network  *testutil.Network
+	identity *testutil.Identity
+	calls    int
+	failAt   int
+}
+
+func (q *networkQuerier) Query(channel, chaincode, function string, args ...string) ([]byte, error) {
+	q.calls++
+	if q.calls == q.failAt {
+		return nil, errors.New("connection reset by peer")
+	}
+
+	response := q.network.Invoke(channel, chaincode, q.identity, append([]string{function}, args...)...)
+	if response.Status >= 400 {
+		return nil, errors.New(response.Message)
+	}
+	return response.Payload, nil
+}
+
+func newQuerier(t *testing.T) *networkQuerier {
+	identity, err := testutil.NewIdentity("a")
+	if err != nil {
+		t.Fatalf("cannot generate identity: %s", err.Error())
+	}
+
+	network := testutil.NewNetwork()
+	stub, err := network.Deploy("common", "reference", new(product.ProductChaincode))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// history carries transaction times, so two exports of ledgers built in different seconds would differ
+	stub.Now = testutil.FixedClock(time.Unix(1000, 0), time.Second)
+
+	q := &networkQuerier{network: network, identity: identity}
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("p%d", i)
+		q.mustInvoke(t, "initProduct", name, "desc, \"quoted\"", "1", "a", "100")
+		if i%2 == 0 {
+			q.mustInvoke(t, "updateOwner", name, "a", "b", "200")
+		}
+	}
+
+	var transfers []transferRecord
+	for i := 0; i < 3; i++ {
+		key := transferKey{ProductKey: fmt.Sprintf("p%d", 2*i), RequestSender: "b", RequestReceiver: "a"}
+		record := transferRecord{Key: key, Value: transferValue{Status: "Accepted", Timestamp: 150}}
+		for _, status := range []string{"Initiated", "Accepted"} {
+			record.History = append(record.History, transferModification{Key: key,
+				Value: transferValue{Status: status, Timestamp: 150}, TxId: key.ProductKey + status, Timestamp: 150})
+		}
+		transfers = append(transfers, record)
+	}
+	if _, err := network.Deploy("a-b", "relationship", &relationshipStub{transfers: transfers}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return q
+}
+
+func (q *networkQuerier) mustInvoke(t *testing.T, args ...string) {
+	if response := q.network.Invoke("common", "reference", q.identity, args...); response.Status >= 400 {
+		t.Fatalf("%s failed: %s", args[0], response.Message)
+	}
+}
+
+func newExporter(t *testing.T, querier Querier, format string) *exporter {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return &exporter{
+		querier:        querier,
+		dir:            dir,
+		format:         format,
+		history:        true,
+		pageSize:       2,
+		checkpointPath: filepath.Join(dir, "export.checkpoint.json"),
+		commonChannel:  "common",
+		channels:       []string{"a-b"},
+		log:            ioutil.Discard,
+	}
+}
+
+func readOutput(t *testing.T, e *exporter, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(e.dir, name+"."+e.format))
+	if err != nil {
+		t.Fatalf("cannot read output %s: %s", name, err.Error())
+	}
+	return string(data)
+}
+
+func TestExportJSONLines(t *testing.T) {
+	e := newExporter(t, newQuerier(t), formatJSONLines)
+	if err := e.run(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	names := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(readOutput(t, e, productsOutput)), "\n") {
+		var p product.Product
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			t.Fatalf("invalid product line %q: %s", line, err.Error())
+		}
+		names = append(names, p.Key.Name+":"+p.Value.Owner)
+	}
+	if expected := []string{"p0:b", "p1:a", "p2:b", "p3:a", "p4:b"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected products %v, got %v", expected, names)
+	}
+
+	// the product history is the dump the snapshot tool reads
+	modifications := strings.Split(strings.TrimSpace(readOutput(t, e, productHistoryOutput)), "\n")
+	if len(modifications) != 8 {
+		t.Errorf("expected 8 product modifications, got %d", len(modifications))
+	}
+	for _, line := range modifications {
+		var modification product.ProductModification
+		if err := json.Unmarshal([]byte(line), &modification); err != nil || len(modification.TxId) == 0 {
+			t.Errorf("invalid product history line %q", line)
+		}
+	}
+
+	transfers := strings.Split(strings.TrimSpace(readOutput(t, e, transfersOutput)), "\n")
+	history := strings.Split(strings.TrimSpace(readOutput(t, e, transferHistoryOutput)), "\n")
+	if len(transfers) != 3 || len(history) != 6 {
+		t.Fatalf("expected 3 transfers with 6 modifications, got %d and %d", len(transfers), len(history))
+	}
+	if !strings.HasPrefix(transfers[0], `{"channel":"a-b","key":{"productKey":"p0"`) {
+		t.Errorf("transfer line doesn't start with its channel and key: %s", transfers[0])
+	}
+
+	c, err := loadCheckpoint(e.checkpointPath)
+	if err != nil || c == nil {
+		t.Fatalf("cannot load checkpoint: %v", err)
+	}
+	for id, records := range map[string]int{"reference@common": 5, "relationship@a-b": 3} {
+		if state := c.Sources[id]; state == nil || !state.Done || state.Records != records {
+			t.Errorf("%s: expected %d records done, got %+v", id, records, state)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	e := newExporter(t, newQuerier(t), formatCSV)
+	if err := e.run(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	for name, columns := range map[string][]string{
+		productsOutput:        productColumns,
+		productHistoryOutput:  productHistoryColumns,
+		transfersOutput:       transferColumns,
+		transferHistoryOutput: transferHistoryColumns,
+	} {
+		rows, err := csv.NewReader(strings.NewReader(readOutput(t, e, name))).ReadAll()
+		if err != nil {
+			t.Fatalf("%s is not valid CSV: %s", name, err.Error())
+		}
+		if !reflect.DeepEqual(rows[0], columns) {
+			t.Errorf("%s: expected header %v, got %v", name, columns, rows[0])
+		}
+		if len(rows) < 2 {
+			t.Errorf("%s has no records", name)
+		}
+	}
+
+	rows, _ := csv.NewReader(strings.NewReader(readOutput(t, e, productsOutput))).ReadAll()
+	if expected := []string{"p0", "product", "desc, \"quoted\"", "1", "200", "b"}; !reflect.DeepEqual(rows[1], expected) {
+		t.Errorf("expected the first product %v, got %v", expected, rows[1])
+	}
+}
+
+func TestExportResume(t *testing.T) {
+	for _, format := range []string{formatJSONLines, formatCSV} {
+		for failAt := 1; failAt <= 5; failAt++ {
+			t.Run(fmt.Sprintf("%s/%d", format, failAt), func(t *testing.T) {
+				complete := newExporter(t, newQuerier(t), format)
+				if err := complete.run(); err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+
+				querier := newQuerier(t)
+				querier.failAt = failAt
+				e := newExporter(t, querier, format)
+				if err := e.run(); err == nil || !strings.Contains(err.Error(), "connection reset") {
+					t.Fatalf("expected the export to be interrupted, got %v", err)
+				}
+
+				// a page written after the last checkpoint must not end up in the output twice
+				file, err := os.OpenFile(filepath.Join(e.dir, productsOutput+"."+format), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				file.WriteString("not committed\n")
+				file.Close()
+
+				if err := e.run(); err != nil {
+					t.Fatalf("unexpected error on resume: %s", err.Error())
+				}
+
+				for _, name := range []string{productsOutput, productHistoryOutput, transfersOutput, transferHistoryOutput} {
+					if expected, actual := readOutput(t, complete, name), readOutput(t, e, name); expected != actual {
+						t.Errorf("%s differs from an uninterrupted export:\n%s\nvs\n%s", name, actual, expected)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestExportCheckpointMismatch(t *testing.T) {
+	e := newExporter(t, newQuerier(t), formatJSONLines)
+	if err := e.run(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	e.format = formatCSV
+	if err := e.run(); err == nil || !strings.Contains(err.Error(), "remove it to start over") {
+		t.Errorf("expected an error about the checkpoint, got %v", err)
+	}
+
+	// an export which is done has nothing left to query
+	e.format = formatJSONLines
+	e.querier = &networkQuerier{failAt: 1}
+	before := readOutput(t, e, productsOutput)
+	if err := e.run(); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+	if after := readOutput(t, e, productsOutput); before != after {
+		t.Errorf("a finished export must not change its output")
+	}
+}
+
+func TestSplitChannels(t *testing.T) {
+	if channels := splitChannels(" a-b, ,a-c "); !reflect.DeepEqual(channels, []string{"a-b", "a-c"}) {
+		t.Errorf("expected [a-b a-c], got %v", channels)
+	}
+}
@@ -0,0 +1,89 @@
+// Command export extracts products of the common channel and ownership transfers of bilateral channels, with
+// their history on request, through the REST API of an organization. It pages through the exportProducts
+// function of the reference chaincode and exportTransfers of the relationship chaincode and writes, to the output
+// directory, products, transfers, product-history and transfer-history as JSON Lines or CSV with a fixed column
+// order. Product history in JSON Lines is the ledger dump the snapshot tool reads.
+//
+// After every page the export saves a checkpoint. Run it again with the same flags to resume an interrupted
+// export; remove the checkpoint to start over.
+//
+// Usage:
+//
+//	export -api http://localhost:4000 -org a -channels a-b,a-c -format csv -history -out /data/extract
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	api := flag.String("api", "http://localhost:4000", "address of the REST API of the organization")
+	org := flag.String("org", "a", "organization to log in to")
+	user := flag.String("user", "export", "user to log in as")
+	peer := flag.String("peer", "", "peer to query, <org>/peer0 if empty")
+	commonChannel := flag.String("common", "common", "channel of the reference chaincode")
+	channels := flag.String("channels", "", "comma-separated bilateral channels to export transfers of, e.g. a-b,a-c")
+	format := flag.String("format", formatJSONLines, "output format: jsonl or csv")
+	history := flag.Bool("history", false, "export history of products and transfers as well")
+	pageSize := flag.Int("page-size", 1000, "records per query, at most 1000")
+	dir := flag.String("out", ".", "directory to write the files to")
+	checkpointPath := flag.String("checkpoint", "", "checkpoint file, export.checkpoint.json in the output directory if empty")
+	flag.Parse()
+
+	if *format != formatJSONLines && *format != formatCSV {
+		fail(fmt.Errorf("format is invalid: %s (must be %s or %s)", *format, formatJSONLines, formatCSV))
+	}
+	if *pageSize <= 0 || *pageSize > 1000 {
+		fail(fmt.Errorf("page size is invalid: %d (must be from 1 to 1000)", *pageSize))
+	}
+	if len(*peer) == 0 {
+		*peer = *org + "/peer0"
+	}
+	if len(*checkpointPath) == 0 {
+		*checkpointPath = filepath.Join(*dir, "export.checkpoint.json")
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fail(err)
+	}
+
+	client, err := newRESTClient(*api, *user, *org, *peer)
+	if err != nil {
+		fail(err)
+	}
+
+	e := &exporter{
+		querier:        client,
+		dir:            *dir,
+		format:         *format,
+		history:        *history,
+		pageSize:       *pageSize,
+		checkpointPath: *checkpointPath,
+		commonChannel:  *commonChannel,
+		channels:       splitChannels(*channels),
+		log:            os.Stderr,
+	}
+	if err := e.run(); err != nil {
+		fail(err)
+	}
+}
+
+func splitChannels(value string) []string {
+	channels := []string{}
+	for _, channel := range strings.Split(value, ",") {
+		if channel = strings.TrimSpace(channel); len(channel) > 0 {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "export:", err.Error())
+	os.Exit(1)
+}
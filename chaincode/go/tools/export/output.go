@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	formatJSONLines = "jsonl"
+	formatCSV       = "csv"
+)
+
+// output is a file of the export. Writes are buffered until Commit, which makes them durable and returns
+// the size of the file to record in the checkpoint.
+type output struct {
+	file    *os.File
+	buffer  *bufio.Writer
+	csv     *csv.Writer
+	encoder *json.Encoder
+}
+
+// openOutput creates the file name.<format> in dir or, when resuming, cuts it to the size committed
+// before the interruption and appends to it.
+func openOutput(dir, name, format string, columns []string, size int64, resume bool) (*output, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if !resume {
+		flags |= os.O_TRUNC
+		size = 0
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, name+"."+format), flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	o := &output{file: file, buffer: bufio.NewWriter(file)}
+	if format == formatCSV {
+		o.csv = csv.NewWriter(o.buffer)
+		if size == 0 {
+			if err := o.csv.Write(columns); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	} else {
+		o.encoder = json.NewEncoder(o.buffer)
+	}
+
+	return o, nil
+}
+
+func (o *output) Write(r row) error {
+	if o.csv != nil {
+		return o.csv.Write(r.fields)
+	}
+
+	return o.encoder.Encode(r.document)
+}
+
+// Commit flushes and syncs everything written so far and returns the size of the file.
+func (o *output) Commit() (int64, error) {
+	if o.csv != nil {
+		o.csv.Flush()
+		if err := o.csv.Error(); err != nil {
+			return 0, err
+		}
+	}
+	if err := o.buffer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := o.file.Sync(); err != nil {
+		return 0, err
+	}
+
+	return o.file.Seek(0, io.SeekCurrent)
+}
+
+func (o *output) Close() error {
+	return o.file.Close()
+}
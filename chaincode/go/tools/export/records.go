@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"reference/product"
+)
+
+// Columns of CSV files. They only ever get new columns appended, so that loaders can rely on positions.
+var (
+	productColumns        = []string{"name", "docType", "desc", "state", "lastUpdated", "owner"}
+	productHistoryColumns = []string{"name", "txId", "txTimestamp", "isDelete",
+		"docType", "desc", "state", "lastUpdated", "owner"}
+	transferColumns = []string{"channel", "productKey", "requestSender", "requestReceiver",
+		"status", "message", "timestamp"}
+	transferHistoryColumns = []string{"channel", "productKey", "requestSender", "requestReceiver", "txId",
+		"txTimestamp", "isDelete", "status", "message", "timestamp"}
+)
+
+// row is a record in both output formats: a JSON document for JSON Lines and fields for CSV
+type row struct {
+	document interface{}
+	fields   []string
+}
+
+// productRecord is an element of the exportProducts response of the reference chaincode
+type productRecord struct {
+	Key     product.ProductKey            `json:"key"`
+	Value   product.ProductValue          `json:"value"`
+	History []product.ProductModification `json:"history"`
+}
+
+// transferKey and transferValue mirror TransferDetails of the relationship chaincode
+type transferKey struct {
+	ProductKey      string `json:"productKey"`
+	RequestSender   string `json:"requestSender"`
+	RequestReceiver string `json:"requestReceiver"`
+}
+
+type transferValue struct {
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type transferModification struct {
+	Channel   string        `json:"channel"`
+	Key       transferKey   `json:"key"`
+	Value     transferValue `json:"value"`
+	TxId      string        `json:"txId"`
+	Timestamp int64         `json:"timestamp"`
+	IsDelete  bool          `json:"isDelete"`
+}
+
+// transferRecord is an element of the exportTransfers response of the relationship chaincode
+type transferRecord struct {
+	Channel string                 `json:"channel"`
+	Key     transferKey            `json:"key"`
+	Value   transferValue          `json:"value"`
+	History []transferModification `json:"history,omitempty"`
+}
+
+// page is a response of exportProducts and exportTransfers with records left undecoded
+type page struct {
+	Records  []json.RawMessage `json:"records"`
+	Bookmark string            `json:"bookmark"`
+}
+
+func productRows(record productRecord) (current row, history []row) {
+	value := record.Value
+	current = row{
+		document: product.Product{Key: record.Key, Value: value},
+		fields: []string{record.Key.Name, value.ObjectType, value.Desc, strconv.Itoa(value.State),
+			strconv.Itoa(value.LastUpdated), value.Owner},
+	}
+
+	for _, modification := range record.History {
+		value := modification.Value
+		history = append(history, row{
+			document: modification,
+			fields: []string{modification.Key.Name, modification.TxId, formatInt(modification.Timestamp),
+				strconv.FormatBool(modification.IsDelete), value.ObjectType, value.Desc, strconv.Itoa(value.State),
+				strconv.Itoa(value.LastUpdated), value.Owner},
+		})
+	}
+
+	return current, history
+}
+
+func transferRows(channel string, record transferRecord) (current row, history []row) {
+	key, value := record.Key, record.Value
+	current = row{
+		document: transferRecord{Channel: channel, Key: key, Value: value},
+		fields: []string{channel, key.ProductKey, key.RequestSender, key.RequestReceiver, value.Status,
+			value.Message, formatInt(value.Timestamp)},
+	}
+
+	for _, modification := range record.History {
+		modification.Channel = channel
+		key, value := modification.Key, modification.Value
+		history = append(history, row{
+			document: modification,
+			fields: []string{channel, key.ProductKey, key.RequestSender, key.RequestReceiver, modification.TxId,
+				formatInt(modification.Timestamp), strconv.FormatBool(modification.IsDelete), value.Status,
+				value.Message, formatInt(value.Timestamp)},
+		})
+	}
+
+	return current, history
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// restClient queries chaincodes through the REST API of an organization, the one the web client uses.
+type restClient struct {
+	api    string
+	peer   string
+	token  string
+	client *http.Client
+}
+
+// newRESTClient logs in to the API as the user of the organization and queries on the peer, e.g. a/peer0.
+func newRESTClient(api, user, org, peer string) (*restClient, error) {
+	c := &restClient{api: strings.TrimSuffix(api, "/"), peer: peer, client: &http.Client{Timeout: 5 * time.Minute}}
+
+	body, err := json.Marshal(map[string]string{"username": user, "orgName": org})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.client.Post(c.api+"/users", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	data, err := readResponse(response)
+	if err != nil {
+		return nil, fmt.Errorf("cannot log in as %s of %s: %s", user, org, err.Error())
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &login); err != nil || len(login.Token) == 0 {
+		return nil, fmt.Errorf("cannot log in as %s of %s: no token in the response", user, org)
+	}
+	c.token = login.Token
+
+	return c, nil
+}
+
+// Query sends arguments comma-separated the way the web client does, so they must not contain commas.
+func (c *restClient) Query(channel, chaincode, function string, args ...string) ([]byte, error) {
+	for _, arg := range args {
+		if strings.Contains(arg, ",") {
+			return nil, fmt.Errorf("argument %q cannot be passed to the REST API", arg)
+		}
+	}
+
+	query := url.Values{}
+	query.Set("peer", c.peer)
+	query.Set("fcn", function)
+	query.Set("args", strings.Join(args, ","))
+
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/channels/%s/chaincodes/%s?%s",
+		c.api, url.PathEscape(channel), url.PathEscape(chaincode), query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return readResponse(response)
+}
+
+func readResponse(response *http.Response) ([]byte, error) {
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRESTClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/users":
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["username"] != "export" || login["orgName"] != "a" {
+				http.Error(w, `{"message":"unknown user"}`, http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"success":true,"token":"secret"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/channels/common/chaincodes/reference":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			query := r.URL.Query()
+			w.Write([]byte(`{"peer":"` + query.Get("peer") + `","fcn":"` + query.Get("fcn") +
+				`","args":"` + query.Get("args") + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := newRESTClient(server.URL, "intruder", "a", "a/peer0"); err == nil {
+		t.Errorf("expected an error logging in as an unknown user")
+	}
+
+	client, err := newRESTClient(server.URL+"/", "export", "a", "a/peer0")
+	if err != nil {
+		t.Fatalf("cannot log in: %s", err.Error())
+	}
+
+	payload, err := client.Query("common", "reference", "exportProducts", "100", "", "true")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if expected := `{"peer":"a/peer0","fcn":"exportProducts","args":"100,,true"}`; string(payload) != expected {
+		t.Errorf("expected %s, got %s", expected, payload)
+	}
+
+	if _, err := client.Query("a-b", "relationship", "exportTransfers"); err == nil ||
+		!strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the status of the response in the error, got %v", err)
+	}
+	if _, err := client.Query("common", "reference", "readProduct", "a,b"); err == nil {
+		t.Errorf("expected an error for an argument with a comma")
+	}
+}
@@ -0,0 +1,113 @@
+// Command snapshot replays a ledger dump of product history to tell which products owners held at a given time,
+// the same way getInventorySnapshot of the reference chaincode does on a peer. The dump is JSON Lines, one product
+// modification per line, with the modifications of each product oldest first:
+//
+//	{"key":{"name":"p1"},"value":{"owner":"a",...},"txId":"...","timestamp":1519905600,"isDelete":false}
+//
+// Usage:
+//
+//	snapshot -at 2018-03-31T23:59:59Z [-owner a] [dump.jsonl ...]
+//
+// Files are read in order, standard input if there are none. The snapshot is written to standard output as JSON.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"reference/product"
+)
+
+// maxLineSize bounds a line of the dump, a product modification is far smaller
+const maxLineSize = 1 << 20
+
+func main() {
+	at := flag.String("at", "", "time of the snapshot, RFC 3339 or Unix seconds")
+	owner := flag.String("owner", "", "organization to make the snapshot for, all of them if empty")
+	flag.Parse()
+
+	asOf, err := parseTime(*at)
+	if err != nil {
+		fail(err)
+	}
+
+	replay := product.NewInventoryReplay(asOf, strings.ToLower(*owner))
+
+	if flag.NArg() == 0 {
+		if err := readDump(os.Stdin, "stdin", replay); err != nil {
+			fail(err)
+		}
+	}
+	for _, name := range flag.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			fail(err)
+		}
+		err = readDump(file, name, replay)
+		file.Close()
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(replay.Snapshot()); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "snapshot:", err.Error())
+	os.Exit(1)
+}
+
+// parseTime takes Unix seconds, the form transaction timestamps are compared in, or an RFC 3339 time
+func parseTime(value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, errors.New("time of the snapshot is required, set it with -at")
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("time of the snapshot is invalid: %s (must be RFC 3339 or Unix seconds)", value)
+	}
+
+	return t.Unix(), nil
+}
+
+// readDump applies every product modification of the dump to the replay. Empty lines are skipped.
+func readDump(reader io.Reader, name string, replay *product.InventoryReplay) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var modification product.ProductModification
+		if err := json.Unmarshal(scanner.Bytes(), &modification); err != nil {
+			return fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+		if len(modification.Key.Name) == 0 {
+			return fmt.Errorf("%s:%d: product key is missing", name, line)
+		}
+
+		replay.Apply(modification)
+	}
+
+	return scanner.Err()
+}
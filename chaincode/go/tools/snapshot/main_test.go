@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"reference/product"
+)
+
+const dump = `{"key":{"name":"p1"},"value":{"owner":"a"},"txId":"tx1","timestamp":100}
+{"key":{"name":"p2"},"value":{"owner":"b"},"txId":"tx2","timestamp":150}
+
+{"key":{"name":"p1"},"value":{"owner":"b"},"txId":"tx3","timestamp":200}
+{"key":{"name":"p2"},"txId":"tx4","timestamp":250,"isDelete":true}
+`
+
+func TestReadDump(t *testing.T) {
+	tests := []struct {
+		asOf     int64
+		owner    string
+		expected string
+	}{
+		{99, "", ""},
+		{150, "", "a:p1@tx1 b:p2@tx2"},
+		{200, "", "b:p1@tx3 b:p2@tx2"},
+		{300, "", "b:p1@tx3"},
+		{150, "b", "b:p2@tx2"},
+	}
+
+	for _, test := range tests {
+		replay := product.NewInventoryReplay(test.asOf, test.owner)
+		if err := readDump(strings.NewReader(dump), "dump", replay); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		held := []string{}
+		for _, inventory := range replay.Snapshot().Inventories {
+			for _, p := range inventory.Products {
+				held = append(held, inventory.Owner+":"+p.Key.Name+"@"+p.TxId)
+			}
+		}
+		if strings.Join(held, " ") != test.expected {
+			t.Errorf("as of %d for %q: expected %q, got %q", test.asOf, test.owner, test.expected,
+				strings.Join(held, " "))
+		}
+	}
+}
+
+func TestReadDumpErrors(t *testing.T) {
+	for _, dump := range []string{"{\"key\":{\"name\":\"p1\"}}\nnot json\n", "{\"txId\":\"tx1\"}\n"} {
+		err := readDump(strings.NewReader(dump), "dump", product.NewInventoryReplay(0, ""))
+		if err == nil || !strings.HasPrefix(err.Error(), "dump:") {
+			t.Errorf("expected an error with the line of the dump, got %v", err)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		ok       bool
+	}{
+		{"1519905600", 1519905600, true},
+		{"2018-03-01T12:00:00Z", 1519905600, true},
+		{"2018-03-01T14:00:00+02:00", 1519905600, true},
+		{"", 0, false},
+		{"yesterday", 0, false},
+	}
+
+	for _, test := range tests {
+		seconds, err := parseTime(test.value)
+		if (err == nil) != test.ok || seconds != test.expected {
+			t.Errorf("%q: expected %d (ok %t), got %d, %v", test.value, test.expected, test.ok, seconds, err)
+		}
+	}
+}
@@ -39,10 +39,10 @@ function getAll() {
   }
 }
 
-function add(product, comment) {
+function add(product, terms) {
   return dispatch => {
     dispatch(request());
-    requestService.add(product, comment)
+    requestService.add(product, terms)
       .then(
         _ => {
           dispatch(success());
@@ -68,10 +68,10 @@ function add(product, comment) {
   }
 }
 
-function edit(req, comment) {
+function edit(req, terms) {
   return dispatch => {
     dispatch(request());
-    requestService.edit(req, comment)
+    requestService.edit(req, terms)
       .then(
         product => {
           dispatch(success());
@@ -9,7 +9,7 @@ class AddRequest extends React.Component {
 
     this.state = {
       request: {
-        comment: '',
+        terms: '',
         created: false
       },
       submitted: false
@@ -23,8 +23,8 @@ class AddRequest extends React.Component {
   }
 
   _fillRequest() {
+    // the terms are private, an edit sends them again in full
     if(this.props.initData && this.props.initData.key.productKey) {
-      this.state.request.comment = this.props.initData.value.message;
       this.state.request.created = true;
     }
   }
@@ -46,8 +46,8 @@ class AddRequest extends React.Component {
 
     this.setState({submitted: true});
     const {request} = this.state;
-    if (request.comment) {
-      this.props.dispatch(requestActions[request.created ? 'edit' : 'add'](this.props.initData, request.comment));
+    if (request.terms) {
+      this.props.dispatch(requestActions[request.created ? 'edit' : 'add'](this.props.initData, request.terms));
     }
   }
 
@@ -57,12 +57,13 @@ class AddRequest extends React.Component {
     return (
       <form name="form" onSubmit={this.handleSubmit}>
         <div className={'form-group'}>
-          <label htmlFor="comment">Comment</label>
-          <textarea className={"form-control" + (submitted && !request.comment ? ' is-invalid' : '')}
-                    name="comment" value={request.comment}
+          <label htmlFor="terms">Commercial terms</label>
+          <textarea className={"form-control" + (submitted && !request.terms ? ' is-invalid' : '')}
+                    name="terms" value={request.terms}
                     onChange={this.handleChange}/>
-          {submitted && !request.comment &&
-          <div className="text-danger form-text">Comment is required</div>
+          <small className="form-text text-muted">Only the two parties see the terms, the channel keeps their hash</small>
+          {submitted && !request.terms &&
+          <div className="text-danger form-text">Terms are required</div>
           }
         </div>
       </form>
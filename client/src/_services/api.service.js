@@ -32,14 +32,16 @@ export function query(channel, chaincode, fcn, args) {
   return sendRequest(url, requestOptions);
 }
 
-export function invoke(channel, chaincode, functionName, args) {
+// transientMap is passed to the chaincode outside of the arguments, which are recorded in the block
+export function invoke(channel, chaincode, functionName, args, transientMap) {
   const {org} = configService.get();
   const requestOptions = {
     method: 'POST',
     body: JSON.stringify({
       peers: [`${org}/peer0`],
       fcn: functionName,
-      args
+      args,
+      ...(transientMap && {transientMap})
     })
   };
 
@@ -45,23 +45,39 @@ function getAll() {
     });
 }
 
-function add(product, comment) {
+// _termsTransientMap puts the commercial terms in the transient map with a random salt of 16 bytes, hex-encoded.
+// The public message stays empty: every peer of the channel keeps it.
+function _termsTransientMap(terms) {
+  const salt = window.crypto.getRandomValues(new Uint8Array(16));
+  return {
+    terms,
+    salt: Array.from(salt, b => b.toString(16).padStart(2, '0')).join('')
+  };
+}
+
+// options are the optional arguments of sendRequest by name: po, line, certification, quantity
+function add(product, terms, options = {}) {
   const {org} = configService.get();
+  const keyed = Object.keys(options)
+    .filter(name => options[name] !== undefined && options[name] !== '')
+    .map(name => `${name}=${options[name]}`);
   return apiService.invoke(
     _selectChannelFromProduct(product),
     apiService.contracts.relationship,
     'sendRequest',
-    [product.key.name, org, product.value.owner, comment]
+    [product.key.name, org, product.value.owner, '', ...keyed],
+    _termsTransientMap(terms)
   );
 }
 
-function edit(request, comment) {
+function edit(request, terms) {
   const {org} = configService.get();
   return apiService.invoke(
     _selectChannelFromRequest(request),
     apiService.contracts.relationship,
     'editRequest',
-    [request.key.productKey, org, request.key.requestReceiver, comment]
+    [request.key.productKey, org, request.key.requestReceiver, ''],
+    _termsTransientMap(terms)
   );
 }
 
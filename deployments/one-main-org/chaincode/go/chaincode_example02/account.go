@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	accountIndex      = "Account"
+	accountObjectType = "account"
+	// tokenKey holds the configuration of the token, set by Init
+	tokenKey = "token"
+
+	maxAssetLength = 32
+)
+
+// errInsufficientFunds is returned by debit when the balance is lower than the amount
+var errInsufficientFunds = errors.New("insufficient funds")
+
+// Token is the configuration of the token: the organization allowed to mint and burn assets and the amount of each
+// asset in circulation. The sum of the balances of an asset equals its supply, so keeping the supply within int64
+// keeps every balance within int64 too. IssuerMSP is the MSP of the issuer organization: minting and burning are
+// authorized by the MSP of the transaction creator, which the peer has validated, not by names in its certificate.
+type Token struct {
+	Issuer    string           `json:"issuer"`
+	IssuerMSP string           `json:"issuerMsp"`
+	Supply    map[string]int64 `json:"supply"`
+}
+
+// AccountKey identifies the account of a user: the organization that issued the certificate and its common name
+type AccountKey struct {
+	Org  string `json:"org"`
+	Name string `json:"name"`
+}
+
+// AccountValue holds the available balances of the account by asset and the amounts reserved by its holds.
+// Assets with a zero amount are left out.
+type AccountValue struct {
+	ObjectType string           `json:"docType"`
+	Balances   map[string]int64 `json:"balances"`
+	Held       map[string]int64 `json:"held"`
+}
+
+type Account struct {
+	Key   AccountKey   `json:"key"`
+	Value AccountValue `json:"value"`
+}
+
+// isValidKeyPart rejects what CreateCompositeKey cannot take as an attribute: invalid UTF-8, U+0000 and U+10FFFF
+func isValidKeyPart(part string) bool {
+	return utf8.ValidString(part) && !strings.ContainsRune(part, 0) && !strings.ContainsRune(part, utf8.MaxRune)
+}
+
+func (account *Account) FillFromKeyParts(org, name string) error {
+	for k, v := range []string{org, name} {
+		if len(v) == 0 {
+			return errors.New(fmt.Sprintf("key part #%d must be a non-empty string", k+1))
+		}
+		if !isValidKeyPart(v) {
+			return errors.New(fmt.Sprintf("key part #%d must be a valid UTF-8 string without U+0000 and U+10FFFF",
+				k+1))
+		}
+	}
+
+	account.Key.Org = org
+	account.Key.Name = name
+
+	return nil
+}
+
+func (account *Account) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey(accountIndex, []string{account.Key.Org, account.Key.Name})
+}
+
+func (account *Account) ExistsIn(stub shim.ChaincodeStubInterface) (bool, error) {
+	compositeKey, err := account.ToCompositeKey(stub)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := stub.GetState(compositeKey)
+	if err != nil {
+		return false, err
+	}
+
+	return data != nil, nil
+}
+
+// LoadFrom reads the account from the ledger. A missing account is not an error: it holds nothing.
+func (account *Account) LoadFrom(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := account.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	data, err := stub.GetState(compositeKey)
+	if err != nil {
+		return err
+	}
+
+	return account.FillFromLedgerValue(data)
+}
+
+func (account *Account) FillFromLedgerValue(data []byte) error {
+	account.Value = AccountValue{ObjectType: accountObjectType}
+	if data != nil {
+		if err := json.Unmarshal(data, &account.Value); err != nil {
+			return err
+		}
+	}
+
+	if account.Value.Balances == nil {
+		account.Value.Balances = map[string]int64{}
+	}
+	if account.Value.Held == nil {
+		account.Value.Held = map[string]int64{}
+	}
+
+	return nil
+}
+
+func (account *Account) UpdateOrInsertIn(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := account.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	account.Value.ObjectType = accountObjectType
+	value, err := json.Marshal(account.Value)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(compositeKey, value)
+}
+
+// credit adds the amount of the asset to the balance, failing instead of wrapping around on overflow
+func (account *Account) credit(asset string, amount int64) error {
+	balance, err := addAmounts(account.Value.Balances[asset], amount)
+	if err != nil {
+		return errors.New(fmt.Sprintf("balance of %s of account %s of %s would overflow", asset, account.Key.Name,
+			account.Key.Org))
+	}
+
+	account.Value.Balances[asset] = balance
+	return nil
+}
+
+// debit subtracts the amount of the asset from the balance, which may not become negative
+func (account *Account) debit(asset string, amount int64) error {
+	balance := account.Value.Balances[asset]
+	if balance < amount {
+		return errInsufficientFunds
+	}
+
+	if balance == amount {
+		delete(account.Value.Balances, asset)
+	} else {
+		account.Value.Balances[asset] = balance - amount
+	}
+	return nil
+}
+
+// reserve moves the amount of the asset from the available balance to the held one
+func (account *Account) reserve(asset string, amount int64) error {
+	if err := account.debit(asset, amount); err != nil {
+		return err
+	}
+
+	// the held and the available amounts together never exceed the supply, so this doesn't overflow
+	account.Value.Held[asset] += amount
+	return nil
+}
+
+// release moves the amount of the asset reserved by a hold back to the available balance
+func (account *Account) release(asset string, amount int64) error {
+	if err := account.spendHeld(asset, amount); err != nil {
+		return err
+	}
+
+	return account.credit(asset, amount)
+}
+
+// spendHeld takes the amount of the asset reserved by a hold out of the account
+func (account *Account) spendHeld(asset string, amount int64) error {
+	held := account.Value.Held[asset]
+	if held < amount {
+		return errors.New(fmt.Sprintf("account %s of %s holds %d %s, less than %d", account.Key.Name,
+			account.Key.Org, held, asset, amount))
+	}
+
+	if held == amount {
+		delete(account.Value.Held, asset)
+	} else {
+		account.Value.Held[asset] = held - amount
+	}
+	return nil
+}
+
+// addAmounts returns a+b of two non-negative amounts or an error if it doesn't fit into int64
+func addAmounts(a, b int64) (int64, error) {
+	if a > math.MaxInt64-b {
+		return 0, errors.New("amount overflow")
+	}
+
+	return a + b, nil
+}
+
+// parseAsset reads the name of an asset or currency, e.g. USD: up to 32 letters, digits, '.', '-' and '_'
+func parseAsset(s string) (string, error) {
+	if len(s) == 0 || len(s) > maxAssetLength || strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_')
+	}) >= 0 {
+		return "", errors.New(fmt.Sprintf("asset is invalid: %q (must be 1 to %d letters, digits, '.', '-', '_')",
+			s, maxAssetLength))
+	}
+
+	return s, nil
+}
+
+// parseAmount reads a positive integer amount
+func parseAmount(s string) (int64, error) {
+	amount, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, errors.New(fmt.Sprintf("amount is invalid: %s (must be positive int64)", s))
+	}
+
+	return amount, nil
+}
+
+func loadToken(stub shim.ChaincodeStubInterface) (Token, error) {
+	var token Token
+
+	data, err := stub.GetState(tokenKey)
+	if err != nil {
+		return token, err
+	}
+	if data == nil {
+		return token, errors.New("token is not initialized: instantiate the chaincode with the issuer organization")
+	}
+
+	if err := json.Unmarshal(data, &token); err != nil {
+		return token, err
+	}
+	if token.Supply == nil {
+		token.Supply = map[string]int64{}
+	}
+
+	return token, nil
+}
+
+func saveToken(stub shim.ChaincodeStubInterface, token Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(tokenKey, data)
+}
@@ -89,6 +89,14 @@ module.exports = function (require) {
 
     //
     const args = [transferDetails.product_key, transferDetails.old_owner, transferDetails.new_owner, Date.now() + ''];
+    if(transferDetails.quantity) {
+      // partial transfer of a lot: the reference chaincode splits it, only for the old owner
+      if(transferDetails.old_owner !== ORG) {
+        logger.debug(`partial transfer is relayed by ${transferDetails.old_owner}`, json);
+        return Promise.resolve();
+      }
+      args.push(transferDetails.quantity + '');
+    }
     return invoke.invokeChaincode([endorsePeerHost], channel, 'reference', 'updateOwner', args, USERNAME, ORG)
       .then(function(/*transactionId*/) {
         logger.info('Update product owner success', transferDetails);
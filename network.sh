@@ -44,6 +44,23 @@ CHAINCODE_COMMON_NAME=reference
 CHAINCODE_BILATERAL_NAME=relationship
 CHAINCODE_COMMON_INIT='{"Args":["init","a","100","b","100"]}'
 CHAINCODE_BILATERAL_INIT='{"Args":["init","a","100","b","100"]}'
+# set to instantiate the bilateral chaincode with the private data collection of commercial terms; the channels need
+# the V1_1_PVTDATA_EXPERIMENTAL application capability
+: ${PRIVATE_DATA:=""}
+# set to the organizations with the auditor role of the common chaincode, space separated, e.g. AUDITORS="lab gov"
+: ${AUDITORS:=""}
+# set to the organizations with the admin role of the common chaincode, the ones that may reindex products
+: ${ADMINS:=""}
+ROLES_INIT=""
+if [ -n "$AUDITORS" ]; then
+  ROLES_INIT=$ROLES_INIT',"auditors"'$(printf ',"%s"' $AUDITORS)
+fi
+if [ -n "$ADMINS" ]; then
+  ROLES_INIT=$ROLES_INIT',"admins"'$(printf ',"%s"' $ADMINS)
+fi
+if [ -n "$ROLES_INIT" ]; then
+  CHAINCODE_COMMON_INIT='{"Args":["init"'$ROLES_INIT']}'
+fi
 
 DEFAULT_ORDERER_PORT=7050
 DEFAULT_WWW_PORT=8080
@@ -448,6 +465,17 @@ function joinChannel() {
     docker-compose --file ${f} run --rm "cli.$org.$DOMAIN" bash -c "CORE_PEER_ADDRESS=peer1.$org.$DOMAIN:7051 peer channel join -b $channel_name.block"
 }
 
+# the two members of a bilateral channel named ORG1-ORG2 share its private data collections
+function generateCollectionsConfig () {
+    local channel_orgs=(${1//-/ })
+    # instantiateChaincode keeps the docker-compose file in f, so this one gets its own name
+    local collections_file="$GENERATED_ARTIFACTS_FOLDER/collections-config-$1.json"
+
+    info "generating private data collections of $1 to $collections_file"
+
+    sed -e "s/ORG1/${channel_orgs[0]}/g" -e "s/ORG2/${channel_orgs[1]}/g" $TEMPLATES_ARTIFACTS_FOLDER/collections-config-template.json > ${collections_file}
+}
+
 function instantiateChaincode () {
     org=$1
     channel_names=($2)
@@ -461,6 +489,11 @@ function instantiateChaincode () {
         c="CORE_PEER_ADDRESS=peer0.$org.$DOMAIN:7051 peer chaincode instantiate -n $n -v ${CHAINCODE_VERSION} -c '$i' -o orderer.$DOMAIN:7050 -C $channel_name --tls --cafile /etc/hyperledger/crypto/orderer/tls/ca.crt"
         d="cli.$org.$DOMAIN"
 
+        if [[ -n "$PRIVATE_DATA" && "$n" == "$CHAINCODE_BILATERAL_NAME" ]]; then
+            generateCollectionsConfig ${channel_name}
+            c="$c --collections-config collections-config-$channel_name.json"
+        fi
+
         echo "instantiating with $d by $c"
         docker-compose --file ${f} run --rm ${d} bash -c "${c}"
     done
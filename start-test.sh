@@ -34,7 +34,7 @@ read -n1 -r -p "On node 'b' join to channel 'a-b' then on node 'c' generate org
 echo -e $separateLine
 echo "Now chaincode 'chaincode_example02' will be installed and instantiated "
 ./network.sh -m install-chaincode -o a -v 1.0 -n chaincode_example02
-./network.sh -m instantiate-chaincode -o a -k a-b -n chaincode_example02
+./network.sh -m instantiate-chaincode -o a -k a-b -n chaincode_example02 -I '{"Args":["init","a"]}'
 
 echo -e $separateLine
 read -n1 -r -p "Press any key to create channel a-c and a-b-c"